@@ -0,0 +1,86 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements the handling of tokens whose roles and permissions are outdated.
+package auth
+
+import (
+	"log"
+	"os"
+	"strings"
+	"github.com/google/uuid"
+	resourceService "nfcunha/aegis/domain/resource"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+// Modes for access tokens stamped with an outdated authorization version ("authz_ver" claim).
+const (
+	AUTHZ_MODE_REJECT = "reject" // Reject the token as stale; the client must refresh it
+	AUTHZ_MODE_LIVE   = "live"   // Accept the token and replace its grants with the user's current ones
+	AUTHZ_MODE_CLAIMS = "claims" // Trust the grants embedded in the token until it expires
+)
+
+var AUTHZ_STALE_MODE = getAuthzStaleMode()
+
+// checkAuthzVersion applies AUTHZ_STALE_MODE to an access token whose authorization version
+// differs from the user's current one. In live mode the claims are updated in place, so
+// validation, introspection and bearer-authenticated endpoints all see the current grants.
+// Refresh tokens are not checked; refreshing always issues tokens with the current grants.
+// Exchanged tokens (with an "act" claim) are never widened to the user's live grants, so in
+// live mode they are rejected as stale instead. Live grants are narrowed like at issuance: to the
+// token's scope for down-scoped tokens, and to the relevant permissions for a resource server.
+//
+// Parameters:
+//   - claims: The verified token claims
+//   - currentVersion: The user's current authorization version
+//
+// Returns:
+//   - ErrTokenStale if the token is outdated and the mode is "reject", nil otherwise
+func checkAuthzVersion(claims *jwt.TokenClaims, currentVersion int) error {
+	if claims.TokenType == "refresh" || claims.AuthzVersion == currentVersion {
+		return nil
+	}
+
+	switch AUTHZ_STALE_MODE {
+	case AUTHZ_MODE_REJECT:
+		return ErrTokenStale
+	case AUTHZ_MODE_LIVE:
+		if claims.Actor != nil {
+			return ErrTokenStale
+		}
+		userId, err := uuid.Parse(claims.UserId)
+		if err != nil {
+			return ErrTokenStale
+		}
+		user := userService.GetUserById(userId)
+		if user == nil {
+			return ErrTokenRevoked
+		}
+		roles, permissions := user.Grants(strings.Fields(claims.Scope))
+		claims.Roles = roles
+		claims.Permissions = resourceService.RestrictPermissions(claims.Audience, permissions)
+		claims.AuthzVersion = user.AuthzVersion
+		log.Printf("Replaced outdated grants of token %s with live grants of user %s", claims.ID, user.Subject)
+	}
+	return nil
+}
+
+// getAuthzStaleMode retrieves how tokens with outdated grants are handled from the
+// AEGIS_AUTHZ_STALE_MODE environment variable: "reject", "live" or "claims".
+// Defaults to "claims", since the version also changes when grants are added; tokens losing
+// grants are marked stale by the token revocation policy instead.
+//
+// Returns:
+//   - The configured mode
+func getAuthzStaleMode() string {
+	const AUTHZ_STALE_MODE_ENV = "AEGIS_AUTHZ_STALE_MODE"
+	mode := os.Getenv(AUTHZ_STALE_MODE_ENV)
+	switch mode {
+	case "":
+		return AUTHZ_MODE_CLAIMS
+	case AUTHZ_MODE_REJECT, AUTHZ_MODE_LIVE, AUTHZ_MODE_CLAIMS:
+		log.Printf("Using authorization stale mode: %s", mode)
+		return mode
+	}
+	log.Printf("Warning: invalid %s value '%s', using '%s'", AUTHZ_STALE_MODE_ENV, mode, AUTHZ_MODE_CLAIMS)
+	return AUTHZ_MODE_CLAIMS
+}
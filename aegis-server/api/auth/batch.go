@@ -0,0 +1,160 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements batch token validation for API gateways.
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"github.com/gin-gonic/gin"
+)
+
+var VALIDATE_BATCH_MAX_TOKENS = getValidateBatchMaxTokens()
+var VALIDATE_BATCH_WORKERS = getValidateBatchWorkers()
+
+// BatchValidateTokenRequest represents the request body for the batch validation endpoint.
+// Each entry is validated like a request to the single token validation endpoint.
+type BatchValidateTokenRequest struct {
+	Tokens []ValidateTokenRequest `json:"tokens" binding:"required,min=1,dive"`
+}
+
+// BatchValidateTokenResponse represents the response of the batch validation endpoint.
+// Results are in the order of the requested tokens.
+type BatchValidateTokenResponse struct {
+	Results []ValidateTokenResponse `json:"results"`
+}
+
+// ValidateTokenBatch is an HTTP handler that validates several tokens in one request, so that
+// gateways can check the tokens of many pending requests in a single round trip.
+// Tokens are validated concurrently by at most VALIDATE_BATCH_WORKERS workers, and each
+// token ID is looked up in the blacklist once per batch.
+//
+// Endpoint: POST /aegis/api/auth/validate/batch
+//
+// Request Body:
+//   - tokens: Up to VALIDATE_BATCH_MAX_TOKENS validation requests, each with the fields
+//     accepted by POST /aegis/api/auth/validate (required)
+//
+// Response (200 OK):
+//   - results: One validation result per token, in request order
+//
+// Response (400 Bad Request):
+//   - The request body is invalid, empty, or has too many tokens
+func ValidateTokenBatch(c *gin.Context) {
+	log.Println("POST /aegis/api/auth/validate/batch - Batch token validation request received")
+
+	var req BatchValidateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Tokens) > VALIDATE_BATCH_MAX_TOKENS {
+		log.Printf("Batch of %d tokens exceeds the limit of %d", len(req.Tokens), VALIDATE_BATCH_MAX_TOKENS)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d tokens can be validated at once", VALIDATE_BATCH_MAX_TOKENS)})
+		return
+	}
+
+	c.JSON(http.StatusOK, BatchValidateTokenResponse{Results: validateTokens(req.Tokens)})
+}
+
+// validateTokens validates tokens with a bounded pool of workers that share blacklist lookups.
+//
+// Parameters:
+//   - requests: The validation requests
+//
+// Returns:
+//   - The validation results, in the order of the requests
+func validateTokens(requests []ValidateTokenRequest) []ValidateTokenResponse {
+	results := make([]ValidateTokenResponse, len(requests))
+	lookups := newBlacklistLookups()
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(VALIDATE_BATCH_WORKERS, len(requests)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = validateToken(requests[i], lookups.IsBlacklisted)
+			}
+		}()
+	}
+	for i := range requests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// blacklistLookups memoizes blacklist lookups for the duration of a batch. Each token ID is
+// looked up once, even when several workers verify tokens with the same ID at the same time.
+type blacklistLookups struct {
+	mu      sync.Mutex
+	results map[string]*blacklistLookup
+}
+
+// blacklistLookup holds the result of looking up one token ID.
+type blacklistLookup struct {
+	once    sync.Once
+	revoked bool
+}
+
+func newBlacklistLookups() *blacklistLookups {
+	return &blacklistLookups{results: make(map[string]*blacklistLookup)}
+}
+
+// IsBlacklisted reports whether a token ID is on the global blacklist, looking it up on first use.
+func (l *blacklistLookups) IsBlacklisted(jti string) bool {
+	l.mu.Lock()
+	lookup, exists := l.results[jti]
+	if !exists {
+		lookup = &blacklistLookup{}
+		l.results[jti] = lookup
+	}
+	l.mu.Unlock()
+
+	lookup.once.Do(func() {
+		lookup.revoked = isBlacklisted(jti)
+	})
+	return lookup.revoked
+}
+
+// getValidateBatchMaxTokens retrieves the maximum number of tokens per batch validation request
+// from the AEGIS_VALIDATE_BATCH_MAX_TOKENS environment variable. Defaults to 100.
+//
+// Returns:
+//   - Maximum number of tokens
+func getValidateBatchMaxTokens() int {
+	const VALIDATE_BATCH_MAX_TOKENS_ENV = "AEGIS_VALIDATE_BATCH_MAX_TOKENS"
+	const DEFAULT_VALIDATE_BATCH_MAX_TOKENS = 100
+	if maxStr := os.Getenv(VALIDATE_BATCH_MAX_TOKENS_ENV); maxStr != "" {
+		if limit, err := strconv.Atoi(maxStr); err == nil && limit > 0 {
+			return limit
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d tokens", VALIDATE_BATCH_MAX_TOKENS_ENV, maxStr, DEFAULT_VALIDATE_BATCH_MAX_TOKENS)
+	}
+	return DEFAULT_VALIDATE_BATCH_MAX_TOKENS
+}
+
+// getValidateBatchWorkers retrieves the number of workers validating the tokens of a batch
+// concurrently from the AEGIS_VALIDATE_BATCH_WORKERS environment variable. Defaults to 8.
+//
+// Returns:
+//   - Number of workers per batch
+func getValidateBatchWorkers() int {
+	const VALIDATE_BATCH_WORKERS_ENV = "AEGIS_VALIDATE_BATCH_WORKERS"
+	const DEFAULT_VALIDATE_BATCH_WORKERS = 8
+	if workersStr := os.Getenv(VALIDATE_BATCH_WORKERS_ENV); workersStr != "" {
+		if workers, err := strconv.Atoi(workersStr); err == nil && workers > 0 {
+			return workers
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d workers", VALIDATE_BATCH_WORKERS_ENV, workersStr, DEFAULT_VALIDATE_BATCH_WORKERS)
+	}
+	return DEFAULT_VALIDATE_BATCH_WORKERS
+}
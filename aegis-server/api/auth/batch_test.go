@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/domain/token"
+	jwtUtil "nfcunha/aegis/util/jwt"
+)
+
+// countingBlacklist counts the lookups made against a blacklist
+type countingBlacklist struct {
+	token.Blacklist
+	lookups atomic.Int32
+}
+
+func (b *countingBlacklist) IsBlacklisted(jti string) bool {
+	b.lookups.Add(1)
+	return b.Blacklist.IsBlacklisted(jti)
+}
+
+// validateBatch sends a batch validation request
+func validateBatch(router *gin.Engine, tokens []ValidateTokenRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(BatchValidateTokenRequest{Tokens: tokens})
+	req, _ := http.NewRequest("POST", "/aegis/api/auth/validate/batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestValidateTokenBatch tests that each token gets its own result, in request order
+func TestValidateTokenBatch(t *testing.T) {
+	bl := &countingBlacklist{Blacklist: token.NewMemoryBlacklist()}
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	router := setupRouter()
+	valid, _ := jwtUtil.GenerateTokenPair(uuid.New(), "batch@example.com", []string{"admin"}, []string{})
+	revoked, _ := jwtUtil.GenerateTokenPair(uuid.New(), "batch-revoked@example.com", []string{}, []string{})
+	bl.Add(revoked.AccessTokenId, time.Now().Add(time.Hour))
+	billing, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "batch@example.com", []string{}, []string{}, jwtUtil.TokenOptions{Audience: []string{"billing"}})
+
+	w := validateBatch(router, []ValidateTokenRequest{
+		{Token: valid.AccessToken},
+		{Token: revoked.AccessToken},
+		{Token: "not.a.token"},
+		{Token: billing.AccessToken, Audience: "orders"},
+		{Token: valid.AccessToken},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response BatchValidateTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(response.Results))
+	}
+	expected := []string{"", "token revoked", "malformed token", "invalid audience", ""}
+	for i, result := range response.Results {
+		if result.Valid != (expected[i] == "") || result.Error != expected[i] {
+			t.Errorf("Result %d: expected error '%s', got %+v", i, expected[i], result)
+		}
+	}
+	if response.Results[0].User == nil || response.Results[0].User.Subject != "batch@example.com" || response.Results[0].ExpiresAt == nil {
+		t.Errorf("Expected user claims for the valid token, got %+v", response.Results[0])
+	}
+
+	// The valid token was sent twice but looked up once, as were the revoked and billing tokens
+	if lookups := bl.lookups.Load(); lookups != 3 {
+		t.Errorf("Expected 3 blacklist lookups, got %d", lookups)
+	}
+}
+
+// TestValidateTokenBatch_Limits tests that empty and oversized batches are rejected
+func TestValidateTokenBatch_Limits(t *testing.T) {
+	originalMax := VALIDATE_BATCH_MAX_TOKENS
+	VALIDATE_BATCH_MAX_TOKENS = 2
+	defer func() { VALIDATE_BATCH_MAX_TOKENS = originalMax }()
+
+	router := setupRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "batch@example.com", []string{}, []string{})
+	request := ValidateTokenRequest{Token: tokenPair.AccessToken}
+
+	if w := validateBatch(router, []ValidateTokenRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an empty batch, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := validateBatch(router, []ValidateTokenRequest{{}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a missing token, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := validateBatch(router, []ValidateTokenRequest{request, request, request}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for too many tokens, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := validateBatch(router, []ValidateTokenRequest{request, request}); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d at the limit, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// TestValidateTokens_Workers tests that results keep their order with a single worker and with more workers than tokens
+func TestValidateTokens_Workers(t *testing.T) {
+	originalWorkers := VALIDATE_BATCH_WORKERS
+	defer func() { VALIDATE_BATCH_WORKERS = originalWorkers }()
+
+	requests := []ValidateTokenRequest{}
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "batch@example.com", []string{}, []string{})
+			requests = append(requests, ValidateTokenRequest{Token: tokenPair.AccessToken})
+		} else {
+			requests = append(requests, ValidateTokenRequest{Token: "invalid"})
+		}
+	}
+
+	for _, workers := range []int{1, 4, 50} {
+		VALIDATE_BATCH_WORKERS = workers
+		results := validateTokens(requests)
+		for i, result := range results {
+			if result.Valid != (i%2 == 0) {
+				t.Errorf("Workers %d, result %d: expected valid=%v, got %+v", workers, i, i%2 == 0, result)
+			}
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements shared token verification and bearer token authentication.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	referenceService "nfcunha/aegis/domain/reference"
+	sessionService "nfcunha/aegis/domain/session"
+	"nfcunha/aegis/domain/token"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+// CLAIMS_CONTEXT_KEY is the Gin context key under which RequireBearerToken stores the verified claims.
+const CLAIMS_CONTEXT_KEY = "aegis.claims"
+
+// ErrTokenRevoked is returned by VerifyToken when the token is on the blacklist, was issued
+// before its user's tokens were revoked or in a revoked session, or its user was deleted.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// ErrTokenStale is returned by VerifyToken when an access token was issued before a change
+// to its user's account. The client should obtain a new one with its refresh token.
+var ErrTokenStale = errors.New("token stale")
+
+// ErrInvalidAudience is returned by VerifyTokenForAudience when the token was not issued for the expected audience.
+var ErrInvalidAudience = errors.New("invalid audience")
+
+// VerifyToken validates a token's signature and expiration and checks that it has not been revoked,
+// either individually through the blacklist, together with all tokens of its user or together
+// with all tokens of its login session, and that its claims are not stale. Opaque reference tokens are first resolved to the signed token
+// they stand for.
+// All endpoints that accept Aegis tokens should verify them through this function.
+//
+// Parameters:
+//   - tokenString: The JWT or reference token string to verify
+//
+// Returns:
+//   - TokenClaims extracted from the token
+//   - Error if the token is invalid, expired, revoked (ErrTokenRevoked) or stale (ErrTokenStale)
+func VerifyToken(tokenString string) (*jwt.TokenClaims, error) {
+	return verifyToken(tokenString, isBlacklisted)
+}
+
+// verifyToken verifies a token like VerifyToken, looking its JTI up with the given function.
+func verifyToken(tokenString string, isBlacklisted func(jti string) bool) (*jwt.TokenClaims, error) {
+	if referenceService.IsReferenceToken(tokenString) {
+		resolved, err := referenceService.Resolve(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		tokenString = resolved
+	}
+
+	claims, err := jwt.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBlacklisted(claims.ID) {
+		log.Printf("Token is blacklisted (revoked): JTI=%s, User=%s", claims.ID, claims.Subject)
+		return nil, ErrTokenRevoked
+	}
+
+	if err := checkUserCutoffs(claims); err != nil {
+		log.Printf("Token rejected by user cutoffs (%v): JTI=%s, User=%s", err, claims.ID, claims.Subject)
+		return nil, err
+	}
+
+	if err := checkSession(claims); err != nil {
+		log.Printf("Token rejected by its session (%v): JTI=%s, SID=%s", err, claims.ID, claims.SessionId)
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// VerifyTokenForAudience verifies a token like VerifyToken and, when an audience is expected,
+// checks that it is one of the token's audiences. Tokens without an audience never match.
+//
+// Parameters:
+//   - tokenString: The JWT token string to verify
+//   - audience: The expected audience, empty to skip the check
+//
+// Returns:
+//   - TokenClaims extracted from the token
+//   - Error as for VerifyToken, or ErrInvalidAudience if the audience does not match
+func VerifyTokenForAudience(tokenString string, audience string) (*jwt.TokenClaims, error) {
+	return verifyTokenForAudience(tokenString, audience, isBlacklisted)
+}
+
+// verifyTokenForAudience verifies a token like VerifyTokenForAudience, looking its JTI up with the given function.
+func verifyTokenForAudience(tokenString string, audience string, isBlacklisted func(jti string) bool) (*jwt.TokenClaims, error) {
+	claims, err := verifyToken(tokenString, isBlacklisted)
+	if err != nil {
+		return nil, err
+	}
+	if audience != "" && !slices.Contains(claims.Audience, audience) {
+		log.Printf("Token audience mismatch: expected=%s, aud=%v, JTI=%s", audience, claims.Audience, claims.ID)
+		return nil, ErrInvalidAudience
+	}
+	return claims, nil
+}
+
+// isBlacklisted reports whether a token ID is on the global blacklist, if one is configured.
+func isBlacklisted(jti string) bool {
+	return token.GlobalBlacklist != nil && token.GlobalBlacklist.IsBlacklisted(jti)
+}
+
+// RequireBearerToken returns middleware that authenticates requests with an access token
+// in the Authorization header (RFC 6750). DPoP-bound tokens must be sent with the "DPoP"
+// scheme and a DPoP proof header (RFC 9449 section 7), and certificate-bound tokens must be
+// sent over a connection with the bound TLS client certificate (RFC 8705). On success the verified claims are
+// stored in the context and can be retrieved with GetClaims; otherwise the request is aborted with 401.
+//
+// Returns:
+//   - Gin middleware handler
+func RequireBearerToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, description := authenticateBearer(c, c.GetHeader("Authorization"), c.Request.Method, RequestUrl(c))
+		if claims == nil {
+			abortUnauthorized(c, description)
+			return
+		}
+
+		c.Set(CLAIMS_CONTEXT_KEY, claims)
+		c.Next()
+	}
+}
+
+// authenticateBearer verifies the access token of an Authorization header value for a request
+// made with the given method and URL, including its DPoP or certificate binding.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - header: The Authorization header value
+//   - method: The HTTP method of the request, checked against DPoP proofs
+//   - requestUrl: The URL of the request, checked against DPoP proofs
+//
+// Returns:
+//   - The verified TokenClaims, or nil if authentication failed
+//   - The error description to answer with if authentication failed
+func authenticateBearer(c *gin.Context, header string, method string, requestUrl string) (*jwt.TokenClaims, string) {
+	tokenString := ExtractBearerToken(header)
+	dpopScheme := tokenString == ""
+	if dpopScheme {
+		tokenString = extractToken(header, "DPoP")
+	}
+	if tokenString == "" {
+		return nil, "missing bearer token"
+	}
+
+	claims, err := VerifyToken(tokenString)
+	if err != nil {
+		log.Printf("Bearer authentication failed: %v", err)
+		return nil, determineValidationError(err)
+	}
+
+	if claims.TokenType != "access" {
+		return nil, "access token required"
+	}
+
+	if bound := claims.Confirmation != nil && claims.Confirmation.JKT != ""; bound != dpopScheme {
+		log.Printf("Bearer authentication failed: authorization scheme does not match the token binding, JTI=%s", claims.ID)
+		return nil, "invalid DPoP proof"
+	}
+	if err := VerifyDPoPBinding(claims, tokenString, c.GetHeader(DPOP_HEADER), method, requestUrl); err != nil {
+		log.Printf("Bearer authentication failed: %v", err)
+		return nil, "invalid DPoP proof"
+	}
+	if err := VerifyCertificateBinding(claims, ClientCertificateThumbprint(c)); err != nil {
+		log.Printf("Bearer authentication failed: %v", err)
+		return nil, "invalid client certificate"
+	}
+
+	return claims, ""
+}
+
+// RequireRole returns middleware that only lets through requests whose bearer token carries the role.
+// Must be registered after RequireBearerToken. Tokens acting on behalf of their subject
+// (impersonation and exchanged tokens, with an "act" claim) are refused, so an impersonated
+// administrator cannot be used for administrative actions. Rejected requests are aborted with 403.
+//
+// Parameters:
+//   - role: The required role
+//
+// Returns:
+//   - Gin middleware handler
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetClaims(c)
+		if claims == nil || claims.Actor != nil || !slices.Contains(claims.Roles, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient privileges"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetClaims returns the claims stored by RequireBearerToken, or nil if the request was not authenticated.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - The verified TokenClaims, or nil
+func GetClaims(c *gin.Context) *jwt.TokenClaims {
+	value, exists := c.Get(CLAIMS_CONTEXT_KEY)
+	if !exists {
+		return nil
+	}
+	claims, _ := value.(*jwt.TokenClaims)
+	return claims
+}
+
+// ExtractBearerToken extracts the token from an "Authorization: Bearer <token>" header value.
+// The scheme is matched case-insensitively.
+//
+// Parameters:
+//   - header: The Authorization header value
+//
+// Returns:
+//   - The token, or an empty string if the header does not carry a bearer token
+func ExtractBearerToken(header string) string {
+	return extractToken(header, "Bearer")
+}
+
+// extractToken extracts the token from an Authorization header value using the given scheme,
+// matched case-insensitively. Returns an empty string for other schemes.
+func extractToken(header string, scheme string) string {
+	headerScheme, tokenString, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(headerScheme, scheme) {
+		return ""
+	}
+	return strings.TrimSpace(tokenString)
+}
+
+// checkUserCutoffs rejects tokens issued before their user's tokens were revoked or marked
+// as stale, and tokens of deleted users unless the deletion policy is "none".
+// Tokens with an outdated authorization version are handled by checkAuthzVersion.
+// Refresh tokens are never stale. Tokens without a user (client credentials) have no cutoffs.
+// Tokens whose cutoffs cannot be looked up are rejected, so that revoked tokens are not
+// accepted again while the database is unavailable.
+func checkUserCutoffs(claims *jwt.TokenClaims) error {
+	if claims.UserId == "" || claims.IssuedAt == nil {
+		return nil
+	}
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		return fmt.Errorf("%w: invalid user ID", ErrTokenRevoked)
+	}
+
+	cutoffs, err := userService.GetTokenCutoffs(userId)
+	if err != nil {
+		return fmt.Errorf("%w: token cutoffs lookup failed: %v", ErrTokenRevoked, err)
+	}
+	if cutoffs == nil {
+		if userService.TokenPolicyFor(userService.EVENT_USER_DELETED) == userService.TOKEN_POLICY_NONE {
+			return nil
+		}
+		return ErrTokenRevoked
+	}
+
+	issuedAt := claims.IssuedAtTime()
+	if cutoffs.IsRevoked(issuedAt) {
+		return ErrTokenRevoked
+	}
+	if claims.TokenType != "refresh" && cutoffs.IsStale(issuedAt) {
+		return ErrTokenStale
+	}
+	return checkAuthzVersion(claims, cutoffs.AuthzVersion)
+}
+
+// checkSession rejects tokens issued in a login session that was revoked, including tokens
+// derived from the session's tokens that its revocation did not blacklist, such as exchanged
+// tokens. Tokens without a "sid" claim, and tokens whose session has ended and been deleted,
+// pass. Tokens whose session cannot be looked up are rejected, like in checkUserCutoffs.
+func checkSession(claims *jwt.TokenClaims) error {
+	if claims.SessionId == "" {
+		return nil
+	}
+	session, err := sessionService.LookupSession(claims.SessionId)
+	if err != nil {
+		return fmt.Errorf("%w: session lookup failed: %v", ErrTokenRevoked, err)
+	}
+	if session != nil && session.RevokedAt != nil {
+		return fmt.Errorf("%w: session revoked", ErrTokenRevoked)
+	}
+	return nil
+}
+
+// abortUnauthorized aborts the request with 401 and an RFC 6750 WWW-Authenticate challenge.
+func abortUnauthorized(c *gin.Context, description string) {
+	c.Header("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+description+`"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": description})
+}
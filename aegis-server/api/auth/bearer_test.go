@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	sessionService "nfcunha/aegis/domain/session"
+	"nfcunha/aegis/domain/token"
+	jwtUtil "nfcunha/aegis/util/jwt"
+)
+
+// setupProtectedRouter creates a test router with a single route behind RequireBearerToken
+func setupProtectedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/protected", RequireBearerToken(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"subject": GetClaims(c).Subject})
+	})
+	return router
+}
+
+// TestRequireBearerToken_ValidToken tests that a valid access token passes and exposes its claims
+func TestRequireBearerToken_ValidToken(t *testing.T) {
+	router := setupProtectedRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "bearer@example.com", []string{}, []string{})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "bearer@example.com") {
+		t.Errorf("Expected claims in context, got %s", w.Body.String())
+	}
+}
+
+// TestRequireBearerToken_MissingToken tests that requests without a token get a 401 challenge
+func TestRequireBearerToken_MissingToken(t *testing.T) {
+	router := setupProtectedRouter()
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+		t.Errorf("Expected Bearer challenge, got %q", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+// TestRequireBearerToken_RefreshToken tests that refresh tokens are not accepted as bearer tokens
+func TestRequireBearerToken_RefreshToken(t *testing.T) {
+	router := setupProtectedRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "bearer@example.com", []string{}, []string{})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.RefreshToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRequireBearerToken_RevokedToken tests that blacklisted tokens are rejected
+func TestRequireBearerToken_RevokedToken(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	router := setupProtectedRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "bearer@example.com", []string{}, []string{})
+	claims, _ := jwtUtil.ValidateToken(tokenPair.AccessToken)
+	bl.Add(claims.ID, time.Now().Add(time.Hour))
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "token revoked") {
+		t.Errorf("Expected revoked error, got %s", w.Body.String())
+	}
+}
+
+// TestVerifyToken_CutoffLookupFailure tests that user tokens are rejected when their cutoffs cannot be looked up
+func TestVerifyToken_CutoffLookupFailure(t *testing.T) {
+	userToken, _ := jwtUtil.GenerateTokenPair(uuid.New(), "bearer@example.com", []string{}, []string{})
+	clientToken, _ := jwtUtil.GenerateClientToken("bearer-client", []string{}, 0, nil, nil)
+
+	// Simulate a database outage
+	originalDBFile := database.DB_FILE
+	database.DB_FILE = filepath.Join(t.TempDir(), "missing", "aegis.db")
+	defer func() { database.DB_FILE = originalDBFile }()
+
+	if _, err := VerifyToken(userToken.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+
+	// Client tokens have no user and thus no cutoffs to look up
+	if _, err := VerifyToken(clientToken.Token); err != nil {
+		t.Errorf("Expected client token to remain valid, got %v", err)
+	}
+}
+
+// TestCheckSession tests that tokens of revoked sessions are rejected, as are tokens whose session cannot be looked up
+func TestCheckSession(t *testing.T) {
+	active := sessionService.CreateSession(uuid.New(), "", "", "127.0.0.1", "test")
+	revoked := sessionService.CreateSession(uuid.New(), "", "", "127.0.0.1", "test")
+	sessionService.SaveSession(active)
+	sessionService.SaveSession(revoked)
+	if err := sessionService.RevokeSession(revoked.Id, "test"); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		sessionId string
+		revoked   bool
+	}{
+		{"no session", "", false},
+		{"active session", active.Id, false},
+		{"ended session", uuid.New().String(), false},
+		{"revoked session", revoked.Id, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkSession(&jwtUtil.TokenClaims{SessionId: tc.sessionId})
+			if errors.Is(err, ErrTokenRevoked) != tc.revoked {
+				t.Errorf("Expected revoked=%v, got %v", tc.revoked, err)
+			}
+		})
+	}
+
+	// Simulate a database outage
+	originalDBFile := database.DB_FILE
+	database.DB_FILE = filepath.Join(t.TempDir(), "missing", "aegis.db")
+	defer func() { database.DB_FILE = originalDBFile }()
+
+	if err := checkSession(&jwtUtil.TokenClaims{SessionId: active.Id}); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
+
+// TestRequireRole tests that the role must be granted to the caller, not to someone acting for them
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/admin", RequireBearerToken(), RequireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	admin, _ := jwtUtil.GenerateTokenPair(uuid.New(), "admin@example.com", []string{"admin"}, []string{})
+	user, _ := jwtUtil.GenerateTokenPair(uuid.New(), "user@example.com", []string{"user"}, []string{})
+	acted, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "admin@example.com", []string{"admin"}, []string{},
+		jwtUtil.TokenOptions{Actor: &jwtUtil.Actor{Subject: "support@example.com"}})
+
+	cases := map[string]struct {
+		token    string
+		expected int
+	}{
+		"role granted": {admin.AccessToken, http.StatusOK},
+		"role missing": {user.AccessToken, http.StatusForbidden},
+		"acting for":   {acted.AccessToken, http.StatusForbidden},
+	}
+	for name, tc := range cases {
+		req, _ := http.NewRequest("GET", "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.expected {
+			t.Errorf("%s: expected status %d, got %d", name, tc.expected, w.Code)
+		}
+	}
+}
+
+// TestExtractBearerToken tests parsing of Authorization header values
+func TestExtractBearerToken(t *testing.T) {
+	cases := map[string]string{
+		"Bearer abc":  "abc",
+		"bearer abc":  "abc",
+		"Basic abc":   "",
+		"Bearer":      "",
+		"":            "",
+	}
+	for header, expected := range cases {
+		if got := ExtractBearerToken(header); got != expected {
+			t.Errorf("ExtractBearerToken(%q) = %q, expected %q", header, got, expected)
+		}
+	}
+}
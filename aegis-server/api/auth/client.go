@@ -0,0 +1,78 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements OAuth 2.0 client authentication (RFC 6749 section 2.3).
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"github.com/gin-gonic/gin"
+	clientService "nfcunha/aegis/domain/client"
+)
+
+// ErrMultipleClientAuth is returned when a request authenticates the client in more than one way.
+var ErrMultipleClientAuth = errors.New("multiple client authentication methods used")
+
+// AuthenticateClient authenticates the client making the request.
+// Supports client_secret_basic (HTTP Basic with the URL-encoded client ID and secret),
+// client_secret_post (client_id and client_secret form parameters), and public
+// clients sending only client_id.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - The authenticated Client
+//   - ErrMultipleClientAuth, or clientService.ErrInvalidClient if authentication fails
+func AuthenticateClient(c *gin.Context) (*clientService.Client, error) {
+	return AuthenticateClientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+}
+
+// AuthenticateClientCredentials authenticates the client making the request like
+// AuthenticateClient, with the client_id and client_secret already read from the request
+// body, e.g. from a JSON body.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - clientId: The client_id sent in the request body, may be empty
+//   - secret: The client_secret sent in the request body, may be empty
+//
+// Returns:
+//   - The authenticated Client
+//   - ErrMultipleClientAuth, or clientService.ErrInvalidClient if authentication fails
+func AuthenticateClientCredentials(c *gin.Context, clientId string, secret string) (*clientService.Client, error) {
+	if basicId, basicSecret, ok := c.Request.BasicAuth(); ok {
+		if secret != "" || (clientId != "" && clientId != basicId) {
+			return nil, ErrMultipleClientAuth
+		}
+		var err error
+		if clientId, err = url.QueryUnescape(basicId); err != nil {
+			return nil, clientService.ErrInvalidClient
+		}
+		if secret, err = url.QueryUnescape(basicSecret); err != nil {
+			return nil, clientService.ErrInvalidClient
+		}
+	}
+
+	if clientId == "" {
+		return nil, clientService.ErrInvalidClient
+	}
+	return clientService.Authenticate(clientId, secret)
+}
+
+// AbortInvalidClient aborts the request with 401 and an OAuth 2.0 invalid_client error.
+// A Basic challenge is included when the client attempted HTTP Basic authentication.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - err: The error returned by AuthenticateClient
+func AbortInvalidClient(c *gin.Context, err error) {
+	if errors.Is(err, ErrMultipleClientAuth) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	if _, _, ok := c.Request.BasicAuth(); ok {
+		c.Header("WWW-Authenticate", `Basic realm="aegis"`)
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client", "error_description": "client authentication failed"})
+}
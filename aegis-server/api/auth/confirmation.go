@@ -0,0 +1,69 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements the binding of issued tokens to the client's DPoP key or TLS certificate.
+package auth
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/util/jwt"
+)
+
+// GetConfirmation returns the "cnf" claim binding tokens issued for the current request to the
+// client's proof of possession: the key of the DPoP proof verified by AcceptDPoPProof and the
+// TLS client certificate, if any.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - The confirmation, or nil if the client presented neither a DPoP proof nor a certificate
+func GetConfirmation(c *gin.Context) *jwt.Confirmation {
+	confirmation := &jwt.Confirmation{JKT: dpopKey(c)}
+	if cert := ClientCertificate(c); cert != nil {
+		confirmation.X5tS256 = jwt.CertificateThumbprint(cert)
+	}
+	if confirmation.IsEmpty() {
+		return nil
+	}
+	return confirmation
+}
+
+// CheckConfirmation checks that a client presents the same DPoP key and certificate that a
+// token was bound to, e.g. when using a bound refresh token.
+//
+// Parameters:
+//   - bound: The "cnf" claim of the token, or nil for an unbound token
+//   - presented: The confirmation of the current request, from GetConfirmation
+//
+// Returns:
+//   - Error wrapping ErrInvalidDPoPProof or ErrInvalidCertificateBinding if a binding is not satisfied
+func CheckConfirmation(bound *jwt.Confirmation, presented *jwt.Confirmation) error {
+	if bound.IsEmpty() {
+		return nil
+	}
+	if presented == nil {
+		presented = &jwt.Confirmation{}
+	}
+	if bound.JKT != "" && bound.JKT != presented.JKT {
+		return fmt.Errorf("%w: missing or mismatched DPoP key", ErrInvalidDPoPProof)
+	}
+	if bound.X5tS256 != "" && bound.X5tS256 != presented.X5tS256 {
+		return fmt.Errorf("%w: missing or mismatched client certificate", ErrInvalidCertificateBinding)
+	}
+	return nil
+}
+
+// TokenTypeFor returns the token_type reported for an issued access token: "DPoP" for
+// DPoP-bound tokens and "Bearer" otherwise, including certificate-bound tokens (RFC 8705).
+//
+// Parameters:
+//   - confirmation: The key the token is bound to, or nil
+//
+// Returns:
+//   - The token type
+func TokenTypeFor(confirmation *jwt.Confirmation) string {
+	if confirmation != nil && confirmation.JKT != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
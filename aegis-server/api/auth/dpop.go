@@ -0,0 +1,134 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements DPoP (RFC 9449) proof verification and sender-constrained tokens.
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/api/wellknown"
+	"nfcunha/aegis/domain/token"
+	"nfcunha/aegis/util/jwt"
+)
+
+// DPOP_HEADER is the request header carrying a DPoP proof.
+const DPOP_HEADER = "DPoP"
+
+// DPOP_CONTEXT_KEY is the Gin context key under which AcceptDPoPProof stores the verified proof.
+const DPOP_CONTEXT_KEY = "aegis.dpop"
+
+// ErrInvalidDPoPProof is returned when a DPoP proof is invalid, replayed, missing for a
+// DPoP-bound token, or signed with another key than the one the token is bound to.
+var ErrInvalidDPoPProof = jwt.ErrInvalidDPoPProof
+
+// VerifyDPoPProof verifies a DPoP proof for a request and records its JTI, so the same proof
+// is never accepted twice.
+//
+// Parameters:
+//   - proof: The DPoP proof JWT
+//   - method: The HTTP method of the request
+//   - requestUrl: The URL of the request
+//   - accessToken: The access token sent with the proof, or empty at the token endpoints
+//
+// Returns:
+//   - The verified proof
+//   - Error wrapping ErrInvalidDPoPProof if the proof is invalid or replayed
+func VerifyDPoPProof(proof string, method string, requestUrl string, accessToken string) (*jwt.DPoPProof, error) {
+	verified, err := jwt.ParseDPoPProof(proof, method, requestUrl, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if !token.DPoPReplayCache.Use(verified.JKT+":"+verified.JTI, verified.ExpiresAt) {
+		return nil, fmt.Errorf("%w: proof %s was already used", ErrInvalidDPoPProof, verified.JTI)
+	}
+	return verified, nil
+}
+
+// VerifyDPoPBinding checks that an access token is presented by the holder of the key it is
+// bound to. DPoP-bound tokens (with a "cnf.jkt" claim) require a proof signed with that key and
+// made for the token; bearer tokens must not be presented with a proof.
+//
+// Parameters:
+//   - claims: The verified token claims
+//   - accessToken: The access token as presented
+//   - proof: The DPoP proof sent with the token, or empty
+//   - method: The HTTP method of the request
+//   - requestUrl: The URL of the request
+//
+// Returns:
+//   - Error wrapping ErrInvalidDPoPProof if the binding is not satisfied
+func VerifyDPoPBinding(claims *jwt.TokenClaims, accessToken string, proof string, method string, requestUrl string) error {
+	if claims.Confirmation == nil || claims.Confirmation.JKT == "" {
+		if proof != "" {
+			return fmt.Errorf("%w: token is not DPoP-bound", ErrInvalidDPoPProof)
+		}
+		return nil
+	}
+	if proof == "" {
+		return fmt.Errorf("%w: DPoP-bound token presented without a proof", ErrInvalidDPoPProof)
+	}
+
+	verified, err := VerifyDPoPProof(proof, method, requestUrl, accessToken)
+	if err != nil {
+		return err
+	}
+	if verified.JKT != claims.Confirmation.JKT {
+		return fmt.Errorf("%w: proof key does not match the token binding", ErrInvalidDPoPProof)
+	}
+	return nil
+}
+
+// AcceptDPoPProof returns middleware for the token endpoints that verifies the DPoP proof of
+// the request, if any. Verified proofs are stored in the context and the issued tokens are
+// bound to their key through GetConfirmation; requests with an invalid proof are aborted
+// with 400 and the "invalid_dpop_proof" error (RFC 9449 section 5).
+//
+// Returns:
+//   - Gin middleware handler
+func AcceptDPoPProof() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proof := c.GetHeader(DPOP_HEADER)
+		if proof == "" {
+			c.Next()
+			return
+		}
+
+		verified, err := VerifyDPoPProof(proof, c.Request.Method, RequestUrl(c), "")
+		if err != nil {
+			log.Printf("DPoP proof rejected: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_dpop_proof", "error_description": "invalid DPoP proof"})
+			return
+		}
+
+		c.Set(DPOP_CONTEXT_KEY, verified)
+		c.Next()
+	}
+}
+
+// dpopKey returns the thumbprint of the key of the DPoP proof verified by AcceptDPoPProof,
+// or an empty string if the request carried no proof.
+func dpopKey(c *gin.Context) string {
+	value, exists := c.Get(DPOP_CONTEXT_KEY)
+	if !exists {
+		return ""
+	}
+	verified, ok := value.(*jwt.DPoPProof)
+	if !ok {
+		return ""
+	}
+	return verified.JKT
+}
+
+// RequestUrl returns the public URL of the current request without its query, as a DPoP
+// proof's "htu" claim names it.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - The absolute request URL
+func RequestUrl(c *gin.Context) string {
+	return wellknown.BaseUrl(c) + strings.TrimPrefix(c.Request.URL.Path, "/aegis")
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	jwtUtil "nfcunha/aegis/util/jwt"
+)
+
+// newDPoPProof signs a DPoP proof for a request, bound to an access token when one is given
+func newDPoPProof(t *testing.T, key *ecdsa.PrivateKey, method string, url string, accessToken string) string {
+	t.Helper()
+	claims := jwtUtil.DPoPClaims{
+		Htm: method,
+		Htu: url,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.New().String(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if accessToken != "" {
+		claims.Ath = jwtUtil.AccessTokenHash(accessToken)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	jwk, _ := jwtUtil.PublicJWK(&key.PublicKey)
+	token.Header["typ"] = jwtUtil.DPOP_PROOF_TYPE
+	token.Header["jwk"] = jwk
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign DPoP proof: %v", err)
+	}
+	return proof
+}
+
+// newBoundTokenPair issues tokens bound to the key
+func newBoundTokenPair(key *ecdsa.PrivateKey) *jwtUtil.TokenPair {
+	jwk, _ := jwtUtil.PublicJWK(&key.PublicKey)
+	tokenPair, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "dpop@example.com", []string{}, []string{},
+		jwtUtil.TokenOptions{Confirmation: &jwtUtil.Confirmation{JKT: jwk.Thumbprint()}})
+	return tokenPair
+}
+
+// TestValidateToken_DPoP tests that DPoP-bound tokens are only valid with a proof from the bound key
+func TestValidateToken_DPoP(t *testing.T) {
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bound := newBoundTokenPair(key)
+	unbound, _ := jwtUtil.GenerateTokenPair(uuid.New(), "bearer@example.com", []string{}, []string{})
+
+	const url = "https://api.example.com/orders"
+	replayed := newDPoPProof(t, key, "GET", url, bound.AccessToken)
+
+	cases := []struct {
+		name          string
+		token         string
+		proof         string
+		expectedValid bool
+	}{
+		{"valid proof", bound.AccessToken, newDPoPProof(t, key, "GET", url, bound.AccessToken), true},
+		{"first use", bound.AccessToken, replayed, true},
+		{"replayed proof", bound.AccessToken, replayed, false},
+		{"missing proof", bound.AccessToken, "", false},
+		{"other key", bound.AccessToken, newDPoPProof(t, otherKey, "GET", url, bound.AccessToken), false},
+		{"proof for other request", bound.AccessToken, newDPoPProof(t, key, "POST", url, bound.AccessToken), false},
+		{"unbound token with proof", unbound.AccessToken, newDPoPProof(t, key, "GET", url, unbound.AccessToken), false},
+		{"unbound token without proof", unbound.AccessToken, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(ValidateTokenRequest{Token: tc.token, DPoPProof: tc.proof, HttpMethod: "GET", HttpUrl: url})
+			req, _ := http.NewRequest("POST", "/aegis/api/auth/validate", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response ValidateTokenResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if response.Valid != tc.expectedValid {
+				t.Fatalf("Expected valid=%v, got %v. Body: %s", tc.expectedValid, response.Valid, w.Body.String())
+			}
+			if !tc.expectedValid && response.Error != "invalid DPoP proof" {
+				t.Errorf("Expected error 'invalid DPoP proof', got '%s'", response.Error)
+			}
+		})
+	}
+}
+
+// TestIntrospectToken_DPoP tests that introspection reports the key a token is bound to
+func TestIntrospectToken_DPoP(t *testing.T) {
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bound := newBoundTokenPair(key)
+
+	body, _ := json.Marshal(IntrospectTokenRequest{Token: bound.AccessToken})
+	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response IntrospectTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	jwk, _ := jwtUtil.PublicJWK(&key.PublicKey)
+	if response.Cnf == nil || response.Cnf.JKT != jwk.Thumbprint() {
+		t.Fatalf("Expected cnf.jkt %s, got %s", jwk.Thumbprint(), w.Body.String())
+	}
+	if response.TokenType != "DPoP" {
+		t.Errorf("Expected token_type DPoP, got %s", response.TokenType)
+	}
+}
+
+// TestRequireBearerToken_DPoP tests that bound tokens need the DPoP scheme and a proof from the bound key
+func TestRequireBearerToken_DPoP(t *testing.T) {
+	router := setupProtectedRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bound := newBoundTokenPair(key)
+
+	const url = "http://aegis.test/aegis/protected"
+	cases := []struct {
+		name           string
+		authorization  string
+		proof          string
+		expectedStatus int
+	}{
+		{"DPoP scheme with proof", "DPoP " + bound.AccessToken, newDPoPProof(t, key, "GET", url, bound.AccessToken), http.StatusOK},
+		{"DPoP scheme without proof", "DPoP " + bound.AccessToken, "", http.StatusUnauthorized},
+		{"Bearer scheme", "Bearer " + bound.AccessToken, newDPoPProof(t, key, "GET", url, bound.AccessToken), http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/protected", nil)
+			req.Host = "aegis.test"
+			req.Header.Set("Authorization", tc.authorization)
+			if tc.proof != "" {
+				req.Header.Set(DPOP_HEADER, tc.proof)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements forward authentication for reverse proxies (nginx auth_request, Traefik ForwardAuth).
+package auth
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/util/jwt"
+)
+
+// Headers set on successful forward authentication, for the proxy to pass on to the upstream
+const (
+	FORWARD_USER_HEADER        = "X-Aegis-User"
+	FORWARD_SUBJECT_HEADER     = "X-Aegis-Subject"
+	FORWARD_ROLES_HEADER       = "X-Aegis-Roles"
+	FORWARD_PERMISSIONS_HEADER = "X-Aegis-Permissions"
+)
+
+var FORWARD_AUTH_COOKIE = getForwardAuthCookie()
+
+// ForwardAuth is an HTTP handler that lets a reverse proxy authenticate requests to another
+// upstream. The proxy sends it the headers of each incoming request and lets the request
+// through on 200 only. The access token is read from the Authorization header or, for
+// browsers, from the AEGIS_FORWARD_AUTH_COOKIE cookie. DPoP proofs are checked against the
+// original request, given in the X-Forwarded-Method, X-Forwarded-Proto, X-Forwarded-Host and
+// X-Forwarded-Uri headers.
+//
+// Endpoint: GET /aegis/api/auth/forward (other methods are accepted too, as nginx
+// subrequests keep the method of the original request)
+//
+// Query Parameters:
+//   - role: Roles the token must carry, repeated or comma-separated (optional)
+//   - permission: Permissions the token must carry, repeated or comma-separated (optional)
+//   - audience: Audience the token must be issued for (optional)
+//
+// Response (200 OK):
+//   - X-Aegis-User, X-Aegis-Subject, X-Aegis-Roles and X-Aegis-Permissions headers
+//     describing the caller; roles and permissions are comma-separated
+//
+// Response (401 Unauthorized):
+//   - The token is missing, invalid, revoked or not issued for the audience
+//
+// Response (403 Forbidden):
+//   - The token lacks a required role or permission
+func ForwardAuth(c *gin.Context) {
+	log.Println("GET /aegis/api/auth/forward - Forward authentication request received")
+
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		if cookie, err := c.Cookie(FORWARD_AUTH_COOKIE); err == nil && cookie != "" {
+			header = "Bearer " + cookie
+		}
+	}
+
+	claims, description := authenticateBearer(c, header, forwardedMethod(c), forwardedUrl(c))
+	if claims == nil {
+		abortUnauthorized(c, description)
+		return
+	}
+	if audience := c.Query("audience"); audience != "" && !slices.Contains(claims.Audience, audience) {
+		log.Printf("Forward authentication failed: audience mismatch, expected=%s, aud=%v, JTI=%s", audience, claims.Audience, claims.ID)
+		abortUnauthorized(c, "invalid audience")
+		return
+	}
+
+	if !hasGrants(claims, queryList(c, "role"), queryList(c, "permission")) {
+		log.Printf("Forward authentication denied: insufficient privileges, JTI=%s, User=%s", claims.ID, claims.Subject)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient privileges"})
+		return
+	}
+
+	if claims.UserId != "" {
+		c.Header(FORWARD_USER_HEADER, claims.UserId)
+	}
+	c.Header(FORWARD_SUBJECT_HEADER, claims.Subject)
+	c.Header(FORWARD_ROLES_HEADER, strings.Join(claims.Roles, ","))
+	c.Header(FORWARD_PERMISSIONS_HEADER, strings.Join(claims.Permissions, ","))
+	c.JSON(http.StatusOK, gin.H{"message": "authorized"})
+}
+
+// hasGrants reports whether the claims carry all required roles and permissions. Like
+// RequireRole, tokens acting on behalf of their subject never satisfy a role requirement.
+func hasGrants(claims *jwt.TokenClaims, roles []string, permissions []string) bool {
+	if len(roles) > 0 && claims.Actor != nil {
+		return false
+	}
+	for _, role := range roles {
+		if !slices.Contains(claims.Roles, role) {
+			return false
+		}
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(claims.Permissions, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryList returns the values of a query parameter that may be repeated or comma-separated.
+func queryList(c *gin.Context, name string) []string {
+	values := []string{}
+	for _, param := range c.QueryArray(name) {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// forwardedMethod returns the method of the request the proxy is authenticating.
+func forwardedMethod(c *gin.Context) string {
+	if method := c.GetHeader("X-Forwarded-Method"); method != "" {
+		return method
+	}
+	return c.Request.Method
+}
+
+// forwardedUrl returns the URL of the request the proxy is authenticating, or the URL of
+// the forward authentication request itself if the proxy did not send X-Forwarded-Uri.
+func forwardedUrl(c *gin.Context) string {
+	uri := c.GetHeader("X-Forwarded-Uri")
+	if uri == "" {
+		return RequestUrl(c)
+	}
+
+	scheme := "http"
+	if forwardedProto := c.GetHeader("X-Forwarded-Proto"); forwardedProto != "" {
+		scheme = forwardedProto
+	}
+	host := c.Request.Host
+	if forwardedHost := c.GetHeader("X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+	return scheme + "://" + host + uri
+}
+
+// getForwardAuthCookie retrieves the name of the cookie that forward authentication reads the
+// access token from when there is no Authorization header, from the AEGIS_FORWARD_AUTH_COOKIE
+// environment variable. Defaults to "aegis_token".
+//
+// Returns:
+//   - The cookie name
+func getForwardAuthCookie() string {
+	const FORWARD_AUTH_COOKIE_ENV = "AEGIS_FORWARD_AUTH_COOKIE"
+	const DEFAULT_FORWARD_AUTH_COOKIE = "aegis_token"
+	if name := os.Getenv(FORWARD_AUTH_COOKIE_ENV); name != "" {
+		return name
+	}
+	return DEFAULT_FORWARD_AUTH_COOKIE
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	jwtUtil "nfcunha/aegis/util/jwt"
+)
+
+// forwardAuth sends a forward authentication request with the given headers
+func forwardAuth(router *gin.Engine, query string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/aegis/api/auth/forward"+query, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestForwardAuth tests that authenticated requests get the caller's identity in response headers
+func TestForwardAuth(t *testing.T) {
+	router := setupRouter()
+	userId := uuid.New()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(userId, "forward@example.com", []string{"admin", "user"}, []string{"read:users"})
+
+	w := forwardAuth(router, "", map[string]string{"Authorization": "Bearer " + tokenPair.AccessToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expected := map[string]string{
+		FORWARD_USER_HEADER:        userId.String(),
+		FORWARD_SUBJECT_HEADER:     "forward@example.com",
+		FORWARD_ROLES_HEADER:       "admin,user",
+		FORWARD_PERMISSIONS_HEADER: "read:users",
+	}
+	for name, value := range expected {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("Expected %s '%s', got '%s'", name, value, got)
+		}
+	}
+
+	// Browsers send the token in a cookie
+	w = forwardAuth(router, "", map[string]string{"Cookie": FORWARD_AUTH_COOKIE + "=" + tokenPair.AccessToken})
+	if w.Code != http.StatusOK || w.Header().Get(FORWARD_SUBJECT_HEADER) != "forward@example.com" {
+		t.Errorf("Expected cookie authentication to succeed, got status %d", w.Code)
+	}
+}
+
+// TestForwardAuth_Unauthorized tests that missing and unusable tokens are rejected with 401
+func TestForwardAuth_Unauthorized(t *testing.T) {
+	router := setupRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "forward@example.com", []string{}, []string{})
+
+	cases := []struct {
+		name    string
+		query   string
+		headers map[string]string
+	}{
+		{"missing token", "", map[string]string{}},
+		{"invalid token", "", map[string]string{"Authorization": "Bearer invalid"}},
+		{"invalid cookie", "", map[string]string{"Cookie": FORWARD_AUTH_COOKIE + "=invalid"}},
+		{"refresh token", "", map[string]string{"Authorization": "Bearer " + tokenPair.RefreshToken}},
+		{"other audience", "?audience=billing", map[string]string{"Authorization": "Bearer " + tokenPair.AccessToken}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := forwardAuth(router, tc.query, tc.headers)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+			if w.Header().Get("WWW-Authenticate") == "" || w.Header().Get(FORWARD_SUBJECT_HEADER) != "" {
+				t.Errorf("Expected a challenge and no identity headers, got %v", w.Header())
+			}
+		})
+	}
+}
+
+// TestForwardAuth_Grants tests that roles and permissions given in the query are required
+func TestForwardAuth_Grants(t *testing.T) {
+	router := setupRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "forward@example.com", []string{"user"}, []string{"read:users", "write:users"})
+	impersonation, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "forward@example.com", []string{"user"}, []string{"read:users"},
+		jwtUtil.TokenOptions{Actor: &jwtUtil.Actor{Subject: "admin@example.com"}})
+
+	cases := []struct {
+		name         string
+		token        string
+		query        string
+		expectedCode int
+	}{
+		{"granted role", tokenPair.AccessToken, "?role=user", http.StatusOK},
+		{"missing role", tokenPair.AccessToken, "?role=admin", http.StatusForbidden},
+		{"granted permissions", tokenPair.AccessToken, "?permission=read:users,write:users", http.StatusOK},
+		{"repeated permissions", tokenPair.AccessToken, "?permission=read:users&permission=delete:users", http.StatusForbidden},
+		{"role and permission", tokenPair.AccessToken, "?role=user&permission=read:users", http.StatusOK},
+		{"impersonation without role", impersonation.AccessToken, "?permission=read:users", http.StatusOK},
+		{"impersonation with role", impersonation.AccessToken, "?role=user", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := forwardAuth(router, tc.query, map[string]string{"Authorization": "Bearer " + tc.token})
+			if w.Code != tc.expectedCode {
+				t.Errorf("Expected status %d, got %d. Body: %s", tc.expectedCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestForwardAuth_DPoP tests that DPoP proofs are checked against the request being forwarded
+func TestForwardAuth_DPoP(t *testing.T) {
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bound := newBoundTokenPair(key)
+
+	forwarded := map[string]string{
+		"Authorization":      "DPoP " + bound.AccessToken,
+		"X-Forwarded-Method": "POST",
+		"X-Forwarded-Proto":  "https",
+		"X-Forwarded-Host":   "app.example.com",
+		"X-Forwarded-Uri":    "/orders?page=2",
+	}
+
+	forwarded[DPOP_HEADER] = newDPoPProof(t, key, "POST", "https://app.example.com/orders", bound.AccessToken)
+	if w := forwardAuth(router, "", forwarded); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	forwarded[DPOP_HEADER] = newDPoPProof(t, key, "GET", "https://app.example.com/orders", bound.AccessToken)
+	if w := forwardAuth(router, "", forwarded); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a proof of another request, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -5,17 +5,32 @@ package auth
 import (
 	"log"
 	"net/http"
-	"nfcunha/aegis/domain/token"
 	"strings"
 	"github.com/gin-gonic/gin"
+	clientService "nfcunha/aegis/domain/client"
+	refreshService "nfcunha/aegis/domain/refresh"
 	"nfcunha/aegis/util/jwt"
 )
 
+// DEFAULT_CLIENT_ID is reported as client_id for tokens not issued to a registered client.
+const DEFAULT_CLIENT_ID = "aegis-default-client"
+
+// Token type hints accepted by introspection and revocation (RFC 7009 section 2.1)
+const (
+	TOKEN_TYPE_HINT_ACCESS_TOKEN  = "access_token"
+	TOKEN_TYPE_HINT_REFRESH_TOKEN = "refresh_token"
+)
+
 // IntrospectTokenRequest represents the request body for token introspection endpoint.
-// Follows RFC 7662 OAuth 2.0 Token Introspection specification.
+// Follows RFC 7662 OAuth 2.0 Token Introspection specification. The body may be sent
+// form-urlencoded, as the RFC requires, or as JSON.
 type IntrospectTokenRequest struct {
-	Token         string `json:"token" binding:"required"`
-	TokenTypeHint string `json:"token_type_hint,omitempty"` // "access_token" or "refresh_token"
+	Token          string `form:"token" json:"token" binding:"required"`
+	TokenTypeHint  string `form:"token_type_hint" json:"token_type_hint,omitempty"` // "access_token" or "refresh_token"
+	Audience       string `form:"audience" json:"audience,omitempty"`               // Expected audience, tokens for others are inactive
+	CertThumbprint string `form:"cert_thumbprint" json:"cert_thumbprint,omitempty"` // Presented client certificate, tokens bound to another are inactive
+	ClientId       string `form:"client_id" json:"client_id,omitempty"`             // Client credentials, unless sent with HTTP Basic authentication
+	ClientSecret   string `form:"client_secret" json:"client_secret,omitempty"`
 }
 
 // IntrospectTokenResponse represents the response structure for token introspection.
@@ -47,12 +62,21 @@ type IntrospectTokenResponse struct {
 	// Iat is the Unix timestamp indicating when the token was issued.
 	Iat int64 `json:"iat,omitempty"`
 	
-	// Sub is the subject identifier (user ID).
+	// Nbf is the Unix timestamp before which the token is not to be used.
+	Nbf int64 `json:"nbf,omitempty"`
+	
+	// Sub is the subject identifier (user ID, or client ID for client credentials tokens).
 	Sub string `json:"sub,omitempty"`
 	
 	// Iss is the issuer identifier (who issued the token).
 	Iss string `json:"iss,omitempty"`
 	
+	// Aud lists the audiences the token is intended for.
+	Aud []string `json:"aud,omitempty"`
+	
+	// Jti is the unique identifier of the token, as used by the revocation list.
+	Jti string `json:"jti,omitempty"`
+	
 	// Extension fields (not part of RFC 7662 but useful for Aegis):
 	
 	// Roles contains the list of roles assigned to the user.
@@ -60,6 +84,31 @@ type IntrospectTokenResponse struct {
 	
 	// Permissions contains the list of permissions granted to the user.
 	Permissions []string `json:"permissions,omitempty"`
+	
+	// Act identifies the party acting on behalf of the subject (RFC 8693), e.g. the
+	// administrator of an impersonation token.
+	Act *jwt.Actor `json:"act,omitempty"`
+	
+	// Cnf holds the key or certificate a bound token is bound to (RFC 9449 section 6.2,
+	// RFC 8705 section 3.2). Resource servers must check that requests prove possession of it.
+	Cnf *jwt.Confirmation `json:"cnf,omitempty"`
+	
+	// Sid identifies the login session the token was issued in, which can be revoked on its own.
+	Sid string `json:"sid,omitempty"`
+	
+	// Impersonated is true for tokens issued to an administrator impersonating the user.
+	// Applications should refuse sensitive actions (e.g. payments) with such tokens.
+	Impersonated bool `json:"impersonated,omitempty"`
+	
+	// Claims holds the custom claims mapped from user attributes (e.g. department or tenant).
+	// They are returned as top-level members, like in the token itself.
+	Claims map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON encodes the response with the custom claims as top-level members.
+func (r IntrospectTokenResponse) MarshalJSON() ([]byte, error) {
+	type introspectTokenResponse IntrospectTokenResponse
+	return jwt.MarshalWithClaims(introspectTokenResponse(r), r.Claims)
 }
 
 // IntrospectToken is an HTTP handler that implements RFC 7662 OAuth 2.0 Token Introspection.
@@ -67,15 +116,23 @@ type IntrospectTokenResponse struct {
 //
 // Endpoint: POST /aegis/api/auth/introspect
 //
-// Request Body:
+// Request Body (application/x-www-form-urlencoded or JSON):
 //   - token: The token to introspect (required)
 //   - token_type_hint: Optional hint about the token type ("access_token" or "refresh_token")
+//   - audience: Optional expected audience; tokens not issued for it are reported inactive
+//   - cert_thumbprint: Optional "x5t#S256" thumbprint of the client certificate the token was
+//     presented with; certificate-bound tokens bound to another certificate are reported inactive
+//   - client_id, client_secret: Client credentials, unless sent with HTTP Basic authentication
+//
+// Only confidential clients, such as API gateways and resource servers registered as clients,
+// may introspect tokens (RFC 7662 section 2.1).
 //
 // Response (200 OK):
 //   - For active tokens: Returns active=true with full OAuth2 metadata
 //   - For inactive tokens: Returns only {"active": false}
+//   - 401 Unauthorized with an invalid_client error if client authentication fails
 //
-// The endpoint always returns 200 OK status per RFC 7662 section 2.2.
+// The endpoint returns 200 OK for every authenticated request per RFC 7662 section 2.2.
 // This allows clients to distinguish between network errors and validation results.
 //
 // Standards Compliance:
@@ -86,20 +143,35 @@ func IntrospectToken(c *gin.Context) {
 	
 	var req IntrospectTokenRequest
 	
-	// Parse and validate request body
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// Parse and validate request body, form-urlencoded or JSON
+	if err := c.ShouldBind(&req); err != nil {
 		log.Printf("Invalid request body: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
 		return
 	}
 	
-	// Log token type hint if provided
-	if req.TokenTypeHint != "" {
-		log.Printf("Token type hint: %s", req.TokenTypeHint)
+	// Introspection reveals token metadata, so only confidential clients may use it
+	client, err := AuthenticateClientCredentials(c, req.ClientId, req.ClientSecret)
+	if err == nil && !client.IsConfidential() {
+		err = clientService.ErrInvalidClient
+	}
+	if err != nil {
+		log.Printf("Token introspection rejected: %v", err)
+		AbortInvalidClient(c, err)
+		return
 	}
 	
-	// Validate the token using JWT utility
-	claims, err := jwt.ValidateToken(req.Token)
+	// Validate the token, check the blacklist and the expected audience
+	claims, err := VerifyTokenForAudience(req.Token, req.Audience)
+	if err == nil {
+		logHintMismatch(req.TokenTypeHint, claims)
+		err = checkRefreshTokenActive(claims)
+	}
+	
+	// Without a thumbprint, the caller checks the "cnf" claim of the response itself
+	if err == nil && req.CertThumbprint != "" {
+		err = VerifyCertificateBinding(claims, req.CertThumbprint)
+	}
 	
 	// Handle validation errors - return inactive token response per RFC 7662
 	if err != nil {
@@ -112,42 +184,91 @@ func IntrospectToken(c *gin.Context) {
 		return
 	}
 	
-	// Check if token is blacklisted (revoked)
-	if token.GlobalBlacklist != nil && token.GlobalBlacklist.IsBlacklisted(claims.ID) {
-		log.Printf("Token introspection failed: token has been revoked (JTI: %s)", claims.ID)
-		
-		// RFC 7662 Section 2.2: Return minimal response for inactive tokens
-		c.JSON(http.StatusOK, IntrospectTokenResponse{
-			Active: false,
-		})
-		return
-	}
-	
 	// Token is active - return full OAuth2 metadata
-	log.Printf("Token introspection successful for user: %s", claims.Subject)
+	log.Printf("Token introspection by client %s successful for user: %s", client.ClientId, claims.Subject)
 	
 	// Build scope string from roles and permissions
 	// Format: "role:admin role:manager permission:read:users permission:write:users"
 	scope := buildScopeString(claims.Roles, claims.Permissions)
 	
+	// Tokens issued without a registered client (e.g. /users/login) report the default client
+	clientId := claims.ClientId
+	if clientId == "" {
+		clientId = DEFAULT_CLIENT_ID
+	}
+	
+	// Tokens issued before the "sub" claim was added only carry user_id
+	sub := claims.RegisteredClaims.Subject
+	if sub == "" {
+		sub = claims.UserId
+	}
+	
+	// Aegis does not issue post-dated tokens, they are valid from their issue time
+	nbf := claims.IssuedAt
+	if claims.NotBefore != nil {
+		nbf = claims.NotBefore
+	}
+	
 	// Construct RFC 7662-compliant response
 	response := IntrospectTokenResponse{
-		Active:      true,
-		Scope:       scope,
-		ClientId:    "aegis-default-client", // TODO: Implement client management in Phase 3
-		Username:    claims.Subject,
-		TokenType:   "Bearer",
-		Exp:         claims.ExpiresAt.Unix(),
-		Iat:         claims.IssuedAt.Unix(),
-		Sub:         claims.UserId,
-		Iss:         claims.Issuer,
-		Roles:       claims.Roles,
-		Permissions: claims.Permissions,
+		Active:       true,
+		Scope:        scope,
+		ClientId:     clientId,
+		Username:     claims.Subject,
+		TokenType:    TokenTypeFor(claims.Confirmation),
+		Exp:          claims.ExpiresAt.Unix(),
+		Iat:          claims.IssuedAt.Unix(),
+		Nbf:          nbf.Unix(),
+		Sub:          sub,
+		Iss:          claims.Issuer,
+		Aud:          claims.Audience,
+		Jti:          claims.ID,
+		Roles:        claims.Roles,
+		Permissions:  claims.Permissions,
+		Act:          claims.Actor,
+		Cnf:          claims.Confirmation,
+		Sid:          claims.SessionId,
+		Impersonated: claims.Impersonated,
+		Claims:       claims.Custom,
 	}
 	
 	c.JSON(http.StatusOK, response)
 }
 
+// logHintMismatch logs when a token_type_hint names another type than the token's. Aegis reads
+// the type from the token itself, so a wrong or unknown hint never prevents finding the token,
+// as RFC 7662 and RFC 7009 require.
+func logHintMismatch(hint string, claims *jwt.TokenClaims) {
+	switch hint {
+	case "":
+	case TOKEN_TYPE_HINT_ACCESS_TOKEN, TOKEN_TYPE_HINT_REFRESH_TOKEN:
+		if hint != claims.TokenType+"_token" {
+			log.Printf("Token type hint %s does not match %s token (JTI: %s)", hint, claims.TokenType, claims.ID)
+		}
+	default:
+		log.Printf("Ignoring unsupported token type hint: %s", hint)
+	}
+}
+
+// checkRefreshTokenActive checks that a refresh token has not been used or revoked server-side.
+// Refresh tokens are single-use, so one that was rotated is no longer active even though it has
+// not expired. Access tokens, and refresh tokens issued before they were tracked, pass. A refresh
+// token that cannot be looked up is reported inactive, as it may have been used or revoked.
+func checkRefreshTokenActive(claims *jwt.TokenClaims) error {
+	if claims.TokenType != "refresh" {
+		return nil
+	}
+	stored, err := refreshService.LookupRefreshToken(claims.ID)
+	if err != nil {
+		log.Printf("Error looking up refresh token %s, reporting it inactive: %v", claims.ID, err)
+		return ErrTokenRevoked
+	}
+	if stored != nil && !stored.IsActive() {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
 // buildScopeString constructs an OAuth2-compliant scope string from roles and permissions.
 // Scope format: Space-separated list of scope identifiers.
 //
@@ -3,12 +3,19 @@ package auth
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	refreshService "nfcunha/aegis/domain/refresh"
 	jwtUtil "nfcunha/aegis/util/jwt"
 )
 
@@ -35,6 +42,7 @@ func TestIntrospectToken_ActiveAccessToken(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -119,6 +127,7 @@ func TestIntrospectToken_ActiveRefreshToken(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -155,6 +164,7 @@ func TestIntrospectToken_InactiveToken(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -212,6 +222,7 @@ func TestIntrospectToken_InactiveTamperedToken(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -255,6 +266,7 @@ func TestIntrospectToken_WithTokenTypeHint(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -288,6 +300,7 @@ func TestIntrospectToken_EmptyToken(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -307,6 +320,7 @@ func TestIntrospectToken_MissingTokenField(t *testing.T) {
 	body := []byte("{}")
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -326,6 +340,7 @@ func TestIntrospectToken_InvalidJSON(t *testing.T) {
 	body := []byte("not valid json")
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -359,6 +374,7 @@ func TestIntrospectToken_RFC7662Compliance(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -391,6 +407,13 @@ func TestIntrospectToken_RFC7662Compliance(t *testing.T) {
 		if response.Iat == 0 {
 			t.Error("RFC 7662: iat field should be present for active token")
 		}
+		if response.Nbf != response.Iat {
+			t.Errorf("RFC 7662: nbf field should be the issue time, got %d", response.Nbf)
+		}
+		claims, _ := jwtUtil.ValidateToken(tokenPair.AccessToken)
+		if response.Jti != claims.ID {
+			t.Errorf("RFC 7662: jti field should be %s, got %s", claims.ID, response.Jti)
+		}
 	}
 }
 
@@ -415,6 +438,7 @@ func TestIntrospectToken_EmptyRolesAndPermissions(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -457,6 +481,7 @@ func TestIntrospectToken_ResponseTime(t *testing.T) {
 	start := time.Now()
 	
 	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -472,6 +497,76 @@ func TestIntrospectToken_ResponseTime(t *testing.T) {
 	t.Logf("Token introspection response time: %v", elapsed)
 }
 
+// TestIntrospectToken_ClientId tests that the client a token was issued to is reported
+// Expected: client_id from the token, or the default client for tokens issued without one
+func TestIntrospectToken_ClientId(t *testing.T) {
+	router := setupRouter()
+	
+	withClient, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "test@example.com", []string{}, []string{}, jwtUtil.TokenOptions{ClientId: "web-app"})
+	withoutClient, _ := jwtUtil.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	machine, _ := jwtUtil.GenerateClientToken("billing-service", []string{"read:users"}, 0, nil, nil)
+	
+	cases := []struct {
+		token       string
+		expectedId  string
+		expectedSub string
+	}{
+		{withClient.AccessToken, "web-app", ""},
+		{withoutClient.AccessToken, DEFAULT_CLIENT_ID, ""},
+		{machine.Token, "billing-service", "billing-service"},
+	}
+	
+	for _, tc := range cases {
+		body, _ := json.Marshal(IntrospectTokenRequest{Token: tc.token})
+		req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+		authenticateClient(req)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		
+		var response IntrospectTokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.ClientId != tc.expectedId {
+			t.Errorf("Expected client_id %s, got %s", tc.expectedId, response.ClientId)
+		}
+		if tc.expectedSub != "" && response.Sub != tc.expectedSub {
+			t.Errorf("Expected sub %s, got %s", tc.expectedSub, response.Sub)
+		}
+	}
+}
+
+// TestIntrospectToken_Audience tests that tokens for another audience are reported inactive
+func TestIntrospectToken_Audience(t *testing.T) {
+	router := setupRouter()
+	
+	tokenPair, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "test@example.com", []string{}, []string{}, jwtUtil.TokenOptions{Audience: []string{"billing"}})
+	
+	introspect := func(audience string) IntrospectTokenResponse {
+		body, _ := json.Marshal(IntrospectTokenRequest{Token: tokenPair.AccessToken, Audience: audience})
+		req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+		authenticateClient(req)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		
+		var response IntrospectTokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+	
+	response := introspect("billing")
+	if !response.Active {
+		t.Fatal("Expected active=true for the token's audience")
+	}
+	if len(response.Aud) != 1 || response.Aud[0] != "billing" {
+		t.Errorf("Expected aud [billing], got %v", response.Aud)
+	}
+	
+	if introspect("orders").Active {
+		t.Error("Expected active=false for another audience")
+	}
+}
+
 // TestBuildScopeString tests the scope string builder function
 func TestBuildScopeString(t *testing.T) {
 	tests := []struct {
@@ -515,3 +610,133 @@ func TestBuildScopeString(t *testing.T) {
 		})
 	}
 }
+
+// TestIntrospectToken_CustomClaims tests that claims mapped from user attributes are returned as top-level members
+func TestIntrospectToken_CustomClaims(t *testing.T) {
+	router := setupRouter()
+	options := jwtUtil.TokenOptions{Claims: map[string]interface{}{"tenant": "acme", "department": "sales"}}
+	tokenPair, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "claims@example.com", []string{}, []string{}, options)
+
+	body, _ := json.Marshal(IntrospectTokenRequest{Token: tokenPair.AccessToken})
+	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+	authenticateClient(req)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var members map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &members)
+	if members["active"] != true || members["tenant"] != "acme" || members["department"] != "sales" {
+		t.Errorf("Expected custom claims in the response, got %s", w.Body.String())
+	}
+}
+
+// introspectForm posts a form-urlencoded introspection request, as RFC 7662 clients such as API gateways do
+func introspectForm(router *gin.Engine, form url.Values, clientId string, secret string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientId != "" {
+		req.SetBasicAuth(clientId, secret)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestIntrospectToken_FormEncoded tests form-urlencoded requests with client_secret_basic and client_secret_post
+func TestIntrospectToken_FormEncoded(t *testing.T) {
+	router := setupRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "form@example.com", []string{"user"}, []string{}, jwtUtil.TokenOptions{Audience: []string{"https://api.example.com"}})
+
+	w := introspectForm(router, url.Values{"token": {tokenPair.AccessToken}, "token_type_hint": {"access_token"}}, testClient.ClientId, testClientSecret)
+	var response IntrospectTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || !response.Active || response.Username != "form@example.com" {
+		t.Fatalf("Expected active token, got status %d: %s", w.Code, w.Body.String())
+	}
+	if len(response.Aud) != 1 || response.Aud[0] != "https://api.example.com" || response.Jti == "" || response.Nbf == 0 {
+		t.Errorf("Expected aud, jti and nbf in the response, got %s", w.Body.String())
+	}
+
+	form := url.Values{"token": {tokenPair.AccessToken}, "client_id": {testClient.ClientId}, "client_secret": {testClientSecret}}
+	if w := introspectForm(router, form, "", ""); !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Errorf("Expected client_secret_post to be accepted, got status %d: %s", w.Code, w.Body.String())
+	}
+
+	// A wrong hint does not prevent finding the token
+	if w := introspectForm(router, url.Values{"token": {tokenPair.AccessToken}, "token_type_hint": {"refresh_token"}}, testClient.ClientId, testClientSecret); !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Errorf("Expected active token despite the hint, got %s", w.Body.String())
+	}
+}
+
+// TestIntrospectToken_ClientAuthentication tests that only authenticated confidential clients may introspect tokens
+func TestIntrospectToken_ClientAuthentication(t *testing.T) {
+	router := setupRouter()
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "client-auth@example.com", []string{}, []string{})
+	form := url.Values{"token": {tokenPair.AccessToken}}
+
+	public := clientService.CreateClient("Single Page App", []string{"https://app.example.com/callback"}, "system")
+	clientService.SaveClient(public)
+
+	tests := []struct {
+		name     string
+		clientId string
+		secret   string
+	}{
+		{"no credentials", "", ""},
+		{"wrong secret", testClient.ClientId, "wrong-secret"},
+		{"unknown client", "unknown-client", testClientSecret},
+		{"public client", public.ClientId, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := introspectForm(router, form, tt.clientId, tt.secret)
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "invalid_client") {
+				t.Errorf("Expected status %d with invalid_client, got %d: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestIntrospectToken_RotatedRefreshToken tests that refresh tokens are inactive once used
+func TestIntrospectToken_RotatedRefreshToken(t *testing.T) {
+	router := setupRouter()
+	userId := uuid.New()
+	first, _ := jwtUtil.GenerateTokenPair(userId, "rotated@example.com", []string{}, []string{})
+	refreshService.StartFamily(uuid.New().String(), userId, "", first)
+
+	form := url.Values{"token": {first.RefreshToken}, "token_type_hint": {"refresh_token"}}
+	if w := introspectForm(router, form, testClient.ClientId, testClientSecret); !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Fatalf("Expected active refresh token, got %s", w.Body.String())
+	}
+
+	second, _ := jwtUtil.GenerateTokenPair(userId, "rotated@example.com", []string{}, []string{})
+	refreshService.Rotate(first.RefreshTokenId, second)
+	if w := introspectForm(router, form, testClient.ClientId, testClientSecret); w.Body.String() != `{"active":false}` {
+		t.Errorf("Expected rotated refresh token to be inactive, got %s", w.Body.String())
+	}
+}
+
+// TestCheckRefreshTokenActive_LookupFailure tests that a refresh token that cannot be looked up is reported inactive
+func TestCheckRefreshTokenActive_LookupFailure(t *testing.T) {
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "lookup@example.com", []string{}, []string{})
+	refreshClaims, _ := jwtUtil.ValidateToken(tokenPair.RefreshToken)
+	accessClaims, _ := jwtUtil.ValidateToken(tokenPair.AccessToken)
+
+	// An untracked refresh token passes while the database is available
+	if err := checkRefreshTokenActive(refreshClaims); err != nil {
+		t.Fatalf("Expected untracked refresh token to pass, got %v", err)
+	}
+
+	// Simulate a database outage
+	originalDBFile := database.DB_FILE
+	database.DB_FILE = filepath.Join(t.TempDir(), "missing", "aegis.db")
+	defer func() { database.DB_FILE = originalDBFile }()
+
+	if err := checkRefreshTokenActive(refreshClaims); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+	if err := checkRefreshTokenActive(accessClaims); err != nil {
+		t.Errorf("Expected access tokens not to be looked up, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements certificate-bound access tokens (RFC 8705).
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/util/jwt"
+)
+
+var CLIENT_CERT_HEADER = getClientCertHeader()
+
+// ErrInvalidCertificateBinding is returned when a certificate-bound token is presented without
+// the certificate it is bound to.
+var ErrInvalidCertificateBinding = errors.New("invalid client certificate")
+
+// ClientCertificate returns the client certificate of the current request: the one presented
+// in the TLS handshake with Aegis or, when AEGIS_CLIENT_CERT_HEADER is configured, the one a
+// TLS-terminating proxy forwarded in that header as URL-encoded PEM (e.g. nginx's
+// $ssl_client_escaped_cert).
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - The client certificate, or nil if none was presented
+func ClientCertificate(c *gin.Context) *x509.Certificate {
+	if c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+		return c.Request.TLS.PeerCertificates[0]
+	}
+	if CLIENT_CERT_HEADER == "" {
+		return nil
+	}
+	forwarded := c.GetHeader(CLIENT_CERT_HEADER)
+	if forwarded == "" {
+		return nil
+	}
+	cert, err := parseForwardedCertificate(forwarded)
+	if err != nil {
+		log.Printf("Ignoring forwarded client certificate: %v", err)
+		return nil
+	}
+	return cert
+}
+
+// CertificateBindingEnabled reports whether client certificates can reach Aegis, so that tokens
+// can be bound to them: either the listener asks clients for a certificate in the TLS handshake,
+// or a TLS-terminating proxy forwards it in the AEGIS_CLIENT_CERT_HEADER header.
+//
+// Parameters:
+//   - tlsConfig: The TLS configuration of the listener, or nil when serving plain HTTP
+//
+// Returns:
+//   - True if tokens can be bound to client certificates
+func CertificateBindingEnabled(tlsConfig *tls.Config) bool {
+	if CLIENT_CERT_HEADER != "" {
+		return true
+	}
+	return tlsConfig != nil && tlsConfig.ClientAuth != tls.NoClientCert
+}
+
+// ClientCertificateThumbprint returns the "x5t#S256" thumbprint of the client certificate of
+// the current request.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - The thumbprint, or an empty string if no certificate was presented
+func ClientCertificateThumbprint(c *gin.Context) string {
+	cert := ClientCertificate(c)
+	if cert == nil {
+		return ""
+	}
+	return jwt.CertificateThumbprint(cert)
+}
+
+// VerifyCertificateBinding checks that a certificate-bound token (with a "cnf.x5t#S256" claim)
+// is presented over a connection authenticated with that certificate. Unbound tokens pass.
+//
+// Parameters:
+//   - claims: The verified token claims
+//   - thumbprint: The "x5t#S256" thumbprint of the presented certificate, or empty if none
+//
+// Returns:
+//   - Error wrapping ErrInvalidCertificateBinding if the binding is not satisfied
+func VerifyCertificateBinding(claims *jwt.TokenClaims, thumbprint string) error {
+	if claims.Confirmation == nil || claims.Confirmation.X5tS256 == "" {
+		return nil
+	}
+	if thumbprint != claims.Confirmation.X5tS256 {
+		return fmt.Errorf("%w: certificate does not match the token binding", ErrInvalidCertificateBinding)
+	}
+	return nil
+}
+
+// parseForwardedCertificate decodes a URL-encoded PEM certificate forwarded by a proxy.
+func parseForwardedCertificate(value string) (*x509.Certificate, error) {
+	decoded, err := url.QueryUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(decoded))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// getClientCertHeader retrieves the header in which a TLS-terminating proxy forwards the
+// client certificate from the AEGIS_CLIENT_CERT_HEADER environment variable.
+// Only set it when every request reaches Aegis through that proxy, which must overwrite the header.
+//
+// Returns:
+//   - The header name, or empty to only use certificates presented to Aegis directly
+func getClientCertHeader() string {
+	const CLIENT_CERT_HEADER_ENV = "AEGIS_CLIENT_CERT_HEADER"
+	if header := os.Getenv(CLIENT_CERT_HEADER_ENV); header != "" {
+		log.Printf("Accepting client certificates forwarded in header: %s", header)
+		return header
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	jwtUtil "nfcunha/aegis/util/jwt"
+)
+
+// newClientCertificate creates a self-signed client certificate
+func newClientCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// newCertificateBoundToken issues an access token bound to the certificate
+func newCertificateBoundToken(cert *x509.Certificate) string {
+	tokenPair, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "mtls@example.com", []string{}, []string{},
+		jwtUtil.TokenOptions{Confirmation: &jwtUtil.Confirmation{X5tS256: jwtUtil.CertificateThumbprint(cert)}})
+	return tokenPair.AccessToken
+}
+
+// TestValidateToken_CertificateBound tests that certificate-bound tokens need the thumbprint of the bound certificate
+func TestValidateToken_CertificateBound(t *testing.T) {
+	router := setupRouter()
+	cert := newClientCertificate(t, "orders-service")
+	other := newClientCertificate(t, "other-service")
+	token := newCertificateBoundToken(cert)
+
+	cases := []struct {
+		name          string
+		thumbprint    string
+		expectedValid bool
+	}{
+		{"bound certificate", jwtUtil.CertificateThumbprint(cert), true},
+		{"missing certificate", "", false},
+		{"other certificate", jwtUtil.CertificateThumbprint(other), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(ValidateTokenRequest{Token: token, CertThumbprint: tc.thumbprint})
+			req, _ := http.NewRequest("POST", "/aegis/api/auth/validate", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response ValidateTokenResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if response.Valid != tc.expectedValid {
+				t.Fatalf("Expected valid=%v, got %v. Body: %s", tc.expectedValid, response.Valid, w.Body.String())
+			}
+			if !tc.expectedValid && response.Error != "invalid client certificate" {
+				t.Errorf("Expected error 'invalid client certificate', got '%s'", response.Error)
+			}
+		})
+	}
+}
+
+// TestIntrospectToken_CertificateBound tests that introspection reports the certificate binding
+// and checks it when the caller passes a thumbprint
+func TestIntrospectToken_CertificateBound(t *testing.T) {
+	router := setupRouter()
+	cert := newClientCertificate(t, "orders-service")
+	token := newCertificateBoundToken(cert)
+
+	introspect := func(thumbprint string) IntrospectTokenResponse {
+		body, _ := json.Marshal(IntrospectTokenRequest{Token: token, CertThumbprint: thumbprint})
+		req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+		authenticateClient(req)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response IntrospectTokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	response := introspect("")
+	if !response.Active || response.Cnf == nil || response.Cnf.X5tS256 != jwtUtil.CertificateThumbprint(cert) {
+		t.Fatalf("Expected active token with cnf.x5t#S256, got %+v", response)
+	}
+	if response.TokenType != "Bearer" {
+		t.Errorf("Expected token_type Bearer for certificate-bound tokens, got %s", response.TokenType)
+	}
+	if !introspect(jwtUtil.CertificateThumbprint(cert)).Active {
+		t.Error("Expected token to be active with the bound certificate")
+	}
+	if introspect(jwtUtil.CertificateThumbprint(newClientCertificate(t, "other"))).Active {
+		t.Error("Expected token to be inactive with another certificate")
+	}
+}
+
+// TestRequireBearerToken_CertificateBound tests that certificate-bound tokens are only accepted
+// over a connection with the bound certificate, directly or forwarded by a trusted proxy
+func TestRequireBearerToken_CertificateBound(t *testing.T) {
+	router := setupProtectedRouter()
+	cert := newClientCertificate(t, "orders-service")
+	token := newCertificateBoundToken(cert)
+	forwarded := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+
+	original := CLIENT_CERT_HEADER
+	CLIENT_CERT_HEADER = "X-Client-Cert"
+	defer func() { CLIENT_CERT_HEADER = original }()
+
+	cases := []struct {
+		name           string
+		tls            *tls.ConnectionState
+		header         string
+		expectedStatus int
+	}{
+		{"bound certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, "", http.StatusOK},
+		{"forwarded certificate", nil, forwarded, http.StatusOK},
+		{"other certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{newClientCertificate(t, "other")}}, "", http.StatusUnauthorized},
+		{"no certificate", nil, "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/protected", nil)
+			req.TLS = tc.tls
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tc.header != "" {
+				req.Header.Set("X-Client-Cert", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestCertificateBindingEnabled tests that binding is enabled when the listener asks for certificates or a proxy forwards them
+func TestCertificateBindingEnabled(t *testing.T) {
+	originalHeader := CLIENT_CERT_HEADER
+	defer func() { CLIENT_CERT_HEADER = originalHeader }()
+
+	CLIENT_CERT_HEADER = ""
+	cases := []struct {
+		name      string
+		tlsConfig *tls.Config
+		expected  bool
+	}{
+		{"plain HTTP", nil, false},
+		{"no client certificates", &tls.Config{ClientAuth: tls.NoClientCert}, false},
+		{"requested certificates", &tls.Config{ClientAuth: tls.RequestClientCert}, true},
+		{"verified certificates", &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if enabled := CertificateBindingEnabled(tc.tlsConfig); enabled != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, enabled)
+			}
+		})
+	}
+
+	CLIENT_CERT_HEADER = "X-Client-Cert"
+	if !CertificateBindingEnabled(nil) {
+		t.Error("Expected binding to be enabled with a forwarded certificate header")
+	}
+}
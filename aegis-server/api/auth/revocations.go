@@ -0,0 +1,158 @@
+// Package auth provides HTTP REST API endpoints for authentication and token management.
+// This file implements the revocation list for services that verify tokens offline.
+package auth
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/domain/token"
+)
+
+const (
+	DEFAULT_REVOCATION_PAGE_SIZE = 100
+	MAX_REVOCATION_PAGE_SIZE     = 1000
+)
+
+// RevokedToken represents a revoked token in the revocation list.
+type RevokedToken struct {
+	// JTI is the revoked token's "jti" claim
+	JTI string `json:"jti"`
+
+	// ExpiresAt is the token's expiration (Unix timestamp); the entry can be dropped afterwards
+	ExpiresAt int64 `json:"exp"`
+
+	// Seq is the entry's position in the change feed
+	Seq int64 `json:"seq"`
+}
+
+// RevocationListResponse represents a page of the revocation list.
+type RevocationListResponse struct {
+	// Revocations holds the revoked tokens of this page
+	Revocations []RevokedToken `json:"revocations"`
+
+	// NextCursor is passed as "cursor" to fetch the next page (page mode, omitted on the last page)
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// Since is passed as "since" in the next poll (changes mode only)
+	Since *int64 `json:"since,omitempty"`
+
+	// Epoch identifies the sequence "since" belongs to and is passed as "epoch" in the next poll (changes mode only)
+	Epoch string `json:"epoch,omitempty"`
+
+	// Reset indicates that the epoch passed in differs from the current one, so the entries start over from since=0 (changes mode only)
+	Reset bool `json:"reset,omitempty"`
+
+	// HasMore indicates whether more entries are available right away
+	HasMore bool `json:"has_more"`
+}
+
+// ListRevocations is an HTTP handler that returns the revoked tokens that have not expired yet,
+// so services verifying tokens offline can keep a local copy of the blacklist.
+//
+// Endpoint: GET /aegis/api/auth/revocations
+//
+// Authentication: Bearer access token
+//
+// Query Parameters:
+//   - cursor: Page mode; the next_cursor of the previous page, omitted for the first page
+//   - since: Changes mode; only tokens revoked after this sequence number, 0 for all
+//   - epoch: Changes mode; the epoch returned by the previous poll, omitted on the first poll
+//   - limit: Maximum number of entries (default 100, max 1000)
+//
+// Response:
+//   - 200 OK: A page of revoked tokens
+//   - 400 Bad Request: Invalid query parameters
+//   - 401 Unauthorized: Missing or invalid bearer token
+//   - 500 Internal Server Error: Blacklist system unavailable or failing
+//
+// Page mode returns the entries ordered by JTI. Changes mode returns them in the order they
+// were revoked, and the returned "since" and "epoch" are passed back in the next poll; a verifier
+// can start with since=0 and poll every few seconds. Sequence numbers start over when an
+// in-memory blacklist restarts, which changes the epoch: a poll with another epoch is answered
+// from since=0 with "reset" set. Expired entries are never returned, so verifiers must drop
+// local entries past their "exp" themselves.
+func ListRevocations(c *gin.Context) {
+	log.Println("GET /aegis/api/auth/revocations - Revocation list request received")
+
+	limit := DEFAULT_REVOCATION_PAGE_SIZE
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > MAX_REVOCATION_PAGE_SIZE {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = parsed
+	}
+
+	sinceStr, changesMode := c.GetQuery("since")
+	cursor := c.Query("cursor")
+	if changesMode && cursor != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor and since cannot be combined"})
+		return
+	}
+	var since int64
+	if changesMode {
+		var err error
+		if since, err = strconv.ParseInt(sinceStr, 10, 64); err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a non-negative integer"})
+			return
+		}
+	}
+
+	if token.GlobalBlacklist == nil {
+		log.Println("Revocation list failed: blacklist system not initialized")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token revocation system unavailable"})
+		return
+	}
+
+	// A cursor from another epoch means nothing in this sequence, so start over
+	epoch := token.GlobalBlacklist.Epoch()
+	reset := false
+	if requested := c.Query("epoch"); changesMode && requested != "" && requested != epoch {
+		log.Printf("Revocation list epoch %s is not the current epoch %s, starting over", requested, epoch)
+		since = 0
+		reset = true
+	}
+
+	// Fetch one extra entry to find out whether there is more
+	var entries []token.BlacklistEntry
+	var err error
+	if changesMode {
+		entries, err = token.GlobalBlacklist.Changes(since, limit+1)
+	} else {
+		entries, err = token.GlobalBlacklist.List(cursor, limit+1)
+	}
+	if err != nil {
+		log.Printf("Revocation list failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list revocations"})
+		return
+	}
+
+	response := RevocationListResponse{
+		Revocations: make([]RevokedToken, 0, min(len(entries), limit)),
+		HasMore:     len(entries) > limit,
+	}
+	for _, entry := range entries[:min(len(entries), limit)] {
+		response.Revocations = append(response.Revocations, RevokedToken{
+			JTI:       entry.JTI,
+			ExpiresAt: entry.ExpiresAt.Unix(),
+			Seq:       entry.Seq,
+		})
+	}
+
+	count := len(response.Revocations)
+	if changesMode {
+		if count > 0 {
+			since = response.Revocations[count-1].Seq
+		}
+		response.Since = &since
+		response.Epoch = epoch
+		response.Reset = reset
+	} else if response.HasMore {
+		response.NextCursor = response.Revocations[count-1].JTI
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/domain/token"
+	jwtUtil "nfcunha/aegis/util/jwt"
+)
+
+// listRevocations calls the revocation list endpoint with a valid bearer token
+func listRevocations(t *testing.T, query string) (*httptest.ResponseRecorder, RevocationListResponse) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/revocations", RequireBearerToken(), ListRevocations)
+	tokenPair, _ := jwtUtil.GenerateTokenPair(uuid.New(), "verifier@example.com", []string{}, []string{})
+
+	req, _ := http.NewRequest("GET", "/revocations"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response RevocationListResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+// TestListRevocations_Pages tests that revoked tokens are listed in pages ordered by JTI
+func TestListRevocations_Pages(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	for i := 5; i >= 1; i-- {
+		bl.Add(fmt.Sprintf("jti-%d", i), expiresAt)
+	}
+	bl.Add("jti-expired", time.Now().Add(-1*time.Minute))
+
+	w, page := listRevocations(t, "?limit=3")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(page.Revocations) != 3 || page.Revocations[0].JTI != "jti-1" || page.Revocations[0].ExpiresAt != expiresAt.Unix() {
+		t.Errorf("Unexpected first page: %+v", page.Revocations)
+	}
+	if !page.HasMore || page.NextCursor != "jti-3" || page.Since != nil {
+		t.Errorf("Expected a next cursor, got %+v", page)
+	}
+
+	_, page = listRevocations(t, "?limit=3&cursor="+page.NextCursor)
+	if len(page.Revocations) != 2 || page.Revocations[1].JTI != "jti-5" {
+		t.Errorf("Unexpected last page, expired entries must be skipped: %+v", page.Revocations)
+	}
+	if page.HasMore || page.NextCursor != "" {
+		t.Errorf("Expected no next cursor on the last page, got %+v", page)
+	}
+}
+
+// TestListRevocations_Changes tests polling for tokens revoked since a cursor
+func TestListRevocations_Changes(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	bl.Add("jti-b", expiresAt)
+	bl.Add("jti-a", expiresAt)
+
+	w, changes := listRevocations(t, "?since=0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(changes.Revocations) != 2 || changes.Revocations[0].JTI != "jti-b" || changes.Since == nil {
+		t.Fatalf("Expected entries in revocation order, got %+v", changes)
+	}
+
+	// Nothing new: the cursor stays where it is
+	since := *changes.Since
+	_, changes = listRevocations(t, fmt.Sprintf("?since=%d", since))
+	if len(changes.Revocations) != 0 || *changes.Since != since {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+
+	bl.Add("jti-c", expiresAt)
+	_, changes = listRevocations(t, fmt.Sprintf("?since=%d", since))
+	if len(changes.Revocations) != 1 || changes.Revocations[0].JTI != "jti-c" || *changes.Since <= since {
+		t.Errorf("Expected only the new revocation, got %+v", changes)
+	}
+}
+
+// TestListRevocations_Restart tests that a poll with the epoch of a previous blacklist starts over
+func TestListRevocations_Restart(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	bl.Add("jti-a", expiresAt)
+	bl.Add("jti-b", expiresAt)
+	_, changes := listRevocations(t, "?since=0")
+	if changes.Epoch != bl.Epoch() || changes.Reset {
+		t.Fatalf("Expected the current epoch without reset, got %+v", changes)
+	}
+	since, epoch := *changes.Since, changes.Epoch
+
+	// The same epoch continues where the previous poll stopped
+	_, changes = listRevocations(t, fmt.Sprintf("?since=%d&epoch=%s", since, epoch))
+	if len(changes.Revocations) != 0 || changes.Reset {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+
+	// After a restart, the sequence starts over with a new epoch
+	restarted := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(restarted)
+	restarted.Add("jti-c", expiresAt)
+	_, changes = listRevocations(t, fmt.Sprintf("?since=%d&epoch=%s", since, epoch))
+	if !changes.Reset || changes.Epoch != restarted.Epoch() || len(changes.Revocations) != 1 || changes.Revocations[0].JTI != "jti-c" {
+		t.Errorf("Expected a reset listing the new revocation, got %+v", changes)
+	}
+}
+
+// TestListRevocations_InvalidParameters tests that invalid query parameters are rejected
+func TestListRevocations_InvalidParameters(t *testing.T) {
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+	defer func() { token.GlobalBlacklist = nil }()
+
+	for _, query := range []string{"?limit=0", "?limit=1001", "?since=-1", "?since=abc", "?since=0&cursor=jti-1"} {
+		if w, _ := listRevocations(t, query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+// TestListRevocations_RequiresBearerToken tests that the revocation list is not public
+func TestListRevocations_RequiresBearerToken(t *testing.T) {
+	router := gin.Default()
+	RegisterApi(router)
+
+	req, _ := http.NewRequest("GET", "/api/auth/revocations", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
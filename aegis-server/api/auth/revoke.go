@@ -3,8 +3,15 @@
 package auth
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
+	referenceService "nfcunha/aegis/domain/reference"
+	refreshService "nfcunha/aegis/domain/refresh"
+	sessionService "nfcunha/aegis/domain/session"
 	"nfcunha/aegis/domain/token"
 	"time"
 
@@ -12,10 +19,20 @@ import (
 	"nfcunha/aegis/util/jwt"
 )
 
+var REVOCATION_CLIENTS = getRevocationClients()
+
 // RevokeTokenRequest represents the request structure for token revocation.
+// Follows RFC 7009 section 2.1. The body may be sent form-urlencoded, as the RFC requires, or as JSON.
 type RevokeTokenRequest struct {
-	// Token is the JWT token to revoke (required)
-	Token string `json:"token" binding:"required"`
+	// Token is the JWT or reference token to revoke (required)
+	Token string `form:"token" json:"token" binding:"required"`
+	
+	// TokenTypeHint optionally names the type of the token: "access_token" or "refresh_token"
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint,omitempty"`
+	
+	// ClientId and ClientSecret authenticate the client, unless sent with HTTP Basic authentication
+	ClientId     string `form:"client_id" json:"client_id,omitempty"`
+	ClientSecret string `form:"client_secret" json:"client_secret,omitempty"`
 }
 
 // RevokeTokenResponse represents the response structure for token revocation.
@@ -27,16 +44,24 @@ type RevokeTokenResponse struct {
 	Message string `json:"message"`
 }
 
-// RevokeToken is an HTTP handler that revokes a JWT token by adding it to the blacklist.
+// RevokeToken is an HTTP handler that implements RFC 7009 OAuth 2.0 Token Revocation.
+// Access tokens are revoked by adding them to the blacklist. Revoking a refresh token revokes
+// the whole grant: its session and every access and refresh token issued in it (RFC 7009
+// section 2.1). Reference tokens are also deleted, so their handle no longer resolves.
 //
 // Endpoint: POST /aegis/api/auth/revoke
 //
-// Request Body:
-//   - token: The JWT token to revoke (required)
+// Request Body (application/x-www-form-urlencoded or JSON):
+//   - token: The JWT or reference token to revoke (required)
+//   - token_type_hint: Optional hint about the token type ("access_token" or "refresh_token")
+//   - client_id, client_secret: Client credentials, unless sent with HTTP Basic authentication;
+//     public clients send only client_id
 //
 // Response:
-//   - 200 OK: Token successfully revoked
-//   - 400 Bad Request: Invalid request or token validation failed
+//   - 200 OK: Token revoked, or invalid and therefore nothing to revoke (RFC 7009 section 2.2)
+//   - 400 Bad Request: Invalid request, or the token was issued to another client, or without a
+//     client and the caller is not one of REVOCATION_CLIENTS
+//   - 401 Unauthorized: Client authentication failed
 //   - 500 Internal Server Error: Blacklist system unavailable
 //
 // The revoked token will be blacklisted until its natural expiration time.
@@ -46,10 +71,17 @@ func RevokeToken(c *gin.Context) {
 	
 	var req RevokeTokenRequest
 	
-	// Parse and validate request body
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// Parse and validate request body, form-urlencoded or JSON
+	if err := c.ShouldBind(&req); err != nil {
 		log.Printf("Invalid request body: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	
+	client, err := AuthenticateClientCredentials(c, req.ClientId, req.ClientSecret)
+	if err != nil {
+		log.Printf("Token revocation rejected: %v", err)
+		AbortInvalidClient(c, err)
 		return
 	}
 	
@@ -62,15 +94,43 @@ func RevokeToken(c *gin.Context) {
 		return
 	}
 	
-	// Validate the token first to ensure it's valid before revoking
-	claims, err := jwt.ValidateToken(req.Token)
+	// Reference tokens are resolved to the signed token they stand for
+	tokenString := req.Token
+	if referenceService.IsReferenceToken(req.Token) {
+		resolved, err := referenceService.Resolve(req.Token)
+		if err != nil {
+			log.Printf("Token revocation skipped: unknown reference token - %v", err)
+			respondTokenInvalid(c)
+			return
+		}
+		tokenString = resolved
+	}
+	
+	// Invalid and expired tokens need no revocation; the client cannot act on an error (RFC 7009 section 2.2)
+	claims, err := jwt.ValidateToken(tokenString)
 	if err != nil {
-		log.Printf("Token revocation failed: invalid token - %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid token",
-		})
+		log.Printf("Token revocation skipped: invalid token - %v", err)
+		respondTokenInvalid(c)
 		return
 	}
+	logHintMismatch(req.TokenTypeHint, claims)
+	
+	// Clients may only revoke their own tokens (RFC 7009 section 2.1); tokens issued without a
+	// client only by the clients explicitly trusted with them
+	if !mayRevoke(client.ClientId, claims) {
+		log.Printf("Token revocation rejected: token of client '%s' presented by %s", claims.ClientId, client.ClientId)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unauthorized_client", "error_description": "token was not issued to this client"})
+		return
+	}
+	
+	// Reference tokens only live server-side, deleting them is enough for the handle itself
+	if tokenString != req.Token {
+		if err := referenceService.Revoke(req.Token); err != nil && !errors.Is(err, referenceService.ErrReferenceNotFound) {
+			log.Printf("Token revocation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token revocation failed"})
+			return
+		}
+	}
 	
 	// Check if token is already blacklisted
 	if token.GlobalBlacklist.IsBlacklisted(claims.ID) {
@@ -82,14 +142,94 @@ func RevokeToken(c *gin.Context) {
 		return
 	}
 	
-	// Add token to blacklist
-	expiresAt := time.Unix(claims.ExpiresAt.Unix(), 0)
-	token.GlobalBlacklist.Add(claims.ID, expiresAt)
+	// Revoking a refresh token ends its grant, including the access tokens issued with it
+	if claims.TokenType == "refresh" {
+		if err := revokeRefreshTokenGrant(claims, client.ClientId); err != nil {
+			log.Printf("Token revocation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token revocation failed"})
+			return
+		}
+	}
+	
+	// Add token to blacklist, unless revoking its grant already did
+	if !token.GlobalBlacklist.IsBlacklisted(claims.ID) {
+		expiresAt := time.Unix(claims.ExpiresAt.Unix(), 0)
+		err = token.GlobalBlacklist.Revoke(token.BlacklistEntry{
+			JTI:       claims.ID,
+			ExpiresAt: expiresAt,
+			UserId:    claims.UserId,
+			Reason:    token.REASON_REVOKED,
+			RevokedBy: client.ClientId,
+		})
+		if err != nil {
+			log.Printf("Token revocation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Token revocation failed",
+			})
+			return
+		}
+	}
 	
-	log.Printf("Token revoked successfully (JTI: %s, User: %s)", claims.ID, claims.Subject)
+	log.Printf("Token revoked successfully (JTI: %s, User: %s, Client: %s)", claims.ID, claims.Subject, client.ClientId)
 	
 	c.JSON(http.StatusOK, RevokeTokenResponse{
 		Success: true,
 		Message: "Token revoked successfully",
 	})
 }
+
+// revokeRefreshTokenGrant revokes the grant a refresh token belongs to: its session or, for
+// refresh tokens without a session, its refresh token family. Every access and refresh token of
+// the grant is blacklisted. Untracked refresh tokens are only blacklisted by the caller.
+func revokeRefreshTokenGrant(claims *jwt.TokenClaims, revokedBy string) error {
+	stored := refreshService.GetRefreshToken(claims.ID)
+	if stored == nil {
+		return nil
+	}
+	err := sessionService.RevokeSession(stored.FamilyId, revokedBy)
+	if errors.Is(err, sessionService.ErrSessionNotFound) {
+		return refreshService.RevokeFamily(stored.FamilyId, token.REASON_REVOKED, revokedBy)
+	}
+	if errors.Is(err, sessionService.ErrSessionRevoked) {
+		return nil
+	}
+	return err
+}
+
+// mayRevoke reports whether a client may revoke a token: tokens issued to the client itself, and
+// tokens issued without a client (e.g. by /users/login) when the client is one of REVOCATION_CLIENTS.
+func mayRevoke(clientId string, claims *jwt.TokenClaims) bool {
+	if claims.ClientId == "" {
+		return slices.Contains(REVOCATION_CLIENTS, clientId)
+	}
+	return claims.ClientId == clientId
+}
+
+// respondTokenInvalid answers a revocation request for a token that is invalid, expired or
+// unknown with 200 OK, as RFC 7009 section 2.2 requires.
+func respondTokenInvalid(c *gin.Context) {
+	c.JSON(http.StatusOK, RevokeTokenResponse{
+		Success: true,
+		Message: "Token is invalid or expired, nothing to revoke",
+	})
+}
+
+// getRevocationClients retrieves the clients allowed to revoke tokens issued without a client,
+// such as the tokens of /users/login, from the AEGIS_REVOCATION_CLIENTS environment variable,
+// a comma-separated list of client IDs. Defaults to none.
+//
+// Returns:
+//   - The IDs of the clients
+func getRevocationClients() []string {
+	const REVOCATION_CLIENTS_ENV = "AEGIS_REVOCATION_CLIENTS"
+	clients := []string{}
+	for _, clientId := range strings.Split(os.Getenv(REVOCATION_CLIENTS_ENV), ",") {
+		if clientId = strings.TrimSpace(clientId); clientId != "" {
+			clients = append(clients, clientId)
+		}
+	}
+	if len(clients) > 0 {
+		log.Printf("Clients allowed to revoke tokens issued without a client: %v", clients)
+	}
+	return clients
+}
@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	clientService "nfcunha/aegis/domain/client"
+	refreshService "nfcunha/aegis/domain/refresh"
 	"nfcunha/aegis/domain/token"
 	"nfcunha/aegis/util/jwt"
 )
@@ -35,6 +39,7 @@ func TestRevokeToken_Success(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
@@ -86,6 +91,7 @@ func TestRevokeToken_AlreadyRevoked(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
@@ -125,23 +131,24 @@ func TestRevokeToken_InvalidToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
 	RevokeToken(c)
 
-	// Assert response
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	// Assert response - invalid tokens are not an error (RFC 7009 section 2.2)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var response map[string]string
+	var response RevokeTokenResponse
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Fatalf("Failed to parse response: %v", err)
 	}
 
-	if response["error"] != "Invalid token" {
-		t.Errorf("Expected 'Invalid token' error, got %s", response["error"])
+	if !response.Success || bl.Size() != 0 {
+		t.Errorf("Expected nothing to be revoked, got %+v", response)
 	}
 }
 
@@ -158,6 +165,7 @@ func TestRevokeToken_MissingToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
@@ -189,6 +197,7 @@ func TestRevokeToken_BlacklistUnavailable(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
@@ -228,14 +237,15 @@ func TestRevokeToken_ExpiredToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
 	RevokeToken(c)
 
-	// Assert response - should fail validation
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400 for expired token, got %d", w.Code)
+	// Assert response - expired tokens need no revocation (RFC 7009 section 2.2)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for expired token, got %d", w.Code)
 	}
 }
 
@@ -249,6 +259,7 @@ func TestRevokeToken_InvalidJSON(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer([]byte("{invalid json")))
+	authenticateClient(c.Request)
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Call handler
@@ -281,6 +292,7 @@ func TestRevokeToken_MultipleRevocations(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
 		c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", bytes.NewBuffer(jsonBody))
+		authenticateClient(c.Request)
 		c.Request.Header.Set("Content-Type", "application/json")
 
 		RevokeToken(c)
@@ -302,3 +314,120 @@ func TestRevokeToken_MultipleRevocations(t *testing.T) {
 		}
 	}
 }
+
+// revokeForm calls the revocation handler with a form-urlencoded body, as RFC 7009 clients do
+func revokeForm(form url.Values, authenticate bool) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/aegis/api/auth/revoke", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authenticate {
+		authenticateClient(c.Request)
+	}
+	RevokeToken(c)
+	return w
+}
+
+func TestRevokeToken_FormEncoded(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "form@example.com", []string{}, []string{})
+
+	// client_secret_post
+	form := url.Values{"token": {tokenPair.AccessToken}, "token_type_hint": {"access_token"}, "client_id": {testClient.ClientId}, "client_secret": {testClientSecret}}
+	if w := revokeForm(form, false); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bl.IsBlacklisted(tokenPair.AccessTokenId) {
+		t.Error("Expected token to be blacklisted after revocation")
+	}
+}
+
+func TestRevokeToken_ClientAuthentication(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "anonymous@example.com", []string{}, []string{})
+
+	w := revokeForm(url.Values{"token": {tokenPair.AccessToken}}, false)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without client authentication, got %d", w.Code)
+	}
+	form := url.Values{"token": {tokenPair.AccessToken}, "client_id": {testClient.ClientId}, "client_secret": {"wrong-secret"}}
+	if w := revokeForm(form, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with a wrong secret, got %d", w.Code)
+	}
+	if bl.Size() != 0 {
+		t.Errorf("Expected no revocation, got %d blacklisted tokens", bl.Size())
+	}
+}
+
+func TestRevokeToken_OtherClient(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	options := jwt.TokenOptions{ClientId: "other-client"}
+	tokenPair, _ := jwt.GenerateTokenPairWithOptions(uuid.New(), "other@example.com", []string{}, []string{}, options)
+
+	w := revokeForm(url.Values{"token": {tokenPair.AccessToken}}, true)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unauthorized_client") {
+		t.Errorf("Expected status 400 with unauthorized_client, got %d: %s", w.Code, w.Body.String())
+	}
+	if bl.IsBlacklisted(tokenPair.AccessTokenId) {
+		t.Error("Expected the token of another client to remain valid")
+	}
+}
+
+func TestRevokeToken_ClientlessToken(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	other := clientService.CreateClient("Other App", nil, "system")
+	otherSecret, _ := other.GenerateSecret("system")
+	clientService.SaveClient(other)
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "clientless@example.com", []string{}, []string{})
+
+	// Only the clients trusted with tokens issued without a client can revoke them
+	form := url.Values{"token": {tokenPair.AccessToken}, "client_id": {other.ClientId}, "client_secret": {otherSecret}}
+	if w := revokeForm(form, false); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unauthorized_client") {
+		t.Errorf("Expected status 400 with unauthorized_client, got %d: %s", w.Code, w.Body.String())
+	}
+	if bl.IsBlacklisted(tokenPair.AccessTokenId) {
+		t.Error("Expected the token to remain valid")
+	}
+
+	if w := revokeForm(url.Values{"token": {tokenPair.AccessToken}}, true); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a trusted client, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bl.IsBlacklisted(tokenPair.AccessTokenId) {
+		t.Error("Expected the token to be blacklisted")
+	}
+}
+
+func TestRevokeToken_RefreshToken(t *testing.T) {
+	bl := token.NewMemoryBlacklist()
+	token.InitializeBlacklist(bl)
+	defer func() { token.GlobalBlacklist = nil }()
+
+	userId := uuid.New()
+	tokenPair, _ := jwt.GenerateTokenPair(userId, "refresh@example.com", []string{}, []string{})
+	refreshService.StartFamily(uuid.New().String(), userId, "", tokenPair)
+
+	w := revokeForm(url.Values{"token": {tokenPair.RefreshToken}, "token_type_hint": {"refresh_token"}}, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The access token issued with the refresh token is revoked with it
+	if !bl.IsBlacklisted(tokenPair.RefreshTokenId) || !bl.IsBlacklisted(tokenPair.AccessTokenId) {
+		t.Error("Expected the refresh token and its access token to be blacklisted")
+	}
+	if stored := refreshService.GetRefreshToken(tokenPair.RefreshTokenId); stored == nil || stored.IsActive() {
+		t.Error("Expected the refresh token to be revoked server-side")
+	}
+}
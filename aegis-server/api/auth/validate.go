@@ -3,19 +3,26 @@
 package auth
 
 import (
+	"errors"
 	"log"
 	"net/http"
-	"nfcunha/aegis/domain/token"
 	"strings"
 	"time"
 	"github.com/gin-gonic/gin"
-	"nfcunha/aegis/util/jwt"
 )
 
 // ValidateTokenRequest represents the request body for token validation endpoint.
-// It contains the JWT token string that needs to be validated.
+// It contains the JWT token string that needs to be validated and, optionally,
+// the audience the caller expects the token to be issued for. Resource servers receiving
+// a DPoP-bound token also pass the DPoP proof and the method and URL of the request it came with,
+// and those receiving a certificate-bound token the thumbprint of the client's certificate.
 type ValidateTokenRequest struct {
-	Token string `json:"token" binding:"required"`
+	Token          string `json:"token" binding:"required"`
+	Audience       string `json:"audience,omitempty"`
+	DPoPProof      string `json:"dpop_proof,omitempty"`
+	HttpMethod     string `json:"http_method,omitempty"`
+	HttpUrl        string `json:"http_url,omitempty"`
+	CertThumbprint string `json:"cert_thumbprint,omitempty"`
 }
 
 // ValidateTokenResponse represents the response structure for token validation.
@@ -35,6 +42,7 @@ type UserInfo struct {
 	Subject     string   `json:"subject"`
 	Roles       []string `json:"roles"`
 	Permissions []string `json:"permissions"`
+	Audience    []string `json:"audience,omitempty"`
 }
 
 // ValidateToken is an HTTP handler that validates JWT tokens and returns user claims.
@@ -44,6 +52,11 @@ type UserInfo struct {
 //
 // Request Body:
 //   - token: The JWT token string to validate (required)
+//   - audience: Expected audience; tokens not issued for it are invalid (optional)
+//   - dpop_proof, http_method, http_url: The DPoP proof and the request it was sent with;
+//     required for DPoP-bound tokens, whose proof must be signed with the bound key
+//   - cert_thumbprint: The "x5t#S256" thumbprint (base64url SHA-256 of the DER encoding) of the
+//     client certificate the token was presented with; required for certificate-bound tokens
 //
 // Response (200 OK):
 //   - For valid tokens: Returns valid=true with user claims and expiration
@@ -63,31 +76,38 @@ func ValidateToken(c *gin.Context) {
 		return
 	}
 
-	// Validate the token using JWT utility
-	claims, err := jwt.ValidateToken(req.Token)
+	c.JSON(http.StatusOK, validateToken(req, isBlacklisted))
+}
+
+// validateToken validates a single token for ValidateToken and ValidateTokenBatch.
+//
+// Parameters:
+//   - req: The validation request
+//   - isBlacklisted: Looks up whether a token ID is revoked
+//
+// Returns:
+//   - The validation result; invalid or revoked tokens yield valid=false with an error description
+func validateToken(req ValidateTokenRequest, isBlacklisted func(jti string) bool) ValidateTokenResponse {
+	// Validate the token, check the blacklist and the expected audience
+	claims, err := verifyTokenForAudience(req.Token, req.Audience, isBlacklisted)
+	
+	// Bound tokens are only valid in the hands of the holder of the bound key or certificate
+	if err == nil {
+		err = VerifyDPoPBinding(claims, req.Token, req.DPoPProof, req.HttpMethod, req.HttpUrl)
+	}
+	if err == nil {
+		err = VerifyCertificateBinding(claims, req.CertThumbprint)
+	}
 	
-	// Handle validation errors - return 200 with valid=false for invalid tokens
+	// Handle validation errors - valid=false for invalid or revoked tokens
 	if err != nil {
 		log.Printf("Token validation failed: %v", err)
 		
 		// Determine error type for more descriptive messages
-		errorMessage := determineValidationError(err)
-		
-		c.JSON(http.StatusOK, ValidateTokenResponse{
+		return ValidateTokenResponse{
 			Valid: false,
-			Error: errorMessage,
-		})
-		return
-	}
-
-	// Check if token is blacklisted (revoked)
-	if token.GlobalBlacklist != nil && token.GlobalBlacklist.IsBlacklisted(claims.ID) {
-		log.Printf("Token is blacklisted (revoked): JTI=%s, User=%s", claims.ID, claims.Subject)
-		c.JSON(http.StatusOK, ValidateTokenResponse{
-			Valid: false,
-			Error: "token revoked",
-		})
-		return
+			Error: determineValidationError(err),
+		}
 	}
 
 	// Token is valid - return user claims and expiration
@@ -96,16 +116,17 @@ func ValidateToken(c *gin.Context) {
 	// Extract expiration time from claims
 	expiresAt := claims.ExpiresAt.Time
 	
-	c.JSON(http.StatusOK, ValidateTokenResponse{
+	return ValidateTokenResponse{
 		Valid: true,
 		User: &UserInfo{
 			ID:          claims.UserId,
 			Subject:     claims.Subject,
 			Roles:       claims.Roles,
 			Permissions: claims.Permissions,
+			Audience:    claims.Audience,
 		},
 		ExpiresAt: &expiresAt,
-	})
+	}
 }
 
 // determineValidationError analyzes the validation error and returns a user-friendly message.
@@ -121,6 +142,16 @@ func determineValidationError(err error) string {
 	
 	// Check for common JWT validation errors using strings package
 	switch {
+	case errors.Is(err, ErrTokenRevoked):
+		return "token revoked"
+	case errors.Is(err, ErrTokenStale):
+		return "token stale"
+	case errors.Is(err, ErrInvalidAudience):
+		return "invalid audience"
+	case errors.Is(err, ErrInvalidDPoPProof):
+		return "invalid DPoP proof"
+	case errors.Is(err, ErrInvalidCertificateBinding):
+		return "invalid client certificate"
 	case strings.Contains(errMsg, "expired"):
 		return "token expired"
 	case strings.Contains(errMsg, "signature"):
@@ -142,8 +173,15 @@ func determineValidationError(err error) string {
 //
 // Public endpoints (under /aegis context path):
 //   - POST /api/auth/validate - Validates a JWT token and returns user claims
-//   - POST /api/auth/introspect - OAuth2-compliant token introspection (RFC 7662)
-//   - POST /api/auth/revoke - Revokes a JWT token by adding it to the blacklist
+//   - POST /api/auth/validate/batch - Validates several tokens at once for API gateways
+//
+// Client-authenticated endpoints (client_secret_basic or client_secret_post):
+//   - POST /api/auth/introspect - OAuth2-compliant token introspection (RFC 7662), confidential clients only
+//   - POST /api/auth/revoke - OAuth2-compliant token revocation (RFC 7009)
+//
+// Authenticated endpoints (bearer access token):
+//   - GET /api/auth/revocations - Lists revoked tokens for offline verifiers
+//   - GET /api/auth/forward - Forward authentication for reverse proxies, also with the token in a cookie
 //
 // Parameters:
 //   - router: The Gin RouterGroup to register routes with (already under /aegis)
@@ -151,7 +189,10 @@ func RegisterApi(router gin.IRouter) {
 	auth := router.Group("/api/auth")
 	{
 		auth.POST("/validate", ValidateToken)
+		auth.POST("/validate/batch", ValidateTokenBatch)
 		auth.POST("/introspect", IntrospectToken)
 		auth.POST("/revoke", RevokeToken)
+		auth.GET("/revocations", RequireBearerToken(), ListRevocations)
+		auth.Any("/forward", ForwardAuth)
 	}
 }
@@ -12,9 +12,41 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	userService "nfcunha/aegis/domain/user"
 	jwtUtil "nfcunha/aegis/util/jwt"
 )
 
+// testClient is the confidential client that authenticates introspection and revocation requests
+var testClient *clientService.Client
+var testClientSecret string
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	// Tokens in these tests belong to users that are not stored, which would count as deleted
+	userService.TOKEN_POLICIES[userService.EVENT_USER_DELETED] = userService.TOKEN_POLICY_NONE
+
+	testClient = clientService.CreateClient("API Gateway", nil, "system")
+	testClientSecret, _ = testClient.GenerateSecret("system")
+	clientService.SaveClient(testClient)
+	// Most tests revoke tokens issued without a client
+	REVOCATION_CLIENTS = []string{testClient.ClientId}
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// authenticateClient adds the test client's credentials to a request with HTTP Basic authentication
+func authenticateClient(req *http.Request) {
+	req.SetBasicAuth(testClient.ClientId, testClientSecret)
+}
+
 // setupRouter creates a test router with the auth API registered
 func setupRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
@@ -515,6 +547,46 @@ func TestValidateToken_ConcurrentRequests(t *testing.T) {
 	}
 }
 
+// TestValidateToken_Audience tests that tokens are only valid for the expected audience when one is given
+// Expected: Matching or omitted audience is valid, mismatching or missing "aud" claim is invalid
+func TestValidateToken_Audience(t *testing.T) {
+	router := setupRouter()
+	
+	billing, _ := jwtUtil.GenerateTokenPairWithOptions(uuid.New(), "test@example.com", []string{}, []string{}, jwtUtil.TokenOptions{Audience: []string{"billing"}})
+	noAudience, _ := jwtUtil.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	
+	cases := []struct {
+		name          string
+		token         string
+		audience      string
+		expectedValid bool
+	}{
+		{"matching audience", billing.AccessToken, "billing", true},
+		{"no expected audience", billing.AccessToken, "", true},
+		{"other audience", billing.AccessToken, "orders", false},
+		{"token without audience", noAudience.AccessToken, "billing", false},
+	}
+	
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(ValidateTokenRequest{Token: tc.token, Audience: tc.audience})
+			req, _ := http.NewRequest("POST", "/aegis/api/auth/validate", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			
+			var response ValidateTokenResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if response.Valid != tc.expectedValid {
+				t.Fatalf("Expected valid=%v, got %v. Body: %s", tc.expectedValid, response.Valid, w.Body.String())
+			}
+			if !tc.expectedValid && response.Error != "invalid audience" {
+				t.Errorf("Expected error 'invalid audience', got '%s'", response.Error)
+			}
+		})
+	}
+}
+
 // TestDetermineValidationError tests the error message determination logic
 func TestDetermineValidationError(t *testing.T) {
 	tests := []struct {
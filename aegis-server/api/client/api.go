@@ -0,0 +1,263 @@
+// Package client provides HTTP REST API endpoints for OAuth 2.0 client registration.
+// Supports creating, listing, retrieving, updating and deleting clients, and rotating client secrets.
+package client
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"github.com/gin-gonic/gin"
+	clientService "nfcunha/aegis/domain/client"
+	"nfcunha/aegis/util/jwt"
+)
+
+type CreateClientRequest struct {
+	Name                 string             `json:"name" binding:"required"`
+	Confidential         bool               `json:"confidential"`
+	RedirectUris         []string           `json:"redirect_uris"`
+	GrantTypes           []string           `json:"grant_types"`
+	Scopes               []string           `json:"scopes"`
+	ExchangeAudiences    []string           `json:"exchange_audiences"`
+	TokenFormat          string             `json:"token_format"`   // "jwt" or "reference", empty for the server default
+	ClaimMappings        []jwt.ClaimMapping `json:"claim_mappings"` // User attributes copied into tokens, omitted for the server default
+	AccessTokenLifetime  int                `json:"access_token_lifetime"`
+	RefreshTokenLifetime int                `json:"refresh_token_lifetime"`
+}
+
+type UpdateClientRequest struct {
+	Name                 string             `json:"name"`
+	RedirectUris         []string           `json:"redirect_uris"`
+	GrantTypes           []string           `json:"grant_types"`
+	Scopes               []string           `json:"scopes"`
+	ExchangeAudiences    []string           `json:"exchange_audiences"`
+	TokenFormat          string             `json:"token_format"`   // "jwt" or "reference", empty for the server default
+	ClaimMappings        []jwt.ClaimMapping `json:"claim_mappings"` // User attributes copied into tokens, omitted for the server default
+	AccessTokenLifetime  int                `json:"access_token_lifetime"`
+	RefreshTokenLifetime int                `json:"refresh_token_lifetime"`
+}
+
+type ClientResponse struct {
+	ClientId             string             `json:"client_id"`
+	ClientSecret         string             `json:"client_secret,omitempty"` // Only returned when the secret is generated
+	Name                 string             `json:"name"`
+	Confidential         bool               `json:"confidential"`
+	RedirectUris         []string           `json:"redirect_uris"`
+	GrantTypes           []string           `json:"grant_types"`
+	Scopes               []string           `json:"scopes"`
+	ExchangeAudiences    []string           `json:"exchange_audiences"`
+	TokenFormat          string             `json:"token_format"`
+	ClaimMappings        []jwt.ClaimMapping `json:"claim_mappings"`         // null when the server default applies
+	AccessTokenLifetime  int                `json:"access_token_lifetime"`  // Seconds, 0 for the server default
+	RefreshTokenLifetime int                `json:"refresh_token_lifetime"` // Seconds, 0 for the server default
+	CreatedAt            time.Time          `json:"created_at"`
+	CreatedBy            string             `json:"created_by"`
+	UpdatedAt            time.Time          `json:"updated_at"`
+	UpdatedBy            string             `json:"updated_by"`
+}
+
+// RegisterApi registers all client-related HTTP routes with the Gin router.
+// Endpoints include create, list, get, update, delete and secret rotation.
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	clients := router.Group("/clients")
+	{
+		clients.POST("", createClient)
+		clients.GET("", listClients)
+		clients.GET("/:id", getClient)
+		clients.PUT("/:id", updateClient)
+		clients.DELETE("/:id", deleteClient)
+		clients.POST("/:id/secret", rotateClientSecret)
+	}
+}
+
+func createClient(c *gin.Context) {
+	log.Println("POST /aegis/clients - Create client request received")
+	var req CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client := clientService.CreateClient(req.Name, req.RedirectUris, "system")
+	grantTypes := client.GrantTypes
+	if len(req.GrantTypes) > 0 {
+		grantTypes = req.GrantTypes
+	}
+	scopes := client.Scopes
+	if req.Scopes != nil {
+		scopes = req.Scopes
+	}
+	client.Update(req.Name, req.RedirectUris, grantTypes, scopes, seconds(req.AccessTokenLifetime), seconds(req.RefreshTokenLifetime), "system")
+	client.ExchangeAudiences = req.ExchangeAudiences
+	client.TokenFormat = req.TokenFormat
+	client.ClaimMappings = req.ClaimMappings
+
+	var secret string
+	if req.Confidential {
+		var err error
+		if secret, err = client.GenerateSecret("system"); err != nil {
+			log.Printf("Error generating client secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate client secret"})
+			return
+		}
+	}
+
+	if err := client.Validate(); err != nil {
+		log.Printf("Invalid client: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := clientService.SaveClient(client); err != nil {
+		log.Printf("Error saving client: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save client"})
+		return
+	}
+
+	log.Printf("Client registered successfully: %s", client.ClientId)
+	response := toClientResponse(client)
+	response.ClientSecret = secret
+	c.JSON(http.StatusCreated, response)
+}
+
+func listClients(c *gin.Context) {
+	log.Println("GET /aegis/clients - List clients request received")
+	clients := clientService.ListClients()
+	response := make([]ClientResponse, len(clients))
+	for i, client := range clients {
+		response[i] = toClientResponse(client)
+	}
+	log.Printf("Returning %d clients", len(response))
+	c.JSON(http.StatusOK, response)
+}
+
+func getClient(c *gin.Context) {
+	clientId := c.Param("id")
+	log.Printf("GET /aegis/clients/%s - Get client request received", clientId)
+	client := clientService.GetClientById(clientId)
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+	c.JSON(http.StatusOK, toClientResponse(client))
+}
+
+func updateClient(c *gin.Context) {
+	clientId := c.Param("id")
+	log.Printf("PUT /aegis/clients/%s - Update client request received", clientId)
+	client := clientService.GetClientById(clientId)
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+
+	var req UpdateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update name if provided
+	name := client.Name
+	if req.Name != "" {
+		name = req.Name
+	}
+
+	client.Update(name, req.RedirectUris, req.GrantTypes, req.Scopes, seconds(req.AccessTokenLifetime), seconds(req.RefreshTokenLifetime), "system")
+	client.ExchangeAudiences = req.ExchangeAudiences
+	client.TokenFormat = req.TokenFormat
+	client.ClaimMappings = req.ClaimMappings
+	if err := client.Validate(); err != nil {
+		log.Printf("Invalid client: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := clientService.UpdateClient(client); err != nil {
+		log.Printf("Error updating client: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update client"})
+		return
+	}
+
+	log.Printf("Client updated successfully: %s", client.ClientId)
+	c.JSON(http.StatusOK, toClientResponse(client))
+}
+
+func deleteClient(c *gin.Context) {
+	clientId := c.Param("id")
+	log.Printf("DELETE /aegis/clients/%s - Delete client request received", clientId)
+	if clientService.GetClientById(clientId) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+
+	if err := clientService.DeleteClient(clientId); err != nil {
+		log.Printf("Error deleting client: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete client"})
+		return
+	}
+
+	log.Printf("Client deleted successfully: %s", clientId)
+	c.Status(http.StatusNoContent)
+}
+
+// rotateClientSecret generates a new secret for the client, invalidating the previous one.
+// A public client becomes confidential.
+func rotateClientSecret(c *gin.Context) {
+	clientId := c.Param("id")
+	log.Printf("POST /aegis/clients/%s/secret - Rotate client secret request received", clientId)
+	client := clientService.GetClientById(clientId)
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+
+	secret, err := client.GenerateSecret("system")
+	if err == nil {
+		err = clientService.UpdateClient(client)
+	}
+	if err != nil {
+		log.Printf("Error rotating client secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate client secret"})
+		return
+	}
+
+	log.Printf("Client secret rotated: %s", client.ClientId)
+	response := toClientResponse(client)
+	response.ClientSecret = secret
+	c.JSON(http.StatusOK, response)
+}
+
+func toClientResponse(client *clientService.Client) ClientResponse {
+	return ClientResponse{
+		ClientId:             client.ClientId,
+		Name:                 client.Name,
+		Confidential:         client.IsConfidential(),
+		RedirectUris:         nonNil(client.RedirectUris),
+		GrantTypes:           nonNil(client.GrantTypes),
+		Scopes:               nonNil(client.Scopes),
+		ExchangeAudiences:    nonNil(client.ExchangeAudiences),
+		TokenFormat:          client.TokenFormat,
+		ClaimMappings:        client.ClaimMappings,
+		AccessTokenLifetime:  int(client.AccessTokenLifetime.Seconds()),
+		RefreshTokenLifetime: int(client.RefreshTokenLifetime.Seconds()),
+		CreatedAt:            client.CreatedAt,
+		CreatedBy:            client.CreatedBy,
+		UpdatedAt:            client.UpdatedAt,
+		UpdatedBy:            client.UpdatedBy,
+	}
+}
+
+// seconds converts a lifetime in seconds from a request into a duration.
+func seconds(value int) time.Duration {
+	return time.Duration(value) * time.Second
+}
+
+// nonNil returns an empty slice instead of nil, so lists are serialized as [] rather than null.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
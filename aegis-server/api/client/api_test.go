@@ -0,0 +1,194 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+)
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	aegis := router.Group("/aegis")
+	RegisterApi(aegis)
+	return router
+}
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// sendJSON sends a request with a JSON body
+func sendJSON(router *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestCreateClient_Public tests registering a public client for the authorization code flow
+func TestCreateClient_Public(t *testing.T) {
+	router := setupRouter()
+	w := sendJSON(router, "POST", "/aegis/clients", CreateClientRequest{
+		Name:         "Web App",
+		RedirectUris: []string{"https://app.example.com/callback"},
+	})
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response ClientResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.ClientId == "" {
+		t.Error("Expected client_id to be generated")
+	}
+	if response.Confidential || response.ClientSecret != "" {
+		t.Error("Public client should not have a secret")
+	}
+	if len(response.GrantTypes) != 1 || response.GrantTypes[0] != clientService.GRANT_AUTHORIZATION_CODE {
+		t.Errorf("Expected default grant types, got %v", response.GrantTypes)
+	}
+}
+
+// TestCreateClient_Confidential tests that the secret is returned once and stored hashed
+func TestCreateClient_Confidential(t *testing.T) {
+	router := setupRouter()
+	w := sendJSON(router, "POST", "/aegis/clients", CreateClientRequest{
+		Name:                "Billing Service",
+		Confidential:        true,
+		GrantTypes:          []string{clientService.GRANT_CLIENT_CREDENTIALS},
+		Scopes:              []string{"read:users"},
+		AccessTokenLifetime: 300,
+	})
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response ClientResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.ClientSecret == "" || !response.Confidential {
+		t.Fatal("Expected client secret in creation response")
+	}
+	if response.AccessTokenLifetime != 300 {
+		t.Errorf("Expected access token lifetime 300, got %d", response.AccessTokenLifetime)
+	}
+
+	stored := clientService.GetClientById(response.ClientId)
+	if stored == nil || !stored.SecretMatch(response.ClientSecret) {
+		t.Error("Stored client should verify the returned secret")
+	}
+
+	getReq, _ := http.NewRequest("GET", "/aegis/clients/"+response.ClientId, nil)
+	getW := httptest.NewRecorder()
+	router.ServeHTTP(getW, getReq)
+	if bytes.Contains(getW.Body.Bytes(), []byte(response.ClientSecret)) {
+		t.Error("Secret should not be returned after creation")
+	}
+}
+
+// TestCreateClient_Invalid tests that inconsistent configurations are rejected
+func TestCreateClient_Invalid(t *testing.T) {
+	router := setupRouter()
+	cases := []CreateClientRequest{
+		{Name: "No Redirect"},
+		{Name: "Bad Redirect", RedirectUris: []string{"/callback"}},
+		{Name: "Public Machine", GrantTypes: []string{clientService.GRANT_CLIENT_CREDENTIALS}},
+	}
+	for _, req := range cases {
+		w := sendJSON(router, "POST", "/aegis/clients", req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", req.Name, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// TestUpdateClient tests replacing a client's configuration
+func TestUpdateClient(t *testing.T) {
+	client := clientService.CreateClient("Old Name", []string{"https://app.example.com/callback"}, "system")
+	clientService.SaveClient(client)
+
+	router := setupRouter()
+	w := sendJSON(router, "PUT", "/aegis/clients/"+client.ClientId, UpdateClientRequest{
+		Name:         "New Name",
+		RedirectUris: []string{"https://new.example.com/callback"},
+		GrantTypes:   []string{clientService.GRANT_AUTHORIZATION_CODE},
+		Scopes:       []string{"openid"},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	stored := clientService.GetClientById(client.ClientId)
+	if stored.Name != "New Name" || !stored.HasRedirectUri("https://new.example.com/callback") {
+		t.Errorf("Client not updated: %+v", stored)
+	}
+}
+
+// TestDeleteClient tests client deletion
+func TestDeleteClient(t *testing.T) {
+	client := clientService.CreateClient("Doomed", []string{"https://app.example.com/callback"}, "system")
+	clientService.SaveClient(client)
+
+	router := setupRouter()
+	req, _ := http.NewRequest("DELETE", "/aegis/clients/"+client.ClientId, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if clientService.GetClientById(client.ClientId) != nil {
+		t.Error("Client should be deleted")
+	}
+}
+
+// TestRotateClientSecret tests that rotation replaces the secret
+func TestRotateClientSecret(t *testing.T) {
+	client := clientService.CreateClient("Service", []string{"https://app.example.com/callback"}, "system")
+	oldSecret, _ := client.GenerateSecret("system")
+	clientService.SaveClient(client)
+
+	router := setupRouter()
+	w := sendJSON(router, "POST", "/aegis/clients/"+client.ClientId+"/secret", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response ClientResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	stored := clientService.GetClientById(client.ClientId)
+	if stored.SecretMatch(oldSecret) {
+		t.Error("Old secret should no longer match")
+	}
+	if !stored.SecretMatch(response.ClientSecret) {
+		t.Error("New secret should match")
+	}
+}
+
+// TestGetClient_NotFound tests retrieving an unknown client
+func TestGetClient_NotFound(t *testing.T) {
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/clients/unknown", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
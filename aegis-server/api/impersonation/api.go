@@ -0,0 +1,222 @@
+// Package impersonation provides HTTP REST API endpoints for administrator impersonation.
+// Administrators obtain short-lived tokens for other users instead of asking for their passwords;
+// every session is recorded and can be listed for auditing.
+package impersonation
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
+	impersonationService "nfcunha/aegis/domain/impersonation"
+	referenceService "nfcunha/aegis/domain/reference"
+	"nfcunha/aegis/domain/token"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+type StartImpersonationRequest struct {
+	UserId string `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type SessionResponse struct {
+	Id           string     `json:"id"`
+	AdminId      string     `json:"admin_id"`
+	AdminSubject string     `json:"admin_subject"`
+	UserId       string     `json:"user_id"`
+	UserSubject  string     `json:"user_subject"`
+	Reason       string     `json:"reason"`
+	StartedAt    time.Time  `json:"started_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	EndedBy      string     `json:"ended_by,omitempty"`
+	EndReason    string     `json:"end_reason,omitempty"`
+	Active       bool       `json:"active"`
+}
+
+type StartImpersonationResponse struct {
+	Session     SessionResponse `json:"session"`
+	AccessToken string          `json:"access_token"`
+	TokenType   string          `json:"token_type"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// RegisterApi registers the impersonation routes with the Gin router.
+// Starting and listing sessions requires a bearer token with the impersonation role;
+// a session can be ended by such an administrator or with the session's own token.
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	sessions := router.Group("/impersonation/sessions", auth.RequireBearerToken())
+	{
+		sessions.POST("", auth.RequireRole(impersonationService.IMPERSONATION_ROLE), startImpersonation)
+		sessions.GET("", auth.RequireRole(impersonationService.IMPERSONATION_ROLE), listSessions)
+		sessions.DELETE("/:id", endImpersonation)
+	}
+}
+
+// startImpersonation issues an impersonation token for the target user and records the session.
+// The token carries the user's current roles and permissions, an "act" claim naming the
+// administrator and the "impersonated" claim. It cannot be refreshed. With AEGIS_TOKEN_FORMAT
+// set to "reference", an opaque handle is returned instead of the JWT.
+func startImpersonation(c *gin.Context) {
+	log.Println("POST /aegis/impersonation/sessions - Start impersonation request received")
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := auth.GetClaims(c)
+	adminId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		// Client credentials tokens have no user
+		c.JSON(http.StatusForbidden, gin.H{"error": "user token required"})
+		return
+	}
+	userId, err := uuid.Parse(req.UserId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	if userId == adminId {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot impersonate yourself"})
+		return
+	}
+
+	user := userService.GetUserById(userId)
+	if user == nil {
+		log.Printf("User not found: %s", req.UserId)
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = string(role)
+	}
+	permissions := make([]string, len(user.Permissions))
+	for i, permission := range user.Permissions {
+		permissions[i] = string(permission)
+	}
+
+	impersonationToken, err := jwt.GenerateAccessToken(user.Id, user.Subject, roles, permissions, jwt.TokenOptions{
+		AccessTokenLifetime: impersonationService.IMPERSONATION_TTL,
+		AuthzVersion:        user.AuthzVersion,
+		Actor:               &jwt.Actor{Subject: adminId.String()},
+		Impersonated:        true,
+	})
+	if err == nil && referenceService.FormatFor("") == referenceService.TOKEN_FORMAT_REFERENCE {
+		err = referenceService.IssueToken(impersonationToken)
+	}
+	if err != nil {
+		log.Printf("Error generating impersonation token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	session := impersonationService.CreateSession(impersonationToken.Id, adminId, claims.Subject, user.Id, user.Subject, req.Reason, impersonationToken.ExpiresAt)
+	if err := impersonationService.StartSession(session); err != nil {
+		// The token is not returned, so an unrecorded impersonation cannot happen
+		log.Printf("Error recording impersonation session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start impersonation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, StartImpersonationResponse{
+		Session:     toSessionResponse(session),
+		AccessToken: impersonationToken.Token,
+		TokenType:   "Bearer",
+		ExpiresAt:   impersonationToken.ExpiresAt,
+	})
+}
+
+func listSessions(c *gin.Context) {
+	log.Println("GET /aegis/impersonation/sessions - List impersonation sessions request received")
+	sessions := impersonationService.ListSessions()
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = toSessionResponse(session)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// endImpersonation ends a session before its token expires and revokes the token.
+// Allowed with the session's own token, or for an administrator with the impersonation role.
+func endImpersonation(c *gin.Context) {
+	id := c.Param("id")
+	log.Printf("DELETE /aegis/impersonation/sessions/%s - End impersonation request received", id)
+	claims := auth.GetClaims(c)
+	isAdmin := claims.Actor == nil && hasRole(claims, impersonationService.IMPERSONATION_ROLE)
+	if claims.ID != id && !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient privileges"})
+		return
+	}
+
+	session := impersonationService.GetSession(id)
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "impersonation session not found"})
+		return
+	}
+	if !session.IsActive() {
+		c.JSON(http.StatusConflict, gin.H{"error": "impersonation session already ended"})
+		return
+	}
+
+	err := token.GlobalBlacklist.Revoke(token.BlacklistEntry{
+		JTI:       session.Id,
+		ExpiresAt: session.ExpiresAt,
+		UserId:    session.UserId.String(),
+		Reason:    token.REASON_IMPERSONATION_ENDED,
+		RevokedBy: claims.Subject,
+	})
+	if err != nil {
+		log.Printf("Error revoking impersonation token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end impersonation"})
+		return
+	}
+
+	if err := impersonationService.EndSession(session.Id, claims.Subject); err != nil {
+		if errors.Is(err, impersonationService.ErrSessionEnded) {
+			c.JSON(http.StatusConflict, gin.H{"error": "impersonation session already ended"})
+			return
+		}
+		log.Printf("Error ending impersonation session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end impersonation"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// hasRole reports whether the token carries the role.
+func hasRole(claims *jwt.TokenClaims, role string) bool {
+	for _, value := range claims.Roles {
+		if value == role {
+			return true
+		}
+	}
+	return false
+}
+
+func toSessionResponse(session *impersonationService.Session) SessionResponse {
+	return SessionResponse{
+		Id:           session.Id,
+		AdminId:      session.AdminId.String(),
+		AdminSubject: session.AdminSubject,
+		UserId:       session.UserId.String(),
+		UserSubject:  session.UserSubject,
+		Reason:       session.Reason,
+		StartedAt:    session.StartedAt,
+		ExpiresAt:    session.ExpiresAt,
+		EndedAt:      session.EndedAt,
+		EndedBy:      session.EndedBy,
+		EndReason:    session.EndReason,
+		Active:       session.IsActive(),
+	}
+}
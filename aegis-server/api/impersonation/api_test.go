@@ -0,0 +1,267 @@
+package impersonation
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/api/auth"
+	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	impersonationService "nfcunha/aegis/domain/impersonation"
+	referenceService "nfcunha/aegis/domain/reference"
+	"nfcunha/aegis/domain/token"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+var testAdmin *userService.User
+var testUser *userService.User
+
+// testGateway is the confidential client that introspects tokens
+var testGateway *clientService.Client
+var testGatewaySecret string
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	aegis := router.Group("/aegis")
+	auth.RegisterApi(aegis)
+	RegisterApi(aegis)
+	return router
+}
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+
+	testAdmin = userService.CreateUser("admin@example.com", "password123", "system")
+	testAdmin.Roles = []userService.UserRole{userService.UserRole(impersonationService.IMPERSONATION_ROLE)}
+	userService.PersistUser(testAdmin)
+	testUser = userService.CreateUser("customer@example.com", "password123", "system")
+	testUser.Roles = []userService.UserRole{"user"}
+	testUser.Permissions = []userService.Permission{"orders:read"}
+	userService.PersistUser(testUser)
+	testGateway = clientService.CreateClient("API Gateway", nil, "system")
+	testGatewaySecret, _ = testGateway.GenerateSecret("system")
+	clientService.SaveClient(testGateway)
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// accessToken issues an access token for the given user
+func accessToken(t *testing.T, user *userService.User, roles []string) string {
+	options := jwt.TokenOptions{AuthzVersion: user.AuthzVersion}
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, roles, []string{}, options)
+	if err != nil {
+		t.Fatalf("Failed to generate tokens: %v", err)
+	}
+	return tokenPair.AccessToken
+}
+
+// request sends a request with a bearer token and optional JSON body
+func request(router *gin.Engine, method string, path string, bearer string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// start starts impersonating the test user as the test admin
+func start(t *testing.T, router *gin.Engine) StartImpersonationResponse {
+	adminToken := accessToken(t, testAdmin, []string{impersonationService.IMPERSONATION_ROLE})
+	w := request(router, "POST", "/aegis/impersonation/sessions", adminToken, StartImpersonationRequest{
+		UserId: testUser.Id.String(),
+		Reason: "ticket 42",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response StartImpersonationResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// introspect returns the introspection response of a token, as seen by a confidential client
+func introspect(t *testing.T, router *gin.Engine, tokenString string) auth.IntrospectTokenResponse {
+	form := url.Values{"token": {tokenString}}
+	req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(testGateway.ClientId, testGatewaySecret)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response auth.IntrospectTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// TestStartImpersonation tests that the token names the admin and carries the user's grants
+func TestStartImpersonation(t *testing.T) {
+	router := setupRouter()
+	response := start(t, router)
+
+	if response.AccessToken == "" {
+		t.Fatal("Expected an impersonation token")
+	}
+	if !response.Session.Active || response.Session.AdminId != testAdmin.Id.String() || response.Session.UserId != testUser.Id.String() {
+		t.Errorf("Unexpected session: %+v", response.Session)
+	}
+
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Impersonation token should be valid: %v", err)
+	}
+	if claims.Subject != testUser.Subject || claims.TokenType != "access" {
+		t.Errorf("Expected access token for %s, got %s token for %s", testUser.Subject, claims.TokenType, claims.Subject)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != testAdmin.Id.String() {
+		t.Errorf("Expected act claim naming the admin, got %+v", claims.Actor)
+	}
+	if !claims.Impersonated {
+		t.Error("Expected impersonated claim")
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "orders:read" {
+		t.Errorf("Expected the user's permissions, got %v", claims.Permissions)
+	}
+	if claims.ID != response.Session.Id {
+		t.Error("Session ID should be the token's JTI")
+	}
+}
+
+// TestStartImpersonation_ReferenceToken tests that an opaque token is returned in reference mode
+func TestStartImpersonation_ReferenceToken(t *testing.T) {
+	original := referenceService.TOKEN_FORMAT
+	referenceService.TOKEN_FORMAT = referenceService.TOKEN_FORMAT_REFERENCE
+	defer func() { referenceService.TOKEN_FORMAT = original }()
+	router := setupRouter()
+	response := start(t, router)
+
+	if !referenceService.IsReferenceToken(response.AccessToken) {
+		t.Fatalf("Expected an opaque token, got %s", response.AccessToken)
+	}
+	if introspection := introspect(t, router, response.AccessToken); !introspection.Active || introspection.Username != testUser.Subject {
+		t.Errorf("Expected the opaque token to be active for %s, got %+v", testUser.Subject, introspection)
+	}
+
+	// The session can be ended with the opaque token
+	w := request(router, "DELETE", "/aegis/impersonation/sessions/"+response.Session.Id, response.AccessToken, nil)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+}
+
+// TestStartImpersonation_RequiresRole tests that users without the role cannot impersonate
+func TestStartImpersonation_RequiresRole(t *testing.T) {
+	router := setupRouter()
+	userToken := accessToken(t, testUser, []string{"user"})
+
+	w := request(router, "POST", "/aegis/impersonation/sessions", userToken, StartImpersonationRequest{
+		UserId: testAdmin.Id.String(),
+		Reason: "ticket 42",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// TestStartImpersonation_UserNotFound tests impersonating an unknown user
+func TestStartImpersonation_UserNotFound(t *testing.T) {
+	router := setupRouter()
+	adminToken := accessToken(t, testAdmin, []string{impersonationService.IMPERSONATION_ROLE})
+
+	w := request(router, "POST", "/aegis/impersonation/sessions", adminToken, StartImpersonationRequest{
+		UserId: "00000000-0000-0000-0000-000000000001",
+		Reason: "ticket 42",
+	})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestIntrospect_Impersonated tests that introspection flags impersonation tokens
+func TestIntrospect_Impersonated(t *testing.T) {
+	router := setupRouter()
+	response := start(t, router)
+
+	introspection := introspect(t, router, response.AccessToken)
+	if !introspection.Active || !introspection.Impersonated {
+		t.Errorf("Expected active impersonated token, got %+v", introspection)
+	}
+	if introspection.Act == nil || introspection.Act.Subject != testAdmin.Id.String() {
+		t.Errorf("Expected act naming the admin, got %+v", introspection.Act)
+	}
+
+	regular := introspect(t, router, accessToken(t, testUser, []string{"user"}))
+	if regular.Impersonated || regular.Act != nil {
+		t.Error("Regular token should not be flagged as impersonated")
+	}
+}
+
+// TestEndImpersonation tests that ending a session revokes its token and records the end
+func TestEndImpersonation(t *testing.T) {
+	router := setupRouter()
+	response := start(t, router)
+
+	w := request(router, "DELETE", "/aegis/impersonation/sessions/"+response.Session.Id, response.AccessToken, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	if introspect(t, router, response.AccessToken).Active {
+		t.Error("Impersonation token should be revoked")
+	}
+	session := impersonationService.GetSession(response.Session.Id)
+	if session.EndedAt == nil || session.EndedBy != testUser.Subject {
+		t.Errorf("Expected session ended by %s, got %+v", testUser.Subject, session)
+	}
+}
+
+// TestEndImpersonation_OtherSession tests that a token cannot end another user's session
+func TestEndImpersonation_OtherSession(t *testing.T) {
+	router := setupRouter()
+	response := start(t, router)
+	userToken := accessToken(t, testUser, []string{"user"})
+
+	w := request(router, "DELETE", "/aegis/impersonation/sessions/"+response.Session.Id, userToken, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// TestListSessions tests that started sessions are listed for auditing
+func TestListSessions(t *testing.T) {
+	router := setupRouter()
+	response := start(t, router)
+	adminToken := accessToken(t, testAdmin, []string{impersonationService.IMPERSONATION_ROLE})
+
+	w := request(router, "GET", "/aegis/impersonation/sessions", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var sessions []SessionResponse
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	for _, session := range sessions {
+		if session.Id == response.Session.Id {
+			return
+		}
+	}
+	t.Error("Started session should be listed")
+}
@@ -0,0 +1,130 @@
+// Package key provides HTTP REST API endpoints for managing token signing keys.
+// Supports listing the keyring, rotating the active key and retiring old keys.
+package key
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"github.com/gin-gonic/gin"
+	keyringService "nfcunha/aegis/domain/keyring"
+)
+
+type RotateKeyRequest struct {
+	Algorithm      string `json:"algorithm"`
+	OverlapMinutes *int   `json:"overlap_minutes"`
+}
+
+type KeyResponse struct {
+	Kid       string     `json:"kid"`
+	Algorithm string     `json:"algorithm"`
+	State     string     `json:"state"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by"`
+	RetireAt  *time.Time `json:"retire_at,omitempty"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// RegisterApi registers all signing key HTTP routes with the Gin router.
+// Endpoints include list, rotate and retire. Key material is never returned.
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	keys := router.Group("/keys")
+	{
+		keys.GET("", listKeys)
+		keys.POST("/rotate", rotateKey)
+		keys.POST("/:kid/retire", retireKey)
+	}
+}
+
+func listKeys(c *gin.Context) {
+	log.Println("GET /aegis/keys - List signing keys request received")
+	keys, err := keyringService.ListKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list keys"})
+		return
+	}
+	response := make([]KeyResponse, len(keys))
+	for i, key := range keys {
+		response[i] = toKeyResponse(key)
+	}
+	log.Printf("Returning %d signing keys", len(response))
+	c.JSON(http.StatusOK, response)
+}
+
+func rotateKey(c *gin.Context) {
+	log.Println("POST /aegis/keys/rotate - Rotate signing key request received")
+	var req RotateKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Printf("Invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	overlap := keyringService.RotationOverlap()
+	if req.OverlapMinutes != nil {
+		if *req.OverlapMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "overlap_minutes must not be negative"})
+			return
+		}
+		overlap = time.Duration(*req.OverlapMinutes) * time.Minute
+	}
+
+	key, err := keyringService.Rotate(req.Algorithm, overlap, "system")
+	if err != nil {
+		log.Printf("Key rotation failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Signing key rotated, new active key: %s", key.Kid)
+	c.JSON(http.StatusCreated, toKeyResponse(key))
+}
+
+func retireKey(c *gin.Context) {
+	kid := c.Param("kid")
+	log.Printf("POST /aegis/keys/%s/retire - Retire signing key request received", kid)
+
+	key := keyringService.GetKey(kid)
+	if key == nil {
+		log.Printf("Signing key not found: %s", kid)
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+
+	if key.State == keyringService.STATE_ACTIVE {
+		c.JSON(http.StatusConflict, gin.H{"error": "the active key cannot be retired, rotate first"})
+		return
+	}
+
+	if err := keyringService.RetireKey(key); err != nil {
+		log.Printf("Failed to retire key %s: %v", kid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retire key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toKeyResponse(key))
+}
+
+// toKeyResponse converts a stored key to an API KeyResponse, leaving out key material.
+//
+// Parameters:
+//   - key: The stored key to convert
+//
+// Returns:
+//   - KeyResponse containing key metadata
+func toKeyResponse(key *keyringService.StoredKey) KeyResponse {
+	return KeyResponse{
+		Kid:       key.Kid,
+		Algorithm: key.Algorithm,
+		State:     string(key.State),
+		CreatedAt: key.CreatedAt,
+		CreatedBy: key.CreatedBy,
+		RetireAt:  key.RetireAt,
+		RetiredAt: key.RetiredAt,
+	}
+}
@@ -0,0 +1,53 @@
+// Package oauth provides the OAuth 2.0 authorization server endpoints.
+// Implements the authorization code grant with PKCE (RFC 6749, RFC 7636) using a
+// server-rendered login page, so client applications never see user credentials,
+// the client credentials grant for service-to-service tokens, and token exchange
+// (RFC 8693) for delegated, down-scoped tokens, and the device authorization grant (RFC 8628)
+// for devices without a browser, such as command-line tools.
+package oauth
+
+import (
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/api/auth"
+)
+
+// OAuth 2.0 error codes (RFC 6749 sections 4.1.2.1 and 5.2, RFC 8693 section 2.2.2, RFC 8628 section 3.5).
+const (
+	ERROR_INVALID_REQUEST           = "invalid_request"
+	ERROR_INVALID_CLIENT            = "invalid_client"
+	ERROR_INVALID_GRANT             = "invalid_grant"
+	ERROR_INVALID_SCOPE             = "invalid_scope"
+	ERROR_INVALID_TARGET            = "invalid_target"
+	ERROR_UNAUTHORIZED_CLIENT       = "unauthorized_client"
+	ERROR_UNSUPPORTED_GRANT_TYPE    = "unsupported_grant_type"
+	ERROR_UNSUPPORTED_RESPONSE_TYPE = "unsupported_response_type"
+	ERROR_ACCESS_DENIED             = "access_denied"
+	ERROR_SERVER_ERROR              = "server_error"
+	ERROR_AUTHORIZATION_PENDING     = "authorization_pending"
+	ERROR_SLOW_DOWN                 = "slow_down"
+	ERROR_EXPIRED_TOKEN             = "expired_token"
+)
+
+// OPENID_UNSUPPORTED_DESCRIPTION explains why the "openid" scope is refused while the active signing key is HS256.
+const OPENID_UNSUPPORTED_DESCRIPTION = "the openid scope requires an asymmetric signing key (AEGIS_JWT_ALGORITHM)"
+
+// RegisterApi registers the OAuth 2.0 routes with the Gin router.
+//
+// Public endpoints (under /aegis context path):
+//   - GET  /authorize - Validate the authorization request and show the login page
+//   - POST /authorize - Authenticate the user and redirect back with an authorization code
+//   - POST /token - Exchange an authorization code, client credentials, a subject token or a device code for tokens
+//   - POST /device_authorization - Start the device authorization grant
+//   - GET  /device - Show the page where the user enters the code displayed by the device
+//   - POST /device - Authenticate the user and approve or deny the device
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	router.GET("/authorize", showAuthorize)
+	router.POST("/authorize", submitAuthorize)
+	router.POST("/token", auth.AcceptDPoPProof(), exchangeToken)
+	router.POST("/device_authorization", authorizeDevice)
+	router.GET("/device", showDevice)
+	router.POST("/device", submitDevice)
+}
@@ -0,0 +1,1218 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
+	"nfcunha/aegis/api/oidc"
+	"nfcunha/aegis/database"
+	authcodeService "nfcunha/aegis/domain/authcode"
+	clientService "nfcunha/aegis/domain/client"
+	referenceService "nfcunha/aegis/domain/reference"
+	resourceService "nfcunha/aegis/domain/resource"
+	sessionService "nfcunha/aegis/domain/session"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+const (
+	testRedirectUri  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testPassword     = "password123"
+)
+
+var testClient *clientService.Client
+var testUser *userService.User
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	aegis := router.Group("/aegis")
+	RegisterApi(aegis)
+	oidc.RegisterApi(aegis)
+	return router
+}
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	database.Migrate()
+
+	// ID tokens need an asymmetric signing key
+	signingKey, _ := jwt.GenerateSigningKey(jwt.ALGORITHM_ES256)
+	jwt.KEYRING = jwt.NewKeyring(signingKey)
+
+	testClient = clientService.CreateClient("Example App", []string{testRedirectUri}, "system")
+	clientService.SaveClient(testClient)
+	testUser = userService.CreateUser("oauth@example.com", testPassword, "system")
+	testUser.Roles = []userService.UserRole{"user"}
+	userService.PersistUser(testUser)
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// authorizeParams builds a valid authorization request
+func authorizeParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClient.ClientId},
+		"redirect_uri":          {testRedirectUri},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {authcodeService.CodeChallengeS256(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// postForm sends a form-encoded POST request
+func postForm(router *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// login submits the login form and returns the redirect location
+func login(t *testing.T, router *gin.Engine, form url.Values) *url.URL {
+	w := postForm(router, "/aegis/authorize", form)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid redirect location: %v", err)
+	}
+	return location
+}
+
+// obtainCode runs the login step and returns the issued authorization code
+func obtainCode(t *testing.T, router *gin.Engine) string {
+	form := authorizeParams()
+	form.Set("subject", testUser.Subject)
+	form.Set("password", testPassword)
+	form.Set("action", "login")
+	location := login(t, router, form)
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("Expected code in redirect, got %s", location)
+	}
+	return code
+}
+
+// tokenForm builds a token request for the given code
+func tokenForm(code string) url.Values {
+	return url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectUri},
+		"client_id":     {testClient.ClientId},
+		"code_verifier": {testCodeVerifier},
+	}
+}
+
+// TestAuthorize_ShowsLoginPage tests that a valid request renders the login page
+func TestAuthorize_ShowsLoginPage(t *testing.T) {
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/authorize?"+authorizeParams().Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Example App") {
+		t.Error("Expected login page to show the client name")
+	}
+	if w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("Expected login page to forbid framing")
+	}
+}
+
+// TestAuthorize_UnregisteredRedirectUri tests that untrusted redirect URIs are never redirected to
+func TestAuthorize_UnregisteredRedirectUri(t *testing.T) {
+	router := setupRouter()
+	params := authorizeParams()
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+	req, _ := http.NewRequest("GET", "/aegis/authorize?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w.Header().Get("Location") != "" {
+		t.Error("Should not redirect to an unregistered URI")
+	}
+}
+
+// TestAuthorize_UnknownClient tests that unknown clients get an error page
+func TestAuthorize_UnknownClient(t *testing.T) {
+	router := setupRouter()
+	params := authorizeParams()
+	params.Set("client_id", "unknown")
+	req, _ := http.NewRequest("GET", "/aegis/authorize?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestAuthorize_MissingCodeChallenge tests that PKCE is mandatory
+func TestAuthorize_MissingCodeChallenge(t *testing.T) {
+	router := setupRouter()
+	params := authorizeParams()
+	params.Del("code_challenge")
+	req, _ := http.NewRequest("GET", "/aegis/authorize?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusFound, w.Code)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if location.Query().Get("error") != ERROR_INVALID_REQUEST {
+		t.Errorf("Expected invalid_request, got %s", location)
+	}
+	if location.Query().Get("state") != "xyz" {
+		t.Error("Expected state to be returned with the error")
+	}
+}
+
+// TestAuthorize_OpenIdWithHMACKey tests that the openid scope is refused while tokens are signed with HS256
+func TestAuthorize_OpenIdWithHMACKey(t *testing.T) {
+	original := jwt.KEYRING
+	jwt.KEYRING = jwt.NewKeyring(&jwt.SigningKey{Algorithm: jwt.ALGORITHM_HS256})
+	defer func() { jwt.KEYRING = original }()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/authorize?"+authorizeParams().Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || location.Query().Get("error") != ERROR_INVALID_SCOPE {
+		t.Errorf("Expected an invalid_scope redirect, got status %d and %s", w.Code, location)
+	}
+
+	client := createDeviceClient(t)
+	w = postForm(router, "/aegis/device_authorization", url.Values{"client_id": {client.ClientId}, "scope": {"openid"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_SCOPE) {
+		t.Errorf("Expected invalid_scope for the device grant, got status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestAuthorize_InvalidCredentials tests that a wrong password re-renders the login page
+func TestAuthorize_InvalidCredentials(t *testing.T) {
+	router := setupRouter()
+	form := authorizeParams()
+	form.Set("subject", testUser.Subject)
+	form.Set("password", "wrong-password")
+	form.Set("action", "login")
+	w := postForm(router, "/aegis/authorize", form)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Invalid username or password") {
+		t.Error("Expected error message on login page")
+	}
+}
+
+// TestAuthorize_Denied tests that cancelling returns access_denied to the client
+func TestAuthorize_Denied(t *testing.T) {
+	router := setupRouter()
+	form := authorizeParams()
+	form.Set("action", "deny")
+	location := login(t, router, form)
+
+	if location.Query().Get("error") != ERROR_ACCESS_DENIED {
+		t.Errorf("Expected access_denied, got %s", location)
+	}
+}
+
+// TestAuthorizationCodeFlow tests the full flow from login to token issuance
+func TestAuthorizationCodeFlow(t *testing.T) {
+	router := setupRouter()
+	code := obtainCode(t, router)
+
+	w := postForm(router, "/aegis/token", tokenForm(code))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("Token response must not be cached")
+	}
+
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.TokenType != "Bearer" || response.ExpiresIn <= 0 {
+		t.Errorf("Unexpected token response: %+v", response)
+	}
+
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Access token should be valid: %v", err)
+	}
+	if claims.UserId != testUser.Id.String() || claims.TokenType != "access" {
+		t.Errorf("Unexpected access token claims: %+v", claims)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "user" {
+		t.Errorf("Expected roles [user], got %v", claims.Roles)
+	}
+
+	idClaims := &jwt.IdTokenClaims{}
+	if _, _, err := gojwt.NewParser().ParseUnverified(response.IdToken, idClaims); err != nil {
+		t.Fatalf("Failed to parse ID token: %v", err)
+	}
+	if idClaims.Nonce != "n-0S6_WzA2Mj" {
+		t.Errorf("Expected nonce in ID token, got %s", idClaims.Nonce)
+	}
+	if len(idClaims.Audience) != 1 || idClaims.Audience[0] != testClient.ClientId {
+		t.Errorf("Expected audience %s, got %v", testClient.ClientId, idClaims.Audience)
+	}
+}
+
+// TestAuthorizationCodeFlow_Scope tests that roles and permissions in the granted scope narrow the tokens
+func TestAuthorizationCodeFlow_Scope(t *testing.T) {
+	router := setupRouter()
+	client := clientService.CreateClient("Scoped App", []string{testRedirectUri}, "system")
+	client.Scopes = append(client.Scopes, "role:user", "read:users")
+	if err := clientService.SaveClient(client); err != nil {
+		t.Fatalf("Failed to save client: %v", err)
+	}
+
+	issue := func(scope string, grantedScope string) *jwt.TokenClaims {
+		form := authorizeParams()
+		form.Set("client_id", client.ClientId)
+		form.Set("scope", scope)
+		form.Set("subject", testUser.Subject)
+		form.Set("password", testPassword)
+		form.Set("action", "login")
+		tokenRequest := tokenForm(login(t, router, form).Query().Get("code"))
+		tokenRequest.Set("client_id", client.ClientId)
+
+		w := postForm(router, "/aegis/token", tokenRequest)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var response TokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Scope != grantedScope {
+			t.Errorf("Expected granted scope '%s', got '%s'", grantedScope, response.Scope)
+		}
+		claims, err := jwt.ValidateToken(response.AccessToken)
+		if err != nil {
+			t.Fatalf("Access token should be valid: %v", err)
+		}
+		return claims
+	}
+
+	claims := issue("openid role:user", "openid role:user")
+	if len(claims.Roles) != 1 || claims.Roles[0] != "user" || claims.Scope != "role:user" {
+		t.Errorf("Expected the user role and scope role:user, got %v and '%s'", claims.Roles, claims.Scope)
+	}
+
+	// A scope naming only grants the user does not hold leaves the tokens without grants
+	claims = issue("openid read:users", "openid")
+	if len(claims.Roles) != 0 || len(claims.Permissions) != 0 || claims.Scope != "read:users" {
+		t.Errorf("Expected no grants and scope read:users, got %v, %v and '%s'", claims.Roles, claims.Permissions, claims.Scope)
+	}
+}
+
+// TestToken_CodeIsSingleUse tests that an authorization code cannot be redeemed twice
+func TestToken_CodeIsSingleUse(t *testing.T) {
+	router := setupRouter()
+	code := obtainCode(t, router)
+
+	first := postForm(router, "/aegis/token", tokenForm(code))
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected first redemption to succeed, got %d", first.Code)
+	}
+
+	second := postForm(router, "/aegis/token", tokenForm(code))
+	if second.Code != http.StatusBadRequest || !strings.Contains(second.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant on reuse, got %d: %s", second.Code, second.Body.String())
+	}
+}
+
+// TestToken_WrongCodeVerifier tests that PKCE verification is enforced
+func TestToken_WrongCodeVerifier(t *testing.T) {
+	router := setupRouter()
+	form := tokenForm(obtainCode(t, router))
+	form.Set("code_verifier", "wrong-verifier-wrong-verifier-wrong-verifier")
+
+	w := postForm(router, "/aegis/token", form)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestToken_RedirectUriMismatch tests that the redirect URI must match the authorization request
+func TestToken_RedirectUriMismatch(t *testing.T) {
+	router := setupRouter()
+	form := tokenForm(obtainCode(t, router))
+	form.Set("redirect_uri", "https://app.example.com/other")
+
+	w := postForm(router, "/aegis/token", form)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestToken_UnsupportedGrantType tests that other grant types are rejected
+func TestToken_UnsupportedGrantType(t *testing.T) {
+	router := setupRouter()
+	w := postForm(router, "/aegis/token", url.Values{"grant_type": {"password"}})
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_UNSUPPORTED_GRANT_TYPE) {
+		t.Errorf("Expected unsupported_grant_type, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// createMachineClient registers a confidential client allowed to use the client credentials grant
+func createMachineClient(t *testing.T) (*clientService.Client, string) {
+	client := clientService.CreateClient("Billing Service", nil, "system")
+	secret, _ := client.GenerateSecret("system")
+	client.Update(client.Name, nil, []string{clientService.GRANT_CLIENT_CREDENTIALS}, []string{"read:users", "write:users"}, 0, 0, "system")
+	if err := clientService.SaveClient(client); err != nil {
+		t.Fatalf("Failed to save client: %v", err)
+	}
+	return client, secret
+}
+
+// TestClientCredentials_Basic tests the grant with HTTP Basic client authentication
+func TestClientCredentials_Basic(t *testing.T) {
+	client, secret := createMachineClient(t)
+	router := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/aegis/token", strings.NewReader("grant_type=client_credentials&scope=read:users"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(client.ClientId), url.QueryEscape(secret))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.RefreshToken != "" {
+		t.Error("Client credentials grant should not issue a refresh token")
+	}
+	if response.Scope != "read:users" {
+		t.Errorf("Expected scope read:users, got %s", response.Scope)
+	}
+
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Client token should be valid: %v", err)
+	}
+	if claims.ClientId != client.ClientId || claims.UserId != "" {
+		t.Errorf("Unexpected client token claims: %+v", claims)
+	}
+}
+
+// TestClientCredentials_Post tests the grant with client_secret_post authentication and default scopes
+func TestClientCredentials_Post(t *testing.T) {
+	client, secret := createMachineClient(t)
+	router := setupRouter()
+
+	w := postForm(router, "/aegis/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {client.ClientId},
+		"client_secret": {secret},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Scope != "read:users write:users" {
+		t.Errorf("Expected all allowed scopes, got %s", response.Scope)
+	}
+}
+
+// TestClientCredentials_WrongSecret tests that client authentication is enforced
+func TestClientCredentials_WrongSecret(t *testing.T) {
+	client, _ := createMachineClient(t)
+	router := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/aegis/token", strings.NewReader("grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientId, "wrong-secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), ERROR_INVALID_CLIENT) {
+		t.Errorf("Expected invalid_client, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("Expected Basic challenge")
+	}
+}
+
+// TestClientCredentials_InvalidScope tests that only allowed scopes can be requested
+func TestClientCredentials_InvalidScope(t *testing.T) {
+	client, secret := createMachineClient(t)
+	router := setupRouter()
+
+	w := postForm(router, "/aegis/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {client.ClientId},
+		"client_secret": {secret},
+		"scope":         {"admin:everything"},
+	})
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_SCOPE) {
+		t.Errorf("Expected invalid_scope, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestClientCredentials_Audience tests that tokens default to the client as audience and that a
+// registered resource server restricts the scopes to its relevant permissions
+func TestClientCredentials_Audience(t *testing.T) {
+	client, secret := createMachineClient(t)
+	router := setupRouter()
+	server := resourceService.CreateResourceServer("https://users-"+client.ClientId+".example.com", "Users", []string{"read:users"}, "system")
+	resourceService.SaveResourceServer(server)
+
+	issue := func(audience string, scope string) *httptest.ResponseRecorder {
+		return postForm(router, "/aegis/token", url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {client.ClientId},
+			"client_secret": {secret},
+			"audience":      {audience},
+			"scope":         {scope},
+		})
+	}
+
+	var response TokenResponse
+	json.Unmarshal(issue("", "").Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims == nil || len(claims.Audience) != 1 || claims.Audience[0] != client.ClientId {
+		t.Errorf("Expected the client as default audience, got %+v", claims)
+	}
+
+	w := issue(server.Audience, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Scope != "read:users" {
+		t.Errorf("Expected default scopes restricted to the audience, got %s", response.Scope)
+	}
+	claims, _ = jwt.ValidateToken(response.AccessToken)
+	if claims == nil || len(claims.Audience) != 1 || claims.Audience[0] != server.Audience {
+		t.Errorf("Expected audience %s, got %+v", server.Audience, claims)
+	}
+
+	if w := issue(server.Audience, "write:users"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_SCOPE) {
+		t.Errorf("Expected invalid_scope for an irrelevant scope, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := issue("https://unknown.example.com", ""); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_TARGET) {
+		t.Errorf("Expected invalid_target for an unknown audience, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestClientCredentials_ReferenceToken tests that clients configured for reference tokens get opaque handles
+func TestClientCredentials_ReferenceToken(t *testing.T) {
+	client, secret := createMachineClient(t)
+	client.TokenFormat = referenceService.TOKEN_FORMAT_REFERENCE
+	clientService.UpdateClient(client)
+	router := setupRouter()
+
+	w := postForm(router, "/aegis/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {client.ClientId},
+		"client_secret": {secret},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !referenceService.IsReferenceToken(response.AccessToken) {
+		t.Fatalf("Expected an opaque token, got %s", response.AccessToken)
+	}
+	signed, err := referenceService.Resolve(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Opaque token should resolve: %v", err)
+	}
+	if claims, err := jwt.ValidateToken(signed); err != nil || claims.ClientId != client.ClientId {
+		t.Errorf("Expected the resolved token to belong to the client, got %v", err)
+	}
+}
+
+// tokenEndpointProof signs a DPoP proof for a request to the token endpoint
+func tokenEndpointProof(key *ecdsa.PrivateKey) string {
+	jwk, _ := jwt.PublicJWK(&key.PublicKey)
+	proof := gojwt.NewWithClaims(gojwt.SigningMethodES256, jwt.DPoPClaims{
+		Htm: "POST",
+		Htu: "http://aegis.test/aegis/token",
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ID:       uuid.New().String(),
+			IssuedAt: gojwt.NewNumericDate(time.Now()),
+		},
+	})
+	proof.Header["typ"] = jwt.DPOP_PROOF_TYPE
+	proof.Header["jwk"] = jwk
+	signed, _ := proof.SignedString(key)
+	return signed
+}
+
+// postFormWithProof sends a form-encoded POST request to the token endpoint with a DPoP proof
+func postFormWithProof(router *gin.Engine, form url.Values, proof string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/aegis/token", strings.NewReader(form.Encode()))
+	req.Host = "aegis.test"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(auth.DPOP_HEADER, proof)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestClientCredentials_DPoP tests that a client token requested with a DPoP proof is bound to its key
+func TestClientCredentials_DPoP(t *testing.T) {
+	client, secret := createMachineClient(t)
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := jwt.PublicJWK(&key.PublicKey)
+	signed := tokenEndpointProof(key)
+
+	send := func() *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {client.ClientId},
+			"client_secret": {secret},
+		}
+		return postFormWithProof(router, form, signed)
+	}
+
+	w := send()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.TokenType != "DPoP" {
+		t.Errorf("Expected token_type DPoP, got %s", response.TokenType)
+	}
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims.Confirmation == nil || claims.Confirmation.JKT != jwk.Thumbprint() {
+		t.Errorf("Expected token bound to %s, got %+v", jwk.Thumbprint(), claims.Confirmation)
+	}
+
+	// Proofs are single-use
+	if w = send(); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_dpop_proof") {
+		t.Errorf("Expected invalid_dpop_proof for a replayed proof, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestClientCredentials_UnauthorizedClient tests that clients only use their allowed grant types
+func TestClientCredentials_UnauthorizedClient(t *testing.T) {
+	router := setupRouter()
+	w := postForm(router, "/aegis/token", url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {testClient.ClientId},
+	})
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_UNAUTHORIZED_CLIENT) {
+		t.Errorf("Expected unauthorized_client, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestAuthorizationCodeFlow_ClientIdClaim tests that user tokens carry the client's ID and lifetime
+func TestAuthorizationCodeFlow_ClientIdClaim(t *testing.T) {
+	router := setupRouter()
+	code := obtainCode(t, router)
+
+	w := postForm(router, "/aegis/token", tokenForm(code))
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Access token should be valid: %v", err)
+	}
+	if claims.ClientId != testClient.ClientId {
+		t.Errorf("Expected client_id %s, got %s", testClient.ClientId, claims.ClientId)
+	}
+}
+
+// TestAuthorizationCodeFlow_ClaimMappings tests that mapped user attributes reach the access and ID tokens
+func TestAuthorizationCodeFlow_ClaimMappings(t *testing.T) {
+	router := setupRouter()
+	original := jwt.CLAIM_MAPPINGS
+	jwt.CLAIM_MAPPINGS = []jwt.ClaimMapping{{Attribute: "tenant_id", Claim: "tenant"}}
+	defer func() { jwt.CLAIM_MAPPINGS = original }()
+	user := userService.GetUserById(testUser.Id)
+	user.UpdateAdditionalInfo(map[string]interface{}{"tenant_id": "acme"}, "system")
+	userService.UpdateUser(user)
+	defer func() {
+		user.UpdateAdditionalInfo(nil, "system")
+		userService.UpdateUser(user)
+	}()
+
+	w := postForm(router, "/aegis/token", tokenForm(obtainCode(t, router)))
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil || claims.Custom["tenant"] != "acme" {
+		t.Errorf("Expected tenant claim in the access token. Body: %s", w.Body.String())
+	}
+	idClaims := &jwt.IdTokenClaims{}
+	gojwt.NewParser().ParseUnverified(response.IdToken, idClaims)
+	if idClaims.Custom["tenant"] != "acme" {
+		t.Errorf("Expected tenant claim in the ID token, got %v", idClaims.Custom)
+	}
+}
+
+// createExchangeClient registers a confidential client allowed to exchange tokens for the billing API
+func createExchangeClient(t *testing.T) (*clientService.Client, string) {
+	client := clientService.CreateClient("API Gateway", nil, "system")
+	secret, _ := client.GenerateSecret("system")
+	client.Update(client.Name, nil, []string{clientService.GRANT_TOKEN_EXCHANGE}, nil, 0, 0, "system")
+	client.ExchangeAudiences = []string{"https://billing.example.com"}
+	if err := clientService.SaveClient(client); err != nil {
+		t.Fatalf("Failed to save client: %v", err)
+	}
+	return client, secret
+}
+
+// subjectToken issues an access token to the test user with the given permissions and options
+func subjectToken(t *testing.T, permissions []string, options jwt.TokenOptions) string {
+	options.AuthzVersion = testUser.AuthzVersion
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(testUser.Id, testUser.Subject, []string{"user"}, permissions, options)
+	if err != nil {
+		t.Fatalf("Failed to generate subject token: %v", err)
+	}
+	return tokenPair.AccessToken
+}
+
+// exchangeForm builds a token exchange request
+func exchangeForm(client *clientService.Client, secret string, subjectToken string, audience string, scope string) url.Values {
+	return url.Values{
+		"grant_type":         {clientService.GRANT_TOKEN_EXCHANGE},
+		"client_id":          {client.ClientId},
+		"client_secret":      {secret},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {TOKEN_TYPE_ACCESS_TOKEN},
+		"audience":           {audience},
+		"scope":              {scope},
+	}
+}
+
+// TestTokenExchange tests that a user token is exchanged for a down-scoped, delegated token
+func TestTokenExchange(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices", "write:invoices", "read:users"}, jwt.TokenOptions{})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", "read:invoices"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.IssuedTokenType != TOKEN_TYPE_ACCESS_TOKEN || response.RefreshToken != "" || response.Scope != "read:invoices" {
+		t.Errorf("Unexpected token exchange response: %+v", response)
+	}
+
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Exchanged token should be valid: %v", err)
+	}
+	if claims.UserId != testUser.Id.String() || claims.Subject != testUser.Subject {
+		t.Errorf("Expected the exchanged token to keep the subject, got %+v", claims)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "read:invoices" || len(claims.Roles) != 0 {
+		t.Errorf("Expected only the requested permission, got roles %v and permissions %v", claims.Roles, claims.Permissions)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "https://billing.example.com" {
+		t.Errorf("Expected the requested audience, got %v", claims.Audience)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != client.ClientId || claims.Actor.Actor != nil {
+		t.Errorf("Expected the client as actor, got %+v", claims.Actor)
+	}
+}
+
+// TestTokenExchange_ReferenceToken tests that clients using reference tokens get an opaque exchanged token
+func TestTokenExchange_ReferenceToken(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	client.TokenFormat = referenceService.TOKEN_FORMAT_REFERENCE
+	clientService.UpdateClient(client)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !referenceService.IsReferenceToken(response.AccessToken) {
+		t.Fatalf("Expected an opaque token, got %s", response.AccessToken)
+	}
+	signed, err := referenceService.Resolve(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Opaque token should resolve: %v", err)
+	}
+	if claims, err := jwt.ValidateToken(signed); err != nil || claims.Actor == nil || claims.Actor.Subject != client.ClientId {
+		t.Errorf("Expected the resolved token to name the client as actor, got %v", err)
+	}
+}
+
+// TestTokenExchange_NestedActor tests that exchanging an exchanged token records the delegation chain
+func TestTokenExchange_NestedActor(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{Actor: &jwt.Actor{Subject: "frontend"}})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims.Actor == nil || claims.Actor.Subject != client.ClientId || claims.Actor.Actor == nil || claims.Actor.Actor.Subject != "frontend" {
+		t.Errorf("Expected nested actors, got %+v", claims.Actor)
+	}
+	if response.Scope != "read:invoices" {
+		t.Errorf("Expected all permissions of the subject token without scope, got %s", response.Scope)
+	}
+}
+
+// TestTokenExchange_Impersonated tests that exchanging an impersonation token keeps the impersonation flag
+func TestTokenExchange_Impersonated(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{Actor: &jwt.Actor{Subject: "admin@example.com"}, Impersonated: true})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims == nil || !claims.Impersonated {
+		t.Errorf("Expected the exchanged token to be flagged as impersonated, got %+v", claims)
+	}
+}
+
+// TestTokenExchange_AudienceNotAllowed tests that clients only exchange tokens for their audiences
+func TestTokenExchange_AudienceNotAllowed(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://hr.example.com", ""))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_TARGET) {
+		t.Errorf("Expected invalid_target, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestTokenExchange_ScopeExceedsSubject tests that exchanged tokens cannot gain permissions
+func TestTokenExchange_ScopeExceedsSubject(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", "write:invoices"))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_SCOPE) {
+		t.Errorf("Expected invalid_scope, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestTokenExchange_InvalidSubjectToken tests that revoked or non-user subject tokens are rejected
+func TestTokenExchange_InvalidSubjectToken(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	machineToken, _ := jwt.GenerateClientToken(client.ClientId, []string{"read:invoices"}, 0, nil, nil)
+
+	for _, subject := range []string{"not-a-token", machineToken.Token} {
+		w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", ""))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+			t.Errorf("Expected invalid_grant, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestTokenExchange_UserInfo tests that userinfo only reports the grants kept in an exchanged token
+func TestTokenExchange_UserInfo(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	user := userService.CreateUser("exchange-userinfo@example.com", testPassword, "system")
+	user.Roles = []userService.UserRole{"user"}
+	user.Permissions = []userService.Permission{"read:invoices", "write:invoices"}
+	userService.PersistUser(user)
+
+	userInfo := func(subjectPermissions []string, scope string) oidc.UserInfoResponse {
+		subject, _ := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, []string{"user"}, subjectPermissions, jwt.TokenOptions{AuthzVersion: user.AuthzVersion})
+		w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject.AccessToken, "https://billing.example.com", scope))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var response TokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if claims, _ := jwt.ValidateToken(response.AccessToken); claims == nil || claims.Scope != scope {
+			t.Errorf("Expected the exchanged token to carry scope '%s', got %+v", scope, claims)
+		}
+
+		req, _ := http.NewRequest("GET", "/aegis/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+response.AccessToken)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var info oidc.UserInfoResponse
+		json.Unmarshal(w.Body.Bytes(), &info)
+		return info
+	}
+
+	info := userInfo([]string{"read:invoices", "write:invoices"}, "read:invoices")
+	if len(info.Roles) != 0 || len(info.Permissions) != 1 || info.Permissions[0] != "read:invoices" {
+		t.Errorf("Expected only read:invoices, got roles %v and permissions %v", info.Roles, info.Permissions)
+	}
+
+	// A token that kept no permissions has no scope, and still reports none
+	info = userInfo([]string{}, "")
+	if len(info.Roles) != 0 || len(info.Permissions) != 0 {
+		t.Errorf("Expected no grants, got roles %v and permissions %v", info.Roles, info.Permissions)
+	}
+}
+
+// TestTokenExchange_SessionRevoked tests that exchanged tokens belong to the subject token's session and are revoked with it
+func TestTokenExchange_SessionRevoked(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	session := sessionService.CreateSession(testUser.Id, "", "", "127.0.0.1", "test")
+	if err := sessionService.SaveSession(session); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{SessionId: session.Id})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if claims, err := auth.VerifyToken(response.AccessToken); err != nil || claims.SessionId != session.Id {
+		t.Fatalf("Expected the exchanged token to carry session %s, got %+v (%v)", session.Id, claims, err)
+	}
+
+	if err := sessionService.RevokeSession(session.Id, "test"); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+	if _, err := auth.VerifyToken(response.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("Expected the exchanged token to be revoked with its session, got %v", err)
+	}
+}
+
+// TestTokenExchange_DPoPBound tests that DPoP-bound subject tokens are only exchanged with a proof of their key
+func TestTokenExchange_DPoPBound(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := jwt.PublicJWK(&key.PublicKey)
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{Confirmation: &jwt.Confirmation{JKT: jwk.Thumbprint()}})
+	form := exchangeForm(client, secret, subject, "https://billing.example.com", "")
+
+	w := postForm(router, "/aegis/token", form)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant without a proof, got %d: %s", w.Code, w.Body.String())
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	w = postFormWithProof(router, form, tokenEndpointProof(otherKey))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant with a proof of another key, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postFormWithProof(router, form, tokenEndpointProof(key))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if response.TokenType != "DPoP" || claims.Confirmation == nil || claims.Confirmation.JKT != jwk.Thumbprint() {
+		t.Errorf("Expected the exchanged token to stay bound to %s, got %+v", jwk.Thumbprint(), claims.Confirmation)
+	}
+}
+
+// TestTokenExchange_CertificateBound tests that certificate-bound subject tokens are only exchanged over a connection with their certificate
+func TestTokenExchange_CertificateBound(t *testing.T) {
+	client, secret := createExchangeClient(t)
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "workload"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	thumbprint := jwt.CertificateThumbprint(cert)
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{Confirmation: &jwt.Confirmation{X5tS256: thumbprint}})
+
+	send := func(peerCertificates []*x509.Certificate) *httptest.ResponseRecorder {
+		form := exchangeForm(client, secret, subject, "https://billing.example.com", "")
+		req, _ := http.NewRequest("POST", "/aegis/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.TLS = &tls.ConnectionState{PeerCertificates: peerCertificates}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(nil); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant without the certificate, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := send([]*x509.Certificate{cert})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims.Confirmation == nil || claims.Confirmation.X5tS256 != thumbprint {
+		t.Errorf("Expected the exchanged token to stay bound to the certificate, got %+v", claims.Confirmation)
+	}
+}
+
+// TestTokenExchange_UnauthorizedClient tests that only clients allowed to exchange tokens can do so
+func TestTokenExchange_UnauthorizedClient(t *testing.T) {
+	client, secret := createMachineClient(t)
+	router := setupRouter()
+	subject := subjectToken(t, []string{"read:invoices"}, jwt.TokenOptions{})
+
+	w := postForm(router, "/aegis/token", exchangeForm(client, secret, subject, "https://billing.example.com", ""))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_UNAUTHORIZED_CLIENT) {
+		t.Errorf("Expected unauthorized_client, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// createDeviceClient registers a public client allowed to use the device code grant
+func createDeviceClient(t *testing.T) *clientService.Client {
+	client := clientService.CreateClient("Aegis CLI", nil, "system")
+	client.Update(client.Name, nil, []string{clientService.GRANT_DEVICE_CODE}, []string{"openid", "profile"}, 0, 0, "system")
+	if err := clientService.SaveClient(client); err != nil {
+		t.Fatalf("Failed to save client: %v", err)
+	}
+	return client
+}
+
+// startDeviceAuthorization requests a device code for the client
+func startDeviceAuthorization(t *testing.T, router *gin.Engine, client *clientService.Client, scope string) DeviceAuthorizationResponse {
+	w := postForm(router, "/aegis/device_authorization", url.Values{"client_id": {client.ClientId}, "scope": {scope}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response DeviceAuthorizationResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// deviceTokenForm builds a device access token request
+func deviceTokenForm(client *clientService.Client, deviceCode string) url.Values {
+	return url.Values{
+		"grant_type":  {clientService.GRANT_DEVICE_CODE},
+		"client_id":   {client.ClientId},
+		"device_code": {deviceCode},
+	}
+}
+
+// verifyDevice submits the device verification page
+func verifyDevice(router *gin.Engine, userCode string, password string, action string) *httptest.ResponseRecorder {
+	return postForm(router, "/aegis/device", url.Values{
+		"user_code": {userCode},
+		"subject":   {testUser.Subject},
+		"password":  {password},
+		"action":    {action},
+	})
+}
+
+// TestDeviceFlow tests the device authorization grant from code request to tokens
+func TestDeviceFlow(t *testing.T) {
+	client := createDeviceClient(t)
+	router := setupRouter()
+
+	device := startDeviceAuthorization(t, router, client, "openid")
+	if device.DeviceCode == "" || len(device.UserCode) != 9 || device.Interval != 5 || device.ExpiresIn <= 0 {
+		t.Fatalf("Unexpected device authorization response: %+v", device)
+	}
+	if !strings.HasSuffix(device.VerificationUri, "/aegis/device") || device.VerificationUriComplete != device.VerificationUri+"?user_code="+device.UserCode {
+		t.Errorf("Unexpected verification URIs: %s, %s", device.VerificationUri, device.VerificationUriComplete)
+	}
+
+	// The verification page names the client once the code is known
+	req, _ := http.NewRequest("GET", "/aegis/device?user_code="+device.UserCode, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Aegis CLI") {
+		t.Fatalf("Expected verification page naming the client, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Codes are accepted in lowercase, as typed by the user
+	w = verifyDevice(router, strings.ToLower(device.UserCode), testPassword, "approve")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Device connected") {
+		t.Fatalf("Expected approval confirmation, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.RefreshToken == "" || response.IdToken == "" {
+		t.Error("Expected refresh token and ID token")
+	}
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Access token should be valid: %v", err)
+	}
+	if claims.Subject != testUser.Subject || len(claims.Roles) != 1 || claims.Roles[0] != "user" {
+		t.Errorf("Expected the user's roles, got %+v", claims)
+	}
+	if claims.ClientId != client.ClientId {
+		t.Errorf("Expected client_id %s, got %s", client.ClientId, claims.ClientId)
+	}
+
+	// The device code is single-use
+	w = postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_INVALID_GRANT) {
+		t.Errorf("Expected invalid_grant on reuse, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDeviceFlow_Scope tests that the scope approved for the device narrows its tokens
+func TestDeviceFlow_Scope(t *testing.T) {
+	client := createDeviceClient(t)
+	client.Scopes = append(client.Scopes, "read:users")
+	clientService.UpdateClient(client)
+	router := setupRouter()
+
+	device := startDeviceAuthorization(t, router, client, "read:users")
+	verifyDevice(router, device.UserCode, testPassword, "approve")
+	w := postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, err := jwt.ValidateToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("Access token should be valid: %v", err)
+	}
+	if len(claims.Roles) != 0 || claims.Scope != "read:users" {
+		t.Errorf("Expected no roles and scope read:users, got %v and '%s'", claims.Roles, claims.Scope)
+	}
+}
+
+// TestDeviceFlow_PendingAndSlowDown tests polling before approval and polling too fast
+func TestDeviceFlow_PendingAndSlowDown(t *testing.T) {
+	client := createDeviceClient(t)
+	router := setupRouter()
+	device := startDeviceAuthorization(t, router, client, "")
+
+	w := postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_AUTHORIZATION_PENDING) {
+		t.Errorf("Expected authorization_pending, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_SLOW_DOWN) {
+		t.Errorf("Expected slow_down, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDeviceFlow_Denied tests that the device receives access_denied when the user denies it
+func TestDeviceFlow_Denied(t *testing.T) {
+	client := createDeviceClient(t)
+	router := setupRouter()
+	device := startDeviceAuthorization(t, router, client, "")
+
+	w := verifyDevice(router, device.UserCode, testPassword, "deny")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Request denied") {
+		t.Fatalf("Expected denial confirmation, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_ACCESS_DENIED) {
+		t.Errorf("Expected access_denied, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDeviceFlow_InvalidCredentials tests that the request stays pending when the login fails
+func TestDeviceFlow_InvalidCredentials(t *testing.T) {
+	client := createDeviceClient(t)
+	router := setupRouter()
+	device := startDeviceAuthorization(t, router, client, "")
+
+	w := verifyDevice(router, device.UserCode, "wrong-password", "approve")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = postForm(router, "/aegis/token", deviceTokenForm(client, device.DeviceCode))
+	if !strings.Contains(w.Body.String(), ERROR_AUTHORIZATION_PENDING) {
+		t.Errorf("Expected authorization_pending, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDeviceFlow_UnknownUserCode tests that unknown codes are rejected on the verification page
+func TestDeviceFlow_UnknownUserCode(t *testing.T) {
+	router := setupRouter()
+
+	w := verifyDevice(router, "BCDF-GHJK", testPassword, "approve")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid or has expired") {
+		t.Errorf("Expected invalid code error, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDeviceFlow_UnauthorizedClient tests that only clients allowed to use the grant get device codes
+func TestDeviceFlow_UnauthorizedClient(t *testing.T) {
+	router := setupRouter()
+
+	w := postForm(router, "/aegis/device_authorization", url.Values{"client_id": {testClient.ClientId}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ERROR_UNAUTHORIZED_CLIENT) {
+		t.Errorf("Expected unauthorized_client, got %d: %s", w.Code, w.Body.String())
+	}
+}
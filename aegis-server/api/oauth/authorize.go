@@ -0,0 +1,204 @@
+package oauth
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"github.com/gin-gonic/gin"
+	authcodeService "nfcunha/aegis/domain/authcode"
+	clientService "nfcunha/aegis/domain/client"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+// AuthorizationRequest represents the parameters of an authorization request (RFC 6749 section 4.1.1),
+// extended with PKCE (RFC 7636 section 4.3) and the OpenID Connect nonce.
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientId            string `form:"client_id"`
+	RedirectUri         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// showAuthorize validates the authorization request and renders the login page.
+//
+// Endpoint: GET /aegis/authorize
+//
+// Response:
+//   - 200 OK: Login page
+//   - 302 Found: Redirect to the client with an error, if the request is invalid
+//   - 400 Bad Request: Error page, if the client or redirect URI cannot be trusted
+func showAuthorize(c *gin.Context) {
+	log.Println("GET /aegis/authorize - Authorization request received")
+	var req AuthorizationRequest
+	if !bindAuthorizationRequest(c, &req) {
+		return
+	}
+	client, ok := resolveClient(c, &req)
+	if !ok {
+		return
+	}
+	if !checkAuthorizationRequest(c, client, &req) {
+		return
+	}
+
+	renderPage(c, http.StatusOK, loginTemplate, loginPage{ClientName: client.Name, Request: req})
+}
+
+// submitAuthorize authenticates the user with the submitted credentials and, on success,
+// redirects back to the client with a single-use authorization code.
+//
+// Endpoint: POST /aegis/authorize
+//
+// Request Body (application/x-www-form-urlencoded):
+//   - The authorization request parameters, carried by hidden form fields
+//   - subject, password: The user's credentials
+//   - action: "login" to sign in, "deny" to cancel
+//
+// Response:
+//   - 302 Found: Redirect to the client with code and state, or with an error
+//   - 401 Unauthorized: Login page with an error, if the credentials are invalid
+//   - 400 Bad Request: Error page, if the client or redirect URI cannot be trusted
+func submitAuthorize(c *gin.Context) {
+	log.Println("POST /aegis/authorize - Authorization login received")
+	var req AuthorizationRequest
+	if !bindAuthorizationRequest(c, &req) {
+		return
+	}
+	client, ok := resolveClient(c, &req)
+	if !ok {
+		return
+	}
+	if !checkAuthorizationRequest(c, client, &req) {
+		return
+	}
+
+	if c.PostForm("action") == "deny" {
+		log.Printf("User denied authorization for client %s", client.ClientId)
+		redirectWithError(c, &req, ERROR_ACCESS_DENIED, "the user denied the request")
+		return
+	}
+
+	subject := c.PostForm("subject")
+	user := userService.GetUserBySubject(subject)
+	if user == nil || !user.PasswordMatch(c.PostForm("password")) {
+		log.Printf("Authorization login failed for subject: %s", subject)
+		renderPage(c, http.StatusUnauthorized, loginTemplate, loginPage{
+			ClientName: client.Name,
+			Subject:    subject,
+			Error:      "Invalid username or password",
+			Request:    req,
+		})
+		return
+	}
+
+	code, err := authcodeService.CreateAuthorizationCode(client.ClientId, user.Id, req.RedirectUri, req.Scope, req.Nonce, req.CodeChallenge)
+	if err == nil {
+		err = authcodeService.SaveAuthorizationCode(code)
+	}
+	if err != nil {
+		log.Printf("Error issuing authorization code: %v", err)
+		redirectWithError(c, &req, ERROR_SERVER_ERROR, "failed to issue authorization code")
+		return
+	}
+
+	log.Printf("Authorization code issued to client %s for user %s", client.ClientId, user.Subject)
+	redirectToClient(c, req.RedirectUri, url.Values{"code": {code.Code}}, req.State)
+}
+
+// bindAuthorizationRequest reads the authorization request from the query string or form body.
+func bindAuthorizationRequest(c *gin.Context, req *AuthorizationRequest) bool {
+	if err := c.ShouldBind(req); err != nil {
+		log.Printf("Invalid authorization request: %v", err)
+		renderPage(c, http.StatusBadRequest, errorTemplate, errorPage{Error: "Malformed authorization request."})
+		return false
+	}
+	return true
+}
+
+// resolveClient looks up the client and checks the redirect URI against its registered URIs.
+// Errors here are shown to the user instead of redirected, since the redirect URI is not trusted
+// (RFC 6749 section 4.1.2.1).
+func resolveClient(c *gin.Context, req *AuthorizationRequest) (*clientService.Client, bool) {
+	client := clientService.GetClientById(req.ClientId)
+	if client == nil {
+		log.Printf("Authorization request for unknown client: %s", req.ClientId)
+		renderPage(c, http.StatusBadRequest, errorTemplate, errorPage{Error: "Unknown client."})
+		return nil, false
+	}
+	if req.RedirectUri == "" || !client.HasRedirectUri(req.RedirectUri) {
+		log.Printf("Authorization request with unregistered redirect URI for client %s: %s", client.ClientId, req.RedirectUri)
+		renderPage(c, http.StatusBadRequest, errorTemplate, errorPage{Error: "The redirect URI is not registered for this client."})
+		return nil, false
+	}
+	return client, true
+}
+
+// checkAuthorizationRequest validates the remaining parameters once the redirect URI is trusted.
+// PKCE with the S256 method is mandatory for every client.
+func checkAuthorizationRequest(c *gin.Context, client *clientService.Client, req *AuthorizationRequest) bool {
+	if req.ResponseType != "code" {
+		redirectWithError(c, req, ERROR_UNSUPPORTED_RESPONSE_TYPE, "only the code response type is supported")
+		return false
+	}
+	if !client.AllowsGrantType(clientService.GRANT_AUTHORIZATION_CODE) {
+		redirectWithError(c, req, ERROR_UNAUTHORIZED_CLIENT, "the client is not allowed to use the authorization code grant")
+		return false
+	}
+	if !client.AllowsScopes(strings.Fields(req.Scope)) {
+		redirectWithError(c, req, ERROR_INVALID_SCOPE, "the requested scope is not allowed for this client")
+		return false
+	}
+	if hasScope(req.Scope, "openid") && !jwt.IdTokensSupported() {
+		redirectWithError(c, req, ERROR_INVALID_SCOPE, OPENID_UNSUPPORTED_DESCRIPTION)
+		return false
+	}
+	if req.CodeChallenge == "" {
+		redirectWithError(c, req, ERROR_INVALID_REQUEST, "code_challenge is required")
+		return false
+	}
+	if req.CodeChallengeMethod != authcodeService.CODE_CHALLENGE_METHOD_S256 {
+		redirectWithError(c, req, ERROR_INVALID_REQUEST, "code_challenge_method must be S256")
+		return false
+	}
+	if len(req.CodeChallenge) != 43 {
+		redirectWithError(c, req, ERROR_INVALID_REQUEST, "code_challenge must be a base64url-encoded SHA-256 hash")
+		return false
+	}
+	return true
+}
+
+// redirectWithError sends the user back to the client with an OAuth 2.0 error response.
+func redirectWithError(c *gin.Context, req *AuthorizationRequest, errorCode string, description string) {
+	log.Printf("Authorization request rejected: %s (%s)", errorCode, description)
+	redirectToClient(c, req.RedirectUri, url.Values{
+		"error":             {errorCode},
+		"error_description": {description},
+	}, req.State)
+}
+
+// redirectToClient redirects to the redirect URI with the given parameters added to its query,
+// keeping any query parameters the URI was registered with.
+func redirectToClient(c *gin.Context, redirectUri string, params url.Values, state string) {
+	target, err := url.Parse(redirectUri)
+	if err != nil {
+		renderPage(c, http.StatusBadRequest, errorTemplate, errorPage{Error: "Invalid redirect URI."})
+		return
+	}
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, target.String())
+}
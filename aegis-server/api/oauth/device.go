@@ -0,0 +1,230 @@
+package oauth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/api/auth"
+	"nfcunha/aegis/api/wellknown"
+	clientService "nfcunha/aegis/domain/client"
+	devicecodeService "nfcunha/aegis/domain/devicecode"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+// DeviceAuthorizationResponse represents a device authorization response (RFC 8628 section 3.2).
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// authorizeDevice starts the device authorization grant for a client.
+// The device shows the user code and verification URI to the user, then polls the token
+// endpoint with the device code until the user approved or denied the request.
+//
+// Endpoint: POST /aegis/device_authorization
+//
+// Request Body (application/x-www-form-urlencoded):
+//   - client_id: The client, plus client_secret or HTTP Basic authentication for confidential clients
+//   - scope: Optional space-delimited scopes
+//
+// Response:
+//   - 200 OK: Device code, user code and verification URI
+//   - 400 Bad Request: Unauthorized client or invalid scope
+//   - 401 Unauthorized: Client authentication failed
+func authorizeDevice(c *gin.Context) {
+	log.Println("POST /aegis/device_authorization - Device authorization request received")
+	c.Header("Cache-Control", "no-store")
+
+	client, err := auth.AuthenticateClient(c)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		auth.AbortInvalidClient(c, err)
+		return
+	}
+	if !client.AllowsGrantType(clientService.GRANT_DEVICE_CODE) {
+		tokenError(c, http.StatusBadRequest, ERROR_UNAUTHORIZED_CLIENT, "the client is not allowed to use the device code grant")
+		return
+	}
+	scope := c.PostForm("scope")
+	if !client.AllowsScopes(strings.Fields(scope)) {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_SCOPE, "the requested scope is not allowed for this client")
+		return
+	}
+	if hasScope(scope, "openid") && !jwt.IdTokensSupported() {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_SCOPE, OPENID_UNSUPPORTED_DESCRIPTION)
+		return
+	}
+
+	authorization, err := devicecodeService.CreateDeviceAuthorization(client.ClientId, scope)
+	if err == nil {
+		err = devicecodeService.SaveDeviceAuthorization(authorization)
+	}
+	if err != nil {
+		log.Printf("Error issuing device code: %v", err)
+		tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to issue device code")
+		return
+	}
+
+	verificationUri := wellknown.BaseUrl(c) + "/device"
+	log.Printf("Device code issued to client %s", client.ClientId)
+	c.JSON(http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                authorization.FormattedUserCode(),
+		VerificationUri:         verificationUri,
+		VerificationUriComplete: verificationUri + "?" + url.Values{"user_code": {authorization.FormattedUserCode()}}.Encode(),
+		ExpiresIn:               int64(time.Until(authorization.ExpiresAt).Seconds()),
+		Interval:                int64(authorization.Interval.Seconds()),
+	})
+}
+
+// showDevice renders the page where the user enters the code shown by the device.
+// When the code is already in the URL (verification_uri_complete), the page names the
+// client asking for access, so the user can check it before signing in.
+//
+// Endpoint: GET /aegis/device
+//
+// Query Parameters:
+//   - user_code: Optional user code to prefill
+//
+// Response:
+//   - 200 OK: Device verification page
+func showDevice(c *gin.Context) {
+	log.Println("GET /aegis/device - Device verification page requested")
+	page := devicePage{UserCode: c.Query("user_code")}
+	if page.UserCode != "" {
+		if _, client := resolveDeviceAuthorization(page.UserCode); client != nil {
+			page.ClientName = client.Name
+		} else {
+			page.Error = "This code is invalid or has expired."
+		}
+	}
+	renderPage(c, http.StatusOK, deviceTemplate, page)
+}
+
+// submitDevice authenticates the user with the submitted credentials and records their
+// approval or denial of the device request.
+//
+// Endpoint: POST /aegis/device
+//
+// Request Body (application/x-www-form-urlencoded):
+//   - user_code: The code shown by the device
+//   - subject, password: The user's credentials
+//   - action: "approve" to grant access, "deny" to refuse it
+//
+// Response:
+//   - 200 OK: Confirmation page
+//   - 400 Bad Request: Device page with an error, if the code is invalid or expired
+//   - 401 Unauthorized: Device page with an error, if the credentials are invalid
+func submitDevice(c *gin.Context) {
+	log.Println("POST /aegis/device - Device verification received")
+	page := devicePage{UserCode: c.PostForm("user_code"), Subject: c.PostForm("subject")}
+
+	authorization, client := resolveDeviceAuthorization(page.UserCode)
+	if client == nil {
+		page.Error = "This code is invalid or has expired."
+		renderPage(c, http.StatusBadRequest, deviceTemplate, page)
+		return
+	}
+	page.ClientName = client.Name
+
+	// The user signs in to deny as well, so a third party cannot cancel requests by guessing codes
+	user := userService.GetUserBySubject(page.Subject)
+	if user == nil || !user.PasswordMatch(c.PostForm("password")) {
+		log.Printf("Device verification login failed for subject: %s", page.Subject)
+		page.Error = "Invalid username or password"
+		renderPage(c, http.StatusUnauthorized, deviceTemplate, page)
+		return
+	}
+
+	approved := c.PostForm("action") == "approve"
+	var err error
+	if approved {
+		err = devicecodeService.Approve(authorization.UserCode, user.Id)
+	} else {
+		err = devicecodeService.Deny(authorization.UserCode, user.Id)
+	}
+	if errors.Is(err, devicecodeService.ErrDeviceCodeNotFound) {
+		page.Error = "This code is invalid or has expired."
+		renderPage(c, http.StatusBadRequest, deviceTemplate, page)
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording device decision: %v", err)
+		renderPage(c, http.StatusInternalServerError, errorTemplate, errorPage{Error: "Failed to record your decision."})
+		return
+	}
+
+	decision := "denied"
+	if approved {
+		decision = "approved"
+	}
+	log.Printf("User %s %s device request of client %s", user.Subject, decision, client.ClientId)
+	renderPage(c, http.StatusOK, deviceDoneTemplate, deviceDonePage{ClientName: client.Name, Approved: approved})
+}
+
+// resolveDeviceAuthorization looks up a pending, unexpired request by user code and its client.
+// Returns a nil client if the code cannot be approved.
+func resolveDeviceAuthorization(userCode string) (*devicecodeService.DeviceAuthorization, *clientService.Client) {
+	authorization := devicecodeService.GetByUserCode(userCode)
+	if authorization == nil || authorization.Status != devicecodeService.STATUS_PENDING || authorization.IsExpired() {
+		return nil, nil
+	}
+	return authorization, clientService.GetClientById(authorization.ClientId)
+}
+
+// exchangeDeviceCode answers a device polling the token endpoint (RFC 8628 section 3.4).
+func exchangeDeviceCode(c *gin.Context, client *clientService.Client, req *TokenRequest) {
+	if req.DeviceCode == "" {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_REQUEST, "device_code is required")
+		return
+	}
+
+	authorization, err := devicecodeService.Poll(req.DeviceCode)
+	if err != nil {
+		errorCode, description := determineDeviceCodeError(err)
+		tokenError(c, http.StatusBadRequest, errorCode, description)
+		return
+	}
+	if authorization.ClientId != client.ClientId {
+		log.Printf("Device code issued to %s redeemed by client %s", authorization.ClientId, client.ClientId)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "device code was issued to another client")
+		return
+	}
+
+	var user *userService.User
+	if authorization.UserId != nil {
+		user = userService.GetUserById(*authorization.UserId)
+	}
+	if user == nil {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "user not found")
+		return
+	}
+	issueUserTokens(c, client, user, authorization.Scope, "")
+}
+
+// determineDeviceCodeError maps device code errors to an OAuth 2.0 error code and description.
+func determineDeviceCodeError(err error) (string, string) {
+	switch {
+	case errors.Is(err, devicecodeService.ErrAuthorizationPending):
+		return ERROR_AUTHORIZATION_PENDING, "the user has not yet approved the request"
+	case errors.Is(err, devicecodeService.ErrSlowDown):
+		return ERROR_SLOW_DOWN, "polling too fast, increase the interval by 5 seconds"
+	case errors.Is(err, devicecodeService.ErrAccessDenied):
+		return ERROR_ACCESS_DENIED, "the user denied the request"
+	case errors.Is(err, devicecodeService.ErrDeviceCodeExpired):
+		return ERROR_EXPIRED_TOKEN, "device code expired"
+	case errors.Is(err, devicecodeService.ErrDeviceCodeAlreadyUsed):
+		return ERROR_INVALID_GRANT, "device code already used"
+	default:
+		return ERROR_INVALID_GRANT, "invalid device code"
+	}
+}
@@ -0,0 +1,116 @@
+package oauth
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
+	clientService "nfcunha/aegis/domain/client"
+	referenceService "nfcunha/aegis/domain/reference"
+	resourceService "nfcunha/aegis/domain/resource"
+	"nfcunha/aegis/util/jwt"
+)
+
+// Token type identifiers (RFC 8693 section 3).
+const (
+	TOKEN_TYPE_ACCESS_TOKEN = "urn:ietf:params:oauth:token-type:access_token"
+	TOKEN_TYPE_JWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// exchangeSubjectToken trades a user's access token for a narrower one (RFC 8693).
+//
+// The subject token must be a valid, unrevoked user access token. The issued token is
+// restricted to the requested audience, which must be one of the client's exchange audiences,
+// and carries only the requested permissions, which must be a subset of the subject token's;
+// without a scope parameter, all of them are kept. When the audience is a registered resource
+// server, permissions not relevant to it are dropped. Roles are not carried over. The "act" claim
+// identifies the exchanging client, nesting any actor of the subject token. The issued token
+// expires no later than the subject token, and no refresh token is issued. Clients using
+// reference tokens receive an opaque handle instead of the JWT. Subject tokens bound to a DPoP
+// key or a client certificate are only exchanged with a proof of possession of that key or
+// certificate, so that a stolen bound token cannot be traded for an unbound one.
+func exchangeSubjectToken(c *gin.Context, client *clientService.Client, req *TokenRequest) {
+	if req.SubjectToken == "" || req.SubjectTokenType == "" || req.Audience == "" {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_REQUEST, "subject_token, subject_token_type and audience are required")
+		return
+	}
+	if req.SubjectTokenType != TOKEN_TYPE_ACCESS_TOKEN && req.SubjectTokenType != TOKEN_TYPE_JWT {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_REQUEST, "unsupported subject_token_type")
+		return
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TOKEN_TYPE_ACCESS_TOKEN {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_REQUEST, "unsupported requested_token_type")
+		return
+	}
+	if !client.AllowsExchangeAudience(req.Audience) {
+		log.Printf("Client %s is not allowed to exchange tokens for audience %s", client.ClientId, req.Audience)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_TARGET, "the client is not allowed to exchange tokens for this audience")
+		return
+	}
+
+	claims, err := auth.VerifyToken(req.SubjectToken)
+	if err != nil {
+		log.Printf("Subject token rejected: %v", err)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "invalid subject token")
+		return
+	}
+	userId, err := uuid.Parse(claims.UserId)
+	if claims.TokenType != "access" || err != nil {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "subject token must be a user access token")
+		return
+	}
+	if err := auth.CheckConfirmation(claims.Confirmation, auth.GetConfirmation(c)); err != nil {
+		log.Printf("Subject token rejected: %v", err)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "missing proof of possession for the subject token")
+		return
+	}
+
+	permissions := strings.Fields(req.Scope)
+	if len(permissions) == 0 {
+		permissions = claims.Permissions
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(claims.Permissions, permission) {
+			tokenError(c, http.StatusBadRequest, ERROR_INVALID_SCOPE, "the requested scope exceeds the subject token's permissions")
+			return
+		}
+	}
+
+	options := client.TokenOptions()
+	lifetime := jwt.TOKEN_EXPIRATION
+	if options.AccessTokenLifetime > 0 {
+		lifetime = options.AccessTokenLifetime
+	}
+	options.AccessTokenLifetime = min(lifetime, time.Until(claims.ExpiresAt.Time))
+	options.AuthzVersion = claims.AuthzVersion
+	options.Audience = []string{req.Audience}
+	permissions = resourceService.RestrictPermissions(options.Audience, permissions)
+	options.Scope = permissions
+	options.Actor = &jwt.Actor{Subject: client.ClientId, Actor: claims.Actor}
+	options.Impersonated = claims.Impersonated // Tokens derived from an impersonation stay flagged as such
+	options.SessionId = claims.SessionId       // Revoking the session also revokes the exchanged token
+	options.Confirmation = auth.GetConfirmation(c)
+
+	token, err := jwt.GenerateAccessToken(userId, claims.Subject, []string{}, permissions, options)
+	if err == nil && referenceService.FormatFor(client.TokenFormat) == referenceService.TOKEN_FORMAT_REFERENCE {
+		err = referenceService.IssueToken(token)
+	}
+	if err != nil {
+		log.Printf("Error generating exchanged token: %v", err)
+		tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+		return
+	}
+
+	log.Printf("Token of user %s exchanged by client %s for audience %s", claims.Subject, client.ClientId, req.Audience)
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:     token.Token,
+		TokenType:       auth.TokenTypeFor(options.Confirmation),
+		ExpiresIn:       int64(time.Until(token.ExpiresAt).Seconds()),
+		Scope:           strings.Join(permissions, " "),
+		IssuedTokenType: TOKEN_TYPE_ACCESS_TOKEN,
+	})
+}
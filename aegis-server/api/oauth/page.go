@@ -0,0 +1,158 @@
+package oauth
+
+import (
+	"html/template"
+	"log"
+	"github.com/gin-gonic/gin"
+)
+
+// loginPage holds the data rendered into the hosted login page.
+type loginPage struct {
+	ClientName string
+	Subject    string
+	Error      string
+	Request    AuthorizationRequest
+}
+
+// devicePage holds the data rendered into the device verification page.
+type devicePage struct {
+	ClientName string // Known once a valid user code was entered
+	UserCode   string
+	Subject    string
+	Error      string
+}
+
+// deviceDonePage holds the data rendered once the user approved or denied a device.
+type deviceDonePage struct {
+	ClientName string
+	Approved   bool
+}
+
+// errorPage holds the data rendered when the request cannot be redirected back to the client.
+type errorPage struct {
+	Error string
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Sign in - Aegis</title>
+	<style>
+		body { font-family: system-ui, sans-serif; background: #f4f5f7; display: flex; justify-content: center; padding-top: 10vh; margin: 0; }
+		main { background: #fff; padding: 2rem; border-radius: 8px; box-shadow: 0 2px 8px rgba(0,0,0,.1); width: 100%; max-width: 360px; }
+		h1 { font-size: 1.25rem; margin: 0 0 .25rem; }
+		p { color: #555; margin: 0 0 1.5rem; }
+		label { display: block; font-size: .875rem; margin-bottom: .25rem; }
+		input[type=text], input[type=password] { width: 100%; box-sizing: border-box; padding: .5rem; margin-bottom: 1rem; border: 1px solid #ccc; border-radius: 4px; }
+		button { padding: .5rem 1rem; border: 0; border-radius: 4px; cursor: pointer; }
+		button[value=login] { background: #2563eb; color: #fff; }
+		.error { color: #b91c1c; background: #fee2e2; padding: .5rem; border-radius: 4px; }
+	</style>
+</head>
+<body>
+<main>
+	<h1>Sign in</h1>
+	<p>to continue to <strong>{{.ClientName}}</strong></p>
+	{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+	<form method="post">
+		<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+		<input type="hidden" name="client_id" value="{{.Request.ClientId}}">
+		<input type="hidden" name="redirect_uri" value="{{.Request.RedirectUri}}">
+		<input type="hidden" name="scope" value="{{.Request.Scope}}">
+		<input type="hidden" name="state" value="{{.Request.State}}">
+		<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+		<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+		<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+		<label for="subject">Username</label>
+		<input type="text" id="subject" name="subject" value="{{.Subject}}" autocomplete="username" required autofocus>
+		<label for="password">Password</label>
+		<input type="password" id="password" name="password" autocomplete="current-password" required>
+		<button type="submit" name="action" value="login">Sign in</button>
+		<button type="submit" name="action" value="deny" formnovalidate>Cancel</button>
+	</form>
+</main>
+</body>
+</html>
+`))
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Connect a device - Aegis</title>
+	<style>
+		body { font-family: system-ui, sans-serif; background: #f4f5f7; display: flex; justify-content: center; padding-top: 10vh; margin: 0; }
+		main { background: #fff; padding: 2rem; border-radius: 8px; box-shadow: 0 2px 8px rgba(0,0,0,.1); width: 100%; max-width: 360px; }
+		h1 { font-size: 1.25rem; margin: 0 0 .25rem; }
+		p { color: #555; margin: 0 0 1.5rem; }
+		label { display: block; font-size: .875rem; margin-bottom: .25rem; }
+		input[type=text], input[type=password] { width: 100%; box-sizing: border-box; padding: .5rem; margin-bottom: 1rem; border: 1px solid #ccc; border-radius: 4px; }
+		input[name=user_code] { font-family: monospace; font-size: 1.25rem; letter-spacing: .1em; text-transform: uppercase; }
+		button { padding: .5rem 1rem; border: 0; border-radius: 4px; cursor: pointer; }
+		button[value=approve] { background: #2563eb; color: #fff; }
+		.error { color: #b91c1c; background: #fee2e2; padding: .5rem; border-radius: 4px; }
+	</style>
+</head>
+<body>
+<main>
+	<h1>Connect a device</h1>
+	{{if .ClientName}}<p><strong>{{.ClientName}}</strong> is requesting access to your account. Only continue if the code matches the one shown on your device.</p>
+	{{else}}<p>Enter the code shown on your device.</p>{{end}}
+	{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+	<form method="post">
+		<label for="user_code">Code</label>
+		<input type="text" id="user_code" name="user_code" value="{{.UserCode}}" autocomplete="off" required {{if not .UserCode}}autofocus{{end}}>
+		<label for="subject">Username</label>
+		<input type="text" id="subject" name="subject" value="{{.Subject}}" autocomplete="username" required {{if .UserCode}}autofocus{{end}}>
+		<label for="password">Password</label>
+		<input type="password" id="password" name="password" autocomplete="current-password" required>
+		<button type="submit" name="action" value="approve">Approve</button>
+		<button type="submit" name="action" value="deny">Deny</button>
+	</form>
+</main>
+</body>
+</html>
+`))
+
+var deviceDoneTemplate = template.Must(template.New("device_done").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Connect a device - Aegis</title>
+</head>
+<body>
+	{{if .Approved}}<h1>Device connected</h1>
+	<p><strong>{{.ClientName}}</strong> now has access to your account. You can return to your device.</p>
+	{{else}}<h1>Request denied</h1>
+	<p><strong>{{.ClientName}}</strong> was not given access to your account.</p>{{end}}
+</body>
+</html>
+`))
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Authorization error - Aegis</title>
+</head>
+<body>
+	<h1>Authorization error</h1>
+	<p>{{.Error}}</p>
+</body>
+</html>
+`))
+
+// renderPage writes an HTML page with headers that prevent caching and framing (clickjacking).
+func renderPage(c *gin.Context, status int, tmpl *template.Template, data interface{}) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	c.Status(status)
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		log.Printf("Error rendering %s page: %v", tmpl.Name(), err)
+	}
+}
@@ -0,0 +1,340 @@
+package oauth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/api/auth"
+	authcodeService "nfcunha/aegis/domain/authcode"
+	clientService "nfcunha/aegis/domain/client"
+	referenceService "nfcunha/aegis/domain/reference"
+	refreshService "nfcunha/aegis/domain/refresh"
+	resourceService "nfcunha/aegis/domain/resource"
+	sessionService "nfcunha/aegis/domain/session"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+// TokenRequest represents an access token request (RFC 6749 sections 4.1.3 and 4.4.2)
+// with the PKCE verifier, a token exchange request (RFC 8693 section 2.1) or a device access
+// token request (RFC 8628 section 3.4).
+// Client credentials may also be sent with HTTP Basic authentication.
+type TokenRequest struct {
+	GrantType          string `form:"grant_type"`
+	Code               string `form:"code"`
+	RedirectUri        string `form:"redirect_uri"`
+	ClientId           string `form:"client_id"`
+	ClientSecret       string `form:"client_secret"`
+	CodeVerifier       string `form:"code_verifier"`
+	Scope              string `form:"scope"`
+	SubjectToken       string `form:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"`
+	RequestedTokenType string `form:"requested_token_type"`
+	Audience           string `form:"audience"`
+	DeviceCode         string `form:"device_code"`
+}
+
+// TokenResponse represents a successful access token response (RFC 6749 section 5.1).
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+
+	// IssuedTokenType is set for token exchange responses (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// exchangeToken issues tokens to an authenticated client.
+//
+// With the authorization_code grant, the code is exchanged for an access token, a refresh token
+// and, when the "openid" scope was requested, an ID token. With the client_credentials grant,
+// a confidential client receives an access token for itself, without refresh token. With the
+// token exchange grant, a confidential client trades a user's access token for a narrower one.
+// With the device code grant, a device polls until the user approved its request, then receives
+// the same tokens as with the authorization_code grant.
+//
+// Endpoint: POST /aegis/token
+//
+// Request Body (application/x-www-form-urlencoded):
+//   - grant_type: "authorization_code", "client_credentials",
+//     "urn:ietf:params:oauth:grant-type:token-exchange" or "urn:ietf:params:oauth:grant-type:device_code"
+//   - client_id, client_secret: Client credentials, unless sent with HTTP Basic authentication
+//   - code, redirect_uri, code_verifier: For the authorization_code grant
+//   - subject_token, subject_token_type, audience, requested_token_type: For the token exchange grant
+//   - device_code: For the device code grant
+//   - scope: Optional space-delimited scopes for the client_credentials grant, or the
+//     permissions to keep for the token exchange grant
+//   - audience: The resource server the token is for, optional for the client_credentials grant
+//
+// Headers:
+//   - DPoP: Optional DPoP proof (RFC 9449); the issued tokens are bound to its key and
+//     reported with token_type "DPoP"
+//
+// Tokens requested over a connection with a TLS client certificate are bound to the
+// certificate (RFC 8705).
+//
+// Response:
+//   - 200 OK: Tokens issued
+//   - 400 Bad Request: Invalid request, unsupported or unauthorized grant type, invalid scope
+//     or target, or invalid/expired/used code or subject token; for the device code grant, also
+//     authorization_pending, slow_down, access_denied or expired_token while polling
+//   - 401 Unauthorized: Client authentication failed
+func exchangeToken(c *gin.Context) {
+	log.Println("POST /aegis/token - Token request received")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		log.Printf("Invalid token request: %v", err)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_REQUEST, "malformed token request")
+		return
+	}
+
+	switch req.GrantType {
+	case clientService.GRANT_AUTHORIZATION_CODE, clientService.GRANT_CLIENT_CREDENTIALS, clientService.GRANT_TOKEN_EXCHANGE,
+		clientService.GRANT_DEVICE_CODE:
+	default:
+		tokenError(c, http.StatusBadRequest, ERROR_UNSUPPORTED_GRANT_TYPE, "unsupported grant type")
+		return
+	}
+
+	client, err := auth.AuthenticateClient(c)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		auth.AbortInvalidClient(c, err)
+		return
+	}
+	if !client.AllowsGrantType(req.GrantType) {
+		tokenError(c, http.StatusBadRequest, ERROR_UNAUTHORIZED_CLIENT, "the client is not allowed to use this grant type")
+		return
+	}
+
+	switch req.GrantType {
+	case clientService.GRANT_AUTHORIZATION_CODE:
+		exchangeAuthorizationCode(c, client, &req)
+	case clientService.GRANT_CLIENT_CREDENTIALS:
+		issueClientToken(c, client, &req)
+	case clientService.GRANT_TOKEN_EXCHANGE:
+		exchangeSubjectToken(c, client, &req)
+	case clientService.GRANT_DEVICE_CODE:
+		exchangeDeviceCode(c, client, &req)
+	}
+}
+
+// exchangeAuthorizationCode redeems an authorization code for the authenticated client.
+func exchangeAuthorizationCode(c *gin.Context, client *clientService.Client, req *TokenRequest) {
+	if req.Code == "" || req.RedirectUri == "" || req.CodeVerifier == "" {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_REQUEST, "code, redirect_uri and code_verifier are required")
+		return
+	}
+
+	code, err := authcodeService.ConsumeAuthorizationCode(req.Code)
+	if err != nil {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, determineCodeError(err))
+		return
+	}
+	if code.ClientId != client.ClientId {
+		log.Printf("Authorization code issued to %s redeemed by client %s", code.ClientId, client.ClientId)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "authorization code was issued to another client")
+		return
+	}
+	if code.RedirectUri != req.RedirectUri {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "redirect_uri does not match the authorization request")
+		return
+	}
+	if !code.VerifyCodeVerifier(req.CodeVerifier) {
+		log.Printf("PKCE verification failed for client %s", client.ClientId)
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "code_verifier does not match the code challenge")
+		return
+	}
+
+	user := userService.GetUserById(code.UserId)
+	if user == nil {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_GRANT, "user not found")
+		return
+	}
+	issueUserTokens(c, client, user, code.Scope, code.Nonce)
+}
+
+// issueUserTokens issues an access token, a refresh token and, when the "openid" scope was
+// granted, an ID token to a client acting on behalf of a user. The tokens carry the user's
+// roles and permissions, like a login, and are issued for the client as audience. Clients using
+// reference tokens receive opaque handles instead of the access and refresh JWTs. With a DPoP
+// proof or a client certificate, the tokens are bound to the proof's key or the certificate.
+// Like a login, each issuance starts a session the user can list and revoke. Roles and
+// permissions in the granted scope narrow the tokens to those grants the user holds, and the
+// response reports the scope the tokens were actually granted (RFC 6749 section 5.1).
+func issueUserTokens(c *gin.Context, client *clientService.Client, user *userService.User, scope string, nonce string) {
+	options := client.TokenOptions()
+	options.Scope = grantScope(scope)
+	roles, permissions := user.Grants(options.Scope)
+	options.AuthzVersion = user.AuthzVersion
+	options.Confirmation = auth.GetConfirmation(c)
+	options.Claims = client.UserClaims(user.AdditionalInfo)
+	session := sessionService.CreateSession(user.Id, client.ClientId, "", c.ClientIP(), c.Request.UserAgent())
+	options.SessionId = session.Id
+	permissions = resourceService.RestrictPermissions(options.Audience, permissions)
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, roles, permissions, options)
+	if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+		return
+	}
+	if _, err := refreshService.StartFamily(session.Id, user.Id, client.ClientId, tokenPair); err != nil {
+		log.Printf("Error recording refresh token: %v", err)
+		tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+		return
+	}
+	if err := sessionService.SaveSession(session); err != nil {
+		log.Printf("Error recording session: %v", err)
+		tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+		return
+	}
+	if referenceService.FormatFor(client.TokenFormat) == referenceService.TOKEN_FORMAT_REFERENCE {
+		if err := referenceService.Issue(tokenPair); err != nil {
+			log.Printf("Error storing reference tokens: %v", err)
+			tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+			return
+		}
+	}
+
+	response := TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		TokenType:    auth.TokenTypeFor(options.Confirmation),
+		ExpiresIn:    int64(time.Until(tokenPair.ExpiresAt).Seconds()),
+		RefreshToken: tokenPair.RefreshToken,
+		Scope:        grantedScope(scope, roles, permissions),
+	}
+
+	if hasScope(scope, "openid") {
+		idToken, err := jwt.GenerateIdToken(user.Id, user.Subject, client.ClientId, nonce, options.Claims)
+		if err != nil {
+			log.Printf("Error generating ID token: %v", err)
+			tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+			return
+		}
+		response.IdToken = idToken.Token
+	}
+
+	log.Printf("Tokens issued to client %s for user %s", client.ClientId, user.Subject)
+	c.JSON(http.StatusOK, response)
+}
+
+// issueClientToken issues an access token to a client acting on its own behalf.
+// Without a scope parameter, all scopes allowed for the client are granted. With an audience
+// parameter, the token is issued for that resource server and only carries scopes relevant to it;
+// otherwise it is issued for the client itself. With a DPoP proof or a client certificate, the token is bound to it.
+func issueClientToken(c *gin.Context, client *clientService.Client, req *TokenRequest) {
+	audience := []string{client.ClientId}
+	var server *resourceService.ResourceServer
+	if req.Audience != "" {
+		if server = resourceService.GetResourceServerByAudience(req.Audience); server == nil {
+			tokenError(c, http.StatusBadRequest, ERROR_INVALID_TARGET, "unknown audience")
+			return
+		}
+		audience = []string{server.Audience}
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+		if server != nil {
+			scopes = server.FilterPermissions(scopes)
+		}
+	}
+	if !client.AllowsScopes(scopes) {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_SCOPE, "the requested scope is not allowed for this client")
+		return
+	}
+	if server != nil && len(server.FilterPermissions(scopes)) != len(scopes) {
+		tokenError(c, http.StatusBadRequest, ERROR_INVALID_SCOPE, "the requested scope is not relevant to the audience")
+		return
+	}
+
+	confirmation := auth.GetConfirmation(c)
+	token, err := jwt.GenerateClientToken(client.ClientId, scopes, client.AccessTokenLifetime, audience, confirmation)
+	if err == nil && referenceService.FormatFor(client.TokenFormat) == referenceService.TOKEN_FORMAT_REFERENCE {
+		err = referenceService.IssueToken(token)
+	}
+	if err != nil {
+		log.Printf("Error generating client token: %v", err)
+		tokenError(c, http.StatusInternalServerError, ERROR_SERVER_ERROR, "failed to generate tokens")
+		return
+	}
+
+	log.Printf("Client token issued to %s", client.ClientId)
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: token.Token,
+		TokenType:   auth.TokenTypeFor(confirmation),
+		ExpiresIn:   int64(time.Until(token.ExpiresAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// determineCodeError maps authorization code errors to an error description.
+func determineCodeError(err error) string {
+	switch {
+	case errors.Is(err, authcodeService.ErrCodeExpired):
+		return "authorization code expired"
+	case errors.Is(err, authcodeService.ErrCodeAlreadyUsed):
+		return "authorization code already used"
+	default:
+		return "invalid authorization code"
+	}
+}
+
+// grantScope returns the values of a space-delimited scope string that select roles and
+// permissions. OpenID Connect scopes only select ID token claims and are left out, so that
+// requesting them alone does not narrow the tokens.
+func grantScope(scope string) []string {
+	values := []string{}
+	for _, value := range strings.Fields(scope) {
+		if value != "openid" && value != "profile" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// grantedScope returns the scope granted to tokens issued for a requested scope: its OpenID
+// Connect scopes, and the roles and permissions the tokens carry when the requested scope
+// narrowed them. Without narrowing, the requested scope was granted as is.
+func grantedScope(scope string, roles []string, permissions []string) string {
+	if len(grantScope(scope)) == 0 {
+		return scope
+	}
+	values := []string{}
+	for _, value := range strings.Fields(scope) {
+		if value == "openid" || value == "profile" {
+			values = append(values, value)
+		}
+	}
+	for _, role := range roles {
+		values = append(values, userService.ROLE_SCOPE_PREFIX+role)
+	}
+	values = append(values, permissions...)
+	return strings.Join(values, " ")
+}
+
+// hasScope reports whether a space-delimited scope string contains the given scope.
+func hasScope(scope string, wanted string) bool {
+	for _, value := range strings.Fields(scope) {
+		if value == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenError writes an OAuth 2.0 error response (RFC 6749 section 5.2).
+func tokenError(c *gin.Context, status int, errorCode string, description string) {
+	log.Printf("Token request rejected: %s (%s)", errorCode, description)
+	c.JSON(status, gin.H{"error": errorCode, "error_description": description})
+}
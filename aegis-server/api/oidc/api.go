@@ -0,0 +1,74 @@
+// Package oidc provides the OpenID Connect endpoints served by Aegis.
+// Discovery metadata is published by the wellknown package.
+package oidc
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
+	resourceService "nfcunha/aegis/domain/resource"
+	userService "nfcunha/aegis/domain/user"
+)
+
+type UserInfoResponse struct {
+	Sub               string   `json:"sub"`
+	PreferredUsername string   `json:"preferred_username"`
+	Roles             []string `json:"roles"`
+	Permissions       []string `json:"permissions"`
+}
+
+// RegisterApi registers the OpenID Connect routes with the Gin router.
+//
+// Protected endpoints (under /aegis context path, require a bearer access token):
+//   - GET  /userinfo - Claims about the authenticated user
+//   - POST /userinfo - Same as GET, as allowed by OpenID Connect Core section 5.3.1
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	router.GET("/userinfo", auth.RequireBearerToken(), getUserInfo)
+	router.POST("/userinfo", auth.RequireBearerToken(), getUserInfo)
+}
+
+// getUserInfo returns the claims of the user the access token was issued to.
+// Roles and permissions are read from the database rather than the token,
+// so the response reflects changes made after the token was issued. Like the token,
+// they are narrowed to its scope and to the permissions relevant to its audience.
+// Tokens acting on behalf of the user (exchanged and impersonation tokens) never report
+// more than they carry themselves, even when their scope is empty.
+func getUserInfo(c *gin.Context) {
+	log.Printf("%s /aegis/userinfo - UserInfo request received", c.Request.Method)
+	claims := auth.GetClaims(c)
+
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		log.Printf("Invalid user ID in token: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	user := userService.GetUserById(userId)
+	if user == nil {
+		log.Printf("User not found for userinfo: %s", claims.UserId)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	roles, permissions := user.Grants(strings.Fields(claims.Scope))
+	permissions = resourceService.RestrictPermissions(claims.Audience, permissions)
+	if claims.Actor != nil {
+		roles = slices.DeleteFunc(roles, func(role string) bool { return !slices.Contains(claims.Roles, role) })
+		permissions = slices.DeleteFunc(permissions, func(permission string) bool { return !slices.Contains(claims.Permissions, permission) })
+	}
+
+	c.JSON(http.StatusOK, UserInfoResponse{
+		Sub:               user.Id.String(),
+		PreferredUsername: user.Subject,
+		Roles:             roles,
+		Permissions:       permissions,
+	})
+}
@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	resourceService "nfcunha/aegis/domain/resource"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	aegis := router.Group("/aegis")
+	RegisterApi(aegis)
+	return router
+}
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// TestGetUserInfo_Success tests that userinfo returns live roles and permissions of the token's user
+func TestGetUserInfo_Success(t *testing.T) {
+	user := userService.CreateUser("userinfo@example.com", "password123", "system")
+	user.Roles = []userService.UserRole{"admin"}
+	user.Permissions = []userService.Permission{"read:users"}
+	userService.PersistUser(user)
+
+	// Token carries different grants; userinfo must report the stored ones
+	options := jwt.TokenOptions{AuthzVersion: user.AuthzVersion}
+	tokenPair, _ := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, []string{}, []string{}, options)
+
+	router := setupRouter()
+	for _, method := range []string{"GET", "POST"} {
+		req, _ := http.NewRequest(method, "/aegis/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d. Body: %s", method, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var response UserInfoResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Sub != user.Id.String() {
+			t.Errorf("Expected sub %s, got %s", user.Id, response.Sub)
+		}
+		if response.PreferredUsername != user.Subject {
+			t.Errorf("Expected preferred_username %s, got %s", user.Subject, response.PreferredUsername)
+		}
+		if len(response.Roles) != 1 || response.Roles[0] != "admin" {
+			t.Errorf("Expected roles [admin], got %v", response.Roles)
+		}
+		if len(response.Permissions) != 1 || response.Permissions[0] != "read:users" {
+			t.Errorf("Expected permissions [read:users], got %v", response.Permissions)
+		}
+	}
+}
+
+// TestGetUserInfo_Scoped tests that userinfo reports only the grants within the token's scope and audience
+func TestGetUserInfo_Scoped(t *testing.T) {
+	user := userService.CreateUser("userinfo-scoped@example.com", "password123", "system")
+	user.Roles = []userService.UserRole{"admin"}
+	user.Permissions = []userService.Permission{"read:users", "write:users", "read:reports"}
+	userService.PersistUser(user)
+	server := resourceService.CreateResourceServer("https://users.example.com", "Users API", []string{"read:users", "write:users"}, "system")
+	if err := resourceService.SaveResourceServer(server); err != nil {
+		t.Fatalf("Failed to save resource server: %v", err)
+	}
+
+	options := jwt.TokenOptions{
+		AuthzVersion: user.AuthzVersion,
+		Scope:        []string{"read:users", "read:reports"},
+		Audience:     []string{server.Audience},
+	}
+	tokenPair, _ := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, []string{}, []string{"read:users"}, options)
+
+	req, _ := http.NewRequest("GET", "/aegis/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response UserInfoResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Roles) != 0 {
+		t.Errorf("Expected no roles outside the scope, got %v", response.Roles)
+	}
+	if len(response.Permissions) != 1 || response.Permissions[0] != "read:users" {
+		t.Errorf("Expected permissions [read:users], got %v", response.Permissions)
+	}
+}
+
+// TestGetUserInfo_NoToken tests that userinfo requires a bearer token
+func TestGetUserInfo_NoToken(t *testing.T) {
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/userinfo", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestGetUserInfo_UnknownUser tests that tokens for deleted users are rejected
+func TestGetUserInfo_UnknownUser(t *testing.T) {
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "ghost@example.com", []string{}, []string{})
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -3,11 +3,19 @@ package api
 import (
 	"os"
 	"log"
+	"net/http"
 	"github.com/gin-gonic/gin"
 	authApi "nfcunha/aegis/api/auth"
 	userApi "nfcunha/aegis/api/user"
 	roleApi "nfcunha/aegis/api/role"
 	permissionApi "nfcunha/aegis/api/permission"
+	keyApi "nfcunha/aegis/api/key"
+	wellKnownApi "nfcunha/aegis/api/wellknown"
+	oidcApi "nfcunha/aegis/api/oidc"
+	oauthApi "nfcunha/aegis/api/oauth"
+	clientApi "nfcunha/aegis/api/client"
+	impersonationApi "nfcunha/aegis/api/impersonation"
+	resourceApi "nfcunha/aegis/api/resource"
 )
 
 const DEFAULT_SERVER_PORT = ":8080"
@@ -43,8 +51,26 @@ func RegisterApis() {
 	userApi.RegisterApi(aegis)
 	roleApi.RegisterApi(aegis)
 	permissionApi.RegisterApi(aegis)
+	keyApi.RegisterApi(aegis)
+	wellKnownApi.RegisterApi(aegis)
+	oidcApi.RegisterApi(aegis)
+	oauthApi.RegisterApi(aegis)
+	clientApi.RegisterApi(aegis)
+	impersonationApi.RegisterApi(aegis)
+	resourceApi.RegisterApi(aegis)
 	
-	err := router.Run(getServerPort())
+	// Serve HTTPS, optionally with client certificates, when a server certificate is configured
+	tlsConfig, err := getTlsConfig()
+	if err != nil {
+		log.Fatal("Failed to configure TLS: ", err)
+	}
+	wellKnownApi.CERTIFICATE_BOUND_TOKENS = authApi.CertificateBindingEnabled(tlsConfig)
+	if tlsConfig == nil {
+		err = router.Run(getServerPort())
+	} else {
+		server := &http.Server{Addr: getServerPort(), Handler: router.Handler(), TLSConfig: tlsConfig}
+		err = server.ListenAndServeTLS("", "")
+	}
 	if err != nil {
 		log.Println("Failed to start server:", err)
 	}
@@ -0,0 +1,189 @@
+// Package resource provides HTTP REST API endpoints for resource server registration.
+// Supports registering, listing, retrieving, updating and deleting the APIs that tokens can be restricted to.
+package resource
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	resourceService "nfcunha/aegis/domain/resource"
+)
+
+type CreateResourceServerRequest struct {
+	Audience    string   `json:"audience" binding:"required"`
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateResourceServerRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type ResourceServerResponse struct {
+	Id          string    `json:"id"`
+	Audience    string    `json:"audience"`
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   string    `json:"created_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UpdatedBy   string    `json:"updated_by"`
+}
+
+// RegisterApi registers all resource server HTTP routes with the Gin router.
+// Endpoints include create, list, get, update and delete.
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	servers := router.Group("/resource-servers")
+	{
+		servers.POST("", createResourceServer)
+		servers.GET("", listResourceServers)
+		servers.GET("/:id", getResourceServer)
+		servers.PUT("/:id", updateResourceServer)
+		servers.DELETE("/:id", deleteResourceServer)
+	}
+}
+
+func createResourceServer(c *gin.Context) {
+	log.Println("POST /aegis/resource-servers - Create resource server request received")
+	var req CreateResourceServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if resourceService.GetResourceServerByAudience(req.Audience) != nil {
+		log.Printf("Resource server already exists: %s", req.Audience)
+		c.JSON(http.StatusConflict, gin.H{"error": "resource server already exists"})
+		return
+	}
+
+	server := resourceService.CreateResourceServer(req.Audience, req.Name, req.Permissions, "system")
+	if err := server.Validate(); err != nil {
+		log.Printf("Invalid resource server: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := resourceService.SaveResourceServer(server); err != nil {
+		log.Printf("Error saving resource server: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save resource server"})
+		return
+	}
+
+	log.Printf("Resource server registered successfully: %s", server.Audience)
+	c.JSON(http.StatusCreated, toResourceServerResponse(server))
+}
+
+func listResourceServers(c *gin.Context) {
+	log.Println("GET /aegis/resource-servers - List resource servers request received")
+	servers := resourceService.ListResourceServers()
+	response := make([]ResourceServerResponse, len(servers))
+	for i, server := range servers {
+		response[i] = toResourceServerResponse(server)
+	}
+	log.Printf("Returning %d resource servers", len(response))
+	c.JSON(http.StatusOK, response)
+}
+
+func getResourceServer(c *gin.Context) {
+	id := c.Param("id")
+	log.Printf("GET /aegis/resource-servers/%s - Get resource server request received", id)
+	server := findResourceServer(c, id)
+	if server == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toResourceServerResponse(server))
+}
+
+func updateResourceServer(c *gin.Context) {
+	id := c.Param("id")
+	log.Printf("PUT /aegis/resource-servers/%s - Update resource server request received", id)
+	server := findResourceServer(c, id)
+	if server == nil {
+		return
+	}
+
+	var req UpdateResourceServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update name if provided
+	name := server.Name
+	if req.Name != "" {
+		name = req.Name
+	}
+
+	server.Update(name, req.Permissions, "system")
+	if err := server.Validate(); err != nil {
+		log.Printf("Invalid resource server: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := resourceService.UpdateResourceServer(server); err != nil {
+		log.Printf("Error updating resource server: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update resource server"})
+		return
+	}
+
+	log.Printf("Resource server updated successfully: %s", server.Audience)
+	c.JSON(http.StatusOK, toResourceServerResponse(server))
+}
+
+func deleteResourceServer(c *gin.Context) {
+	id := c.Param("id")
+	log.Printf("DELETE /aegis/resource-servers/%s - Delete resource server request received", id)
+	server := findResourceServer(c, id)
+	if server == nil {
+		return
+	}
+
+	if err := resourceService.DeleteResourceServer(server.Id); err != nil {
+		log.Printf("Error deleting resource server: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete resource server"})
+		return
+	}
+
+	log.Printf("Resource server deleted successfully: %s", server.Audience)
+	c.Status(http.StatusNoContent)
+}
+
+// findResourceServer looks up the resource server of the request path,
+// writing a 400 or 404 response if it cannot be found.
+func findResourceServer(c *gin.Context, id string) *resourceService.ResourceServer {
+	serverId, err := uuid.Parse(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resource server id"})
+		return nil
+	}
+	server := resourceService.GetResourceServerById(serverId)
+	if server == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "resource server not found"})
+		return nil
+	}
+	return server
+}
+
+func toResourceServerResponse(server *resourceService.ResourceServer) ResourceServerResponse {
+	permissions := server.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return ResourceServerResponse{
+		Id:          server.Id.String(),
+		Audience:    server.Audience,
+		Name:        server.Name,
+		Permissions: permissions,
+		CreatedAt:   server.CreatedAt,
+		CreatedBy:   server.CreatedBy,
+		UpdatedAt:   server.UpdatedAt,
+		UpdatedBy:   server.UpdatedBy,
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Client certificate modes selectable with AEGIS_TLS_CLIENT_AUTH.
+const (
+	CLIENT_AUTH_NONE    = "none"    // Do not ask for client certificates
+	CLIENT_AUTH_REQUEST = "request" // Accept any certificate, e.g. self-signed ones, for binding tokens only
+	CLIENT_AUTH_VERIFY  = "verify"  // Verify certificates against the client CA when presented
+	CLIENT_AUTH_REQUIRE = "require" // Reject connections without a certificate signed by the client CA
+)
+
+// getTlsConfig builds the TLS configuration of the listener from the environment:
+//   - AEGIS_TLS_CERT_FILE and AEGIS_TLS_KEY_FILE: PEM server certificate and key; without them
+//     Aegis serves plain HTTP
+//   - AEGIS_TLS_CLIENT_CA_FILE: PEM bundle of the CAs that issue client certificates
+//   - AEGIS_TLS_CLIENT_AUTH: "none", "request", "verify" or "require"; defaults to "verify"
+//     when a client CA is configured and "none" otherwise
+//
+// Returns:
+//   - The TLS configuration, or nil to serve plain HTTP
+//   - Error if a file cannot be loaded or the settings are inconsistent
+func getTlsConfig() (*tls.Config, error) {
+	const TLS_CERT_FILE_ENV = "AEGIS_TLS_CERT_FILE"
+	const TLS_KEY_FILE_ENV = "AEGIS_TLS_KEY_FILE"
+	const TLS_CLIENT_CA_FILE_ENV = "AEGIS_TLS_CLIENT_CA_FILE"
+	const TLS_CLIENT_AUTH_ENV = "AEGIS_TLS_CLIENT_AUTH"
+
+	certFile := os.Getenv(TLS_CERT_FILE_ENV)
+	keyFile := os.Getenv(TLS_KEY_FILE_ENV)
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s and %s must be set together", TLS_CERT_FILE_ENV, TLS_KEY_FILE_ENV)
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caFile := os.Getenv(TLS_CLIENT_CA_FILE_ENV); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA file")
+		}
+	}
+
+	clientAuth := os.Getenv(TLS_CLIENT_AUTH_ENV)
+	if clientAuth == "" {
+		clientAuth = CLIENT_AUTH_NONE
+		if config.ClientCAs != nil {
+			clientAuth = CLIENT_AUTH_VERIFY
+		}
+	}
+	switch clientAuth {
+	case CLIENT_AUTH_NONE:
+		config.ClientAuth = tls.NoClientCert
+	case CLIENT_AUTH_REQUEST:
+		config.ClientAuth = tls.RequestClientCert
+	case CLIENT_AUTH_VERIFY, CLIENT_AUTH_REQUIRE:
+		if config.ClientCAs == nil {
+			return nil, fmt.Errorf("%s=%s requires %s", TLS_CLIENT_AUTH_ENV, clientAuth, TLS_CLIENT_CA_FILE_ENV)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if clientAuth == CLIENT_AUTH_REQUIRE {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s value '%s'", TLS_CLIENT_AUTH_ENV, clientAuth)
+	}
+
+	log.Printf("Using TLS with certificate %s (client certificates: %s)", certFile, clientAuth)
+	return config, nil
+}
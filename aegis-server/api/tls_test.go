@@ -0,0 +1,102 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM files
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "aegis.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+// TestGetTlsConfig tests the listener TLS settings read from the environment
+func TestGetTlsConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	cases := []struct {
+		name               string
+		cert               string
+		key                string
+		clientCa           string
+		clientAuth         string
+		expectedClientAuth tls.ClientAuthType
+		expectError        bool
+	}{
+		{"server certificate only", certFile, keyFile, "", "", tls.NoClientCert, false},
+		{"client CA verifies when given", certFile, keyFile, certFile, "", tls.VerifyClientCertIfGiven, false},
+		{"client certificate required", certFile, keyFile, certFile, CLIENT_AUTH_REQUIRE, tls.RequireAndVerifyClientCert, false},
+		{"any client certificate", certFile, keyFile, "", CLIENT_AUTH_REQUEST, tls.RequestClientCert, false},
+		{"verify without client CA", certFile, keyFile, "", CLIENT_AUTH_VERIFY, 0, true},
+		{"invalid client auth", certFile, keyFile, certFile, "sometimes", 0, true},
+		{"certificate without key", certFile, "", "", "", 0, true},
+		{"missing certificate file", filepath.Join(t.TempDir(), "missing.pem"), keyFile, "", "", 0, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AEGIS_TLS_CERT_FILE", tc.cert)
+			t.Setenv("AEGIS_TLS_KEY_FILE", tc.key)
+			t.Setenv("AEGIS_TLS_CLIENT_CA_FILE", tc.clientCa)
+			t.Setenv("AEGIS_TLS_CLIENT_AUTH", tc.clientAuth)
+
+			config, err := getTlsConfig()
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getTlsConfig failed: %v", err)
+			}
+			if config.ClientAuth != tc.expectedClientAuth {
+				t.Errorf("Expected client auth %v, got %v", tc.expectedClientAuth, config.ClientAuth)
+			}
+			if len(config.Certificates) != 1 {
+				t.Errorf("Expected the server certificate to be loaded")
+			}
+		})
+	}
+}
+
+// TestGetTlsConfig_PlainHttp tests that no TLS is configured without a server certificate
+func TestGetTlsConfig_PlainHttp(t *testing.T) {
+	t.Setenv("AEGIS_TLS_CERT_FILE", "")
+	t.Setenv("AEGIS_TLS_KEY_FILE", "")
+
+	if config, err := getTlsConfig(); config != nil || err != nil {
+		t.Errorf("Expected plain HTTP, got %v, %v", config, err)
+	}
+}
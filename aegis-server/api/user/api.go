@@ -3,32 +3,48 @@
 package user
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
+	clientService "nfcunha/aegis/domain/client"
+	referenceService "nfcunha/aegis/domain/reference"
+	refreshService "nfcunha/aegis/domain/refresh"
+	resourceService "nfcunha/aegis/domain/resource"
+	sessionService "nfcunha/aegis/domain/session"
 	userService "nfcunha/aegis/domain/user"
 	"nfcunha/aegis/util/jwt"
 )
 
 type RegisterRequest struct {
-	Subject     string   `json:"subject" binding:"required"`
-	Password    string   `json:"password" binding:"required,min=8"`
-	Roles       []string `json:"roles"`
-	Permissions []string `json:"permissions"`
+	Subject        string                 `json:"subject" binding:"required"`
+	Password       string                 `json:"password" binding:"required,min=8"`
+	Roles          []string               `json:"roles"`
+	Permissions    []string               `json:"permissions"`
+	AdditionalInfo map[string]interface{} `json:"additional_info"` // Attributes such as department or tenant, mapped into tokens with claim mappings
 }
 
 type LoginRequest struct {
-	Subject  string `json:"subject" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Subject      string `json:"subject" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Audience     string `json:"audience"` // Registered resource server the tokens are for
+	Scope        string `json:"scope"`    // Space-delimited roles ("role:<name>") and permissions to narrow the tokens to
+	Device       string `json:"device"`   // Human-readable name of the device, shown in the user's sessions
 }
 
 type UpdateUserRequest struct {
-	Subject     string   `json:"subject"`
-	Password    string   `json:"password,omitempty"`
-	Roles       []string `json:"roles"`
-	Permissions []string `json:"permissions"`
+	Subject        string                 `json:"subject"`
+	Password       string                 `json:"password,omitempty"`
+	Roles          []string               `json:"roles"`
+	Permissions    []string               `json:"permissions"`
+	AdditionalInfo map[string]interface{} `json:"additional_info"` // Replaces the user's attributes when provided
 }
 
 type ChangePasswordRequest struct {
@@ -38,6 +54,7 @@ type ChangePasswordRequest struct {
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
+	Scope        string `json:"scope"` // Narrows the tokens further; must be within the scope of the login
 }
 
 type AddRoleRequest struct {
@@ -49,26 +66,35 @@ type AddPermissionRequest struct {
 }
 
 type UserResponse struct {
-	Id          string                     `json:"id"`
-	Subject     string                     `json:"subject"`
-	CreatedAt   time.Time                  `json:"created_at"`
-	CreatedBy   string                     `json:"created_by"`
-	UpdatedAt   time.Time                  `json:"updated_at"`
-	UpdatedBy   string                     `json:"updated_by"`
-	Roles       []userService.UserRole     `json:"roles"`
-	Permissions []userService.Permission   `json:"permissions"`
+	Id             string                   `json:"id"`
+	Subject        string                   `json:"subject"`
+	CreatedAt      time.Time                `json:"created_at"`
+	CreatedBy      string                   `json:"created_by"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+	UpdatedBy      string                   `json:"updated_by"`
+	Roles          []userService.UserRole   `json:"roles"`
+	Permissions    []userService.Permission `json:"permissions"`
+	AdditionalInfo map[string]interface{}   `json:"additional_info,omitempty"`
 }
 
 type LoginResponse struct {
 	User         UserResponse `json:"user"`
 	AccessToken  string       `json:"access_token"`
 	RefreshToken string       `json:"refresh_token"`
+	TokenType    string       `json:"token_type"` // "DPoP" for tokens bound to the client's key, otherwise "Bearer"
 	ExpiresAt    time.Time    `json:"expires_at"`
 	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionId    string       `json:"session_id,omitempty"` // Login session the tokens belong to
+}
+
+type RevokeTokensResponse struct {
+	TokensValidAfter time.Time `json:"tokens_valid_after"`
 }
 
 // RegisterApi registers all user-related HTTP routes with the Gin router.
-// Endpoints include register, login, list, get, update, delete, and change password.
+// Endpoints include register, login, list, get, update, delete, change password,
+// revoking all tokens of a user, and listing and revoking a user's login sessions, either by
+// an administrator or by the user themselves.
 //
 // Parameters:
 //   - router: The Gin RouterGroup to register routes with (already under /aegis)
@@ -76,13 +102,19 @@ func RegisterApi(router gin.IRouter) {
 	users := router.Group("/users")
 	{
 		users.POST("/register", registerUser)
-		users.POST("/login", loginUser)
-		users.POST("/refresh", refreshToken)
+		users.POST("/login", auth.AcceptDPoPProof(), loginUser)
+		users.POST("/refresh", auth.AcceptDPoPProof(), refreshToken)
+		users.POST("/me/revoke-tokens", auth.RequireBearerToken(), revokeOwnTokens)
+		users.GET("/me/sessions", auth.RequireBearerToken(), listOwnSessions)
+		users.DELETE("/me/sessions/:sessionId", auth.RequireBearerToken(), revokeOwnSession)
 		users.GET("", listUsers)
 		users.GET("/:id", getUser)
 		users.PUT("/:id", updateUser)
 		users.DELETE("/:id", deleteUser)
 		users.POST("/:id/password", changePassword)
+		users.POST("/:id/revoke-tokens", revokeUserTokens)
+		users.GET("/:id/sessions", listUserSessions)
+		users.DELETE("/:id/sessions/:sessionId", revokeUserSession)
 		users.POST("/:id/roles", addRoleToUser)
 		users.DELETE("/:id/roles/:role", removeRoleFromUser)
 		users.POST("/:id/permissions", addPermissionToUser)
@@ -119,6 +151,11 @@ func registerUser(c *gin.Context) {
 		user.Permissions = append(user.Permissions, userService.Permission(permission))
 	}
 
+	// Add additional info
+	if req.AdditionalInfo != nil {
+		user.UpdateAdditionalInfo(req.AdditionalInfo, "system")
+	}
+
 	// Persist user
 	userService.PersistUser(user)
 
@@ -150,31 +187,80 @@ func loginUser(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	roles := make([]string, len(user.Roles))
-	for i, role := range user.Roles {
-		roles[i] = string(role)
+	// Tokens requested on behalf of a registered client carry its ID and lifetimes, and use its
+	// token format and claim mappings
+	var options jwt.TokenOptions
+	tokenFormat := referenceService.FormatFor("")
+	options.Claims = jwt.MapClaims(user.AdditionalInfo, jwt.CLAIM_MAPPINGS)
+	if req.ClientId != "" {
+		client, err := clientService.Authenticate(req.ClientId, req.ClientSecret)
+		if err != nil {
+			log.Printf("Login failed: invalid client - %s", req.ClientId)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid client"})
+			return
+		}
+		options = client.TokenOptions()
+		options.Claims = client.UserClaims(user.AdditionalInfo)
+		tokenFormat = referenceService.FormatFor(client.TokenFormat)
 	}
 
-	permissions := make([]string, len(user.Permissions))
-	for i, permission := range user.Permissions {
-		permissions[i] = string(permission)
+	// An explicit audience replaces the client as audience
+	if req.Audience != "" {
+		server := resourceService.GetResourceServerByAudience(req.Audience)
+		if server == nil {
+			log.Printf("Login failed: unknown audience - %s", req.Audience)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown audience"})
+			return
+		}
+		options.Audience = []string{server.Audience}
 	}
 
-	tokenPair, err := jwt.GenerateTokenPair(user.Id, user.Subject, roles, permissions)
+	// Generate token, with only the requested grants the user holds
+	options.Scope = strings.Fields(req.Scope)
+	roles, permissions := user.Grants(options.Scope)
+
+	// With a DPoP proof or a client certificate, the tokens are bound to the client's key
+	options.Confirmation = auth.GetConfirmation(c)
+
+	// Every login starts a session, which the tokens name in their "sid" claim
+	session := sessionService.CreateSession(user.Id, options.ClientId, req.Device, c.ClientIP(), c.Request.UserAgent())
+	options.SessionId = session.Id
+
+	options.AuthzVersion = user.AuthzVersion
+	permissions = resourceService.RestrictPermissions(options.Audience, permissions)
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, roles, permissions, options)
 	if err != nil {
 		log.Printf("Failed to generate tokens for user %s: %v", req.Subject, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
 		return
 	}
+	if _, err := refreshService.StartFamily(session.Id, user.Id, options.ClientId, tokenPair); err != nil {
+		log.Printf("Failed to record refresh token for user %s: %v", req.Subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+	if err := sessionService.SaveSession(session); err != nil {
+		log.Printf("Failed to record session for user %s: %v", req.Subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+	if tokenFormat == referenceService.TOKEN_FORMAT_REFERENCE {
+		if err := referenceService.Issue(tokenPair); err != nil {
+			log.Printf("Failed to store reference tokens for user %s: %v", req.Subject, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+			return
+		}
+	}
 
 	log.Printf("User logged in successfully: %s", user.Subject)
 	c.JSON(http.StatusOK, LoginResponse{
 		User:             toUserResponse(user),
 		AccessToken:      tokenPair.AccessToken,
 		RefreshToken:     tokenPair.RefreshToken,
+		TokenType:        auth.TokenTypeFor(options.Confirmation),
 		ExpiresAt:        tokenPair.ExpiresAt,
 		RefreshExpiresAt: tokenPair.RefreshExpiresAt,
+		SessionId:        session.Id,
 	})
 }
 
@@ -187,8 +273,11 @@ func refreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	claims, err := jwt.ValidateRefreshToken(req.RefreshToken)
+	// Validate refresh token, rejecting it if revoked
+	claims, err := auth.VerifyToken(req.RefreshToken)
+	if err == nil && claims.TokenType != "refresh" {
+		err = errors.New("token is not a refresh token")
+	}
 	if err != nil {
 		log.Printf("Invalid refresh token: %v", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
@@ -210,31 +299,96 @@ func refreshToken(c *gin.Context) {
 		return
 	}
 
-	// Generate new token pair
-	roles := make([]string, len(user.Roles))
-	for i, role := range user.Roles {
-		roles[i] = string(role)
+	// Keep issuing tokens to the client and audience the session was started with, with
+	// custom claims mapped from the user's current attributes
+	var options jwt.TokenOptions
+	tokenFormat := referenceService.FormatFor("")
+	options.Claims = jwt.MapClaims(user.AdditionalInfo, jwt.CLAIM_MAPPINGS)
+	if claims.ClientId != "" {
+		client := clientService.GetClientById(claims.ClientId)
+		if client == nil {
+			log.Printf("Client not found for token refresh: %s", claims.ClientId)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		options = client.TokenOptions()
+		options.Claims = client.UserClaims(user.AdditionalInfo)
+		tokenFormat = referenceService.FormatFor(client.TokenFormat)
+	}
+	options.Audience = claims.Audience
+
+	// A refresh can narrow the scope of the login but never widen it
+	options.Scope = strings.Fields(claims.Scope)
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, value := range requested {
+			if len(options.Scope) > 0 && !slices.Contains(options.Scope, value) {
+				log.Printf("Refresh rejected: scope %s was not granted to user %s", value, user.Subject)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "requested scope exceeds the original grant"})
+				return
+			}
+		}
+		options.Scope = requested
+	}
+
+	// A bound refresh token can only be used with a proof from the same DPoP key and over
+	// a connection with the same client certificate
+	options.Confirmation = auth.GetConfirmation(c)
+	if err := auth.CheckConfirmation(claims.Confirmation, options.Confirmation); err != nil {
+		log.Printf("Refresh rejected for user %s: %v", user.Subject, err)
+		if errors.Is(err, auth.ErrInvalidCertificateBinding) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid client certificate"})
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid DPoP proof"})
+		}
+		return
 	}
 
-	permissions := make([]string, len(user.Permissions))
-	for i, permission := range user.Permissions {
-		permissions[i] = string(permission)
-	}
+	// Generate new token pair with the current grants, in the same session
+	roles, permissions := user.Grants(options.Scope)
 
-	tokenPair, err := jwt.GenerateTokenPair(user.Id, user.Subject, roles, permissions)
+	options.SessionId = claims.SessionId
+	options.AuthzVersion = user.AuthzVersion
+	permissions = resourceService.RestrictPermissions(options.Audience, permissions)
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(user.Id, user.Subject, roles, permissions, options)
 	if err != nil {
 		log.Printf("Failed to generate new tokens for user %s: %v", user.Subject, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
 		return
 	}
 
+	// Retire the presented refresh token; replaying a retired token revokes its whole family
+	if _, err := refreshService.Rotate(claims.ID, tokenPair); err != nil {
+		if errors.Is(err, refreshService.ErrTokenNotFound) || errors.Is(err, refreshService.ErrTokenReused) || errors.Is(err, refreshService.ErrTokenRevoked) {
+			log.Printf("Refresh token rejected for user %s: %v", user.Subject, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		log.Printf("Failed to rotate refresh token for user %s: %v", user.Subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+	if options.SessionId != "" {
+		if err := sessionService.TouchSession(options.SessionId); err != nil {
+			log.Printf("Failed to record refresh of session %s: %v", options.SessionId, err)
+		}
+	}
+	if tokenFormat == referenceService.TOKEN_FORMAT_REFERENCE {
+		if err := referenceService.Issue(tokenPair); err != nil {
+			log.Printf("Failed to store reference tokens for user %s: %v", user.Subject, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+			return
+		}
+	}
+
 	log.Printf("Token refreshed successfully for user: %s", user.Subject)
 	c.JSON(http.StatusOK, LoginResponse{
 		User:             toUserResponse(user),
 		AccessToken:      tokenPair.AccessToken,
 		RefreshToken:     tokenPair.RefreshToken,
+		TokenType:        auth.TokenTypeFor(options.Confirmation),
 		ExpiresAt:        tokenPair.ExpiresAt,
 		RefreshExpiresAt: tokenPair.RefreshExpiresAt,
+		SessionId:        options.SessionId,
 	})
 }
 
@@ -305,6 +459,18 @@ func updateUser(c *gin.Context) {
 		user.UpdatePassword(req.Password, "system")
 	}
 
+	// Changing the password or removing grants affects outstanding tokens
+	var events []userService.ChangeEvent
+	if req.Password != "" {
+		events = append(events, userService.EVENT_PASSWORD_CHANGED)
+	}
+	if removesAny(user.Roles, req.Roles) {
+		events = append(events, userService.EVENT_ROLE_REMOVED)
+	}
+	if removesAny(user.Permissions, req.Permissions) {
+		events = append(events, userService.EVENT_PERMISSION_REMOVED)
+	}
+
 	// Update roles
 	user.Roles = make([]userService.UserRole, len(req.Roles))
 	for i, role := range req.Roles {
@@ -317,10 +483,16 @@ func updateUser(c *gin.Context) {
 		user.Permissions[i] = userService.Permission(permission)
 	}
 
+	// Update additional info if provided
+	if req.AdditionalInfo != nil {
+		user.UpdateAdditionalInfo(req.AdditionalInfo, "system")
+	}
+
 	user.UpdatedAt = time.Now()
 	user.UpdatedBy = "system"
 
 	userService.PersistUser(user)
+	invalidateTokens(user.Id, events...)
 
 	c.JSON(http.StatusOK, toUserResponse(user))
 }
@@ -343,6 +515,7 @@ func deleteUser(c *gin.Context) {
 	}
 
 	userService.DeleteUser(userId)
+	invalidateTokens(userId, userService.EVENT_USER_DELETED)
 
 	log.Printf("User deleted: %s", user.Subject)
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
@@ -377,10 +550,58 @@ func changePassword(c *gin.Context) {
 	// Update password
 	user.UpdatePassword(req.NewPassword, "system")
 	userService.UpdateUser(user)
+	invalidateTokens(user.Id, userService.EVENT_PASSWORD_CHANGED)
 
 	c.JSON(http.StatusOK, gin.H{"message": "password changed successfully"})
 }
 
+func revokeUserTokens(c *gin.Context) {
+	idStr := c.Param("id")
+	log.Printf("POST /aegis/users/%s/revoke-tokens - Revoke user tokens request received", idStr)
+	userId, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	user := userService.GetUserById(userId)
+	if user == nil {
+		log.Printf("User not found: %s", idStr)
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	validAfter, err := userService.RevokeAllTokens(user.Id, "system")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	log.Printf("All tokens revoked for user %s", user.Subject)
+	c.JSON(http.StatusOK, RevokeTokensResponse{TokensValidAfter: validAfter})
+}
+
+func revokeOwnTokens(c *gin.Context) {
+	log.Println("POST /aegis/users/me/revoke-tokens - Revoke own tokens request received")
+	claims := auth.GetClaims(c)
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		// Client credentials tokens have no user
+		c.JSON(http.StatusForbidden, gin.H{"error": "user token required"})
+		return
+	}
+
+	validAfter, err := userService.RevokeAllTokens(userId, claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	log.Printf("User %s logged out everywhere", claims.Subject)
+	c.JSON(http.StatusOK, RevokeTokensResponse{TokensValidAfter: validAfter})
+}
+
 func addRoleToUser(c *gin.Context) {
 	idStr := c.Param("id")
 	log.Printf("POST /aegis/users/%s/roles - Add role to user request received", idStr)
@@ -450,6 +671,7 @@ func removeRoleFromUser(c *gin.Context) {
 	// Remove role
 	user.RemoveRole(role, "system")
 	userService.RemoveUserRole(user, role)
+	invalidateTokens(user.Id, userService.EVENT_ROLE_REMOVED)
 
 	log.Printf("Role %s removed from user %s", roleStr, user.Subject)
 	c.JSON(http.StatusOK, toUserResponse(user))
@@ -524,11 +746,36 @@ func removePermissionFromUser(c *gin.Context) {
 	// Remove permission
 	user.RemovePermission(permission, "system")
 	userService.RemoveUserPermission(user, permission)
+	invalidateTokens(user.Id, userService.EVENT_PERMISSION_REMOVED)
 
 	log.Printf("Permission %s removed from user %s", permissionStr, user.Subject)
 	c.JSON(http.StatusOK, toUserResponse(user))
 }
 
+// invalidateTokens applies the configured token policy of each account change to the
+// user's outstanding tokens. Failures are logged; the account change itself is kept.
+//
+// Parameters:
+//   - userId: The UUID of the changed user
+//   - events: The account changes that were made
+func invalidateTokens(userId uuid.UUID, events ...userService.ChangeEvent) {
+	for _, event := range events {
+		if err := userService.InvalidateTokens(userId, event, "system"); err != nil {
+			log.Printf("Failed to invalidate tokens of user %s after %s: %v", userId.String(), event, err)
+		}
+	}
+}
+
+// removesAny reports whether any of the current values is missing from the updated values.
+func removesAny[T ~string](current []T, updated []string) bool {
+	for _, value := range current {
+		if !slices.Contains(updated, string(value)) {
+			return true
+		}
+	}
+	return false
+}
+
 // toUserResponse converts a domain User model to an API UserResponse.
 // Excludes sensitive fields like password hashes.
 //
@@ -539,13 +786,14 @@ func removePermissionFromUser(c *gin.Context) {
 //   - UserResponse containing safe user data for API responses
 func toUserResponse(user *userService.User) UserResponse {
 	return UserResponse{
-		Id:          user.Id.String(),
-		Subject:     user.Subject,
-		CreatedAt:   user.CreatedAt,
-		CreatedBy:   user.CreatedBy,
-		UpdatedAt:   user.UpdatedAt,
-		UpdatedBy:   user.UpdatedBy,
-		Roles:       user.Roles,
-		Permissions: user.Permissions,
+		Id:             user.Id.String(),
+		Subject:        user.Subject,
+		CreatedAt:      user.CreatedAt,
+		CreatedBy:      user.CreatedBy,
+		UpdatedAt:      user.UpdatedAt,
+		UpdatedBy:      user.UpdatedBy,
+		Roles:          user.Roles,
+		Permissions:    user.Permissions,
+		AdditionalInfo: user.AdditionalInfo,
 	}
 }
\ No newline at end of file
@@ -2,14 +2,30 @@ package user
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
 	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	referenceService "nfcunha/aegis/domain/reference"
+	resourceService "nfcunha/aegis/domain/resource"
+	"nfcunha/aegis/domain/token"
 	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
 )
 
 func setupTestDB() {
@@ -169,6 +185,729 @@ func TestLoginUser_Success(t *testing.T) {
 	}
 }
 
+// TestLoginUser_WithClient tests that tokens requested for a client carry its ID and lifetime,
+// and that refreshing keeps them
+func TestLoginUser_WithClient(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("login-client@example.com", "password123", "system")
+	userService.PersistUser(user)
+	
+	client := clientService.CreateClient("Portal", []string{"https://portal.example.com/callback"}, "system")
+	client.AccessTokenLifetime = 10 * time.Minute
+	secret, _ := client.GenerateSecret("system")
+	clientService.SaveClient(client)
+	
+	// Confidential clients must present their secret
+	loginBody, _ := json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123", ClientId: client.ClientId})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without client secret, got %d", http.StatusUnauthorized, w.Code)
+	}
+	
+	loginBody, _ = json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123", ClientId: client.ClientId, ClientSecret: secret})
+	req, _ = http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var response LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims.ClientId != client.ClientId {
+		t.Errorf("Expected client_id %s, got %s", client.ClientId, claims.ClientId)
+	}
+	if lifetime := time.Until(response.ExpiresAt); lifetime > 11*time.Minute {
+		t.Errorf("Expected client access token lifetime, got %v", lifetime)
+	}
+	
+	refreshBody, _ := json.Marshal(RefreshTokenRequest{RefreshToken: response.RefreshToken})
+	req, _ = http.NewRequest("POST", "/aegis/users/refresh", bytes.NewBuffer(refreshBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	refreshedClaims, _ := jwt.ValidateToken(refreshed.AccessToken)
+	if refreshedClaims == nil || refreshedClaims.ClientId != client.ClientId {
+		t.Errorf("Expected refreshed token to keep client_id %s", client.ClientId)
+	}
+}
+
+// refresh posts a refresh token to the refresh endpoint
+func refresh(router *gin.Engine, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(RefreshTokenRequest{RefreshToken: refreshToken})
+	req, _ := http.NewRequest("POST", "/aegis/users/refresh", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestRefreshToken_Rotation tests that refreshing issues a new refresh token and retires the old one,
+// and that replaying the old token revokes the whole family
+func TestRefreshToken_Rotation(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("rotation@example.com", "password123", "system")
+	userService.PersistUser(user)
+	
+	loginBody, _ := json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123"})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var login LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &login)
+	
+	w = refresh(router, login.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Error("Expected a new refresh token")
+	}
+	
+	// Replaying the retired token is rejected and revokes the family
+	if w = refresh(router, login.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d on reuse, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = refresh(router, refreshed.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after family revocation, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRefreshToken_NotIssued tests that a validly signed refresh token unknown to the server is rejected
+func TestRefreshToken_NotIssued(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("not-issued@example.com", "password123", "system")
+	userService.PersistUser(user)
+	tokenPair, _ := jwt.GenerateTokenPair(user.Id, user.Subject, []string{}, []string{})
+	
+	if w := refresh(router, tokenPair.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// gatewayClient registers a confidential client, which introspection and revocation require
+func gatewayClient(t *testing.T) (*clientService.Client, string) {
+	client := clientService.CreateClient("API Gateway", nil, "system")
+	secret, _ := client.GenerateSecret("system")
+	if err := clientService.SaveClient(client); err != nil {
+		t.Fatalf("Failed to save client: %v", err)
+	}
+	return client, secret
+}
+
+// login logs a user in and returns the issued tokens
+func login(t *testing.T, router *gin.Engine, subject string, password string) LoginResponse {
+	body, _ := json.Marshal(LoginRequest{Subject: subject, Password: password})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login failed with status %d: %s", w.Code, w.Body.String())
+	}
+	var response LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// TestRevokeUserTokens tests that an administrator can invalidate every token of a user
+func TestRevokeUserTokens(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("revoke-all@example.com", "password123", "system")
+	userService.PersistUser(user)
+	first := login(t, router, user.Subject, "password123")
+	second := login(t, router, user.Subject, "password123")
+	
+	req, _ := http.NewRequest("POST", "/aegis/users/"+user.Id.String()+"/revoke-tokens", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	for _, session := range []LoginResponse{first, second} {
+		if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenRevoked {
+			t.Errorf("Expected access token to be revoked, got %v", err)
+		}
+		if w := refresh(router, session.RefreshToken); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d on refresh, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// Logging in again right away is not affected, even within the same second
+	if _, err := auth.VerifyToken(login(t, router, user.Subject, "password123").AccessToken); err != nil {
+		t.Errorf("Expected a new login to be valid, got %v", err)
+	}
+}
+
+// TestMarkTokensStale_Refresh tests that the refresh a stale token asks for yields a valid token right away
+func TestMarkTokensStale_Refresh(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("stale-refresh@example.com", "password123", "system")
+	userService.PersistUser(user)
+	session := login(t, router, user.Subject, "password123")
+	
+	if _, err := userService.MarkTokensStale(user.Id, "system"); err != nil {
+		t.Fatalf("MarkTokensStale failed: %v", err)
+	}
+	if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenStale {
+		t.Fatalf("Expected access token to be stale, got %v", err)
+	}
+	
+	w := refresh(router, session.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d on refresh, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	if _, err := auth.VerifyToken(refreshed.AccessToken); err != nil {
+		t.Errorf("Expected refreshed access token to be valid, got %v", err)
+	}
+}
+
+// TestRevokeUserTokens_NotFound tests revoking the tokens of an unknown user
+func TestRevokeUserTokens_NotFound(t *testing.T) {
+	router := setupRouter()
+	
+	req, _ := http.NewRequest("POST", "/aegis/users/"+uuid.New().String()+"/revoke-tokens", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestRevokeOwnTokens tests the self-service "log out everywhere" endpoint
+func TestRevokeOwnTokens(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("logout-everywhere@example.com", "password123", "system")
+	userService.PersistUser(user)
+	session := login(t, router, user.Subject, "password123")
+	
+	req, _ := http.NewRequest("POST", "/aegis/users/me/revoke-tokens", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	
+	req, _ = http.NewRequest("POST", "/aegis/users/me/revoke-tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response RevokeTokensResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.TokensValidAfter.IsZero() {
+		t.Error("Expected tokens_valid_after to be set")
+	}
+	
+	// The token used to log out is revoked as well
+	req, _ = http.NewRequest("POST", "/aegis/users/me/revoke-tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with a revoked token, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// addPermission grants a permission to a user through the API
+func addPermission(t *testing.T, router *gin.Engine, userId string, permission string) {
+	body, _ := json.Marshal(AddPermissionRequest{Permission: permission})
+	req, _ := http.NewRequest("POST", "/aegis/users/"+userId+"/permissions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Adding permission failed with status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestLoginUser_Audience tests that tokens for a resource server only carry its permissions,
+// also after refreshing, and that unknown audiences are refused
+func TestLoginUser_Audience(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("login-audience@example.com", "password123", "system")
+	userService.PersistUser(user)
+	addPermission(t, router, user.Id.String(), "read:invoices")
+	addPermission(t, router, user.Id.String(), "read:users")
+	
+	server := resourceService.CreateResourceServer("https://billing.example.com", "Billing", []string{"read:invoices"}, "system")
+	resourceService.SaveResourceServer(server)
+	
+	loginBody, _ := json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123", Audience: "https://unknown.example.com"})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown audience, got %d", http.StatusBadRequest, w.Code)
+	}
+	
+	loginBody, _ = json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123", Audience: server.Audience})
+	req, _ = http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var response LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if len(claims.Audience) != 1 || claims.Audience[0] != server.Audience {
+		t.Errorf("Expected audience %s, got %v", server.Audience, claims.Audience)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "read:invoices" {
+		t.Errorf("Expected only the billing permission, got %v", claims.Permissions)
+	}
+	
+	w = refresh(router, response.RefreshToken)
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	refreshedClaims, _ := jwt.ValidateToken(refreshed.AccessToken)
+	if refreshedClaims == nil || len(refreshedClaims.Audience) != 1 || len(refreshedClaims.Permissions) != 1 {
+		t.Errorf("Expected refreshed token to keep the audience restriction, got %+v", refreshedClaims)
+	}
+}
+
+// TestLoginUser_Scope tests that a requested scope narrows the tokens to the grants the user holds,
+// that refreshing keeps or narrows it, and that a refresh cannot widen it
+func TestLoginUser_Scope(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("login-scope@example.com", "password123", "system")
+	user.AddRole(userService.UserRole("admin"), "system")
+	userService.PersistUser(user)
+	addPermission(t, router, user.Id.String(), "read:reports")
+	addPermission(t, router, user.Id.String(), "write:reports")
+	
+	loginBody, _ := json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123", Scope: "read:reports delete:reports"})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var session LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &session)
+	claims, err := auth.VerifyToken(session.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected token to be valid, got %v", err)
+	}
+	if len(claims.Roles) != 0 || len(claims.Permissions) != 1 || claims.Permissions[0] != "read:reports" {
+		t.Errorf("Expected only read:reports, got roles %v and permissions %v", claims.Roles, claims.Permissions)
+	}
+	
+	// Introspection reports the reduced scope
+	introspectRouter := gin.New()
+	auth.RegisterApi(introspectRouter.Group("/aegis"))
+	gateway, gatewaySecret := gatewayClient(t)
+	introspectBody, _ := json.Marshal(auth.IntrospectTokenRequest{Token: session.AccessToken})
+	req, _ = http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(introspectBody))
+	req.SetBasicAuth(gateway.ClientId, gatewaySecret)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	introspectRouter.ServeHTTP(w, req)
+	var introspection auth.IntrospectTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &introspection)
+	if introspection.Scope != "read:reports" {
+		t.Errorf("Expected introspection scope 'read:reports', got '%s'", introspection.Scope)
+	}
+	
+	// Refreshing without a scope keeps the narrowed grants
+	w = refresh(router, session.RefreshToken)
+	json.Unmarshal(w.Body.Bytes(), &session)
+	if claims, _ = auth.VerifyToken(session.AccessToken); claims == nil || len(claims.Permissions) != 1 || len(claims.Roles) != 0 {
+		t.Errorf("Expected refreshed token to keep the scope, got %+v", claims)
+	}
+	
+	// Refreshing cannot widen the scope
+	body, _ := json.Marshal(RefreshTokenRequest{RefreshToken: session.RefreshToken, Scope: "role:admin read:reports"})
+	req, _ = http.NewRequest("POST", "/aegis/users/refresh", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d when widening the scope, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestAuthzVersion_LiveScope tests that live mode does not widen a down-scoped token
+func TestAuthzVersion_LiveScope(t *testing.T) {
+	original := auth.AUTHZ_STALE_MODE
+	auth.AUTHZ_STALE_MODE = auth.AUTHZ_MODE_LIVE
+	defer func() { auth.AUTHZ_STALE_MODE = original }()
+	router := setupRouter()
+	
+	user := userService.CreateUser("authz-live-scope@example.com", "password123", "system")
+	userService.PersistUser(user)
+	addPermission(t, router, user.Id.String(), "read:reports")
+	
+	loginBody, _ := json.Marshal(LoginRequest{Subject: user.Subject, Password: "password123", Scope: "read:reports"})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var session LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &session)
+	
+	addPermission(t, router, user.Id.String(), "write:reports")
+	
+	claims, err := auth.VerifyToken(session.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected token to be accepted, got %v", err)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "read:reports" {
+		t.Errorf("Expected live permissions narrowed to the scope, got %v", claims.Permissions)
+	}
+}
+
+// TestLoginUser_ReferenceTokens tests that reference mode returns opaque handles that are resolved
+// by introspection and refresh, and that revoking a handle deletes it
+func TestLoginUser_ReferenceTokens(t *testing.T) {
+	original := referenceService.TOKEN_FORMAT
+	referenceService.TOKEN_FORMAT = referenceService.TOKEN_FORMAT_REFERENCE
+	defer func() { referenceService.TOKEN_FORMAT = original }()
+	router := setupRouter()
+	authRouter := gin.New()
+	auth.RegisterApi(authRouter.Group("/aegis"))
+	gateway, gatewaySecret := gatewayClient(t)
+	originalClients := auth.REVOCATION_CLIENTS
+	auth.REVOCATION_CLIENTS = []string{gateway.ClientId}
+	defer func() { auth.REVOCATION_CLIENTS = originalClients }()
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+	
+	user := userService.CreateUser("login-reference@example.com", "password123", "system")
+	userService.PersistUser(user)
+	addPermission(t, router, user.Id.String(), "read:reports")
+	session := login(t, router, user.Subject, "password123")
+	
+	if !referenceService.IsReferenceToken(session.AccessToken) || !referenceService.IsReferenceToken(session.RefreshToken) {
+		t.Fatalf("Expected opaque tokens, got %s and %s", session.AccessToken, session.RefreshToken)
+	}
+	if _, err := jwt.ValidateToken(session.AccessToken); err == nil {
+		t.Error("Opaque token should not be readable as a JWT")
+	}
+	
+	introspect := func(token string) auth.IntrospectTokenResponse {
+		body, _ := json.Marshal(auth.IntrospectTokenRequest{Token: token})
+		req, _ := http.NewRequest("POST", "/aegis/api/auth/introspect", bytes.NewBuffer(body))
+		req.SetBasicAuth(gateway.ClientId, gatewaySecret)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		authRouter.ServeHTTP(w, req)
+		var response auth.IntrospectTokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+	if response := introspect(session.AccessToken); !response.Active || response.Username != user.Subject || response.Scope != "read:reports" {
+		t.Errorf("Expected opaque token to be resolved, got %+v", response)
+	}
+	
+	// Refreshing with the opaque refresh token issues new handles
+	w := refresh(router, session.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d on refresh, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	if !referenceService.IsReferenceToken(refreshed.AccessToken) || refreshed.RefreshToken == session.RefreshToken {
+		t.Errorf("Expected new opaque tokens, got %+v", refreshed)
+	}
+	
+	// Revoking deletes the handle
+	body, _ := json.Marshal(auth.RevokeTokenRequest{Token: refreshed.AccessToken})
+	req, _ := http.NewRequest("POST", "/aegis/api/auth/revoke", bytes.NewBuffer(body))
+	req.SetBasicAuth(gateway.ClientId, gatewaySecret)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	authRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d on revoke, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if introspect(refreshed.AccessToken).Active {
+		t.Error("Revoked opaque token should be inactive")
+	}
+	if _, err := referenceService.Resolve(refreshed.AccessToken); err == nil {
+		t.Error("Revoked opaque token should be deleted")
+	}
+}
+
+// dpopRequest sends a login or refresh request with a DPoP proof signed by the key
+func dpopRequest(t *testing.T, router *gin.Engine, path string, payload interface{}, key *ecdsa.PrivateKey) *httptest.ResponseRecorder {
+	claims := jwt.DPoPClaims{
+		Htm: "POST",
+		Htu: "http://aegis.test/aegis" + path,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ID:       uuid.New().String(),
+			IssuedAt: gojwt.NewNumericDate(time.Now()),
+		},
+	}
+	proof := gojwt.NewWithClaims(gojwt.SigningMethodES256, claims)
+	jwk, _ := jwt.PublicJWK(&key.PublicKey)
+	proof.Header["typ"] = jwt.DPOP_PROOF_TYPE
+	proof.Header["jwk"] = jwk
+	signed, err := proof.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign DPoP proof: %v", err)
+	}
+	
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "/aegis"+path, bytes.NewBuffer(body))
+	req.Host = "aegis.test"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.DPOP_HEADER, signed)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestLoginUser_DPoP tests that tokens issued with a DPoP proof are bound to its key,
+// and that the bound refresh token can only be used with a proof from the same key
+func TestLoginUser_DPoP(t *testing.T) {
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := jwt.PublicJWK(&key.PublicKey)
+	
+	user := userService.CreateUser("login-dpop@example.com", "password123", "system")
+	userService.PersistUser(user)
+	
+	w := dpopRequest(t, router, "/users/login", LoginRequest{Subject: user.Subject, Password: "password123"}, key)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var session LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &session)
+	if session.TokenType != "DPoP" {
+		t.Errorf("Expected token_type DPoP, got %s", session.TokenType)
+	}
+	claims, _ := jwt.ValidateToken(session.AccessToken)
+	if claims.Confirmation == nil || claims.Confirmation.JKT != jwk.Thumbprint() {
+		t.Fatalf("Expected access token bound to %s, got %+v", jwk.Thumbprint(), claims.Confirmation)
+	}
+	
+	// A bound refresh token needs a proof from the same key
+	if w = refresh(router, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without proof, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = dpopRequest(t, router, "/users/refresh", RefreshTokenRequest{RefreshToken: session.RefreshToken}, otherKey); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with another key, got %d", http.StatusUnauthorized, w.Code)
+	}
+	w = dpopRequest(t, router, "/users/refresh", RefreshTokenRequest{RefreshToken: session.RefreshToken}, key)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d on refresh, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	if claims, _ := jwt.ValidateToken(refreshed.AccessToken); claims.Confirmation == nil || claims.Confirmation.JKT != jwk.Thumbprint() {
+		t.Errorf("Expected refreshed token to stay bound, got %+v", claims.Confirmation)
+	}
+	
+	// Logins without a proof still get bearer tokens
+	if session := login(t, router, user.Subject, "password123"); session.TokenType != "Bearer" {
+		t.Errorf("Expected token_type Bearer, got %s", session.TokenType)
+	}
+}
+
+// TestLoginUser_ClientCertificate tests that tokens requested over a connection with a client
+// certificate are bound to it, and that the bound refresh token needs the same certificate
+func TestLoginUser_ClientCertificate(t *testing.T) {
+	router := setupRouter()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "reporting-job"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	
+	user := userService.CreateUser("login-mtls@example.com", "password123", "system")
+	userService.PersistUser(user)
+	
+	send := func(path string, payload interface{}, state *tls.ConnectionState) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/aegis"+path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.TLS = state
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	withCert := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	
+	w := send("/users/login", LoginRequest{Subject: user.Subject, Password: "password123"}, withCert)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var session LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &session)
+	if session.TokenType != "Bearer" {
+		t.Errorf("Expected token_type Bearer, got %s", session.TokenType)
+	}
+	claims, _ := jwt.ValidateToken(session.AccessToken)
+	if claims.Confirmation == nil || claims.Confirmation.X5tS256 != jwt.CertificateThumbprint(cert) {
+		t.Fatalf("Expected access token bound to the certificate, got %+v", claims.Confirmation)
+	}
+	
+	if w = send("/users/refresh", RefreshTokenRequest{RefreshToken: session.RefreshToken}, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without certificate, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = send("/users/refresh", RefreshTokenRequest{RefreshToken: session.RefreshToken}, withCert); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the bound certificate, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+// TestLoginUser_ClaimMappings tests that mapped user attributes are stored with the user and
+// copied into access tokens, and that refreshed tokens carry the current attributes
+func TestLoginUser_ClaimMappings(t *testing.T) {
+	router := setupRouter()
+	original := jwt.CLAIM_MAPPINGS
+	jwt.CLAIM_MAPPINGS = []jwt.ClaimMapping{{Attribute: "department", Claim: "department"}, {Attribute: "tenant_id", Claim: "tenant"}}
+	defer func() { jwt.CLAIM_MAPPINGS = original }()
+
+	body, _ := json.Marshal(RegisterRequest{Subject: "claims@example.com", Password: "password123",
+		AdditionalInfo: map[string]interface{}{"department": "sales", "tenant_id": "acme", "salary": 1000}})
+	req, _ := http.NewRequest("POST", "/aegis/users/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var registered UserResponse
+	json.Unmarshal(w.Body.Bytes(), &registered)
+
+	response := login(t, router, "claims@example.com", "password123")
+	if response.User.AdditionalInfo["tenant_id"] != "acme" {
+		t.Errorf("Expected stored additional info, got %v", response.User.AdditionalInfo)
+	}
+	claims, _ := jwt.ValidateToken(response.AccessToken)
+	if claims.Custom["department"] != "sales" || claims.Custom["tenant"] != "acme" {
+		t.Errorf("Expected mapped claims, got %v", claims.Custom)
+	}
+	if _, exists := claims.Custom["salary"]; exists {
+		t.Error("Expected unmapped attribute to stay out of the token")
+	}
+
+	body, _ = json.Marshal(UpdateUserRequest{AdditionalInfo: map[string]interface{}{"department": "support", "tenant_id": "acme"}})
+	req, _ = http.NewRequest("PUT", "/aegis/users/"+registered.Id, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w = refresh(router, response.RefreshToken)
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	refreshedClaims, _ := jwt.ValidateToken(refreshed.AccessToken)
+	if refreshedClaims == nil || refreshedClaims.Custom["department"] != "support" {
+		t.Errorf("Expected refreshed token with the current department. Body: %s", w.Body.String())
+	}
+}
+
+// TestAuthzVersion_Reject tests that tokens issued before a grant change are rejected as stale
+// and that refreshing issues tokens with the current grants
+func TestAuthzVersion_Reject(t *testing.T) {
+	original := auth.AUTHZ_STALE_MODE
+	auth.AUTHZ_STALE_MODE = auth.AUTHZ_MODE_REJECT
+	defer func() { auth.AUTHZ_STALE_MODE = original }()
+	router := setupRouter()
+	
+	user := userService.CreateUser("authz-reject@example.com", "password123", "system")
+	userService.PersistUser(user)
+	session := login(t, router, user.Subject, "password123")
+	if _, err := auth.VerifyToken(session.AccessToken); err != nil {
+		t.Fatalf("Expected fresh token to be valid, got %v", err)
+	}
+	
+	addPermission(t, router, user.Id.String(), "write:reports")
+	
+	if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenStale {
+		t.Errorf("Expected token to be stale, got %v", err)
+	}
+	
+	w := refresh(router, session.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d on refresh, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	claims, err := auth.VerifyToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected refreshed token to be valid, got %v", err)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "write:reports" {
+		t.Errorf("Expected current permissions, got %v", claims.Permissions)
+	}
+}
+
+// TestAuthzVersion_Live tests that live mode replaces outdated grants with the current ones
+func TestAuthzVersion_Live(t *testing.T) {
+	original := auth.AUTHZ_STALE_MODE
+	auth.AUTHZ_STALE_MODE = auth.AUTHZ_MODE_LIVE
+	defer func() { auth.AUTHZ_STALE_MODE = original }()
+	router := setupRouter()
+	
+	user := userService.CreateUser("authz-live@example.com", "password123", "system")
+	userService.PersistUser(user)
+	session := login(t, router, user.Subject, "password123")
+	
+	addPermission(t, router, user.Id.String(), "write:reports")
+	
+	claims, err := auth.VerifyToken(session.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected token to be accepted, got %v", err)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "write:reports" {
+		t.Errorf("Expected live permissions, got %v", claims.Permissions)
+	}
+}
+
+// TestAuthzVersion_Claims tests that claims mode keeps trusting the embedded grants
+func TestAuthzVersion_Claims(t *testing.T) {
+	original := auth.AUTHZ_STALE_MODE
+	auth.AUTHZ_STALE_MODE = auth.AUTHZ_MODE_CLAIMS
+	defer func() { auth.AUTHZ_STALE_MODE = original }()
+	router := setupRouter()
+	
+	user := userService.CreateUser("authz-claims@example.com", "password123", "system")
+	userService.PersistUser(user)
+	session := login(t, router, user.Subject, "password123")
+	
+	addPermission(t, router, user.Id.String(), "write:reports")
+	
+	claims, err := auth.VerifyToken(session.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected token to be accepted, got %v", err)
+	}
+	if len(claims.Permissions) != 0 {
+		t.Errorf("Expected embedded permissions, got %v", claims.Permissions)
+	}
+}
+
 func TestLoginUser_WrongPassword(t *testing.T) {
 	router := setupRouter()
 	
@@ -329,6 +1068,78 @@ func TestChangePassword_Success(t *testing.T) {
 	}
 }
 
+// TestChangePassword_RevokesTokens tests that changing the password revokes outstanding tokens
+func TestChangePassword_RevokesTokens(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("changepass-revoke@example.com", "oldpassword123", "system")
+	userService.SaveUser(user)
+	session := login(t, router, user.Subject, "oldpassword123")
+	
+	body, _ := json.Marshal(ChangePasswordRequest{OldPassword: "oldpassword123", NewPassword: "newpassword123"})
+	req, _ := http.NewRequest("POST", "/aegis/users/"+user.Id.String()+"/password", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	
+	if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenRevoked {
+		t.Errorf("Expected access token to be revoked, got %v", err)
+	}
+	if w := refresh(router, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d on refresh, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRemoveRole_MarksTokensStale tests that removing a role rejects access tokens
+// carrying the old roles while the refresh token still works
+func TestRemoveRole_MarksTokensStale(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("demoted-admin@example.com", "password123", "system")
+	user.Roles = []userService.UserRole{"admin"}
+	userService.PersistUser(user)
+	session := login(t, router, user.Subject, "password123")
+	
+	req, _ := http.NewRequest("DELETE", "/aegis/users/"+user.Id.String()+"/roles/admin", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenStale {
+		t.Errorf("Expected access token to be stale, got %v", err)
+	}
+	
+	w = refresh(router, session.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d on refresh, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	claims, _ := jwt.ValidateToken(refreshed.AccessToken)
+	if len(claims.Roles) != 0 {
+		t.Errorf("Expected refreshed token without roles, got %v", claims.Roles)
+	}
+}
+
+// TestDeleteUser_RevokesTokens tests that tokens of a deleted user are rejected
+func TestDeleteUser_RevokesTokens(t *testing.T) {
+	router := setupRouter()
+	
+	user := userService.CreateUser("fired@example.com", "password123", "system")
+	userService.SaveUser(user)
+	session := login(t, router, user.Subject, "password123")
+	
+	req, _ := http.NewRequest("DELETE", "/aegis/users/"+user.Id.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	
+	if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenRevoked {
+		t.Errorf("Expected access token to be revoked, got %v", err)
+	}
+}
+
 func TestChangePassword_WrongOldPassword(t *testing.T) {
 	router := setupRouter()
 	
@@ -0,0 +1,127 @@
+// Package user provides HTTP REST API endpoints for user management operations.
+// This file implements listing and revoking the login sessions of a user.
+package user
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/aegis/api/auth"
+	sessionService "nfcunha/aegis/domain/session"
+	userService "nfcunha/aegis/domain/user"
+)
+
+type SessionResponse struct {
+	Id              string     `json:"id"`
+	ClientId        string     `json:"client_id,omitempty"`
+	Device          string     `json:"device,omitempty"`
+	IpAddress       string     `json:"ip_address"`
+	UserAgent       string     `json:"user_agent"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	Current         bool       `json:"current,omitempty"` // Whether the request was made with a token of this session
+}
+
+func listOwnSessions(c *gin.Context) {
+	log.Println("GET /aegis/users/me/sessions - List own sessions request received")
+	claims := auth.GetClaims(c)
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		// Client credentials tokens have no user
+		c.JSON(http.StatusForbidden, gin.H{"error": "user token required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSessionResponses(sessionService.ListActiveSessions(userId), claims.SessionId))
+}
+
+func revokeOwnSession(c *gin.Context) {
+	sessionId := c.Param("sessionId")
+	log.Printf("DELETE /aegis/users/me/sessions/%s - Revoke own session request received", sessionId)
+	claims := auth.GetClaims(c)
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		// Client credentials tokens have no user
+		c.JSON(http.StatusForbidden, gin.H{"error": "user token required"})
+		return
+	}
+
+	revokeSession(c, userId, sessionId, claims.Subject)
+}
+
+func listUserSessions(c *gin.Context) {
+	idStr := c.Param("id")
+	log.Printf("GET /aegis/users/%s/sessions - List user sessions request received", idStr)
+	userId, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if userService.GetUserById(userId) == nil {
+		log.Printf("User not found: %s", idStr)
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSessionResponses(sessionService.ListActiveSessions(userId), ""))
+}
+
+func revokeUserSession(c *gin.Context) {
+	idStr := c.Param("id")
+	sessionId := c.Param("sessionId")
+	log.Printf("DELETE /aegis/users/%s/sessions/%s - Revoke user session request received", idStr, sessionId)
+	userId, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	revokeSession(c, userId, sessionId, "system")
+}
+
+// revokeSession revokes a session of a user and every token issued in it.
+// Sessions of other users are reported as not found.
+func revokeSession(c *gin.Context, userId uuid.UUID, sessionId string, revokedBy string) {
+	session := sessionService.GetSession(sessionId)
+	if session == nil || session.UserId != userId {
+		log.Printf("Session not found: %s", sessionId)
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	err := sessionService.RevokeSession(session.Id, revokedBy)
+	if errors.Is(err, sessionService.ErrSessionRevoked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "session already revoked"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke session %s: %v", session.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked successfully"})
+}
+
+func toSessionResponses(sessions []*sessionService.Session, currentSessionId string) []SessionResponse {
+	responses := []SessionResponse{}
+	for _, session := range sessions {
+		responses = append(responses, SessionResponse{
+			Id:              session.Id,
+			ClientId:        session.ClientId,
+			Device:          session.Device,
+			IpAddress:       session.IpAddress,
+			UserAgent:       session.UserAgent,
+			CreatedAt:       session.CreatedAt,
+			LastRefreshedAt: session.LastRefreshedAt,
+			Current:         currentSessionId != "" && session.Id == currentSessionId,
+		})
+	}
+	return responses
+}
@@ -0,0 +1,173 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/api/auth"
+	"nfcunha/aegis/domain/token"
+	userService "nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+// loginFrom logs a user in from a named device and returns the issued tokens
+func loginFrom(t *testing.T, router *gin.Engine, subject string, device string) LoginResponse {
+	body, _ := json.Marshal(LoginRequest{Subject: subject, Password: "password123", Device: device})
+	req, _ := http.NewRequest("POST", "/aegis/users/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sessions-test")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login failed with status %d: %s", w.Code, w.Body.String())
+	}
+	var response LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// sessionRequest sends a request to a sessions endpoint, with a bearer token when given
+func sessionRequest(router *gin.Engine, method string, path string, accessToken string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestListOwnSessions tests that a user sees their sessions, with the current one marked
+func TestListOwnSessions(t *testing.T) {
+	router := setupRouter()
+
+	user := userService.CreateUser("sessions-list@example.com", "password123", "system")
+	userService.PersistUser(user)
+	laptop := loginFrom(t, router, user.Subject, "Laptop")
+	phone := loginFrom(t, router, user.Subject, "Phone")
+
+	claims, _ := jwt.ValidateToken(laptop.AccessToken)
+	if claims == nil || laptop.SessionId == "" || claims.SessionId != laptop.SessionId {
+		t.Fatalf("Expected the access token to carry session %s", laptop.SessionId)
+	}
+
+	w := sessionRequest(router, "GET", "/aegis/users/me/sessions", laptop.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var sessions []SessionResponse
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+	for _, session := range sessions {
+		switch session.Id {
+		case laptop.SessionId:
+			if !session.Current || session.Device != "Laptop" || session.UserAgent != "sessions-test" {
+				t.Errorf("Unexpected current session: %+v", session)
+			}
+		case phone.SessionId:
+			if session.Current || session.Device != "Phone" {
+				t.Errorf("Unexpected other session: %+v", session)
+			}
+		default:
+			t.Errorf("Unexpected session %s", session.Id)
+		}
+	}
+
+	// Administrators list the same sessions
+	w = sessionRequest(router, "GET", "/aegis/users/"+user.Id.String()+"/sessions", "")
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if w.Code != http.StatusOK || len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions for the administrator, got status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestRevokeOwnSession tests that revoking a session invalidates its tokens and keeps the others
+func TestRevokeOwnSession(t *testing.T) {
+	router := setupRouter()
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+
+	user := userService.CreateUser("sessions-revoke@example.com", "password123", "system")
+	userService.PersistUser(user)
+	laptop := loginFrom(t, router, user.Subject, "Laptop")
+	phone := loginFrom(t, router, user.Subject, "Phone")
+
+	w := sessionRequest(router, "DELETE", "/aegis/users/me/sessions/"+phone.SessionId, laptop.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if _, err := auth.VerifyToken(phone.AccessToken); err != auth.ErrTokenRevoked {
+		t.Errorf("Expected the session's access token to be revoked, got %v", err)
+	}
+	if w := refresh(router, phone.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d on refresh, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if _, err := auth.VerifyToken(laptop.AccessToken); err != nil {
+		t.Errorf("Expected the other session to remain valid, got %v", err)
+	}
+
+	// Refreshing keeps the session
+	w = refresh(router, laptop.RefreshToken)
+	var refreshed LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	if w.Code != http.StatusOK || refreshed.SessionId != laptop.SessionId {
+		t.Fatalf("Expected refresh in session %s, got status %d: %s", laptop.SessionId, w.Code, w.Body.String())
+	}
+	var sessions []SessionResponse
+	w = sessionRequest(router, "GET", "/aegis/users/me/sessions", refreshed.AccessToken)
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions) != 1 || sessions[0].Id != laptop.SessionId || sessions[0].LastRefreshedAt == nil {
+		t.Errorf("Expected only the refreshed session to remain, got %s", w.Body.String())
+	}
+
+	if w := sessionRequest(router, "DELETE", "/aegis/users/me/sessions/"+phone.SessionId, refreshed.AccessToken); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a revoked session, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+// TestRevokeUserSession tests that administrators revoke sessions of the given user only
+func TestRevokeUserSession(t *testing.T) {
+	router := setupRouter()
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+
+	user := userService.CreateUser("sessions-admin@example.com", "password123", "system")
+	userService.PersistUser(user)
+	other := userService.CreateUser("sessions-other@example.com", "password123", "system")
+	userService.PersistUser(other)
+	session := loginFrom(t, router, user.Subject, "")
+	otherSession := loginFrom(t, router, other.Subject, "")
+
+	// A session of another user is not found, and users cannot revoke it either
+	if w := sessionRequest(router, "DELETE", "/aegis/users/"+user.Id.String()+"/sessions/"+otherSession.SessionId, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := sessionRequest(router, "DELETE", "/aegis/users/me/sessions/"+otherSession.SessionId, session.AccessToken); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := sessionRequest(router, "DELETE", "/aegis/users/"+user.Id.String()+"/sessions/"+session.SessionId, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if _, err := auth.VerifyToken(session.AccessToken); err != auth.ErrTokenRevoked {
+		t.Errorf("Expected the session's access token to be revoked, got %v", err)
+	}
+	if _, err := auth.VerifyToken(otherSession.AccessToken); err != nil {
+		t.Errorf("Expected the other user's session to remain valid, got %v", err)
+	}
+}
+
+// TestListOwnSessions_ClientToken tests that client credentials tokens have no sessions
+func TestListOwnSessions_ClientToken(t *testing.T) {
+	router := setupRouter()
+
+	clientToken, _ := jwt.GenerateClientToken("sessions-client", []string{}, 0, nil, nil)
+	if w := sessionRequest(router, "GET", "/aegis/users/me/sessions", clientToken.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+// Package wellknown provides HTTP endpoints published under the /.well-known path.
+// These endpoints let downstream services and OpenID Connect clients discover
+// the Aegis endpoints and how to verify Aegis tokens.
+package wellknown
+
+import (
+	"log"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/util/jwt"
+)
+
+// OpenIDConfiguration represents the OpenID Provider Metadata document
+// (OpenID Connect Discovery 1.0, section 3).
+type OpenIDConfiguration struct {
+	Issuer                                string   `json:"issuer"`
+	AuthorizationEndpoint                 string   `json:"authorization_endpoint"`
+	TokenEndpoint                         string   `json:"token_endpoint"`
+	JwksUri                               string   `json:"jwks_uri"`
+	UserinfoEndpoint                      string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint                 string   `json:"introspection_endpoint"`
+	RevocationEndpoint                    string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint           string   `json:"device_authorization_endpoint"`
+	ResponseTypesSupported                []string `json:"response_types_supported"`
+	GrantTypesSupported                   []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported         []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported     []string `json:"token_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported"`
+	SubjectTypesSupported                 []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported      []string `json:"id_token_signing_alg_values_supported"`
+	DPoPSigningAlgValuesSupported         []string `json:"dpop_signing_alg_values_supported"`
+	TlsClientCertificateBoundAccessTokens bool     `json:"tls_client_certificate_bound_access_tokens"`
+	ScopesSupported                       []string `json:"scopes_supported"`
+	ClaimsSupported                       []string `json:"claims_supported"`
+}
+
+// CERTIFICATE_BOUND_TOKENS tells whether tokens can be bound to TLS client certificates (RFC 8705),
+// advertised as tls_client_certificate_bound_access_tokens. It is set at startup, once the
+// listener is configured.
+var CERTIFICATE_BOUND_TOKENS = false
+
+// supportedGrantTypes lists the grant types accepted by the token endpoint.
+var supportedGrantTypes = []string{
+	"authorization_code",
+	"client_credentials",
+	"urn:ietf:params:oauth:grant-type:token-exchange",
+	"urn:ietf:params:oauth:grant-type:device_code",
+}
+
+// RegisterApi registers the /.well-known routes with the Gin router.
+//
+// Public endpoints (under /aegis context path):
+//   - GET /.well-known/jwks.json - Public keys used to sign tokens (RFC 7517)
+//   - GET /.well-known/openid-configuration - OpenID Connect discovery document
+//
+// Parameters:
+//   - router: The Gin RouterGroup to register routes with (already under /aegis)
+func RegisterApi(router gin.IRouter) {
+	wellKnown := router.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", getJwks)
+		wellKnown.GET("/openid-configuration", getOpenIDConfiguration)
+	}
+}
+
+// getJwks returns the JSON Web Key Set containing the public signing keys.
+// The set is empty when tokens are signed with HS256, since shared secrets are never published.
+func getJwks(c *gin.Context) {
+	log.Println("GET /aegis/.well-known/jwks.json - JWKS request received")
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwt.PublicJWKS())
+}
+
+// getOpenIDConfiguration returns the discovery document advertising the endpoints,
+// signing algorithms and claims supported by Aegis.
+func getOpenIDConfiguration(c *gin.Context) {
+	log.Println("GET /aegis/.well-known/openid-configuration - Discovery request received")
+	baseUrl := BaseUrl(c)
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, OpenIDConfiguration{
+		Issuer:                                jwt.ISSUER,
+		AuthorizationEndpoint:                 baseUrl + "/authorize",
+		TokenEndpoint:                         baseUrl + "/token",
+		JwksUri:                               baseUrl + "/.well-known/jwks.json",
+		UserinfoEndpoint:                      baseUrl + "/userinfo",
+		IntrospectionEndpoint:                 baseUrl + "/api/auth/introspect",
+		RevocationEndpoint:                    baseUrl + "/api/auth/revoke",
+		DeviceAuthorizationEndpoint:           baseUrl + "/device_authorization",
+		ResponseTypesSupported:                []string{"code"},
+		GrantTypesSupported:                   supportedGrantTypes,
+		CodeChallengeMethodsSupported:         []string{"S256"},
+		TokenEndpointAuthMethodsSupported:     []string{"client_secret_basic", "client_secret_post", "none"},
+		IntrospectionEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		RevocationEndpointAuthMethodsSupported:    []string{"client_secret_basic", "client_secret_post", "none"},
+		SubjectTypesSupported:                 []string{"public"},
+		IdTokenSigningAlgValuesSupported:      supportedSigningAlgorithms(),
+		DPoPSigningAlgValuesSupported:         jwt.DPOP_SIGNING_ALGORITHMS,
+		TlsClientCertificateBoundAccessTokens: CERTIFICATE_BOUND_TOKENS,
+		ScopesSupported:                       supportedScopes(),
+		ClaimsSupported: []string{
+			"sub", "iss", "iat", "exp", "jti",
+			"preferred_username", "roles", "permissions",
+		},
+	})
+}
+
+// supportedSigningAlgorithms lists the distinct asymmetric algorithms of the keys in the keyring.
+// HMAC algorithms are left out: relying parties cannot verify tokens signed with Aegis' secret.
+func supportedSigningAlgorithms() []string {
+	algorithms := []string{}
+	seen := make(map[string]bool)
+	for _, key := range jwt.KEYRING.Keys() {
+		if jwt.IsAsymmetric(key.Algorithm) && !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+// supportedScopes lists the scopes clients can request. The "openid" scope is only offered while
+// ID tokens can be issued, see jwt.IdTokensSupported.
+func supportedScopes() []string {
+	if jwt.IdTokensSupported() {
+		return []string{"openid", "profile"}
+	}
+	return []string{"profile"}
+}
@@ -0,0 +1,181 @@
+package wellknown
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"github.com/gin-gonic/gin"
+	"nfcunha/aegis/util/jwt"
+)
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	aegis := router.Group("/aegis")
+	RegisterApi(aegis)
+	return router
+}
+
+// TestGetJwks_PublishesSigningKey tests that the configured public key is served
+func TestGetJwks_PublishesSigningKey(t *testing.T) {
+	key, err := jwt.GenerateSigningKey(jwt.ALGORITHM_ES256)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	original := jwt.KEYRING
+	jwt.KEYRING = jwt.NewKeyring(key)
+	defer func() { jwt.KEYRING = original }()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response jwt.JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Keys) != 1 || response.Keys[0].Kid != key.Kid {
+		t.Errorf("Expected the signing key to be published, got %+v", response.Keys)
+	}
+}
+
+// TestGetJwks_HMAC tests that an empty key set is returned for HS256
+func TestGetJwks_HMAC(t *testing.T) {
+	original := jwt.KEYRING
+	jwt.KEYRING = jwt.NewKeyring(&jwt.SigningKey{Algorithm: jwt.ALGORITHM_HS256})
+	defer func() { jwt.KEYRING = original }()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Body.String() != `{"keys":[]}` {
+		t.Errorf("Expected empty key set, got %s", w.Body.String())
+	}
+}
+
+// TestGetOpenIDConfiguration tests that the discovery document advertises the issuer and endpoints
+func TestGetOpenIDConfiguration(t *testing.T) {
+	key, _ := jwt.GenerateSigningKey(jwt.ALGORITHM_ES256)
+	original := jwt.KEYRING
+	jwt.KEYRING = jwt.NewKeyring(key, &jwt.SigningKey{Kid: "legacy", Algorithm: jwt.ALGORITHM_HS256})
+	defer func() { jwt.KEYRING = original }()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/openid-configuration", nil)
+	req.Host = "auth.example.com"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response OpenIDConfiguration
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Issuer != jwt.ISSUER {
+		t.Errorf("Expected issuer %s, got %s", jwt.ISSUER, response.Issuer)
+	}
+	if response.JwksUri != "http://auth.example.com/aegis/.well-known/jwks.json" {
+		t.Errorf("Unexpected jwks_uri: %s", response.JwksUri)
+	}
+	if response.UserinfoEndpoint != "http://auth.example.com/aegis/userinfo" {
+		t.Errorf("Unexpected userinfo_endpoint: %s", response.UserinfoEndpoint)
+	}
+	if response.DeviceAuthorizationEndpoint != "http://auth.example.com/aegis/device_authorization" {
+		t.Errorf("Unexpected device_authorization_endpoint: %s", response.DeviceAuthorizationEndpoint)
+	}
+	if len(response.IdTokenSigningAlgValuesSupported) != 1 || response.IdTokenSigningAlgValuesSupported[0] != jwt.ALGORITHM_ES256 {
+		t.Errorf("Expected only the asymmetric algorithm, got %v", response.IdTokenSigningAlgValuesSupported)
+	}
+	if len(response.ScopesSupported) == 0 || response.ScopesSupported[0] != "openid" {
+		t.Errorf("Expected the openid scope, got %v", response.ScopesSupported)
+	}
+	if response.TlsClientCertificateBoundAccessTokens {
+		t.Error("Expected certificate-bound tokens not to be advertised without client certificates")
+	}
+}
+
+// TestGetOpenIDConfiguration_CertificateBound tests that certificate-bound tokens are advertised once enabled
+func TestGetOpenIDConfiguration_CertificateBound(t *testing.T) {
+	originalBound := CERTIFICATE_BOUND_TOKENS
+	CERTIFICATE_BOUND_TOKENS = true
+	defer func() { CERTIFICATE_BOUND_TOKENS = originalBound }()
+
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+
+	var response OpenIDConfiguration
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !response.TlsClientCertificateBoundAccessTokens {
+		t.Error("Expected certificate-bound tokens to be advertised")
+	}
+}
+
+// TestGetOpenIDConfiguration_HMAC tests that HS256 and the openid scope are not advertised with an HMAC key
+func TestGetOpenIDConfiguration_HMAC(t *testing.T) {
+	original := jwt.KEYRING
+	jwt.KEYRING = jwt.NewKeyring(&jwt.SigningKey{Algorithm: jwt.ALGORITHM_HS256})
+	defer func() { jwt.KEYRING = original }()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response OpenIDConfiguration
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.IdTokenSigningAlgValuesSupported) != 0 {
+		t.Errorf("Expected no signing algorithms, got %v", response.IdTokenSigningAlgValuesSupported)
+	}
+	for _, scope := range response.ScopesSupported {
+		if scope == "openid" {
+			t.Error("Expected the openid scope not to be advertised")
+		}
+	}
+}
+
+// TestBaseUrl_ForwardedHeaders tests that proxy headers are honored when deriving the base URL
+func TestBaseUrl_ForwardedHeaders(t *testing.T) {
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/openid-configuration", nil)
+	req.Host = "aegis:8080"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "auth.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response OpenIDConfiguration
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.JwksUri != "https://auth.example.com/aegis/.well-known/jwks.json" {
+		t.Errorf("Unexpected jwks_uri: %s", response.JwksUri)
+	}
+}
+
+// TestBaseUrl_Configured tests that AEGIS_PUBLIC_URL takes precedence over the request host
+func TestBaseUrl_Configured(t *testing.T) {
+	original := PUBLIC_URL
+	PUBLIC_URL = "https://example.com/api/aegis"
+	defer func() { PUBLIC_URL = original }()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/aegis/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response OpenIDConfiguration
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.UserinfoEndpoint != "https://example.com/api/aegis/userinfo" {
+		t.Errorf("Unexpected userinfo_endpoint: %s", response.UserinfoEndpoint)
+	}
+}
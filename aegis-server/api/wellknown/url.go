@@ -0,0 +1,54 @@
+package wellknown
+
+import (
+	"log"
+	"os"
+	"strings"
+	"github.com/gin-gonic/gin"
+)
+
+var PUBLIC_URL = getPublicUrl()
+
+// BaseUrl returns the public base URL of the Aegis API, used to build absolute endpoint URLs.
+// Uses AEGIS_PUBLIC_URL when configured; otherwise derives it from the request's scheme and host
+// (honoring X-Forwarded-Proto and X-Forwarded-Host) plus the "/aegis" context path.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//
+// Returns:
+//   - Base URL without a trailing slash (e.g., "https://auth.example.com/api/aegis")
+func BaseUrl(c *gin.Context) string {
+	if PUBLIC_URL != "" {
+		return PUBLIC_URL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwardedProto := c.GetHeader("X-Forwarded-Proto"); forwardedProto != "" {
+		scheme = forwardedProto
+	}
+
+	host := c.Request.Host
+	if forwardedHost := c.GetHeader("X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+
+	return scheme + "://" + host + "/aegis"
+}
+
+// getPublicUrl retrieves the public base URL from the AEGIS_PUBLIC_URL environment variable.
+// Set it when Aegis runs behind a proxy that changes the path, e.g. "http://localhost:3100/api/aegis".
+//
+// Returns:
+//   - The configured URL without a trailing slash, or empty to derive it per request
+func getPublicUrl() string {
+	const PUBLIC_URL_ENV = "AEGIS_PUBLIC_URL"
+	if publicUrl := os.Getenv(PUBLIC_URL_ENV); publicUrl != "" {
+		log.Printf("Using public URL: %s", publicUrl)
+		return strings.TrimSuffix(publicUrl, "/")
+	}
+	return ""
+}
@@ -102,6 +102,32 @@ func RunCommandWithArgs(query string, args ...interface{}) error {
 	return nil
 }
 
+// RunCommandWithRowsAffected executes a SQL command with parameterized arguments and reports
+// how many rows it changed. Useful for conditional updates that must succeed only once.
+// Opens and closes the database connection automatically.
+//
+// Parameters:
+//   - query: The SQL command with ? placeholders
+//   - args: Values to substitute for placeholders
+//
+// Returns:
+//   - int64: Number of rows affected by the command
+//   - error: Error if execution fails
+func RunCommandWithRowsAffected(query string, args ...interface{}) (int64, error) {
+	db, err := OpenConnection();
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 // RunQuery executes a SQL SELECT query without parameters.
 // Opens and closes the database connection automatically.
 // The caller must close the returned rows using defer rows.Close().
@@ -151,4 +177,33 @@ func RunQueryWithArgs(query string, args ...interface{}) (*sql.Rows, error) {
 	}
 
 	return rows, nil
-}
\ No newline at end of file
+}
+
+// RunInTransaction executes several SQL commands atomically.
+// Opens and closes the database connection automatically. The transaction is committed if
+// the function returns nil and rolled back otherwise.
+//
+// Parameters:
+//   - commands: Function running the commands on the transaction
+//
+// Returns:
+//   - error: Error if the transaction cannot be started or committed, or the function's error
+func RunInTransaction(commands func(tx *sql.Tx) error) error {
+	db, err := OpenConnection();
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := commands(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -1,8 +1,25 @@
 package database
 
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
 // Migrate creates the database schema if it doesn't already exist.
-// Creates five tables: users, roles, permissions, user_roles, and user_permissions.
+// Creates the following tables:
+//   - users, roles, permissions, user_roles and user_permissions
+//   - signing_keys for the token signing keyring
+//   - clients and authorization_codes for the OAuth 2.0 authorization code flow
+//   - device_authorizations for the OAuth 2.0 device authorization grant
+//   - refresh_tokens and sessions for refresh token rotation and login sessions
+//   - revoked_tokens and revocation_events for the token blacklist and its replication
+//   - impersonation_sessions to audit impersonation
+//   - resource_servers for the APIs tokens can be restricted to
+//   - reference_tokens for opaque token handles
 // Includes foreign key constraints with CASCADE delete for referential integrity.
+// Columns added after a table was first released are added with addColumnIfMissing,
+// so existing databases are upgraded in place.
 // This function is idempotent and safe to call multiple times.
 func Migrate() {
 	RunCommand(`
@@ -51,4 +68,195 @@ func Migrate() {
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 			FOREIGN KEY (permission) REFERENCES permissions(name) ON DELETE CASCADE
 	)`)
-}
\ No newline at end of file
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS signing_keys (
+			kid TEXT PRIMARY KEY,
+			algorithm TEXT NOT NULL,
+			key_material TEXT NOT NULL,
+			state TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			created_by TEXT NOT NULL,
+			retire_at DATETIME,
+			retired_at DATETIME
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS clients (
+			client_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			secret_hash TEXT NOT NULL DEFAULT '',
+			secret_salt TEXT NOT NULL DEFAULT '',
+			secret_pepper TEXT NOT NULL DEFAULT '',
+			redirect_uris TEXT NOT NULL,
+			grant_types TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			access_token_lifetime INTEGER NOT NULL DEFAULT 0,
+			refresh_token_lifetime INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			created_by TEXT NOT NULL,
+			updated_at DATETIME NOT NULL,
+			updated_by TEXT NOT NULL
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS authorization_codes (
+			code TEXT PRIMARY KEY,
+			client_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			redirect_uri TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			code_challenge TEXT NOT NULL,
+			code_challenge_method TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			jti TEXT PRIMARY KEY,
+			family_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			client_id TEXT NOT NULL DEFAULT '',
+			access_jti TEXT NOT NULL,
+			access_expires_at DATETIME NOT NULL,
+			status TEXT NOT NULL,
+			issued_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			rotated_at DATETIME,
+			revoked_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	RunCommand(`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS revoked_tokens (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			jti TEXT NOT NULL UNIQUE,
+			user_id TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			revoked_by TEXT NOT NULL DEFAULT '',
+			revoked_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS revocation_events (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			origin TEXT NOT NULL,
+			jti TEXT NOT NULL,
+			user_id TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			revoked_by TEXT NOT NULL DEFAULT '',
+			revoked_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS impersonation_sessions (
+			id TEXT PRIMARY KEY,
+			admin_id TEXT NOT NULL,
+			admin_subject TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			user_subject TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			started_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			ended_at DATETIME,
+			ended_by TEXT NOT NULL DEFAULT '',
+			end_reason TEXT NOT NULL DEFAULT ''
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS device_authorizations (
+			device_code TEXT PRIMARY KEY,
+			user_code TEXT NOT NULL UNIQUE,
+			client_id TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			user_id TEXT,
+			status TEXT NOT NULL,
+			interval_seconds INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			last_polled_at DATETIME,
+			FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS resource_servers (
+			id TEXT PRIMARY KEY,
+			audience TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			permissions TEXT NOT NULL DEFAULT '[]',
+			created_at DATETIME NOT NULL,
+			created_by TEXT NOT NULL,
+			updated_at DATETIME NOT NULL,
+			updated_by TEXT NOT NULL
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS reference_tokens (
+			handle_hash TEXT PRIMARY KEY,
+			token TEXT NOT NULL,
+			token_id TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+	)`)
+	RunCommand(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			client_id TEXT NOT NULL DEFAULT '',
+			device TEXT NOT NULL DEFAULT '',
+			ip_address TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			last_refreshed_at DATETIME,
+			revoked_at DATETIME,
+			revoked_by TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	RunCommand(`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`)
+
+	addColumnIfMissing("users", "tokens_valid_after", "DATETIME")
+	addColumnIfMissing("users", "tokens_stale_before", "DATETIME")
+	addColumnIfMissing("users", "authz_version", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("clients", "exchange_audiences", "TEXT NOT NULL DEFAULT '[]'")
+	addColumnIfMissing("clients", "token_format", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("users", "additional_info", "TEXT NOT NULL DEFAULT '{}'")
+	addColumnIfMissing("clients", "claim_mappings", "TEXT NOT NULL DEFAULT 'null'")
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already present.
+// SQLite has no "ADD COLUMN IF NOT EXISTS", so the table layout is read with PRAGMA table_info.
+//
+// Parameters:
+//   - table: The table to alter
+//   - column: The column name
+//   - definition: The column type and constraints (e.g., "TEXT NOT NULL DEFAULT ''")
+func addColumnIfMissing(table string, column string, definition string) {
+	rows, err := RunQuery(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		log.Printf("Failed to read columns of table %s: %v", table, err)
+		return
+	}
+
+	exists := false
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			log.Printf("Failed to scan column of table %s: %v", table, err)
+			continue
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	rows.Close()
+
+	if exists {
+		return
+	}
+	if err := RunCommand(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		log.Printf("Failed to add column %s.%s: %v", table, column, err)
+		return
+	}
+	log.Printf("Added column %s.%s", table, column)
+}
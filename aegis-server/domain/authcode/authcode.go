@@ -0,0 +1,101 @@
+// Package authcode provides domain models and business logic for OAuth 2.0 authorization codes.
+// Codes are short-lived, single-use and bound to a client, redirect URI and PKCE challenge.
+package authcode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+	"github.com/google/uuid"
+)
+
+// CODE_EXPIRATION is how long an authorization code can be exchanged for tokens.
+// RFC 6749 section 4.1.2 recommends a maximum lifetime of 10 minutes.
+const CODE_EXPIRATION = 1 * time.Minute
+
+// CODE_CHALLENGE_METHOD_S256 is the only PKCE transformation accepted (RFC 7636 section 4.2).
+const CODE_CHALLENGE_METHOD_S256 = "S256"
+
+// AuthorizationCode represents a code issued by the authorization endpoint after the
+// user logged in, waiting to be exchanged for tokens at the token endpoint.
+type AuthorizationCode struct {
+	Code                string
+	ClientId            string
+	UserId              uuid.UUID
+	RedirectUri         string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+}
+
+// CreateAuthorizationCode creates a new authorization code with 256 bits of randomness.
+//
+// Parameters:
+//   - clientId: The client the code is issued to
+//   - userId: The user who authorized the request
+//   - redirectUri: The redirect URI the code is delivered to
+//   - scope: The requested scope
+//   - nonce: The OpenID Connect nonce to include in the ID token, may be empty
+//   - codeChallenge: The PKCE code challenge sent by the client
+//
+// Returns:
+//   - Pointer to the newly created AuthorizationCode
+//   - Error if random generation fails
+func CreateAuthorizationCode(clientId string, userId uuid.UUID, redirectUri string, scope string, nonce string, codeChallenge string) (*AuthorizationCode, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &AuthorizationCode{
+		Code:                base64.RawURLEncoding.EncodeToString(randomBytes),
+		ClientId:            clientId,
+		UserId:              userId,
+		RedirectUri:         redirectUri,
+		Scope:               scope,
+		Nonce:               nonce,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: CODE_CHALLENGE_METHOD_S256,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(CODE_EXPIRATION),
+	}, nil
+}
+
+// IsExpired reports whether the code can no longer be exchanged.
+func (a *AuthorizationCode) IsExpired() bool {
+	return time.Now().After(a.ExpiresAt)
+}
+
+// VerifyCodeVerifier checks the PKCE code verifier against the stored challenge.
+// The challenge must equal BASE64URL(SHA256(verifier)) (RFC 7636 section 4.6).
+//
+// Parameters:
+//   - codeVerifier: The code verifier sent to the token endpoint
+//
+// Returns:
+//   - true if the verifier matches the challenge, false otherwise
+func (a *AuthorizationCode) VerifyCodeVerifier(codeVerifier string) bool {
+	if codeVerifier == "" || a.CodeChallengeMethod != CODE_CHALLENGE_METHOD_S256 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(CodeChallengeS256(codeVerifier)), []byte(a.CodeChallenge)) == 1
+}
+
+// CodeChallengeS256 derives the S256 code challenge for a code verifier.
+//
+// Parameters:
+//   - codeVerifier: The PKCE code verifier
+//
+// Returns:
+//   - The base64url-encoded SHA-256 hash of the verifier
+func CodeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,78 @@
+package authcode
+
+import (
+	"testing"
+	"time"
+	"github.com/google/uuid"
+)
+
+// TestCreateAuthorizationCode tests code creation
+func TestCreateAuthorizationCode(t *testing.T) {
+	userId := uuid.New()
+
+	code, err := CreateAuthorizationCode("client-1", userId, "https://app.example.com/callback", "openid", "nonce-1", CodeChallengeS256("verifier"))
+
+	if err != nil {
+		t.Fatalf("CreateAuthorizationCode failed: %v", err)
+	}
+	if len(code.Code) != 43 {
+		t.Errorf("Expected 43 character code, got %d", len(code.Code))
+	}
+	if code.UserId != userId {
+		t.Errorf("Expected user %s, got %s", userId, code.UserId)
+	}
+	if code.CodeChallengeMethod != CODE_CHALLENGE_METHOD_S256 {
+		t.Errorf("Expected method %s, got %s", CODE_CHALLENGE_METHOD_S256, code.CodeChallengeMethod)
+	}
+	if code.ExpiresAt.Sub(code.CreatedAt) != CODE_EXPIRATION {
+		t.Errorf("Expected code to expire after %v", CODE_EXPIRATION)
+	}
+	if code.IsExpired() {
+		t.Error("New code should not be expired")
+	}
+}
+
+// TestCreateAuthorizationCode_Unique tests that codes are random
+func TestCreateAuthorizationCode_Unique(t *testing.T) {
+	first, _ := CreateAuthorizationCode("client-1", uuid.New(), "", "", "", "")
+	second, _ := CreateAuthorizationCode("client-1", uuid.New(), "", "", "", "")
+
+	if first.Code == second.Code {
+		t.Error("Codes should be unique")
+	}
+}
+
+// TestIsExpired tests expiration check
+func TestIsExpired(t *testing.T) {
+	code, _ := CreateAuthorizationCode("client-1", uuid.New(), "", "", "", "")
+	code.ExpiresAt = time.Now().Add(-time.Second)
+
+	if !code.IsExpired() {
+		t.Error("Code past its expiration should be expired")
+	}
+}
+
+// TestCodeChallengeS256 tests the RFC 7636 appendix B example
+func TestCodeChallengeS256(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	expected := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if challenge := CodeChallengeS256(verifier); challenge != expected {
+		t.Errorf("Expected challenge %s, got %s", expected, challenge)
+	}
+}
+
+// TestVerifyCodeVerifier tests PKCE verification
+func TestVerifyCodeVerifier(t *testing.T) {
+	code, _ := CreateAuthorizationCode("client-1", uuid.New(), "", "", "", CodeChallengeS256("correct-verifier"))
+
+	if !code.VerifyCodeVerifier("correct-verifier") {
+		t.Error("Matching verifier should be accepted")
+	}
+	if code.VerifyCodeVerifier("wrong-verifier") {
+		t.Error("Wrong verifier should be rejected")
+	}
+	if code.VerifyCodeVerifier("") {
+		t.Error("Empty verifier should be rejected")
+	}
+}
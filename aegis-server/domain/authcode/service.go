@@ -0,0 +1,164 @@
+package authcode
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+)
+
+var ErrCodeNotFound = errors.New("authorization code not found")
+var ErrCodeExpired = errors.New("authorization code expired")
+var ErrCodeAlreadyUsed = errors.New("authorization code already used")
+
+const (
+	SELECT_CODE = `
+		SELECT
+			code,
+			client_id,
+			user_id,
+			redirect_uri,
+			scope,
+			nonce,
+			code_challenge,
+			code_challenge_method,
+			created_at,
+			expires_at,
+			used_at
+		FROM
+			authorization_codes
+		WHERE
+			code = ?
+	`
+
+	INSERT_CODE = `
+		INSERT INTO authorization_codes (
+			code,
+			client_id,
+			user_id,
+			redirect_uri,
+			scope,
+			nonce,
+			code_challenge,
+			code_challenge_method,
+			created_at,
+			expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	MARK_CODE_USED = `
+		UPDATE
+			authorization_codes
+		SET
+			used_at = ?
+		WHERE code = ? AND used_at IS NULL
+	`
+
+	DELETE_EXPIRED_CODES = `
+		DELETE FROM authorization_codes
+		WHERE expires_at < ?
+	`
+)
+
+// SaveAuthorizationCode inserts a new authorization code into the database.
+//
+// Parameters:
+//   - code: The authorization code to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveAuthorizationCode(code *AuthorizationCode) error {
+	return db.RunCommandWithArgs(INSERT_CODE,
+		code.Code,
+		code.ClientId,
+		code.UserId.String(),
+		code.RedirectUri,
+		code.Scope,
+		code.Nonce,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.CreatedAt,
+		code.ExpiresAt,
+	)
+}
+
+// GetAuthorizationCode retrieves an authorization code by its value.
+//
+// Parameters:
+//   - code: The code value
+//
+// Returns:
+//   - Pointer to the AuthorizationCode if found, nil otherwise
+func GetAuthorizationCode(code string) *AuthorizationCode {
+	queryResult, err := db.RunQueryWithArgs(SELECT_CODE, code)
+	if err != nil {
+		log.Println("Error fetching authorization code:", err)
+		return nil
+	}
+	defer queryResult.Close()
+
+	if !queryResult.Next() {
+		return nil
+	}
+
+	var authCode AuthorizationCode
+	var userId string
+	var usedAt sql.NullTime
+	err = queryResult.Scan(&authCode.Code, &authCode.ClientId, &userId, &authCode.RedirectUri, &authCode.Scope, &authCode.Nonce,
+		&authCode.CodeChallenge, &authCode.CodeChallengeMethod, &authCode.CreatedAt, &authCode.ExpiresAt, &usedAt)
+	if err != nil {
+		log.Println("Error scanning authorization code:", err)
+		return nil
+	}
+	authCode.UserId, _ = uuid.Parse(userId)
+	if usedAt.Valid {
+		authCode.UsedAt = &usedAt.Time
+	}
+	return &authCode
+}
+
+// ConsumeAuthorizationCode redeems an authorization code exactly once.
+// The code is marked as used with a conditional update, so concurrent redemptions
+// of the same code cannot both succeed.
+//
+// Parameters:
+//   - code: The code value sent to the token endpoint
+//
+// Returns:
+//   - The redeemed AuthorizationCode
+//   - ErrCodeNotFound, ErrCodeExpired or ErrCodeAlreadyUsed if the code cannot be redeemed
+func ConsumeAuthorizationCode(code string) (*AuthorizationCode, error) {
+	authCode := GetAuthorizationCode(code)
+	if authCode == nil {
+		return nil, ErrCodeNotFound
+	}
+	if authCode.UsedAt != nil {
+		log.Printf("Authorization code reuse detected for client %s, user %s", authCode.ClientId, authCode.UserId)
+		return nil, ErrCodeAlreadyUsed
+	}
+	if authCode.IsExpired() {
+		return nil, ErrCodeExpired
+	}
+
+	now := time.Now()
+	affected, err := db.RunCommandWithRowsAffected(MARK_CODE_USED, now, code)
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		log.Printf("Authorization code reuse detected for client %s, user %s", authCode.ClientId, authCode.UserId)
+		return nil, ErrCodeAlreadyUsed
+	}
+	authCode.UsedAt = &now
+	return authCode, nil
+}
+
+// DeleteExpiredAuthorizationCodes removes codes that can no longer be redeemed.
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteExpiredAuthorizationCodes() error {
+	return db.RunCommandWithArgs(DELETE_EXPIRED_CODES, time.Now())
+}
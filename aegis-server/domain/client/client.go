@@ -0,0 +1,310 @@
+// Package client provides domain models and business logic for OAuth 2.0 client registration.
+// Clients are the applications allowed to request tokens, on behalf of users or for themselves.
+package client
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/domain/reference"
+	"nfcunha/aegis/util/hash"
+	"nfcunha/aegis/util/jwt"
+)
+
+// Grant types a client can be allowed to use.
+const (
+	GRANT_AUTHORIZATION_CODE = "authorization_code"
+	GRANT_CLIENT_CREDENTIALS = "client_credentials"
+	GRANT_TOKEN_EXCHANGE     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	GRANT_DEVICE_CODE        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// DEFAULT_SCOPES are the scopes granted to clients registered without an explicit scope list.
+var DEFAULT_SCOPES = []string{"openid", "profile"}
+
+// Client represents an application registered to use the OAuth 2.0 endpoints.
+//
+// Confidential clients hold a secret, stored hashed like user passwords, and authenticate
+// with it at the token endpoint. Public clients (e.g. single-page apps) have no secret and
+// rely on PKCE.
+type Client struct {
+	ClientId             string
+	Name                 string
+	SecretHash           string
+	SecretSalt           string
+	SecretPepper         string
+	RedirectUris         []string
+	GrantTypes           []string
+	Scopes               []string
+	ExchangeAudiences    []string           // Audiences the client may request with the token exchange grant
+	TokenFormat          string             // JWTs or opaque reference tokens; empty uses the server default
+	ClaimMappings        []jwt.ClaimMapping // User attributes copied into the client's user tokens; nil uses the server default
+	AccessTokenLifetime  time.Duration      // Zero uses the server default
+	RefreshTokenLifetime time.Duration      // Zero uses the server default
+	CreatedAt            time.Time
+	CreatedBy            string
+	UpdatedAt            time.Time
+	UpdatedBy            string
+}
+
+// CreateClient creates a new public Client instance with a random client ID.
+// The client may use the authorization code grant with the default scopes;
+// use Update and GenerateSecret to configure it further.
+//
+// Parameters:
+//   - name: Human-readable name shown on the login page
+//   - redirectUris: Absolute URIs the client may receive authorization codes on
+//   - createdBy: Identifier of who registered the client
+//
+// Returns:
+//   - Pointer to the newly created Client
+func CreateClient(name string, redirectUris []string, createdBy string) *Client {
+	return &Client{
+		ClientId:     uuid.New().String(),
+		Name:         name,
+		RedirectUris: redirectUris,
+		GrantTypes:   []string{GRANT_AUTHORIZATION_CODE},
+		Scopes:       DEFAULT_SCOPES,
+		CreatedAt:    time.Now(),
+		CreatedBy:    createdBy,
+		UpdatedAt:    time.Now(),
+		UpdatedBy:    createdBy,
+	}
+}
+
+// Update replaces the client's configuration and updates audit fields.
+//
+// Parameters:
+//   - name: Human-readable name
+//   - redirectUris: Registered redirect URIs
+//   - grantTypes: Grant types the client may use
+//   - scopes: Scopes the client may request
+//   - accessTokenLifetime: Access token lifetime override, 0 for the server default
+//   - refreshTokenLifetime: Refresh token lifetime override, 0 for the server default
+//   - updatedBy: Identifier of who is updating the client
+func (c *Client) Update(name string, redirectUris []string, grantTypes []string, scopes []string, accessTokenLifetime time.Duration, refreshTokenLifetime time.Duration, updatedBy string) {
+	c.Name = name
+	c.RedirectUris = redirectUris
+	c.GrantTypes = grantTypes
+	c.Scopes = scopes
+	c.AccessTokenLifetime = accessTokenLifetime
+	c.RefreshTokenLifetime = refreshTokenLifetime
+	c.UpdatedAt = time.Now()
+	c.UpdatedBy = updatedBy
+}
+
+// GenerateSecret creates a new random client secret, replacing any previous one,
+// and makes the client confidential. Only the hash is kept.
+//
+// Parameters:
+//   - updatedBy: Identifier of who is generating the secret
+//
+// Returns:
+//   - The plain text secret, to be shown to the caller exactly once
+//   - Error if random generation fails
+func (c *Client) GenerateSecret(updatedBy string) (string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	hashOutput := hash.Hash(secret)
+	c.SecretHash = hashOutput.Hash
+	c.SecretSalt = hashOutput.Salt
+	c.SecretPepper = hashOutput.Pepper
+	c.UpdatedAt = time.Now()
+	c.UpdatedBy = updatedBy
+	return secret, nil
+}
+
+// IsConfidential reports whether the client has a secret and must authenticate with it.
+func (c *Client) IsConfidential() bool {
+	return c.SecretHash != ""
+}
+
+// SecretMatch verifies a client secret against the stored hash.
+//
+// Parameters:
+//   - secret: Plain text secret presented by the client
+//
+// Returns:
+//   - true if the client is confidential and the secret matches, false otherwise
+func (c *Client) SecretMatch(secret string) bool {
+	if !c.IsConfidential() {
+		return false
+	}
+	return hash.Compare(secret, c.SecretSalt, c.SecretPepper, c.SecretHash)
+}
+
+// HasRedirectUri reports whether the URI is registered for this client.
+// URIs are compared with exact string matching, as recommended by RFC 6749 section 3.1.2.
+//
+// Parameters:
+//   - redirectUri: The redirect URI sent in the authorization request
+//
+// Returns:
+//   - true if the URI is registered, false otherwise
+func (c *Client) HasRedirectUri(redirectUri string) bool {
+	return contains(c.RedirectUris, redirectUri)
+}
+
+// AllowsGrantType reports whether the client may use the given grant type.
+func (c *Client) AllowsGrantType(grantType string) bool {
+	return contains(c.GrantTypes, grantType)
+}
+
+// AllowsScopes reports whether every requested scope is allowed for the client.
+//
+// Parameters:
+//   - scopes: The requested scopes
+//
+// Returns:
+//   - true if all scopes are allowed (or none were requested), false otherwise
+func (c *Client) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsExchangeAudience reports whether the client may exchange tokens for the given audience.
+//
+// Parameters:
+//   - audience: The requested audience
+//
+// Returns:
+//   - true if the audience is listed in the client's exchange audiences, false otherwise
+func (c *Client) AllowsExchangeAudience(audience string) bool {
+	return contains(c.ExchangeAudiences, audience)
+}
+
+// Validate checks that the client configuration is consistent.
+// Redirect URIs must be valid, the authorization code grant needs at least one
+// redirect URI, and the client credentials and token exchange grants are reserved to
+// confidential clients. Token exchange also needs at least one exchange audience.
+// Claim mappings must not map attributes to claims Aegis sets itself.
+//
+// Returns:
+//   - Error describing the first problem found, nil if the client is valid
+func (c *Client) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	for _, redirectUri := range c.RedirectUris {
+		if err := ValidateRedirectUri(redirectUri); err != nil {
+			return fmt.Errorf("invalid redirect URI %s: %w", redirectUri, err)
+		}
+	}
+	if len(c.GrantTypes) == 0 {
+		return errors.New("at least one grant type is required")
+	}
+	for _, grantType := range c.GrantTypes {
+		switch grantType {
+		case GRANT_AUTHORIZATION_CODE:
+			if len(c.RedirectUris) == 0 {
+				return errors.New("the authorization_code grant requires at least one redirect URI")
+			}
+		case GRANT_CLIENT_CREDENTIALS:
+			if !c.IsConfidential() {
+				return errors.New("the client_credentials grant requires a confidential client")
+			}
+		case GRANT_TOKEN_EXCHANGE:
+			if !c.IsConfidential() {
+				return errors.New("the token exchange grant requires a confidential client")
+			}
+			if len(c.ExchangeAudiences) == 0 {
+				return errors.New("the token exchange grant requires at least one exchange audience")
+			}
+		case GRANT_DEVICE_CODE:
+			// Public clients allowed: devices such as CLIs cannot keep a secret
+		default:
+			return fmt.Errorf("unsupported grant type: %s", grantType)
+		}
+	}
+	for _, audience := range c.ExchangeAudiences {
+		if audience == "" {
+			return errors.New("exchange audiences must not be empty")
+		}
+	}
+	if c.TokenFormat != "" && !reference.IsValidFormat(c.TokenFormat) {
+		return fmt.Errorf("unsupported token format: %s", c.TokenFormat)
+	}
+	for _, mapping := range c.ClaimMappings {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.AccessTokenLifetime < 0 || c.RefreshTokenLifetime < 0 {
+		return errors.New("token lifetimes must not be negative")
+	}
+	return nil
+}
+
+// ValidateRedirectUri checks that a URI can be registered as a redirect URI.
+// Redirect URIs must be absolute and must not contain a fragment (RFC 6749 section 3.1.2).
+//
+// Parameters:
+//   - redirectUri: The URI to validate
+//
+// Returns:
+//   - Error describing why the URI is invalid, nil if it is valid
+func ValidateRedirectUri(redirectUri string) error {
+	parsed, err := url.Parse(redirectUri)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsAbs() || parsed.Host == "" {
+		return errors.New("redirect URI must be an absolute URI")
+	}
+	if parsed.Fragment != "" {
+		return errors.New("redirect URI must not contain a fragment")
+	}
+	return nil
+}
+
+// contains reports whether the slice holds the value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenOptions returns the options used to issue tokens to this client.
+// Unless an explicit audience is requested, tokens are issued for the client itself.
+//
+// Returns:
+//   - TokenOptions carrying the client ID as client and audience, and lifetime overrides
+func (c *Client) TokenOptions() jwt.TokenOptions {
+	return jwt.TokenOptions{
+		ClientId:             c.ClientId,
+		Audience:             []string{c.ClientId},
+		AccessTokenLifetime:  c.AccessTokenLifetime,
+		RefreshTokenLifetime: c.RefreshTokenLifetime,
+	}
+}
+
+// UserClaims returns the custom claims of the client's tokens for a user, mapped from the
+// user's attributes with the client's claim mappings, or the server's when it has none.
+//
+// Parameters:
+//   - attributes: The user's additional info
+//
+// Returns:
+//   - The custom claims, or nil if none apply
+func (c *Client) UserClaims(attributes map[string]interface{}) map[string]interface{} {
+	mappings := c.ClaimMappings
+	if mappings == nil {
+		mappings = jwt.CLAIM_MAPPINGS
+	}
+	return jwt.MapClaims(attributes, mappings)
+}
@@ -0,0 +1,257 @@
+package client
+
+import (
+	"testing"
+	"nfcunha/aegis/util/jwt"
+)
+
+// TestCreateClient tests client creation
+func TestCreateClient(t *testing.T) {
+	redirectUris := []string{"https://app.example.com/callback"}
+
+	client := CreateClient("Example App", redirectUris, "system")
+
+	if client == nil {
+		t.Fatal("CreateClient should not return nil")
+	}
+	if client.ClientId == "" {
+		t.Error("ClientId should not be empty")
+	}
+	if client.Name != "Example App" {
+		t.Errorf("Expected name %s, got %s", "Example App", client.Name)
+	}
+	if len(client.RedirectUris) != 1 {
+		t.Errorf("Expected 1 redirect URI, got %d", len(client.RedirectUris))
+	}
+	if client.CreatedAt.IsZero() {
+		t.Error("CreatedAt should not be zero")
+	}
+}
+
+// TestCreateClient_UniqueIds tests that each client gets its own ID
+func TestCreateClient_UniqueIds(t *testing.T) {
+	first := CreateClient("First", nil, "system")
+	second := CreateClient("Second", nil, "system")
+
+	if first.ClientId == second.ClientId {
+		t.Error("Client IDs should be unique")
+	}
+}
+
+// TestHasRedirectUri tests exact matching of registered redirect URIs
+func TestHasRedirectUri(t *testing.T) {
+	client := CreateClient("Example App", []string{"https://app.example.com/callback"}, "system")
+
+	if !client.HasRedirectUri("https://app.example.com/callback") {
+		t.Error("Registered redirect URI should match")
+	}
+	if client.HasRedirectUri("https://app.example.com/callback/") {
+		t.Error("Redirect URI with trailing slash should not match")
+	}
+	if client.HasRedirectUri("https://app.example.com/callback?next=evil") {
+		t.Error("Redirect URI with extra query should not match")
+	}
+	if client.HasRedirectUri("https://evil.example.com/callback") {
+		t.Error("Redirect URI on another host should not match")
+	}
+}
+
+// TestValidateRedirectUri tests which URIs can be registered
+func TestValidateRedirectUri(t *testing.T) {
+	valid := []string{
+		"https://app.example.com/callback",
+		"http://localhost:3000/callback",
+		"https://app.example.com/callback?tenant=1",
+	}
+	for _, uri := range valid {
+		if err := ValidateRedirectUri(uri); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", uri, err)
+		}
+	}
+
+	invalid := []string{
+		"/callback",
+		"app.example.com/callback",
+		"https://app.example.com/callback#fragment",
+	}
+	for _, uri := range invalid {
+		if err := ValidateRedirectUri(uri); err == nil {
+			t.Errorf("Expected %s to be invalid", uri)
+		}
+	}
+}
+
+// TestCreateClient_Defaults tests the grant types and scopes of a new client
+func TestCreateClient_Defaults(t *testing.T) {
+	client := CreateClient("Example App", []string{"https://app.example.com/callback"}, "system")
+
+	if client.IsConfidential() {
+		t.Error("New client should be public")
+	}
+	if !client.AllowsGrantType(GRANT_AUTHORIZATION_CODE) {
+		t.Error("New client should allow the authorization code grant")
+	}
+	if client.AllowsGrantType(GRANT_CLIENT_CREDENTIALS) {
+		t.Error("New client should not allow the client credentials grant")
+	}
+	if !client.AllowsScopes([]string{"openid"}) {
+		t.Error("New client should allow the openid scope")
+	}
+}
+
+// TestGenerateSecret tests secret generation and verification
+func TestGenerateSecret(t *testing.T) {
+	client := CreateClient("Service", nil, "system")
+
+	secret, err := client.GenerateSecret("admin")
+	if err != nil {
+		t.Fatalf("GenerateSecret failed: %v", err)
+	}
+	if secret == "" {
+		t.Fatal("Secret should not be empty")
+	}
+	if !client.IsConfidential() {
+		t.Error("Client with a secret should be confidential")
+	}
+	if client.SecretHash == secret {
+		t.Error("Secret should be stored hashed")
+	}
+	if !client.SecretMatch(secret) {
+		t.Error("Generated secret should match")
+	}
+	if client.SecretMatch("wrong-secret") {
+		t.Error("Wrong secret should not match")
+	}
+	if client.UpdatedBy != "admin" {
+		t.Errorf("Expected updatedBy admin, got %s", client.UpdatedBy)
+	}
+}
+
+// TestGenerateSecret_Rotation tests that a new secret invalidates the previous one
+func TestGenerateSecret_Rotation(t *testing.T) {
+	client := CreateClient("Service", nil, "system")
+	oldSecret, _ := client.GenerateSecret("system")
+	newSecret, _ := client.GenerateSecret("system")
+
+	if client.SecretMatch(oldSecret) {
+		t.Error("Old secret should no longer match")
+	}
+	if !client.SecretMatch(newSecret) {
+		t.Error("New secret should match")
+	}
+}
+
+// TestAllowsScopes tests that every requested scope must be allowed
+func TestAllowsScopes(t *testing.T) {
+	client := CreateClient("Service", nil, "system")
+	client.Scopes = []string{"read:users", "write:users"}
+
+	if !client.AllowsScopes([]string{"read:users"}) {
+		t.Error("Allowed scope should be accepted")
+	}
+	if !client.AllowsScopes(nil) {
+		t.Error("No scopes should be accepted")
+	}
+	if client.AllowsScopes([]string{"read:users", "delete:users"}) {
+		t.Error("Scope outside the allowed list should be rejected")
+	}
+}
+
+// TestValidate tests client configuration validation
+func TestValidate(t *testing.T) {
+	client := CreateClient("Example App", []string{"https://app.example.com/callback"}, "system")
+	if err := client.Validate(); err != nil {
+		t.Errorf("Default client should be valid, got %v", err)
+	}
+
+	noRedirect := CreateClient("Example App", nil, "system")
+	if err := noRedirect.Validate(); err == nil {
+		t.Error("Authorization code client without redirect URI should be invalid")
+	}
+
+	publicMachine := CreateClient("Service", nil, "system")
+	publicMachine.GrantTypes = []string{GRANT_CLIENT_CREDENTIALS}
+	if err := publicMachine.Validate(); err == nil {
+		t.Error("Client credentials grant without secret should be invalid")
+	}
+
+	publicMachine.GenerateSecret("system")
+	if err := publicMachine.Validate(); err != nil {
+		t.Errorf("Confidential machine client should be valid, got %v", err)
+	}
+
+	publicDevice := CreateClient("CLI", nil, "system")
+	publicDevice.GrantTypes = []string{GRANT_DEVICE_CODE}
+	if err := publicDevice.Validate(); err != nil {
+		t.Errorf("Public device client should be valid, got %v", err)
+	}
+
+	unknownGrant := CreateClient("Service", nil, "system")
+	unknownGrant.GrantTypes = []string{"password"}
+	if err := unknownGrant.Validate(); err == nil {
+		t.Error("Unsupported grant type should be invalid")
+	}
+
+	client.TokenFormat = "reference"
+	if err := client.Validate(); err != nil {
+		t.Errorf("Client with reference tokens should be valid, got %v", err)
+	}
+	client.TokenFormat = "paseto"
+	if err := client.Validate(); err == nil {
+		t.Error("Unsupported token format should be invalid")
+	}
+}
+
+// TestValidate_TokenExchange tests that token exchange requires a secret and exchange audiences
+func TestValidate_TokenExchange(t *testing.T) {
+	gateway := CreateClient("Gateway", nil, "system")
+	gateway.GrantTypes = []string{GRANT_TOKEN_EXCHANGE}
+	gateway.ExchangeAudiences = []string{"https://billing.example.com"}
+	if err := gateway.Validate(); err == nil {
+		t.Error("Token exchange without secret should be invalid")
+	}
+
+	gateway.GenerateSecret("system")
+	if err := gateway.Validate(); err != nil {
+		t.Errorf("Confidential gateway client should be valid, got %v", err)
+	}
+	if !gateway.AllowsExchangeAudience("https://billing.example.com") || gateway.AllowsExchangeAudience("https://hr.example.com") {
+		t.Error("Expected only the listed exchange audience to be allowed")
+	}
+
+	gateway.ExchangeAudiences = nil
+	if err := gateway.Validate(); err == nil {
+		t.Error("Token exchange without exchange audiences should be invalid")
+	}
+}
+
+// TestUserClaims tests that client claim mappings replace the server's and cannot target reserved claims
+func TestUserClaims(t *testing.T) {
+	original := jwt.CLAIM_MAPPINGS
+	jwt.CLAIM_MAPPINGS = []jwt.ClaimMapping{{Attribute: "department", Claim: "department"}}
+	defer func() { jwt.CLAIM_MAPPINGS = original }()
+
+	attributes := map[string]interface{}{"department": "sales", "tenant_id": "acme"}
+	client := CreateClient("Example App", []string{"https://app.example.com/callback"}, "system")
+	if claims := client.UserClaims(attributes); len(claims) != 1 || claims["department"] != "sales" {
+		t.Errorf("Expected the server's mappings, got %v", claims)
+	}
+
+	client.ClaimMappings = []jwt.ClaimMapping{{Attribute: "tenant_id", Claim: "tenant"}}
+	if claims := client.UserClaims(attributes); len(claims) != 1 || claims["tenant"] != "acme" {
+		t.Errorf("Expected the client's mappings, got %v", claims)
+	}
+	if err := client.Validate(); err != nil {
+		t.Errorf("Client with claim mappings should be valid, got %v", err)
+	}
+
+	client.ClaimMappings = []jwt.ClaimMapping{}
+	if claims := client.UserClaims(attributes); claims != nil {
+		t.Errorf("Expected no claims with empty client mappings, got %v", claims)
+	}
+
+	client.ClaimMappings = []jwt.ClaimMapping{{Attribute: "tenant_id", Claim: "aud"}}
+	if err := client.Validate(); err == nil {
+		t.Error("Claim mapping to a reserved claim should be invalid")
+	}
+}
@@ -0,0 +1,346 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+	db "nfcunha/aegis/database"
+)
+
+// ErrInvalidClient is returned by Authenticate when the client is unknown or its credentials are wrong.
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+const (
+	SELECT_ALL_CLIENTS = `
+		SELECT
+			client_id,
+			name,
+			secret_hash,
+			secret_salt,
+			secret_pepper,
+			redirect_uris,
+			grant_types,
+			scopes,
+			exchange_audiences,
+			token_format,
+			claim_mappings,
+			access_token_lifetime,
+			refresh_token_lifetime,
+			created_at,
+			created_by,
+			updated_at,
+			updated_by
+		FROM
+			clients
+	`
+
+	SELECT_CLIENT_BY_ID = `
+		SELECT
+			client_id,
+			name,
+			secret_hash,
+			secret_salt,
+			secret_pepper,
+			redirect_uris,
+			grant_types,
+			scopes,
+			exchange_audiences,
+			token_format,
+			claim_mappings,
+			access_token_lifetime,
+			refresh_token_lifetime,
+			created_at,
+			created_by,
+			updated_at,
+			updated_by
+		FROM
+			clients
+		WHERE
+			client_id = ?
+	`
+
+	INSERT_CLIENT = `
+		INSERT INTO clients (
+			client_id,
+			name,
+			secret_hash,
+			secret_salt,
+			secret_pepper,
+			redirect_uris,
+			grant_types,
+			scopes,
+			exchange_audiences,
+			token_format,
+			claim_mappings,
+			access_token_lifetime,
+			refresh_token_lifetime,
+			created_at,
+			created_by,
+			updated_at,
+			updated_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	UPDATE_CLIENT = `
+		UPDATE
+			clients
+		SET
+			name = ?,
+			secret_hash = ?,
+			secret_salt = ?,
+			secret_pepper = ?,
+			redirect_uris = ?,
+			grant_types = ?,
+			scopes = ?,
+			exchange_audiences = ?,
+			token_format = ?,
+			claim_mappings = ?,
+			access_token_lifetime = ?,
+			refresh_token_lifetime = ?,
+			updated_at = ?,
+			updated_by = ?
+		WHERE client_id = ?
+	`
+
+	DELETE_CLIENT = `
+		DELETE FROM clients
+		WHERE client_id = ?
+	`
+)
+
+// scanner is implemented by *sql.Rows and lets scanClient read a client from a result row.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ListClients retrieves all registered clients from the database.
+//
+// Returns:
+//   - Slice of Client pointers, empty slice if no clients exist or on error
+func ListClients() []*Client {
+	log.Println("Listing all clients")
+	queryResult, err := db.RunQuery(SELECT_ALL_CLIENTS)
+	if err != nil {
+		log.Println("Error listing clients:", err)
+		return []*Client{}
+	}
+	defer queryResult.Close()
+
+	clients := []*Client{}
+	for queryResult.Next() {
+		client, err := scanClient(queryResult)
+		if err != nil {
+			log.Println("Error scanning client:", err)
+			continue
+		}
+		clients = append(clients, client)
+	}
+
+	log.Printf("Found %d clients", len(clients))
+	return clients
+}
+
+// GetClientById retrieves a client by its client ID.
+//
+// Parameters:
+//   - clientId: The client ID to look up
+//
+// Returns:
+//   - Pointer to the Client if found, nil otherwise
+func GetClientById(clientId string) *Client {
+	queryResult, err := db.RunQueryWithArgs(SELECT_CLIENT_BY_ID, clientId)
+	if err != nil {
+		log.Println("Error fetching client:", err)
+		return nil
+	}
+	defer queryResult.Close()
+
+	if !queryResult.Next() {
+		log.Printf("Client not found: %s", clientId)
+		return nil
+	}
+
+	client, err := scanClient(queryResult)
+	if err != nil {
+		log.Println("Error scanning client:", err)
+		return nil
+	}
+	return client
+}
+
+// SaveClient inserts a new client record into the database.
+//
+// Parameters:
+//   - client: The client to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveClient(client *Client) error {
+	log.Printf("Saving client: %s (%s)", client.Name, client.ClientId)
+	redirectUris, grantTypes, scopes, exchangeAudiences, err := encodeLists(client)
+	if err != nil {
+		return err
+	}
+	claimMappings, err := json.Marshal(client.ClaimMappings)
+	if err != nil {
+		return err
+	}
+	return db.RunCommandWithArgs(INSERT_CLIENT,
+		client.ClientId,
+		client.Name,
+		client.SecretHash,
+		client.SecretSalt,
+		client.SecretPepper,
+		redirectUris,
+		grantTypes,
+		scopes,
+		exchangeAudiences,
+		client.TokenFormat,
+		string(claimMappings),
+		int64(client.AccessTokenLifetime.Seconds()),
+		int64(client.RefreshTokenLifetime.Seconds()),
+		client.CreatedAt,
+		client.CreatedBy,
+		client.UpdatedAt,
+		client.UpdatedBy,
+	)
+}
+
+// UpdateClient updates an existing client record in the database, including its secret.
+//
+// Parameters:
+//   - client: The client with updated data
+//
+// Returns:
+//   - Error if the update fails
+func UpdateClient(client *Client) error {
+	log.Printf("Updating client: %s", client.ClientId)
+	redirectUris, grantTypes, scopes, exchangeAudiences, err := encodeLists(client)
+	if err != nil {
+		return err
+	}
+	claimMappings, err := json.Marshal(client.ClaimMappings)
+	if err != nil {
+		return err
+	}
+	return db.RunCommandWithArgs(UPDATE_CLIENT,
+		client.Name,
+		client.SecretHash,
+		client.SecretSalt,
+		client.SecretPepper,
+		redirectUris,
+		grantTypes,
+		scopes,
+		exchangeAudiences,
+		client.TokenFormat,
+		string(claimMappings),
+		int64(client.AccessTokenLifetime.Seconds()),
+		int64(client.RefreshTokenLifetime.Seconds()),
+		client.UpdatedAt,
+		client.UpdatedBy,
+		client.ClientId,
+	)
+}
+
+// DeleteClient removes a client from the database.
+// Pending authorization codes of the client are deleted via foreign key constraints.
+// Tokens already issued to the client stay valid until they expire or are revoked.
+//
+// Parameters:
+//   - clientId: The ID of the client to delete
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteClient(clientId string) error {
+	log.Printf("Deleting client: %s", clientId)
+	return db.RunCommandWithArgs(DELETE_CLIENT, clientId)
+}
+
+// Authenticate verifies the credentials a client presented to the token endpoint.
+// Confidential clients must present their secret. Public clients must not present one.
+//
+// Parameters:
+//   - clientId: The client ID
+//   - secret: The client secret, empty if none was presented
+//
+// Returns:
+//   - The authenticated Client
+//   - ErrInvalidClient if the client is unknown or the credentials do not match
+func Authenticate(clientId string, secret string) (*Client, error) {
+	client := GetClientById(clientId)
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+	if client.IsConfidential() != (secret != "") {
+		log.Printf("Client authentication failed for %s: confidential=%t", clientId, client.IsConfidential())
+		return nil, ErrInvalidClient
+	}
+	if client.IsConfidential() && !client.SecretMatch(secret) {
+		log.Printf("Client authentication failed for %s: invalid secret", clientId)
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// encodeLists serializes the list fields of a client as JSON arrays for storage.
+func encodeLists(client *Client) (string, string, string, string, error) {
+	redirectUris, err := json.Marshal(nonNil(client.RedirectUris))
+	if err != nil {
+		return "", "", "", "", err
+	}
+	grantTypes, err := json.Marshal(nonNil(client.GrantTypes))
+	if err != nil {
+		return "", "", "", "", err
+	}
+	scopes, err := json.Marshal(nonNil(client.Scopes))
+	if err != nil {
+		return "", "", "", "", err
+	}
+	exchangeAudiences, err := json.Marshal(nonNil(client.ExchangeAudiences))
+	if err != nil {
+		return "", "", "", "", err
+	}
+	return string(redirectUris), string(grantTypes), string(scopes), string(exchangeAudiences), nil
+}
+
+// scanClient reads a client from the current result row.
+// List fields are stored as JSON arrays and lifetimes in seconds. Claim mappings are stored
+// as a JSON array, or null when the client uses the server's mappings.
+func scanClient(row scanner) (*Client, error) {
+	var client Client
+	var redirectUris, grantTypes, scopes, exchangeAudiences, claimMappings string
+	var accessTokenLifetime, refreshTokenLifetime int64
+	err := row.Scan(&client.ClientId, &client.Name, &client.SecretHash, &client.SecretSalt, &client.SecretPepper,
+		&redirectUris, &grantTypes, &scopes, &exchangeAudiences, &client.TokenFormat, &claimMappings, &accessTokenLifetime, &refreshTokenLifetime,
+		&client.CreatedAt, &client.CreatedBy, &client.UpdatedAt, &client.UpdatedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(redirectUris), &client.RedirectUris); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(grantTypes), &client.GrantTypes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &client.Scopes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(exchangeAudiences), &client.ExchangeAudiences); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(claimMappings), &client.ClaimMappings); err != nil {
+		return nil, err
+	}
+	client.AccessTokenLifetime = time.Duration(accessTokenLifetime) * time.Second
+	client.RefreshTokenLifetime = time.Duration(refreshTokenLifetime) * time.Second
+	return &client, nil
+}
+
+// nonNil returns an empty slice instead of nil, so lists are stored as [] rather than null.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,131 @@
+// Package devicecode provides domain models and business logic for the OAuth 2.0 device
+// authorization grant (RFC 8628). A device without a browser obtains a device code and a short
+// user code; the user approves the request on another device, while the device polls for tokens.
+package devicecode
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+	"github.com/google/uuid"
+)
+
+// DEVICE_CODE_EXPIRATION is how long the user has to approve a device authorization request.
+const DEVICE_CODE_EXPIRATION = 10 * time.Minute
+
+// POLLING_INTERVAL is the minimum time a device must wait between token requests (RFC 8628 section 3.2).
+const POLLING_INTERVAL = 5 * time.Second
+
+// SLOW_DOWN_INCREMENT is added to the polling interval each time a device polls too fast (RFC 8628 section 3.5).
+const SLOW_DOWN_INCREMENT = 5 * time.Second
+
+// USER_CODE_CHARSET holds the characters of user codes: uppercase consonants only, so codes are
+// easy to type, cannot be mistaken for one another and cannot spell words (RFC 8628 section 6.1).
+const USER_CODE_CHARSET = "BCDFGHJKLMNPQRSTVWXZ"
+
+// USER_CODE_LENGTH is the number of characters of a user code, about 34 bits of entropy.
+const USER_CODE_LENGTH = 8
+
+// Status of a device authorization request.
+const (
+	STATUS_PENDING  = "pending"  // Waiting for the user
+	STATUS_APPROVED = "approved" // Approved, tokens not yet issued
+	STATUS_DENIED   = "denied"   // Denied by the user
+	STATUS_CONSUMED = "consumed" // Tokens issued
+)
+
+// DeviceAuthorization represents a device authorization request, from the moment the device
+// asks for a code until tokens are issued.
+type DeviceAuthorization struct {
+	DeviceCode   string
+	UserCode     string // Normalized, without separator
+	ClientId     string
+	Scope        string
+	UserId       *uuid.UUID // The user who approved or denied the request
+	Status       string
+	Interval     time.Duration
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	LastPolledAt *time.Time
+}
+
+// CreateDeviceAuthorization creates a new pending device authorization request.
+// The device code has 256 bits of randomness; the user code is short enough to be typed by hand.
+//
+// Parameters:
+//   - clientId: The client the request is made for
+//   - scope: The requested scope
+//
+// Returns:
+//   - Pointer to the newly created DeviceAuthorization
+//   - Error if random generation fails
+func CreateDeviceAuthorization(clientId string, scope string) (*DeviceAuthorization, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &DeviceAuthorization{
+		DeviceCode: base64.RawURLEncoding.EncodeToString(randomBytes),
+		UserCode:   userCode,
+		ClientId:   clientId,
+		Scope:      scope,
+		Status:     STATUS_PENDING,
+		Interval:   POLLING_INTERVAL,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(DEVICE_CODE_EXPIRATION),
+	}, nil
+}
+
+// IsExpired reports whether the request can no longer be approved or redeemed.
+func (d *DeviceAuthorization) IsExpired() bool {
+	return time.Now().After(d.ExpiresAt)
+}
+
+// FormattedUserCode returns the user code as shown to the user, e.g. "WDJB-MJHT".
+func (d *DeviceAuthorization) FormattedUserCode() string {
+	half := len(d.UserCode) / 2
+	return d.UserCode[:half] + "-" + d.UserCode[half:]
+}
+
+// NormalizeUserCode converts a user code as typed by the user to its stored form.
+// Case, dashes and spaces are ignored (RFC 8628 section 6.1).
+//
+// Parameters:
+//   - userCode: The user code entered by the user
+//
+// Returns:
+//   - The uppercase user code without separators
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
+
+// generateUserCode draws a user code uniformly from USER_CODE_CHARSET.
+// Random bytes that would bias the distribution are discarded.
+func generateUserCode() (string, error) {
+	limit := 256 - 256%len(USER_CODE_CHARSET)
+	code := make([]byte, 0, USER_CODE_LENGTH)
+	buffer := make([]byte, USER_CODE_LENGTH*2)
+	for len(code) < USER_CODE_LENGTH {
+		if _, err := rand.Read(buffer); err != nil {
+			return "", err
+		}
+		for _, b := range buffer {
+			if int(b) < limit && len(code) < USER_CODE_LENGTH {
+				code = append(code, USER_CODE_CHARSET[int(b)%len(USER_CODE_CHARSET)])
+			}
+		}
+	}
+	return string(code), nil
+}
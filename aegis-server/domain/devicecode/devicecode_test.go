@@ -0,0 +1,49 @@
+package devicecode
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCreateDeviceAuthorization tests that a new request is pending with a readable user code
+func TestCreateDeviceAuthorization(t *testing.T) {
+	authorization, err := CreateDeviceAuthorization("client-1", "openid")
+	if err != nil {
+		t.Fatalf("CreateDeviceAuthorization failed: %v", err)
+	}
+
+	if authorization.Status != STATUS_PENDING {
+		t.Errorf("Expected status %s, got %s", STATUS_PENDING, authorization.Status)
+	}
+	if len(authorization.DeviceCode) != 43 {
+		t.Errorf("Expected 43 character device code, got %d", len(authorization.DeviceCode))
+	}
+	if len(authorization.UserCode) != USER_CODE_LENGTH {
+		t.Errorf("Expected %d character user code, got %s", USER_CODE_LENGTH, authorization.UserCode)
+	}
+	for _, r := range authorization.UserCode {
+		if !strings.ContainsRune(USER_CODE_CHARSET, r) {
+			t.Errorf("User code contains unexpected character %q", r)
+		}
+	}
+	if authorization.IsExpired() {
+		t.Error("New request should not be expired")
+	}
+}
+
+// TestFormattedUserCode tests that user codes are shown with a separator
+func TestFormattedUserCode(t *testing.T) {
+	authorization := &DeviceAuthorization{UserCode: "WDJBMJHT"}
+	if formatted := authorization.FormattedUserCode(); formatted != "WDJB-MJHT" {
+		t.Errorf("Expected WDJB-MJHT, got %s", formatted)
+	}
+}
+
+// TestNormalizeUserCode tests that case and separators typed by the user are ignored
+func TestNormalizeUserCode(t *testing.T) {
+	for _, input := range []string{"WDJB-MJHT", "wdjb-mjht", "wdjb mjht", "WDJBMJHT"} {
+		if normalized := NormalizeUserCode(input); normalized != "WDJBMJHT" {
+			t.Errorf("NormalizeUserCode(%q) = %s, expected WDJBMJHT", input, normalized)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package devicecode
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+)
+
+var ErrDeviceCodeNotFound = errors.New("device code not found")
+var ErrDeviceCodeExpired = errors.New("device code expired")
+var ErrDeviceCodeAlreadyUsed = errors.New("device code already used")
+var ErrAuthorizationPending = errors.New("authorization pending")
+var ErrSlowDown = errors.New("polling too fast")
+var ErrAccessDenied = errors.New("authorization denied")
+
+const (
+	SELECT_DEVICE_AUTHORIZATION_COLUMNS = `
+		SELECT
+			device_code,
+			user_code,
+			client_id,
+			scope,
+			user_id,
+			status,
+			interval_seconds,
+			created_at,
+			expires_at,
+			last_polled_at
+		FROM
+			device_authorizations
+	`
+
+	SELECT_BY_DEVICE_CODE = SELECT_DEVICE_AUTHORIZATION_COLUMNS + `
+		WHERE
+			device_code = ?
+	`
+
+	SELECT_BY_USER_CODE = SELECT_DEVICE_AUTHORIZATION_COLUMNS + `
+		WHERE
+			user_code = ?
+	`
+
+	INSERT_DEVICE_AUTHORIZATION = `
+		INSERT INTO device_authorizations (
+			device_code,
+			user_code,
+			client_id,
+			scope,
+			status,
+			interval_seconds,
+			created_at,
+			expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	DECIDE_DEVICE_AUTHORIZATION = `
+		UPDATE
+			device_authorizations
+		SET
+			status = ?,
+			user_id = ?
+		WHERE user_code = ? AND status = 'pending' AND expires_at > ?
+	`
+
+	RECORD_POLL = `
+		UPDATE
+			device_authorizations
+		SET
+			last_polled_at = ?,
+			interval_seconds = ?
+		WHERE device_code = ?
+	`
+
+	MARK_CONSUMED = `
+		UPDATE
+			device_authorizations
+		SET
+			status = 'consumed'
+		WHERE device_code = ? AND status = 'approved'
+	`
+
+	DELETE_EXPIRED_DEVICE_AUTHORIZATIONS = `
+		DELETE FROM device_authorizations
+		WHERE expires_at < ?
+	`
+)
+
+// SaveDeviceAuthorization inserts a new device authorization request into the database.
+//
+// Parameters:
+//   - authorization: The device authorization request to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveDeviceAuthorization(authorization *DeviceAuthorization) error {
+	return db.RunCommandWithArgs(INSERT_DEVICE_AUTHORIZATION,
+		authorization.DeviceCode,
+		authorization.UserCode,
+		authorization.ClientId,
+		authorization.Scope,
+		authorization.Status,
+		int64(authorization.Interval.Seconds()),
+		authorization.CreatedAt,
+		authorization.ExpiresAt,
+	)
+}
+
+// GetByDeviceCode retrieves a device authorization request by its device code.
+//
+// Parameters:
+//   - deviceCode: The device code held by the device
+//
+// Returns:
+//   - Pointer to the DeviceAuthorization if found, nil otherwise
+func GetByDeviceCode(deviceCode string) *DeviceAuthorization {
+	return queryDeviceAuthorization(SELECT_BY_DEVICE_CODE, deviceCode)
+}
+
+// GetByUserCode retrieves a device authorization request by the code entered by the user.
+//
+// Parameters:
+//   - userCode: The user code, in any case and with or without separators
+//
+// Returns:
+//   - Pointer to the DeviceAuthorization if found, nil otherwise
+func GetByUserCode(userCode string) *DeviceAuthorization {
+	return queryDeviceAuthorization(SELECT_BY_USER_CODE, NormalizeUserCode(userCode))
+}
+
+// Approve records that the user approved the request; the device receives tokens on its next poll.
+//
+// Parameters:
+//   - userCode: The user code entered by the user
+//   - userId: The user approving the request, on whose behalf tokens are issued
+//
+// Returns:
+//   - ErrDeviceCodeNotFound if there is no pending, unexpired request with this user code
+//   - Error if the update fails
+func Approve(userCode string, userId uuid.UUID) error {
+	return decide(userCode, STATUS_APPROVED, userId)
+}
+
+// Deny records that the user denied the request; the device receives access_denied on its next poll.
+//
+// Parameters:
+//   - userCode: The user code entered by the user
+//   - userId: The user denying the request
+//
+// Returns:
+//   - ErrDeviceCodeNotFound if there is no pending, unexpired request with this user code
+//   - Error if the update fails
+func Deny(userCode string, userId uuid.UUID) error {
+	return decide(userCode, STATUS_DENIED, userId)
+}
+
+// Poll handles a token request from the device. The poll is recorded; polling again before the
+// interval elapsed increases the interval. Once the request is approved, the first poll redeems it
+// with a conditional update, so concurrent polls cannot both obtain tokens.
+//
+// Parameters:
+//   - deviceCode: The device code sent to the token endpoint
+//
+// Returns:
+//   - The redeemed DeviceAuthorization, once approved
+//   - ErrAuthorizationPending while the user has not decided, ErrSlowDown if the device polls too fast,
+//     ErrAccessDenied if the user denied the request, or ErrDeviceCodeNotFound, ErrDeviceCodeExpired
+//     or ErrDeviceCodeAlreadyUsed if the device code cannot be redeemed
+func Poll(deviceCode string) (*DeviceAuthorization, error) {
+	authorization := GetByDeviceCode(deviceCode)
+	if authorization == nil {
+		return nil, ErrDeviceCodeNotFound
+	}
+	if authorization.Status == STATUS_CONSUMED {
+		log.Printf("Device code reuse detected for client %s", authorization.ClientId)
+		return nil, ErrDeviceCodeAlreadyUsed
+	}
+	if authorization.IsExpired() {
+		return nil, ErrDeviceCodeExpired
+	}
+
+	now := time.Now()
+	interval := authorization.Interval
+	tooFast := authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < interval
+	if tooFast {
+		interval += SLOW_DOWN_INCREMENT
+	}
+	if err := db.RunCommandWithArgs(RECORD_POLL, now, int64(interval.Seconds()), deviceCode); err != nil {
+		return nil, err
+	}
+	if tooFast {
+		return nil, ErrSlowDown
+	}
+
+	switch authorization.Status {
+	case STATUS_PENDING:
+		return nil, ErrAuthorizationPending
+	case STATUS_DENIED:
+		return nil, ErrAccessDenied
+	}
+
+	affected, err := db.RunCommandWithRowsAffected(MARK_CONSUMED, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		log.Printf("Device code reuse detected for client %s", authorization.ClientId)
+		return nil, ErrDeviceCodeAlreadyUsed
+	}
+	authorization.Status = STATUS_CONSUMED
+	return authorization, nil
+}
+
+// DeleteExpiredDeviceAuthorizations removes requests that can no longer be approved or redeemed.
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteExpiredDeviceAuthorizations() error {
+	return db.RunCommandWithArgs(DELETE_EXPIRED_DEVICE_AUTHORIZATIONS, time.Now())
+}
+
+// decide records the user's decision on a pending request with a conditional update,
+// so a request cannot be decided twice.
+func decide(userCode string, status string, userId uuid.UUID) error {
+	affected, err := db.RunCommandWithRowsAffected(DECIDE_DEVICE_AUTHORIZATION, status, userId.String(), NormalizeUserCode(userCode), time.Now())
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+// queryDeviceAuthorization runs a device authorization query and scans the first row.
+func queryDeviceAuthorization(query string, args ...interface{}) *DeviceAuthorization {
+	queryResult, err := db.RunQueryWithArgs(query, args...)
+	if err != nil {
+		log.Println("Error fetching device authorization:", err)
+		return nil
+	}
+	defer queryResult.Close()
+
+	if !queryResult.Next() {
+		return nil
+	}
+
+	var authorization DeviceAuthorization
+	var userId sql.NullString
+	var intervalSeconds int64
+	var lastPolledAt sql.NullTime
+	err = queryResult.Scan(&authorization.DeviceCode, &authorization.UserCode, &authorization.ClientId, &authorization.Scope, &userId,
+		&authorization.Status, &intervalSeconds, &authorization.CreatedAt, &authorization.ExpiresAt, &lastPolledAt)
+	if err != nil {
+		log.Println("Error scanning device authorization:", err)
+		return nil
+	}
+	if userId.Valid {
+		if parsed, err := uuid.Parse(userId.String); err == nil {
+			authorization.UserId = &parsed
+		}
+	}
+	authorization.Interval = time.Duration(intervalSeconds) * time.Second
+	if lastPolledAt.Valid {
+		authorization.LastPolledAt = &lastPolledAt.Time
+	}
+	return &authorization
+}
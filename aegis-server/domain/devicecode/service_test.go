@@ -0,0 +1,132 @@
+package devicecode
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	userService "nfcunha/aegis/domain/user"
+)
+
+var testClient *clientService.Client
+var testUser *userService.User
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	testClient = clientService.CreateClient("CLI", nil, "system")
+	clientService.SaveClient(testClient)
+	testUser = userService.CreateUser("device@example.com", "password123", "system")
+	userService.PersistUser(testUser)
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// startAuthorization saves a new pending device authorization request
+func startAuthorization(t *testing.T) *DeviceAuthorization {
+	authorization, err := CreateDeviceAuthorization(testClient.ClientId, "openid")
+	if err != nil {
+		t.Fatalf("CreateDeviceAuthorization failed: %v", err)
+	}
+	if err := SaveDeviceAuthorization(authorization); err != nil {
+		t.Fatalf("SaveDeviceAuthorization failed: %v", err)
+	}
+	return authorization
+}
+
+// TestGetByUserCode tests that requests are found by the code as typed by the user
+func TestGetByUserCode(t *testing.T) {
+	authorization := startAuthorization(t)
+
+	found := GetByUserCode(authorization.FormattedUserCode())
+	if found == nil || found.DeviceCode != authorization.DeviceCode {
+		t.Fatal("Request should be found by its formatted user code")
+	}
+	if found.Interval != POLLING_INTERVAL {
+		t.Errorf("Expected interval %v, got %v", POLLING_INTERVAL, found.Interval)
+	}
+}
+
+// TestPoll_Pending tests that polling before the user decided returns authorization_pending
+func TestPoll_Pending(t *testing.T) {
+	authorization := startAuthorization(t)
+
+	if _, err := Poll(authorization.DeviceCode); !errors.Is(err, ErrAuthorizationPending) {
+		t.Errorf("Expected ErrAuthorizationPending, got %v", err)
+	}
+}
+
+// TestPoll_SlowDown tests that polling faster than the interval increases it
+func TestPoll_SlowDown(t *testing.T) {
+	authorization := startAuthorization(t)
+	Poll(authorization.DeviceCode)
+
+	if _, err := Poll(authorization.DeviceCode); !errors.Is(err, ErrSlowDown) {
+		t.Errorf("Expected ErrSlowDown, got %v", err)
+	}
+	if interval := GetByDeviceCode(authorization.DeviceCode).Interval; interval != POLLING_INTERVAL+SLOW_DOWN_INCREMENT {
+		t.Errorf("Expected interval %v, got %v", POLLING_INTERVAL+SLOW_DOWN_INCREMENT, interval)
+	}
+}
+
+// TestPoll_Approved tests that an approved request is redeemed exactly once
+func TestPoll_Approved(t *testing.T) {
+	authorization := startAuthorization(t)
+	if err := Approve(authorization.FormattedUserCode(), testUser.Id); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+
+	redeemed, err := Poll(authorization.DeviceCode)
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if redeemed.UserId == nil || *redeemed.UserId != testUser.Id {
+		t.Errorf("Expected approving user %s, got %v", testUser.Id, redeemed.UserId)
+	}
+
+	if _, err := Poll(authorization.DeviceCode); !errors.Is(err, ErrDeviceCodeAlreadyUsed) {
+		t.Errorf("Expected ErrDeviceCodeAlreadyUsed, got %v", err)
+	}
+}
+
+// TestPoll_Denied tests that a denied request returns access_denied
+func TestPoll_Denied(t *testing.T) {
+	authorization := startAuthorization(t)
+	Deny(authorization.UserCode, testUser.Id)
+
+	if _, err := Poll(authorization.DeviceCode); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+	if err := Approve(authorization.UserCode, testUser.Id); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Errorf("Denied request should not be approvable, got %v", err)
+	}
+}
+
+// TestPoll_Expired tests that expired requests can neither be approved nor redeemed
+func TestPoll_Expired(t *testing.T) {
+	authorization, _ := CreateDeviceAuthorization(testClient.ClientId, "")
+	authorization.ExpiresAt = time.Now().Add(-time.Second)
+	SaveDeviceAuthorization(authorization)
+
+	if err := Approve(authorization.UserCode, testUser.Id); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Errorf("Expected ErrDeviceCodeNotFound, got %v", err)
+	}
+	if _, err := Poll(authorization.DeviceCode); !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Errorf("Expected ErrDeviceCodeExpired, got %v", err)
+	}
+}
+
+// TestPoll_UnknownCode tests polling with a device code that was never issued
+func TestPoll_UnknownCode(t *testing.T) {
+	if _, err := Poll(uuid.New().String()); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Errorf("Expected ErrDeviceCodeNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package impersonation provides domain models and business logic for administrator impersonation.
+// An administrator can obtain a short-lived, non-refreshable token for another user to reproduce
+// issues without knowing their password. Every impersonation session is recorded from start to end.
+package impersonation
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"github.com/google/uuid"
+)
+
+// Reasons an impersonation session ended.
+const (
+	END_REASON_ENDED   = "ended"   // Ended explicitly before the token expired
+	END_REASON_EXPIRED = "expired" // The token expired
+)
+
+var IMPERSONATION_ROLE = getImpersonationRole()
+var IMPERSONATION_TTL = getImpersonationTTL()
+
+// Session represents an impersonation session, identified by the JTI of its token.
+type Session struct {
+	Id           string
+	AdminId      uuid.UUID
+	AdminSubject string
+	UserId       uuid.UUID
+	UserSubject  string
+	Reason       string
+	StartedAt    time.Time
+	ExpiresAt    time.Time
+	EndedAt      *time.Time
+	EndedBy      string
+	EndReason    string
+}
+
+// CreateSession creates the record of a newly issued impersonation token.
+//
+// Parameters:
+//   - tokenId: JTI of the impersonation token
+//   - adminId, adminSubject: The administrator impersonating the user
+//   - userId, userSubject: The impersonated user
+//   - reason: Why the administrator impersonates the user (e.g. a support ticket)
+//   - expiresAt: When the impersonation token expires
+//
+// Returns:
+//   - Pointer to the newly created Session
+func CreateSession(tokenId string, adminId uuid.UUID, adminSubject string, userId uuid.UUID, userSubject string, reason string, expiresAt time.Time) *Session {
+	return &Session{
+		Id:           tokenId,
+		AdminId:      adminId,
+		AdminSubject: adminSubject,
+		UserId:       userId,
+		UserSubject:  userSubject,
+		Reason:       reason,
+		StartedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+	}
+}
+
+// IsActive reports whether the session has not ended and its token has not expired.
+func (s *Session) IsActive() bool {
+	return s.EndedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// getImpersonationRole retrieves the role allowed to impersonate users from the
+// AEGIS_IMPERSONATION_ROLE environment variable. Defaults to "admin".
+//
+// Returns:
+//   - The role name
+func getImpersonationRole() string {
+	if role := os.Getenv("AEGIS_IMPERSONATION_ROLE"); role != "" {
+		log.Printf("Using impersonation role: %s", role)
+		return role
+	}
+	return "admin"
+}
+
+// getImpersonationTTL retrieves the lifetime of impersonation tokens from the
+// AEGIS_IMPERSONATION_TTL environment variable, in minutes. Defaults to 15 minutes.
+//
+// Returns:
+//   - Impersonation token lifetime
+func getImpersonationTTL() time.Duration {
+	const IMPERSONATION_TTL_ENV = "AEGIS_IMPERSONATION_TTL"
+	const DEFAULT_TTL_MINUTES = 15
+	if ttlStr := os.Getenv(IMPERSONATION_TTL_ENV); ttlStr != "" {
+		if minutes, err := strconv.Atoi(ttlStr); err == nil && minutes > 0 {
+			return time.Duration(minutes) * time.Minute
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d minutes", IMPERSONATION_TTL_ENV, ttlStr, DEFAULT_TTL_MINUTES)
+	}
+	return DEFAULT_TTL_MINUTES * time.Minute
+}
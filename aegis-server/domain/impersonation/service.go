@@ -0,0 +1,196 @@
+package impersonation
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+)
+
+var ErrSessionNotFound = errors.New("impersonation session not found")
+var ErrSessionEnded = errors.New("impersonation session already ended")
+
+const (
+	SELECT_SESSION_COLUMNS = `
+		SELECT
+			id,
+			admin_id,
+			admin_subject,
+			user_id,
+			user_subject,
+			reason,
+			started_at,
+			expires_at,
+			ended_at,
+			ended_by,
+			end_reason
+		FROM
+			impersonation_sessions
+	`
+
+	SELECT_SESSION_BY_ID = SELECT_SESSION_COLUMNS + `
+		WHERE
+			id = ?
+	`
+
+	SELECT_ALL_SESSIONS = SELECT_SESSION_COLUMNS + `
+		ORDER BY
+			started_at DESC
+	`
+
+	INSERT_SESSION = `
+		INSERT INTO impersonation_sessions (
+			id,
+			admin_id,
+			admin_subject,
+			user_id,
+			user_subject,
+			reason,
+			started_at,
+			expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	END_SESSION = `
+		UPDATE
+			impersonation_sessions
+		SET
+			ended_at = ?,
+			ended_by = ?,
+			end_reason = ?
+		WHERE id = ? AND ended_at IS NULL
+	`
+
+	END_EXPIRED_SESSIONS = `
+		UPDATE
+			impersonation_sessions
+		SET
+			ended_at = expires_at,
+			ended_by = 'system',
+			end_reason = 'expired'
+		WHERE ended_at IS NULL AND expires_at < ?
+	`
+)
+
+// StartSession records the start of an impersonation session.
+//
+// Parameters:
+//   - session: The session to record
+//
+// Returns:
+//   - Error if the insertion fails
+func StartSession(session *Session) error {
+	err := db.RunCommandWithArgs(INSERT_SESSION,
+		session.Id,
+		session.AdminId.String(),
+		session.AdminSubject,
+		session.UserId.String(),
+		session.UserSubject,
+		session.Reason,
+		session.StartedAt,
+		session.ExpiresAt,
+	)
+	if err == nil {
+		log.Printf("AUDIT: impersonation started - admin %s impersonates user %s (session %s, expires %s, reason: %s)",
+			session.AdminSubject, session.UserSubject, session.Id, session.ExpiresAt.Format(time.RFC3339), session.Reason)
+	}
+	return err
+}
+
+// GetSession retrieves an impersonation session by the JTI of its token.
+//
+// Parameters:
+//   - id: The session ID
+//
+// Returns:
+//   - Pointer to the Session if found, nil otherwise
+func GetSession(id string) *Session {
+	sessions := querySessions(SELECT_SESSION_BY_ID, id)
+	if len(sessions) == 0 {
+		return nil
+	}
+	return sessions[0]
+}
+
+// ListSessions retrieves all impersonation sessions, most recent first.
+//
+// Returns:
+//   - Slice of Session pointers
+func ListSessions() []*Session {
+	return querySessions(SELECT_ALL_SESSIONS)
+}
+
+// EndSession records the end of an impersonation session before its token expired.
+// The caller is responsible for revoking the token.
+//
+// Parameters:
+//   - id: The session ID
+//   - endedBy: Identifier of who ended the session
+//
+// Returns:
+//   - ErrSessionNotFound or ErrSessionEnded if the session cannot be ended
+//   - Error if the update fails
+func EndSession(id string, endedBy string) error {
+	session := GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	if !session.IsActive() {
+		return ErrSessionEnded
+	}
+
+	affected, err := db.RunCommandWithRowsAffected(END_SESSION, time.Now(), endedBy, END_REASON_ENDED, id)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionEnded
+	}
+	log.Printf("AUDIT: impersonation ended - admin %s stopped impersonating user %s (session %s, ended by %s)",
+		session.AdminSubject, session.UserSubject, session.Id, endedBy)
+	return nil
+}
+
+// EndExpiredSessions records the end of sessions whose token expired without being ended explicitly.
+//
+// Returns:
+//   - Error if the update fails
+func EndExpiredSessions() error {
+	affected, err := db.RunCommandWithRowsAffected(END_EXPIRED_SESSIONS, time.Now())
+	if err == nil && affected > 0 {
+		log.Printf("AUDIT: %d impersonation sessions ended by token expiry", affected)
+	}
+	return err
+}
+
+// querySessions runs an impersonation session query and scans the resulting rows.
+func querySessions(query string, args ...interface{}) []*Session {
+	rows, err := db.RunQueryWithArgs(query, args...)
+	if err != nil {
+		log.Println("Error fetching impersonation sessions:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var session Session
+		var adminId, userId string
+		var endedAt sql.NullTime
+		err := rows.Scan(&session.Id, &adminId, &session.AdminSubject, &userId, &session.UserSubject, &session.Reason,
+			&session.StartedAt, &session.ExpiresAt, &endedAt, &session.EndedBy, &session.EndReason)
+		if err != nil {
+			log.Println("Error scanning impersonation session:", err)
+			continue
+		}
+		session.AdminId, _ = uuid.Parse(adminId)
+		session.UserId, _ = uuid.Parse(userId)
+		if endedAt.Valid {
+			session.EndedAt = &endedAt.Time
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions
+}
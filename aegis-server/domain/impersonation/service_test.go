@@ -0,0 +1,101 @@
+package impersonation
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// startSession records a new session expiring after the given duration
+func startSession(t *testing.T, expiresIn time.Duration) *Session {
+	session := CreateSession(uuid.New().String(), uuid.New(), "admin@example.com", uuid.New(), "user@example.com", "ticket 42", time.Now().Add(expiresIn))
+	if err := StartSession(session); err != nil {
+		t.Fatalf("StartSession failed: %v", err)
+	}
+	return session
+}
+
+// TestStartSession tests that a started session is stored as active
+func TestStartSession(t *testing.T) {
+	session := startSession(t, time.Minute)
+
+	stored := GetSession(session.Id)
+	if stored == nil {
+		t.Fatal("Session should be stored")
+	}
+	if stored.AdminId != session.AdminId || stored.UserId != session.UserId {
+		t.Error("Session should keep the administrator and the user")
+	}
+	if stored.Reason != "ticket 42" {
+		t.Errorf("Expected reason 'ticket 42', got %s", stored.Reason)
+	}
+	if !stored.IsActive() {
+		t.Error("New session should be active")
+	}
+}
+
+// TestEndSession tests that ending a session records who ended it
+func TestEndSession(t *testing.T) {
+	session := startSession(t, time.Minute)
+
+	if err := EndSession(session.Id, "admin@example.com"); err != nil {
+		t.Fatalf("EndSession failed: %v", err)
+	}
+
+	stored := GetSession(session.Id)
+	if stored.IsActive() {
+		t.Error("Ended session should not be active")
+	}
+	if stored.EndedAt == nil || stored.EndedBy != "admin@example.com" || stored.EndReason != END_REASON_ENDED {
+		t.Errorf("Unexpected end of session: %+v", stored)
+	}
+}
+
+// TestEndSession_Twice tests that a session can only be ended once
+func TestEndSession_Twice(t *testing.T) {
+	session := startSession(t, time.Minute)
+	EndSession(session.Id, "admin@example.com")
+
+	if err := EndSession(session.Id, "admin@example.com"); !errors.Is(err, ErrSessionEnded) {
+		t.Errorf("Expected ErrSessionEnded, got %v", err)
+	}
+}
+
+// TestEndSession_NotFound tests ending an unknown session
+func TestEndSession_NotFound(t *testing.T) {
+	if err := EndSession(uuid.New().String(), "admin@example.com"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+// TestEndExpiredSessions tests that sessions past their expiry are recorded as expired
+func TestEndExpiredSessions(t *testing.T) {
+	expired := startSession(t, -time.Minute)
+	active := startSession(t, time.Minute)
+
+	if err := EndExpiredSessions(); err != nil {
+		t.Fatalf("EndExpiredSessions failed: %v", err)
+	}
+
+	stored := GetSession(expired.Id)
+	if stored.EndedAt == nil || stored.EndReason != END_REASON_EXPIRED {
+		t.Errorf("Expired session should be ended, got %+v", stored)
+	}
+	if GetSession(active.Id).EndedAt != nil {
+		t.Error("Active session should not be ended")
+	}
+}
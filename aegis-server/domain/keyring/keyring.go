@@ -0,0 +1,120 @@
+// Package keyring provides domain models and business logic for token signing keys.
+// Keys are persisted so tokens survive restarts, and rotated with an overlap window
+// so tokens signed by a previous key stay valid until they expire.
+package keyring
+
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+	"nfcunha/aegis/util/jwt"
+)
+
+// KeyState represents the lifecycle stage of a signing key.
+type KeyState string
+
+const (
+	// STATE_ACTIVE marks the key used to sign new tokens. Exactly one key is active.
+	STATE_ACTIVE KeyState = "active"
+	// STATE_VERIFYING marks a rotated-out key that still verifies existing tokens.
+	STATE_VERIFYING KeyState = "verifying"
+	// STATE_RETIRED marks a key that no longer signs or verifies anything.
+	STATE_RETIRED KeyState = "retired"
+)
+
+// StoredKey represents a signing key as persisted in the keyring,
+// with its encoded key material, state and audit information.
+type StoredKey struct {
+	Kid         string
+	Algorithm   string
+	KeyMaterial string
+	State       KeyState
+	CreatedAt   time.Time
+	CreatedBy   string
+	RetireAt    *time.Time // When a verifying key is due to be retired
+	RetiredAt   *time.Time // When the key was retired
+}
+
+// NewStoredKey creates an active StoredKey from a signing key.
+// Asymmetric keys are encoded as PKCS#8 PEM and HMAC secrets as hex.
+//
+// Parameters:
+//   - key: The signing key to store
+//   - createdBy: Identifier of who created this key
+//
+// Returns:
+//   - Pointer to the newly created StoredKey
+//   - Error if the key material cannot be encoded
+func NewStoredKey(key *jwt.SigningKey, createdBy string) (*StoredKey, error) {
+	var material string
+	if jwt.IsAsymmetric(key.Algorithm) {
+		pemBytes, err := key.EncodePrivateKeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		material = string(pemBytes)
+	} else {
+		if key.Secret == nil {
+			return nil, errors.New("HMAC key has no secret")
+		}
+		material = hex.EncodeToString(key.Secret)
+	}
+
+	return &StoredKey{
+		Kid:         key.Kid,
+		Algorithm:   key.Algorithm,
+		KeyMaterial: material,
+		State:       STATE_ACTIVE,
+		CreatedAt:   time.Now(),
+		CreatedBy:   createdBy,
+	}, nil
+}
+
+// SigningKey decodes the stored key material back into a usable signing key.
+//
+// Returns:
+//   - The decoded SigningKey
+//   - Error if the key material is invalid
+func (k *StoredKey) SigningKey() (*jwt.SigningKey, error) {
+	if jwt.IsAsymmetric(k.Algorithm) {
+		key, err := jwt.ParsePrivateKeyPEM(k.Algorithm, []byte(k.KeyMaterial))
+		if err != nil {
+			return nil, err
+		}
+		key.Kid = k.Kid
+		return key, nil
+	}
+
+	secret, err := hex.DecodeString(k.KeyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	return &jwt.SigningKey{Kid: k.Kid, Algorithm: k.Algorithm, Secret: secret}, nil
+}
+
+// Demote moves an active key to the verifying state, to be retired at the given time.
+//
+// Parameters:
+//   - retireAt: When the key should stop verifying tokens
+func (k *StoredKey) Demote(retireAt time.Time) {
+	k.State = STATE_VERIFYING
+	k.RetireAt = &retireAt
+}
+
+// Retire moves the key to the retired state.
+func (k *StoredKey) Retire() {
+	now := time.Now()
+	k.State = STATE_RETIRED
+	k.RetiredAt = &now
+}
+
+// IsDueForRetirement reports whether a verifying key has passed its overlap window.
+//
+// Parameters:
+//   - now: The current time
+//
+// Returns:
+//   - true if the key is verifying and its retire time has passed
+func (k *StoredKey) IsDueForRetirement(now time.Time) bool {
+	return k.State == STATE_VERIFYING && k.RetireAt != nil && !k.RetireAt.After(now)
+}
@@ -0,0 +1,456 @@
+package keyring
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	"nfcunha/aegis/util/jwt"
+)
+
+var ROTATION_INTERVAL = getRotationInterval()
+var ROTATION_OVERLAP = getRotationOverlap()
+
+// UNKNOWN_KEY_RELOAD_INTERVAL limits how often tokens naming an unknown key reload the keyring.
+var UNKNOWN_KEY_RELOAD_INTERVAL = 30 * time.Second
+
+const (
+	SELECT_ALL_KEYS = `
+		SELECT
+			kid,
+			algorithm,
+			key_material,
+			state,
+			created_at,
+			created_by,
+			retire_at,
+			retired_at
+		FROM
+			signing_keys
+		ORDER BY
+			created_at DESC
+	`
+
+	INSERT_KEY = `
+		INSERT INTO signing_keys (
+			kid,
+			algorithm,
+			key_material,
+			state,
+			created_at,
+			created_by,
+			retire_at,
+			retired_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	DEMOTE_ACTIVE_KEYS = `
+		UPDATE
+			signing_keys
+		SET
+			state = ?,
+			retire_at = ?
+		WHERE state = ?
+	`
+
+	UPDATE_KEY_STATE = `
+		UPDATE
+			signing_keys
+		SET
+			state = ?,
+			retire_at = ?,
+			retired_at = ?
+		WHERE kid = ?
+	`
+)
+
+// ListKeys retrieves all signing keys from the database, newest first.
+//
+// Returns:
+//   - Slice of StoredKey pointers
+//   - Error if the query fails
+func ListKeys() ([]*StoredKey, error) {
+	rows, err := db.RunQuery(SELECT_ALL_KEYS)
+	if err != nil {
+		log.Println("Error listing signing keys:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*StoredKey
+	for rows.Next() {
+		var key StoredKey
+		var state string
+		var retireAt, retiredAt sql.NullTime
+
+		err := rows.Scan(&key.Kid, &key.Algorithm, &key.KeyMaterial, &state, &key.CreatedAt, &key.CreatedBy, &retireAt, &retiredAt)
+		if err != nil {
+			log.Println("Error scanning signing key:", err)
+			continue
+		}
+		key.State = KeyState(state)
+		if retireAt.Valid {
+			key.RetireAt = &retireAt.Time
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, nil
+}
+
+// GetKey retrieves a signing key by its key ID.
+//
+// Parameters:
+//   - kid: The key ID to look up
+//
+// Returns:
+//   - Pointer to the StoredKey if found, nil otherwise
+func GetKey(kid string) *StoredKey {
+	keys, err := ListKeys()
+	if err != nil {
+		return nil
+	}
+	for _, key := range keys {
+		if key.Kid == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// SaveKey inserts a new signing key record into the database.
+//
+// Parameters:
+//   - key: The key to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveKey(key *StoredKey) error {
+	return db.RunCommandWithArgs(INSERT_KEY, keyArgs(key)...)
+}
+
+// UpdateKeyState persists the state and retirement timestamps of a signing key.
+//
+// Parameters:
+//   - key: The key with updated state
+//
+// Returns:
+//   - Error if the update fails
+func UpdateKeyState(key *StoredKey) error {
+	return db.RunCommandWithArgs(UPDATE_KEY_STATE, keyStateArgs(key)...)
+}
+
+// keyArgs returns the arguments of INSERT_KEY for a key.
+func keyArgs(key *StoredKey) []interface{} {
+	return []interface{}{
+		key.Kid,
+		key.Algorithm,
+		key.KeyMaterial,
+		string(key.State),
+		key.CreatedAt,
+		key.CreatedBy,
+		key.RetireAt,
+		key.RetiredAt,
+	}
+}
+
+// keyStateArgs returns the arguments of UPDATE_KEY_STATE for a key.
+func keyStateArgs(key *StoredKey) []interface{} {
+	return []interface{}{
+		string(key.State),
+		key.RetireAt,
+		key.RetiredAt,
+		key.Kid,
+	}
+}
+
+// Initialize loads the persisted keyring into the JWT package.
+// On first start the key configured through the environment is stored as the active key,
+// so the same key keeps verifying tokens across restarts. Tokens signed by a key the
+// keyring does not hold reload it, to pick up rotations made by other instances.
+//
+// Returns:
+//   - Error if the keyring cannot be loaded or bootstrapped
+func Initialize() error {
+	keys, err := ListKeys()
+	if err != nil {
+		return err
+	}
+
+	if findActive(keys) == nil {
+		log.Println("No active signing key found, storing the configured key in the keyring")
+		if err := bootstrap(); err != nil {
+			return err
+		}
+	}
+
+	if err := Reload(); err != nil {
+		return err
+	}
+	jwt.KEYRING.ReloadOnUnknownKey(Reload, UNKNOWN_KEY_RELOAD_INTERVAL)
+	return nil
+}
+
+// Reload reads the keyring from the database and installs it in the JWT package.
+// Retired keys are left out so tokens signed with them are rejected.
+//
+// Returns:
+//   - Error if the keys cannot be read or decoded, or if no key is active
+func Reload() error {
+	keys, err := ListKeys()
+	if err != nil {
+		return err
+	}
+
+	var active *jwt.SigningKey
+	var verifying []*jwt.SigningKey
+	for _, stored := range keys {
+		if stored.State == STATE_RETIRED {
+			continue
+		}
+		key, err := stored.SigningKey()
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", stored.Kid, err)
+			continue
+		}
+		if stored.State == STATE_ACTIVE && active == nil {
+			active = key
+		} else {
+			verifying = append(verifying, key)
+		}
+	}
+
+	if active == nil {
+		return errors.New("keyring has no active signing key")
+	}
+
+	jwt.KEYRING.Replace(active, verifying...)
+	log.Printf("Keyring loaded: active key %s (%s), %d verifying key(s)", active.Kid, active.Algorithm, len(verifying))
+	return nil
+}
+
+// Rotate generates a new active signing key and demotes the current one to verifying.
+// The demoted key keeps verifying tokens for the overlap window, then is retired. Every key
+// active in the database is demoted and the new key saved in one transaction, so concurrent
+// rotations never leave the keyring with two active keys or none.
+//
+// Parameters:
+//   - algorithm: Algorithm for the new key, or empty to use the configured algorithm
+//   - overlap: How long the previous key keeps verifying tokens
+//   - rotatedBy: Identifier of who triggered the rotation
+//
+// Returns:
+//   - The newly created active key
+//   - Error if the algorithm is unsupported or the keyring cannot be updated
+func Rotate(algorithm string, overlap time.Duration, rotatedBy string) (*StoredKey, error) {
+	if algorithm == "" {
+		algorithm = jwt.SIGNING_ALGORITHM
+	}
+	if !jwt.IsSupportedAlgorithm(algorithm) {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	signingKey, err := jwt.GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	newKey, err := NewStoredKey(signingKey, rotatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	retireAt := time.Now().Add(overlap)
+	var demoted int64
+	err = db.RunInTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(DEMOTE_ACTIVE_KEYS, string(STATE_VERIFYING), retireAt, string(STATE_ACTIVE))
+		if err != nil {
+			return err
+		}
+		if demoted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		_, err = tx.Exec(INSERT_KEY, keyArgs(newKey)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%d signing key(s) demoted to verifying until %s", demoted, retireAt.Format(time.RFC3339))
+
+	log.Printf("Signing key rotated by %s: new active key %s (%s)", rotatedBy, newKey.Kid, newKey.Algorithm)
+	return newKey, Reload()
+}
+
+// RetireKey immediately retires a verifying key, e.g. when it is suspected to be compromised.
+// Tokens signed by the key are rejected from then on.
+//
+// Parameters:
+//   - key: The key to retire
+//
+// Returns:
+//   - Error if the key is active or the update fails
+func RetireKey(key *StoredKey) error {
+	if key.State == STATE_ACTIVE {
+		return errors.New("the active key cannot be retired, rotate first")
+	}
+	key.Retire()
+	if err := UpdateKeyState(key); err != nil {
+		return err
+	}
+	log.Printf("Signing key retired: %s", key.Kid)
+	return Reload()
+}
+
+// RetireExpiredKeys retires every verifying key whose overlap window has passed.
+//
+// Returns:
+//   - Number of keys retired
+//   - Error if the keys cannot be listed or the keyring cannot be reloaded after retiring them
+func RetireExpiredKeys() (int, error) {
+	keys, err := ListKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	retired := 0
+	for _, key := range keys {
+		if !key.IsDueForRetirement(now) {
+			continue
+		}
+		key.Retire()
+		if err := UpdateKeyState(key); err != nil {
+			log.Printf("Error retiring signing key %s: %v", key.Kid, err)
+			continue
+		}
+		log.Printf("Signing key retired after overlap window: %s", key.Kid)
+		retired++
+	}
+
+	if retired > 0 {
+		if err := Reload(); err != nil {
+			return retired, err
+		}
+	}
+	return retired, nil
+}
+
+// RunScheduledMaintenance retires expired keys and rotates the active key when it is
+// older than ROTATION_INTERVAL. It also reloads the keyring so that rotations made
+// by other instances sharing the database are picked up.
+func RunScheduledMaintenance() {
+	if _, err := RetireExpiredKeys(); err != nil {
+		log.Println("Failed to retire expired signing keys:", err)
+	}
+
+	if ROTATION_INTERVAL > 0 {
+		keys, err := ListKeys()
+		if err == nil {
+			if active := findActive(keys); active != nil && time.Since(active.CreatedAt) >= ROTATION_INTERVAL {
+				log.Printf("Active signing key %s is older than %v, rotating", active.Kid, ROTATION_INTERVAL)
+				if _, err := Rotate("", RotationOverlap(), "scheduler"); err != nil {
+					log.Println("Scheduled key rotation failed:", err)
+				}
+				return
+			}
+		}
+	}
+
+	if err := Reload(); err != nil {
+		log.Println("Failed to reload keyring:", err)
+	}
+}
+
+// bootstrap stores the startup signing key as the first active key.
+// Keys backed by JWT_SECRET are materialized with the current secret, which
+// persists a randomly generated secret instead of losing it on restart.
+func bootstrap() error {
+	signingKey := *jwt.KEYRING.ActiveKey()
+	if signingKey.Algorithm == jwt.ALGORITHM_HS256 && signingKey.Secret == nil {
+		signingKey.Secret = []byte(jwt.JWT_SECRET)
+	}
+	if signingKey.Kid == "" {
+		signingKey.Kid = uuid.New().String()
+	}
+
+	stored, err := NewStoredKey(&signingKey, "system")
+	if err != nil {
+		return err
+	}
+	return SaveKey(stored)
+}
+
+// findActive returns the active key from a list of keys, or nil if there is none.
+func findActive(keys []*StoredKey) *StoredKey {
+	for _, key := range keys {
+		if key.State == STATE_ACTIVE {
+			return key
+		}
+	}
+	return nil
+}
+
+// getRotationInterval retrieves the automatic rotation interval from the
+// AEGIS_KEY_ROTATION_INTERVAL environment variable, in hours.
+// Defaults to 0, which disables automatic rotation.
+//
+// Returns:
+//   - Rotation interval duration, or 0 when disabled
+func getRotationInterval() time.Duration {
+	const KEY_ROTATION_INTERVAL_ENV = "AEGIS_KEY_ROTATION_INTERVAL"
+	if intervalStr := os.Getenv(KEY_ROTATION_INTERVAL_ENV); intervalStr != "" {
+		if hours, err := strconv.Atoi(intervalStr); err == nil && hours >= 0 {
+			log.Printf("Using key rotation interval: %d hours", hours)
+			return time.Duration(hours) * time.Hour
+		}
+		log.Printf("Warning: invalid %s value '%s', automatic key rotation disabled", KEY_ROTATION_INTERVAL_ENV, intervalStr)
+	}
+	return 0
+}
+
+// RotationOverlap returns how long a rotated-out key keeps verifying tokens: ROTATION_OVERLAP
+// when configured, otherwise the longest lifetime of the tokens the server issues, taking the
+// lifetime overrides of every client into account, so no live session is invalidated by a rotation.
+//
+// Returns:
+//   - Overlap window duration
+func RotationOverlap() time.Duration {
+	if ROTATION_OVERLAP >= 0 {
+		return ROTATION_OVERLAP
+	}
+
+	longest := jwt.TOKEN_EXPIRATION + jwt.REFRESH_TOKEN_EXTRA_TIME
+	for _, client := range clientService.ListClients() {
+		accessLifetime, refreshLifetime := jwt.TokenLifetimes(client.TokenOptions())
+		longest = max(longest, accessLifetime, refreshLifetime)
+	}
+	return longest
+}
+
+// getRotationOverlap retrieves how long a rotated-out key keeps verifying tokens from the
+// AEGIS_KEY_ROTATION_OVERLAP environment variable, in minutes.
+// Defaults to -1, which derives the overlap from the token lifetimes in use (see RotationOverlap).
+//
+// Returns:
+//   - Overlap window duration, or -1 to derive it from the token lifetimes
+func getRotationOverlap() time.Duration {
+	const KEY_ROTATION_OVERLAP_ENV = "AEGIS_KEY_ROTATION_OVERLAP"
+	const DEFAULT_ROTATION_OVERLAP = -1
+	if overlapStr := os.Getenv(KEY_ROTATION_OVERLAP_ENV); overlapStr != "" {
+		if minutes, err := strconv.Atoi(overlapStr); err == nil && minutes >= 0 {
+			log.Printf("Using key rotation overlap: %d minutes", minutes)
+			return time.Duration(minutes) * time.Minute
+		}
+		log.Printf("Warning: invalid %s value '%s', deriving the overlap from the token lifetimes", KEY_ROTATION_OVERLAP_ENV, overlapStr)
+	}
+	return DEFAULT_ROTATION_OVERLAP
+}
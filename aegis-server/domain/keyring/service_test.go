@@ -0,0 +1,210 @@
+package keyring
+
+import (
+	"os"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	clientService "nfcunha/aegis/domain/client"
+	"nfcunha/aegis/util/jwt"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// resetKeyring clears persisted keys and restores the startup keyring after the test
+func resetKeyring(t *testing.T) {
+	database.RunCommand("DELETE FROM signing_keys")
+	original := jwt.KEYRING
+	jwt.KEYRING = jwt.NewKeyring(&jwt.SigningKey{Algorithm: jwt.ALGORITHM_HS256})
+	t.Cleanup(func() { jwt.KEYRING = original })
+}
+
+// TestInitialize_BootstrapsConfiguredKey tests that the startup key is persisted on first start
+func TestInitialize_BootstrapsConfiguredKey(t *testing.T) {
+	resetKeyring(t)
+
+	if err := Initialize(); err != nil {
+		t.Fatalf("Initialize should not return error: %v", err)
+	}
+
+	keys, _ := ListKeys()
+	if len(keys) != 1 || keys[0].State != STATE_ACTIVE {
+		t.Fatalf("Expected one active key, got %+v", keys)
+	}
+	active := jwt.KEYRING.ActiveKey()
+	if active.Kid != keys[0].Kid {
+		t.Errorf("Expected keyring to use persisted kid %s, got %s", keys[0].Kid, active.Kid)
+	}
+	if string(active.Secret) != jwt.JWT_SECRET {
+		t.Error("Expected bootstrapped HMAC key to keep the configured secret")
+	}
+}
+
+// TestInitialize_SurvivesRestart tests that tokens remain valid after the keyring is reloaded
+func TestInitialize_SurvivesRestart(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+
+	// Simulate a restart with a different startup key
+	newStartupKey, _ := jwt.GenerateSigningKey(jwt.ALGORITHM_HS256)
+	jwt.KEYRING = jwt.NewKeyring(newStartupKey)
+	if err := Initialize(); err != nil {
+		t.Fatalf("Initialize should not return error: %v", err)
+	}
+
+	if _, err := jwt.ValidateToken(tokenPair.AccessToken); err != nil {
+		t.Errorf("Token should survive a restart: %v", err)
+	}
+}
+
+// TestRotate_KeepsOldTokensValid tests that rotation demotes the previous key to verifying
+func TestRotate_KeepsOldTokensValid(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+	oldKid := jwt.KEYRING.ActiveKey().Kid
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+
+	newKey, err := Rotate(jwt.ALGORITHM_ES256, time.Hour, "test")
+	if err != nil {
+		t.Fatalf("Rotate should not return error: %v", err)
+	}
+
+	if jwt.KEYRING.ActiveKey().Kid != newKey.Kid {
+		t.Error("Expected new key to be active after rotation")
+	}
+	old := GetKey(oldKid)
+	if old.State != STATE_VERIFYING || old.RetireAt == nil {
+		t.Errorf("Expected old key to be verifying with a retire time, got %+v", old)
+	}
+	if _, err := jwt.ValidateToken(tokenPair.AccessToken); err != nil {
+		t.Errorf("Token signed before rotation should remain valid: %v", err)
+	}
+	if len(jwt.PublicJWKS().Keys) != 1 {
+		t.Error("Expected the new ES256 key to be published")
+	}
+}
+
+// TestInitialize_ReloadsUnknownKey tests that tokens signed by a key rotated in by another instance are accepted
+func TestInitialize_ReloadsUnknownKey(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+	local := jwt.KEYRING
+
+	// Another instance sharing the database rotates the key
+	signingKey, _ := jwt.GenerateSigningKey(jwt.ALGORITHM_ES256)
+	stored, _ := NewStoredKey(signingKey, "test")
+	keys, _ := ListKeys()
+	keys[0].Demote(time.Now().Add(time.Hour))
+	UpdateKeyState(keys[0])
+	SaveKey(stored)
+	jwt.KEYRING = jwt.NewKeyring(signingKey)
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	jwt.KEYRING = local
+
+	if _, err := jwt.ValidateToken(tokenPair.AccessToken); err != nil {
+		t.Errorf("Token signed by the rotated key should be accepted after a reload: %v", err)
+	}
+	if jwt.KEYRING.ActiveKey().Kid != signingKey.Kid {
+		t.Error("Expected the reload to make the rotated key active")
+	}
+}
+
+// TestRetireExpiredKeys tests that keys past their overlap window stop verifying tokens
+func TestRetireExpiredKeys(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+
+	Rotate("", 0, "test")
+
+	if retired, err := RetireExpiredKeys(); err != nil || retired != 1 {
+		t.Errorf("Expected 1 key retired, got %d (%v)", retired, err)
+	}
+	if _, err := jwt.ValidateToken(tokenPair.AccessToken); err == nil {
+		t.Error("Token signed by a retired key should be rejected")
+	}
+}
+
+// TestRetireKey_ActiveKeyRejected tests that the active key cannot be retired
+func TestRetireKey_ActiveKeyRejected(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+	keys, _ := ListKeys()
+
+	if err := RetireKey(keys[0]); err == nil {
+		t.Error("RetireKey should refuse to retire the active key")
+	}
+}
+
+// TestRotate_UnsupportedAlgorithm tests that rotation rejects unknown algorithms
+func TestRotate_UnsupportedAlgorithm(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+
+	if _, err := Rotate("HS512", time.Hour, "test"); err == nil {
+		t.Error("Rotate should reject an unsupported algorithm")
+	}
+}
+
+// TestRotate_DemotesEveryActiveKey tests that rotation demotes keys activated by other instances since the keyring was loaded
+func TestRotate_DemotesEveryActiveKey(t *testing.T) {
+	resetKeyring(t)
+	Initialize()
+
+	// Another instance rotated in a key this instance has not seen
+	signingKey, _ := jwt.GenerateSigningKey(jwt.ALGORITHM_ES256)
+	concurrent, _ := NewStoredKey(signingKey, "other")
+	if err := SaveKey(concurrent); err != nil {
+		t.Fatalf("Failed to save key: %v", err)
+	}
+
+	newKey, err := Rotate(jwt.ALGORITHM_ES256, time.Hour, "test")
+	if err != nil {
+		t.Fatalf("Rotate should not return error: %v", err)
+	}
+
+	keys, _ := ListKeys()
+	for _, key := range keys {
+		if key.Kid == newKey.Kid {
+			if key.State != STATE_ACTIVE {
+				t.Errorf("Expected the new key to be active, got %s", key.State)
+			}
+		} else if key.State != STATE_VERIFYING || key.RetireAt == nil {
+			t.Errorf("Expected key %s to be verifying with a retire time, got %+v", key.Kid, key)
+		}
+	}
+}
+
+// TestRotationOverlap_ClientLifetimes tests that the default overlap covers the longest token lifetime of any client
+func TestRotationOverlap_ClientLifetimes(t *testing.T) {
+	originalOverlap := ROTATION_OVERLAP
+	defer func() { ROTATION_OVERLAP = originalOverlap }()
+
+	ROTATION_OVERLAP = -1
+	client := clientService.CreateClient("Long-lived App", []string{"https://app.example.com/callback"}, "system")
+	client.AccessTokenLifetime = jwt.TOKEN_EXPIRATION + 48*time.Hour
+	if err := clientService.SaveClient(client); err != nil {
+		t.Fatalf("Failed to save client: %v", err)
+	}
+	defer clientService.DeleteClient(client.ClientId)
+
+	if overlap := RotationOverlap(); overlap != client.AccessTokenLifetime+jwt.REFRESH_TOKEN_EXTRA_TIME {
+		t.Errorf("Expected the overlap to cover the client's refresh tokens, got %v", overlap)
+	}
+
+	ROTATION_OVERLAP = 10 * time.Minute
+	if overlap := RotationOverlap(); overlap != ROTATION_OVERLAP {
+		t.Errorf("Expected the configured overlap, got %v", overlap)
+	}
+}
@@ -0,0 +1,115 @@
+// Package reference provides domain models and business logic for opaque reference tokens.
+// In reference mode, clients receive a random handle instead of a JWT. The signed token is kept
+// server-side and resolved on validation and introspection, so clients cannot read its claims,
+// large permission sets do not inflate request headers, and revoking a token deletes it.
+package reference
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token formats tokens can be issued in.
+const (
+	TOKEN_FORMAT_JWT       = "jwt"       // Self-contained signed JWTs
+	TOKEN_FORMAT_REFERENCE = "reference" // Opaque handles resolved server-side
+)
+
+// REFERENCE_TOKEN_PREFIX starts every handle, telling reference tokens apart from JWTs
+// and making leaked handles easy to spot for secret scanners.
+const REFERENCE_TOKEN_PREFIX = "aegis_ref_"
+
+var TOKEN_FORMAT = getTokenFormat()
+
+// ReferenceToken represents an opaque handle and the token it stands for.
+// Only a SHA-256 hash of the handle is stored, so a database leak does not expose usable tokens.
+type ReferenceToken struct {
+	Handle     string // Plain handle, only set when the token is created
+	HandleHash string
+	Token      string // The signed JWT the handle resolves to
+	TokenId    string // JTI of the JWT
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
+
+// CreateReferenceToken creates a new random handle for a signed token.
+// The handle has 256 bits of randomness.
+//
+// Parameters:
+//   - token: The signed JWT to keep server-side
+//   - tokenId: JTI of the JWT
+//   - expiresAt: Expiration of the JWT
+//
+// Returns:
+//   - Pointer to the newly created ReferenceToken
+//   - Error if random generation fails
+func CreateReferenceToken(token string, tokenId string, expiresAt time.Time) (*ReferenceToken, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+	handle := REFERENCE_TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(randomBytes)
+	return &ReferenceToken{
+		Handle:     handle,
+		HandleHash: HashHandle(handle),
+		Token:      token,
+		TokenId:    tokenId,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// IsReferenceToken reports whether a token string is an opaque handle rather than a JWT.
+func IsReferenceToken(token string) bool {
+	return strings.HasPrefix(token, REFERENCE_TOKEN_PREFIX)
+}
+
+// HashHandle returns the hex-encoded SHA-256 hash a handle is stored under.
+func HashHandle(handle string) string {
+	sum := sha256.Sum256([]byte(handle))
+	return hex.EncodeToString(sum[:])
+}
+
+// FormatFor returns the format tokens are issued in, given a client's configured format.
+//
+// Parameters:
+//   - clientFormat: The client's token format, empty for direct logins or to use the server default
+//
+// Returns:
+//   - TOKEN_FORMAT_JWT or TOKEN_FORMAT_REFERENCE
+func FormatFor(clientFormat string) string {
+	if clientFormat != "" {
+		return clientFormat
+	}
+	return TOKEN_FORMAT
+}
+
+// IsValidFormat reports whether the value is a known token format.
+func IsValidFormat(format string) bool {
+	return format == TOKEN_FORMAT_JWT || format == TOKEN_FORMAT_REFERENCE
+}
+
+// getTokenFormat retrieves the default token format from the AEGIS_TOKEN_FORMAT
+// environment variable: "jwt" or "reference". Defaults to "jwt".
+//
+// Returns:
+//   - The configured token format
+func getTokenFormat() string {
+	const TOKEN_FORMAT_ENV = "AEGIS_TOKEN_FORMAT"
+	format := os.Getenv(TOKEN_FORMAT_ENV)
+	if format == "" {
+		return TOKEN_FORMAT_JWT
+	}
+	if !IsValidFormat(format) {
+		log.Printf("Warning: invalid %s value '%s', using default %s", TOKEN_FORMAT_ENV, format, TOKEN_FORMAT_JWT)
+		return TOKEN_FORMAT_JWT
+	}
+	log.Printf("Using token format: %s", format)
+	return format
+}
@@ -0,0 +1,163 @@
+package reference
+
+import (
+	"errors"
+	"log"
+	"time"
+	db "nfcunha/aegis/database"
+	"nfcunha/aegis/util/jwt"
+)
+
+var ErrReferenceNotFound = errors.New("reference token not found")
+
+const (
+	INSERT_REFERENCE_TOKEN = `
+		INSERT INTO reference_tokens (
+			handle_hash,
+			token,
+			token_id,
+			expires_at,
+			created_at
+		) VALUES (?, ?, ?, ?, ?)
+	`
+
+	SELECT_REFERENCE_TOKEN = `
+		SELECT
+			token
+		FROM
+			reference_tokens
+		WHERE
+			handle_hash = ?
+			AND expires_at > ?
+	`
+
+	DELETE_REFERENCE_TOKEN = `
+		DELETE FROM reference_tokens
+		WHERE handle_hash = ?
+	`
+
+	DELETE_EXPIRED_REFERENCE_TOKENS = `
+		DELETE FROM reference_tokens
+		WHERE expires_at < ?
+	`
+)
+
+// SaveReferenceToken inserts a new reference token into the database.
+//
+// Parameters:
+//   - referenceToken: The reference token to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveReferenceToken(referenceToken *ReferenceToken) error {
+	return db.RunCommandWithArgs(INSERT_REFERENCE_TOKEN,
+		referenceToken.HandleHash,
+		referenceToken.Token,
+		referenceToken.TokenId,
+		referenceToken.ExpiresAt,
+		referenceToken.CreatedAt,
+	)
+}
+
+// Issue replaces the tokens of a pair with reference tokens, storing the signed tokens server-side.
+// Token IDs and expirations are unchanged, so refresh token rotation works as for JWTs.
+//
+// Parameters:
+//   - tokenPair: The issued token pair, updated in place
+//
+// Returns:
+//   - Error if a handle cannot be generated or saved
+func Issue(tokenPair *jwt.TokenPair) error {
+	accessHandle, err := store(tokenPair.AccessToken, tokenPair.AccessTokenId, tokenPair.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	refreshHandle, err := store(tokenPair.RefreshToken, tokenPair.RefreshTokenId, tokenPair.RefreshExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	tokenPair.AccessToken = accessHandle
+	tokenPair.RefreshToken = refreshHandle
+	return nil
+}
+
+// IssueToken replaces a single token, such as a client credentials token, with a reference token.
+//
+// Parameters:
+//   - token: The issued token, updated in place
+//
+// Returns:
+//   - Error if the handle cannot be generated or saved
+func IssueToken(token *jwt.TokenOutput) error {
+	handle, err := store(token.Token, token.Id, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	token.Token = handle
+	return nil
+}
+
+// Resolve returns the signed token a handle stands for.
+//
+// Parameters:
+//   - handle: The opaque handle presented by the client
+//
+// Returns:
+//   - The signed JWT
+//   - ErrReferenceNotFound if the handle is unknown, revoked or expired
+func Resolve(handle string) (string, error) {
+	queryResult, err := db.RunQueryWithArgs(SELECT_REFERENCE_TOKEN, HashHandle(handle), time.Now())
+	if err != nil {
+		return "", err
+	}
+	defer queryResult.Close()
+
+	if !queryResult.Next() {
+		return "", ErrReferenceNotFound
+	}
+	var token string
+	if err := queryResult.Scan(&token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Revoke deletes a reference token, so its handle no longer resolves.
+//
+// Parameters:
+//   - handle: The opaque handle to revoke
+//
+// Returns:
+//   - ErrReferenceNotFound if the handle is unknown or already revoked, other errors if the deletion fails
+func Revoke(handle string) error {
+	affected, err := db.RunCommandWithRowsAffected(DELETE_REFERENCE_TOKEN, HashHandle(handle))
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrReferenceNotFound
+	}
+	log.Println("Reference token revoked")
+	return nil
+}
+
+// DeleteExpiredReferenceTokens removes reference tokens whose signed token has expired.
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteExpiredReferenceTokens() error {
+	return db.RunCommandWithArgs(DELETE_EXPIRED_REFERENCE_TOKENS, time.Now())
+}
+
+// store saves a signed token under a new handle and returns the handle.
+func store(token string, tokenId string, expiresAt time.Time) (string, error) {
+	referenceToken, err := CreateReferenceToken(token, tokenId, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	if err := SaveReferenceToken(referenceToken); err != nil {
+		return "", err
+	}
+	return referenceToken.Handle, nil
+}
@@ -0,0 +1,85 @@
+package reference
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	"nfcunha/aegis/util/jwt"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// TestIssue tests that both tokens of a pair are replaced with handles resolving to the JWTs
+func TestIssue(t *testing.T) {
+	tokenPair, _ := jwt.GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{"read:users"})
+	accessToken, refreshToken := tokenPair.AccessToken, tokenPair.RefreshToken
+
+	if err := Issue(tokenPair); err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if !IsReferenceToken(tokenPair.AccessToken) || !IsReferenceToken(tokenPair.RefreshToken) {
+		t.Fatal("Both tokens should be replaced with handles")
+	}
+
+	if resolved, err := Resolve(tokenPair.AccessToken); err != nil || resolved != accessToken {
+		t.Errorf("Access handle should resolve to the access token, got %v", err)
+	}
+	if resolved, err := Resolve(tokenPair.RefreshToken); err != nil || resolved != refreshToken {
+		t.Errorf("Refresh handle should resolve to the refresh token, got %v", err)
+	}
+}
+
+// TestResolve_Unknown tests that unknown handles do not resolve
+func TestResolve_Unknown(t *testing.T) {
+	if _, err := Resolve(REFERENCE_TOKEN_PREFIX + "unknown"); !errors.Is(err, ErrReferenceNotFound) {
+		t.Errorf("Expected ErrReferenceNotFound, got %v", err)
+	}
+}
+
+// TestRevoke tests that a revoked handle no longer resolves and cannot be revoked twice
+func TestRevoke(t *testing.T) {
+	token, _ := jwt.GenerateClientToken("billing-service", []string{}, 0, nil, nil)
+	if err := IssueToken(token); err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+
+	if err := Revoke(token.Token); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := Resolve(token.Token); !errors.Is(err, ErrReferenceNotFound) {
+		t.Errorf("Revoked handle should not resolve, got %v", err)
+	}
+	if err := Revoke(token.Token); !errors.Is(err, ErrReferenceNotFound) {
+		t.Errorf("Expected ErrReferenceNotFound on second revocation, got %v", err)
+	}
+}
+
+// TestResolve_Expired tests that expired handles do not resolve and are cleaned up
+func TestResolve_Expired(t *testing.T) {
+	referenceToken, _ := CreateReferenceToken("header.payload.signature", uuid.New().String(), time.Now().Add(-time.Minute))
+	if err := SaveReferenceToken(referenceToken); err != nil {
+		t.Fatalf("SaveReferenceToken failed: %v", err)
+	}
+
+	if _, err := Resolve(referenceToken.Handle); !errors.Is(err, ErrReferenceNotFound) {
+		t.Errorf("Expired handle should not resolve, got %v", err)
+	}
+	if err := DeleteExpiredReferenceTokens(); err != nil {
+		t.Fatalf("DeleteExpiredReferenceTokens failed: %v", err)
+	}
+	if err := Revoke(referenceToken.Handle); !errors.Is(err, ErrReferenceNotFound) {
+		t.Error("Expired handle should have been deleted")
+	}
+}
@@ -0,0 +1,66 @@
+// Package refresh provides domain models and business logic for server-side refresh tokens.
+// Refresh tokens are grouped in families: every token obtained by rotating a refresh token
+// belongs to the family started at login. Presenting a token that was already rotated is
+// treated as a theft and revokes the whole family.
+package refresh
+
+import (
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/util/jwt"
+)
+
+// Status represents the lifecycle state of a refresh token.
+type Status string
+
+const (
+	STATUS_ACTIVE  Status = "active"  // Can be exchanged for a new token pair
+	STATUS_ROTATED Status = "rotated" // Already exchanged; presenting it again means it was replayed
+	STATUS_REVOKED Status = "revoked" // Its family was revoked
+)
+
+// RefreshToken represents an issued refresh token, tracked by its JTI.
+// The JTI of the access token issued alongside it is kept so that both can be
+// blacklisted when the family is revoked.
+type RefreshToken struct {
+	Jti             string
+	FamilyId        string
+	UserId          uuid.UUID
+	ClientId        string
+	AccessJti       string
+	AccessExpiresAt time.Time
+	Status          Status
+	IssuedAt        time.Time
+	ExpiresAt       time.Time
+	RotatedAt       *time.Time
+	RevokedAt       *time.Time
+}
+
+// CreateRefreshToken creates the record of a newly issued token pair within a family.
+//
+// Parameters:
+//   - familyId: The family the token belongs to
+//   - userId: The user the tokens were issued to
+//   - clientId: The client the tokens were issued to, empty for direct logins
+//   - tokenPair: The issued token pair
+//
+// Returns:
+//   - Pointer to the newly created RefreshToken
+func CreateRefreshToken(familyId string, userId uuid.UUID, clientId string, tokenPair *jwt.TokenPair) *RefreshToken {
+	return &RefreshToken{
+		Jti:             tokenPair.RefreshTokenId,
+		FamilyId:        familyId,
+		UserId:          userId,
+		ClientId:        clientId,
+		AccessJti:       tokenPair.AccessTokenId,
+		AccessExpiresAt: tokenPair.ExpiresAt,
+		Status:          STATUS_ACTIVE,
+		IssuedAt:        time.Now(),
+		ExpiresAt:       tokenPair.RefreshExpiresAt,
+	}
+}
+
+// IsActive reports whether the token can still be exchanged for a new token pair.
+func (t *RefreshToken) IsActive() bool {
+	return t.Status == STATUS_ACTIVE
+}
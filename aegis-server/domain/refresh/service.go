@@ -0,0 +1,319 @@
+package refresh
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+	"nfcunha/aegis/domain/token"
+	"nfcunha/aegis/util/jwt"
+)
+
+var ErrTokenNotFound = errors.New("refresh token not found")
+var ErrTokenReused = errors.New("refresh token reused")
+var ErrTokenRevoked = errors.New("refresh token revoked")
+
+const (
+	SELECT_TOKEN_COLUMNS = `
+		SELECT
+			jti,
+			family_id,
+			user_id,
+			client_id,
+			access_jti,
+			access_expires_at,
+			status,
+			issued_at,
+			expires_at,
+			rotated_at,
+			revoked_at
+		FROM
+			refresh_tokens
+	`
+
+	SELECT_TOKEN_BY_JTI = SELECT_TOKEN_COLUMNS + `
+		WHERE
+			jti = ?
+	`
+
+	SELECT_TOKENS_BY_FAMILY = SELECT_TOKEN_COLUMNS + `
+		WHERE
+			family_id = ?
+		ORDER BY
+			issued_at
+	`
+
+	INSERT_TOKEN = `
+		INSERT INTO refresh_tokens (
+			jti,
+			family_id,
+			user_id,
+			client_id,
+			access_jti,
+			access_expires_at,
+			status,
+			issued_at,
+			expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	MARK_TOKEN_ROTATED = `
+		UPDATE
+			refresh_tokens
+		SET
+			status = 'rotated',
+			rotated_at = ?
+		WHERE jti = ? AND status = 'active'
+	`
+
+	REVOKE_FAMILY = `
+		UPDATE
+			refresh_tokens
+		SET
+			status = 'revoked',
+			revoked_at = ?
+		WHERE family_id = ? AND status != 'revoked'
+	`
+
+	DELETE_EXPIRED_TOKENS = `
+		DELETE FROM refresh_tokens
+		WHERE expires_at < ?
+	`
+)
+
+// SaveRefreshToken inserts a refresh token record into the database.
+//
+// Parameters:
+//   - refreshToken: The refresh token to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveRefreshToken(refreshToken *RefreshToken) error {
+	return db.RunCommandWithArgs(INSERT_TOKEN,
+		refreshToken.Jti,
+		refreshToken.FamilyId,
+		refreshToken.UserId.String(),
+		refreshToken.ClientId,
+		refreshToken.AccessJti,
+		refreshToken.AccessExpiresAt,
+		string(refreshToken.Status),
+		refreshToken.IssuedAt,
+		refreshToken.ExpiresAt,
+	)
+}
+
+// GetRefreshToken retrieves a refresh token record by its JTI.
+//
+// Parameters:
+//   - jti: The JWT ID of the refresh token
+//
+// Returns:
+//   - Pointer to the RefreshToken if found, nil otherwise
+func GetRefreshToken(jti string) *RefreshToken {
+	refreshToken, err := LookupRefreshToken(jti)
+	if err != nil {
+		log.Println("Error fetching refresh tokens:", err)
+	}
+	return refreshToken
+}
+
+// LookupRefreshToken retrieves a refresh token record by its JTI, telling a token that is
+// not tracked apart from a failed query.
+//
+// Parameters:
+//   - jti: The JWT ID of the refresh token
+//
+// Returns:
+//   - Pointer to the RefreshToken if found, nil otherwise
+//   - Error if the query fails
+func LookupRefreshToken(jti string) (*RefreshToken, error) {
+	tokens, err := fetchTokens(SELECT_TOKEN_BY_JTI, jti)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	return tokens[0], nil
+}
+
+// ListFamily retrieves every refresh token of a family, oldest first.
+//
+// Parameters:
+//   - familyId: The family ID
+//
+// Returns:
+//   - Slice of RefreshToken pointers
+func ListFamily(familyId string) []*RefreshToken {
+	return queryTokens(SELECT_TOKENS_BY_FAMILY, familyId)
+}
+
+// StartFamily records the refresh token of a new login as the first token of a new family.
+//
+// Parameters:
+//   - familyId: The ID of the new family, the ID of the login session
+//   - userId: The user who logged in
+//   - clientId: The client the tokens were issued to, empty for direct logins
+//   - tokenPair: The issued token pair
+//
+// Returns:
+//   - The saved RefreshToken
+//   - Error if the insertion fails
+func StartFamily(familyId string, userId uuid.UUID, clientId string, tokenPair *jwt.TokenPair) (*RefreshToken, error) {
+	refreshToken := CreateRefreshToken(familyId, userId, clientId, tokenPair)
+	if err := SaveRefreshToken(refreshToken); err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+// Rotate retires a refresh token and records its replacement in the same family.
+// The old token is retired with a conditional update, so concurrent refreshes with the
+// same token cannot both succeed. Presenting a token that was already rotated revokes
+// the whole family, since either the legitimate client or an attacker holds a stolen copy.
+//
+// Parameters:
+//   - jti: The JWT ID of the presented refresh token
+//   - tokenPair: The token pair issued in exchange
+//
+// Returns:
+//   - The saved replacement RefreshToken
+//   - ErrTokenNotFound, ErrTokenReused or ErrTokenRevoked if the token cannot be rotated
+func Rotate(jti string, tokenPair *jwt.TokenPair) (*RefreshToken, error) {
+	current := GetRefreshToken(jti)
+	if current == nil {
+		return nil, ErrTokenNotFound
+	}
+
+	switch current.Status {
+	case STATUS_REVOKED:
+		return nil, ErrTokenRevoked
+	case STATUS_ROTATED:
+		reportReuse(current)
+		return nil, ErrTokenReused
+	}
+
+	affected, err := db.RunCommandWithRowsAffected(MARK_TOKEN_ROTATED, time.Now(), jti)
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		// Rotated concurrently by another request
+		reportReuse(current)
+		return nil, ErrTokenReused
+	}
+
+	replacement := CreateRefreshToken(current.FamilyId, current.UserId, current.ClientId, tokenPair)
+	if err := SaveRefreshToken(replacement); err != nil {
+		return nil, err
+	}
+	return replacement, nil
+}
+
+// RevokeFamily revokes every token of a family. The refresh tokens and the access tokens
+// issued with them are added to the global blacklist until they expire. The family is only
+// marked revoked once all its tokens are blacklisted, so that a failed revocation can be retried.
+//
+// Parameters:
+//   - familyId: The family to revoke
+//   - reason: Why the family is revoked, recorded with the blacklisted tokens
+//   - revokedBy: Identifier of who revoked the family
+//
+// Returns:
+//   - Error if a token cannot be blacklisted or the update fails
+func RevokeFamily(familyId string, reason string, revokedBy string) error {
+	now := time.Now()
+	var errs []error
+	for _, refreshToken := range ListFamily(familyId) {
+		if refreshToken.Status == STATUS_REVOKED {
+			continue
+		}
+		errs = append(errs,
+			blacklist(refreshToken, refreshToken.Jti, refreshToken.ExpiresAt, now, reason, revokedBy),
+			blacklist(refreshToken, refreshToken.AccessJti, refreshToken.AccessExpiresAt, now, reason, revokedBy))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to blacklist the tokens of family %s: %w", familyId, err)
+	}
+	return db.RunCommandWithArgs(REVOKE_FAMILY, now, familyId)
+}
+
+// DeleteExpiredRefreshTokens removes tokens that can no longer be presented.
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteExpiredRefreshTokens() error {
+	return db.RunCommandWithArgs(DELETE_EXPIRED_TOKENS, time.Now())
+}
+
+// reportReuse logs a suspected refresh token theft and revokes the token's family.
+func reportReuse(refreshToken *RefreshToken) {
+	log.Printf("SECURITY: refresh token reuse detected, suspected token theft - user %s, client '%s', family %s, token %s",
+		refreshToken.UserId, refreshToken.ClientId, refreshToken.FamilyId, refreshToken.Jti)
+	if err := RevokeFamily(refreshToken.FamilyId, token.REASON_REFRESH_TOKEN_REUSE, "system"); err != nil {
+		log.Printf("Failed to revoke refresh token family %s: %v", refreshToken.FamilyId, err)
+		return
+	}
+	log.Printf("SECURITY: refresh token family %s revoked", refreshToken.FamilyId)
+}
+
+// blacklist adds a token of a revoked family that has not yet expired to the global blacklist.
+func blacklist(refreshToken *RefreshToken, jti string, expiresAt time.Time, now time.Time, reason string, revokedBy string) error {
+	if jti == "" || token.GlobalBlacklist == nil || !expiresAt.After(now) {
+		return nil
+	}
+	err := token.GlobalBlacklist.Revoke(token.BlacklistEntry{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+		RevokedAt: now,
+		UserId:    refreshToken.UserId.String(),
+		Reason:    reason,
+		RevokedBy: revokedBy,
+	})
+	if err != nil {
+		log.Printf("Failed to blacklist token %s: %v", jti, err)
+	}
+	return err
+}
+
+// queryTokens runs a refresh token query, logging a failed query and returning no tokens.
+func queryTokens(query string, args ...interface{}) []*RefreshToken {
+	tokens, err := fetchTokens(query, args...)
+	if err != nil {
+		log.Println("Error fetching refresh tokens:", err)
+		return nil
+	}
+	return tokens
+}
+
+// fetchTokens runs a refresh token query and scans the resulting rows, reporting a failed query.
+func fetchTokens(query string, args ...interface{}) ([]*RefreshToken, error) {
+	rows, err := db.RunQueryWithArgs(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*RefreshToken
+	for rows.Next() {
+		var refreshToken RefreshToken
+		var userId, status string
+		var rotatedAt, revokedAt sql.NullTime
+		err := rows.Scan(&refreshToken.Jti, &refreshToken.FamilyId, &userId, &refreshToken.ClientId, &refreshToken.AccessJti,
+			&refreshToken.AccessExpiresAt, &status, &refreshToken.IssuedAt, &refreshToken.ExpiresAt, &rotatedAt, &revokedAt)
+		if err != nil {
+			log.Println("Error scanning refresh token:", err)
+			continue
+		}
+		refreshToken.UserId, _ = uuid.Parse(userId)
+		refreshToken.Status = Status(status)
+		if rotatedAt.Valid {
+			refreshToken.RotatedAt = &rotatedAt.Time
+		}
+		if revokedAt.Valid {
+			refreshToken.RevokedAt = &revokedAt.Time
+		}
+		tokens = append(tokens, &refreshToken)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,114 @@
+package refresh
+
+import (
+	"os"
+	"testing"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	"nfcunha/aegis/domain/token"
+	"nfcunha/aegis/util/jwt"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// issuePair generates a token pair for the given user
+func issuePair(t *testing.T, userId uuid.UUID) *jwt.TokenPair {
+	tokenPair, err := jwt.GenerateTokenPair(userId, "refresh@example.com", []string{}, []string{})
+	if err != nil {
+		t.Fatalf("Failed to generate tokens: %v", err)
+	}
+	return tokenPair
+}
+
+// TestStartFamily tests that the refresh token of a login is stored as active
+func TestStartFamily(t *testing.T) {
+	userId := uuid.New()
+	tokenPair := issuePair(t, userId)
+
+	started, err := StartFamily(uuid.New().String(), userId, "client-1", tokenPair)
+	if err != nil {
+		t.Fatalf("StartFamily failed: %v", err)
+	}
+
+	stored := GetRefreshToken(tokenPair.RefreshTokenId)
+	if stored == nil {
+		t.Fatal("Expected refresh token to be stored")
+	}
+	if stored.FamilyId != started.FamilyId || stored.UserId != userId || stored.ClientId != "client-1" {
+		t.Errorf("Unexpected stored token: %+v", stored)
+	}
+	if stored.AccessJti != tokenPair.AccessTokenId {
+		t.Errorf("Expected access JTI %s, got %s", tokenPair.AccessTokenId, stored.AccessJti)
+	}
+	if !stored.IsActive() {
+		t.Errorf("Expected active token, got %s", stored.Status)
+	}
+}
+
+// TestRotate tests that rotation retires the old token and keeps the family
+func TestRotate(t *testing.T) {
+	userId := uuid.New()
+	first := issuePair(t, userId)
+	started, _ := StartFamily(uuid.New().String(), userId, "", first)
+
+	second := issuePair(t, userId)
+	replacement, err := Rotate(first.RefreshTokenId, second)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if replacement.FamilyId != started.FamilyId {
+		t.Errorf("Expected family %s, got %s", started.FamilyId, replacement.FamilyId)
+	}
+
+	old := GetRefreshToken(first.RefreshTokenId)
+	if old.Status != STATUS_ROTATED || old.RotatedAt == nil {
+		t.Errorf("Expected old token to be rotated, got %s", old.Status)
+	}
+	if len(ListFamily(started.FamilyId)) != 2 {
+		t.Error("Expected two tokens in the family")
+	}
+}
+
+// TestRotate_UnknownToken tests that tokens not issued by a login are rejected
+func TestRotate_UnknownToken(t *testing.T) {
+	if _, err := Rotate(uuid.New().String(), issuePair(t, uuid.New())); err != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+}
+
+// TestRotate_ReuseRevokesFamily tests that replaying a rotated token revokes every token of the family
+func TestRotate_ReuseRevokesFamily(t *testing.T) {
+	userId := uuid.New()
+	first := issuePair(t, userId)
+	started, _ := StartFamily(uuid.New().String(), userId, "", first)
+	second := issuePair(t, userId)
+	Rotate(first.RefreshTokenId, second)
+
+	if _, err := Rotate(first.RefreshTokenId, issuePair(t, userId)); err != ErrTokenReused {
+		t.Fatalf("Expected ErrTokenReused, got %v", err)
+	}
+
+	for _, refreshToken := range ListFamily(started.FamilyId) {
+		if refreshToken.Status != STATUS_REVOKED || refreshToken.RevokedAt == nil {
+			t.Errorf("Expected token %s to be revoked, got %s", refreshToken.Jti, refreshToken.Status)
+		}
+	}
+	if !token.GlobalBlacklist.IsBlacklisted(second.AccessTokenId) {
+		t.Error("Expected the latest access token to be blacklisted")
+	}
+
+	// The legitimate holder of the latest token is logged out as well
+	if _, err := Rotate(second.RefreshTokenId, issuePair(t, userId)); err != ErrTokenRevoked {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
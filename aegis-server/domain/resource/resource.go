@@ -0,0 +1,103 @@
+// Package resource provides domain models and business logic for resource servers.
+// A resource server is an API that accepts Aegis tokens, identified by the audience value
+// tokens are issued for. Tokens for a resource server only carry the permissions registered
+// as relevant to it, so a token for one service is useless at another.
+package resource
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"github.com/google/uuid"
+)
+
+// ResourceServer represents an API registered to receive audience-restricted tokens.
+type ResourceServer struct {
+	Id          uuid.UUID
+	Audience    string   // Value of the "aud" claim, e.g. "https://billing.example.com"
+	Name        string
+	Permissions []string // Permissions relevant to this server; others are left out of its tokens
+	CreatedAt   time.Time
+	CreatedBy   string
+	UpdatedAt   time.Time
+	UpdatedBy   string
+}
+
+// CreateResourceServer creates a new ResourceServer instance.
+// Initializes timestamps with the current time.
+//
+// Parameters:
+//   - audience: The audience value identifying the server in tokens
+//   - name: Human-readable name of the server
+//   - permissions: Permissions relevant to the server
+//   - createdBy: Identifier of who registered the server
+//
+// Returns:
+//   - Pointer to the newly created ResourceServer
+func CreateResourceServer(audience string, name string, permissions []string, createdBy string) *ResourceServer {
+	now := time.Now()
+	return &ResourceServer{
+		Id:          uuid.New(),
+		Audience:    audience,
+		Name:        name,
+		Permissions: permissions,
+		CreatedAt:   now,
+		CreatedBy:   createdBy,
+		UpdatedAt:   now,
+		UpdatedBy:   createdBy,
+	}
+}
+
+// Update modifies the server's name and relevant permissions and updates audit fields.
+// The audience cannot change, since tokens already issued carry it.
+//
+// Parameters:
+//   - name: New name of the server
+//   - permissions: New list of relevant permissions
+//   - updatedBy: Identifier of who is updating the server
+func (r *ResourceServer) Update(name string, permissions []string, updatedBy string) {
+	r.Name = name
+	r.Permissions = permissions
+	r.UpdatedAt = time.Now()
+	r.UpdatedBy = updatedBy
+}
+
+// Validate checks that the resource server can be saved.
+//
+// Returns:
+//   - Error describing the first invalid field, nil if the server is valid
+func (r *ResourceServer) Validate() error {
+	if r.Audience == "" {
+		return errors.New("audience is required")
+	}
+	if strings.ContainsAny(r.Audience, " \t\n") {
+		return errors.New("audience must not contain whitespace")
+	}
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	for _, permission := range r.Permissions {
+		if permission == "" {
+			return errors.New("permissions must not be empty")
+		}
+	}
+	return nil
+}
+
+// FilterPermissions keeps only the permissions relevant to the server.
+//
+// Parameters:
+//   - permissions: Permissions granted to the token's subject
+//
+// Returns:
+//   - The granted permissions registered for this server, in their original order
+func (r *ResourceServer) FilterPermissions(permissions []string) []string {
+	relevant := []string{}
+	for _, permission := range permissions {
+		if slices.Contains(r.Permissions, permission) {
+			relevant = append(relevant, permission)
+		}
+	}
+	return relevant
+}
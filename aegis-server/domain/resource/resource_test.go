@@ -0,0 +1,48 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestValidate tests that resource servers need an audience without whitespace and a name
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *ResourceServer
+		expectError bool
+	}{
+		{"valid", CreateResourceServer("https://billing.example.com", "Billing", []string{"read:invoices"}, "test"), false},
+		{"no permissions", CreateResourceServer("billing", "Billing", nil, "test"), false},
+		{"missing audience", CreateResourceServer("", "Billing", nil, "test"), true},
+		{"audience with whitespace", CreateResourceServer("billing api", "Billing", nil, "test"), true},
+		{"missing name", CreateResourceServer("billing", "", nil, "test"), true},
+		{"empty permission", CreateResourceServer("billing", "Billing", []string{""}, "test"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.server.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected validation error")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no validation error, got: %v", err)
+			}
+		})
+	}
+}
+
+// TestFilterPermissions tests that only the registered permissions are kept, in order
+func TestFilterPermissions(t *testing.T) {
+	server := CreateResourceServer("billing", "Billing", []string{"write:invoices", "read:invoices"}, "test")
+
+	filtered := server.FilterPermissions([]string{"read:users", "read:invoices", "write:invoices"})
+	if !reflect.DeepEqual(filtered, []string{"read:invoices", "write:invoices"}) {
+		t.Errorf("Expected invoice permissions only, got %v", filtered)
+	}
+
+	if filtered := server.FilterPermissions([]string{"read:users"}); len(filtered) != 0 {
+		t.Errorf("Expected no permissions, got %v", filtered)
+	}
+}
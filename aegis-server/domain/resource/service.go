@@ -0,0 +1,239 @@
+package resource
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+)
+
+const (
+	SELECT_RESOURCE_SERVER_COLUMNS = `
+		SELECT
+			id,
+			audience,
+			name,
+			permissions,
+			created_at,
+			created_by,
+			updated_at,
+			updated_by
+		FROM
+			resource_servers
+	`
+
+	SELECT_ALL_RESOURCE_SERVERS = SELECT_RESOURCE_SERVER_COLUMNS + `
+		ORDER BY
+			audience
+	`
+
+	SELECT_RESOURCE_SERVER_BY_ID = SELECT_RESOURCE_SERVER_COLUMNS + `
+		WHERE
+			id = ?
+	`
+
+	SELECT_RESOURCE_SERVER_BY_AUDIENCE = SELECT_RESOURCE_SERVER_COLUMNS + `
+		WHERE
+			audience = ?
+	`
+
+	INSERT_RESOURCE_SERVER = `
+		INSERT INTO resource_servers (
+			id,
+			audience,
+			name,
+			permissions,
+			created_at,
+			created_by,
+			updated_at,
+			updated_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	UPDATE_RESOURCE_SERVER = `
+		UPDATE
+			resource_servers
+		SET
+			name = ?,
+			permissions = ?,
+			updated_at = ?,
+			updated_by = ?
+		WHERE id = ?
+	`
+
+	DELETE_RESOURCE_SERVER = `
+		DELETE FROM resource_servers
+		WHERE id = ?
+	`
+)
+
+// ListResourceServers retrieves all registered resource servers, ordered by audience.
+//
+// Returns:
+//   - Slice of ResourceServer pointers, empty slice if none exist or on error
+func ListResourceServers() []*ResourceServer {
+	return queryResourceServers(SELECT_ALL_RESOURCE_SERVERS)
+}
+
+// GetResourceServerById retrieves a resource server by its ID.
+//
+// Parameters:
+//   - id: The resource server ID
+//
+// Returns:
+//   - Pointer to the ResourceServer if found, nil otherwise
+func GetResourceServerById(id uuid.UUID) *ResourceServer {
+	servers := queryResourceServers(SELECT_RESOURCE_SERVER_BY_ID, id.String())
+	if len(servers) == 0 {
+		return nil
+	}
+	return servers[0]
+}
+
+// GetResourceServerByAudience retrieves the resource server tokens with the given audience are issued for.
+//
+// Parameters:
+//   - audience: The audience value
+//
+// Returns:
+//   - Pointer to the ResourceServer if found, nil otherwise
+func GetResourceServerByAudience(audience string) *ResourceServer {
+	servers := queryResourceServers(SELECT_RESOURCE_SERVER_BY_AUDIENCE, audience)
+	if len(servers) == 0 {
+		return nil
+	}
+	return servers[0]
+}
+
+// SaveResourceServer inserts a new resource server into the database.
+//
+// Parameters:
+//   - server: The resource server to save
+//
+// Returns:
+//   - Error if the insertion fails, e.g. when the audience is already registered
+func SaveResourceServer(server *ResourceServer) error {
+	log.Printf("Saving resource server: %s (%s)", server.Name, server.Audience)
+	permissions, err := json.Marshal(nonNil(server.Permissions))
+	if err != nil {
+		return err
+	}
+	return db.RunCommandWithArgs(INSERT_RESOURCE_SERVER,
+		server.Id.String(),
+		server.Audience,
+		server.Name,
+		string(permissions),
+		server.CreatedAt,
+		server.CreatedBy,
+		server.UpdatedAt,
+		server.UpdatedBy,
+	)
+}
+
+// UpdateResourceServer updates an existing resource server in the database.
+//
+// Parameters:
+//   - server: The resource server with updated data
+//
+// Returns:
+//   - Error if the update fails
+func UpdateResourceServer(server *ResourceServer) error {
+	log.Printf("Updating resource server: %s", server.Audience)
+	permissions, err := json.Marshal(nonNil(server.Permissions))
+	if err != nil {
+		return err
+	}
+	return db.RunCommandWithArgs(UPDATE_RESOURCE_SERVER,
+		server.Name,
+		string(permissions),
+		server.UpdatedAt,
+		server.UpdatedBy,
+		server.Id.String(),
+	)
+}
+
+// DeleteResourceServer removes a resource server from the database.
+// Tokens already issued for it stay valid until they expire or are revoked.
+//
+// Parameters:
+//   - id: The ID of the resource server to delete
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteResourceServer(id uuid.UUID) error {
+	log.Printf("Deleting resource server: %s", id)
+	return db.RunCommandWithArgs(DELETE_RESOURCE_SERVER, id.String())
+}
+
+// RestrictPermissions keeps only the permissions relevant to the registered resource servers
+// among a token's audiences. Audiences that are not registered resource servers, such as client
+// IDs, do not restrict permissions; a token without registered audiences keeps all of them.
+//
+// Parameters:
+//   - audience: The token's "aud" claim
+//   - permissions: Permissions granted to the token's subject
+//
+// Returns:
+//   - The permissions relevant to at least one registered audience
+func RestrictPermissions(audience []string, permissions []string) []string {
+	var servers []*ResourceServer
+	for _, value := range audience {
+		if server := GetResourceServerByAudience(value); server != nil {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return permissions
+	}
+
+	relevant := []string{}
+	for _, permission := range permissions {
+		for _, server := range servers {
+			if slices.Contains(server.Permissions, permission) {
+				relevant = append(relevant, permission)
+				break
+			}
+		}
+	}
+	return relevant
+}
+
+// queryResourceServers runs a resource server query and scans the resulting rows.
+// Permissions are stored as a JSON array.
+func queryResourceServers(query string, args ...interface{}) []*ResourceServer {
+	queryResult, err := db.RunQueryWithArgs(query, args...)
+	if err != nil {
+		log.Println("Error fetching resource servers:", err)
+		return []*ResourceServer{}
+	}
+	defer queryResult.Close()
+
+	servers := []*ResourceServer{}
+	for queryResult.Next() {
+		var server ResourceServer
+		var id, permissions string
+		err := queryResult.Scan(&id, &server.Audience, &server.Name, &permissions,
+			&server.CreatedAt, &server.CreatedBy, &server.UpdatedAt, &server.UpdatedBy)
+		if err == nil {
+			server.Id, err = uuid.Parse(id)
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(permissions), &server.Permissions)
+		}
+		if err != nil {
+			log.Println("Error scanning resource server:", err)
+			continue
+		}
+		servers = append(servers, &server)
+	}
+	return servers
+}
+
+// nonNil returns an empty slice instead of nil, so lists are stored as [] rather than null.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,108 @@
+package resource
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// registerServer saves a resource server with a unique audience
+func registerServer(t *testing.T, permissions []string) *ResourceServer {
+	server := CreateResourceServer("https://"+uuid.New().String()+".example.com", "Test API", permissions, "test")
+	if err := SaveResourceServer(server); err != nil {
+		t.Fatalf("SaveResourceServer failed: %v", err)
+	}
+	return server
+}
+
+// TestSaveResourceServer tests that a saved server can be found by ID and audience
+func TestSaveResourceServer(t *testing.T) {
+	server := registerServer(t, []string{"read:invoices"})
+
+	byId := GetResourceServerById(server.Id)
+	if byId == nil {
+		t.Fatal("Server should be found by ID")
+	}
+	if byId.Audience != server.Audience || !reflect.DeepEqual(byId.Permissions, []string{"read:invoices"}) {
+		t.Errorf("Stored server does not match: %+v", byId)
+	}
+
+	if GetResourceServerByAudience(server.Audience) == nil {
+		t.Error("Server should be found by audience")
+	}
+	if GetResourceServerByAudience("https://unknown.example.com") != nil {
+		t.Error("Unknown audience should not be found")
+	}
+}
+
+// TestSaveResourceServer_DuplicateAudience tests that an audience can only be registered once
+func TestSaveResourceServer_DuplicateAudience(t *testing.T) {
+	server := registerServer(t, nil)
+
+	duplicate := CreateResourceServer(server.Audience, "Other API", nil, "test")
+	if err := SaveResourceServer(duplicate); err == nil {
+		t.Error("Saving a duplicate audience should fail")
+	}
+}
+
+// TestUpdateAndDeleteResourceServer tests updating the permissions and deleting a server
+func TestUpdateAndDeleteResourceServer(t *testing.T) {
+	server := registerServer(t, []string{"read:invoices"})
+
+	server.Update("Renamed API", []string{"read:invoices", "write:invoices"}, "admin")
+	if err := UpdateResourceServer(server); err != nil {
+		t.Fatalf("UpdateResourceServer failed: %v", err)
+	}
+	updated := GetResourceServerById(server.Id)
+	if updated.Name != "Renamed API" || len(updated.Permissions) != 2 || updated.UpdatedBy != "admin" {
+		t.Errorf("Server was not updated: %+v", updated)
+	}
+
+	if err := DeleteResourceServer(server.Id); err != nil {
+		t.Fatalf("DeleteResourceServer failed: %v", err)
+	}
+	if GetResourceServerById(server.Id) != nil {
+		t.Error("Deleted server should not be found")
+	}
+}
+
+// TestRestrictPermissions tests that permissions are restricted to the registered audiences only
+func TestRestrictPermissions(t *testing.T) {
+	billing := registerServer(t, []string{"read:invoices"})
+	users := registerServer(t, []string{"read:users"})
+	granted := []string{"read:invoices", "read:users", "write:orders"}
+
+	tests := []struct {
+		name     string
+		audience []string
+		expected []string
+	}{
+		{"no audience", nil, granted},
+		{"unregistered audience", []string{"some-client-id"}, granted},
+		{"one server", []string{billing.Audience}, []string{"read:invoices"}},
+		{"server and unregistered audience", []string{"some-client-id", billing.Audience}, []string{"read:invoices"}},
+		{"two servers", []string{billing.Audience, users.Audience}, []string{"read:invoices", "read:users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restricted := RestrictPermissions(tt.audience, granted)
+			if !reflect.DeepEqual(restricted, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, restricted)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+	"github.com/google/uuid"
+	db "nfcunha/aegis/database"
+	"nfcunha/aegis/domain/refresh"
+	"nfcunha/aegis/domain/token"
+	"nfcunha/aegis/domain/user"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+var ErrSessionRevoked = errors.New("session already revoked")
+
+const (
+	SELECT_SESSION_COLUMNS = `
+		SELECT
+			id,
+			user_id,
+			client_id,
+			device,
+			ip_address,
+			user_agent,
+			created_at,
+			last_refreshed_at,
+			revoked_at,
+			revoked_by
+		FROM
+			sessions
+	`
+
+	SELECT_SESSION_BY_ID = SELECT_SESSION_COLUMNS + `
+		WHERE
+			id = ?
+	`
+
+	SELECT_ACTIVE_SESSIONS_BY_USER = SELECT_SESSION_COLUMNS + `
+		WHERE
+			user_id = ?
+			AND revoked_at IS NULL
+			AND EXISTS (
+				SELECT 1 FROM refresh_tokens
+				WHERE family_id = sessions.id AND status = 'active' AND expires_at > ?
+			)
+		ORDER BY
+			created_at DESC
+	`
+
+	INSERT_SESSION = `
+		INSERT INTO sessions (
+			id,
+			user_id,
+			client_id,
+			device,
+			ip_address,
+			user_agent,
+			created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	UPDATE_LAST_REFRESHED_AT = `
+		UPDATE
+			sessions
+		SET
+			last_refreshed_at = ?
+		WHERE id = ?
+	`
+
+	REVOKE_SESSION = `
+		UPDATE
+			sessions
+		SET
+			revoked_at = ?,
+			revoked_by = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`
+
+	DELETE_ENDED_SESSIONS = `
+		DELETE FROM sessions
+		WHERE NOT EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = sessions.id
+		)
+	`
+)
+
+// SaveSession inserts a new session record into the database.
+//
+// Parameters:
+//   - session: The session to save
+//
+// Returns:
+//   - Error if the insertion fails
+func SaveSession(session *Session) error {
+	log.Printf("Saving session %s for user %s", session.Id, session.UserId)
+	return db.RunCommandWithArgs(INSERT_SESSION,
+		session.Id,
+		session.UserId.String(),
+		session.ClientId,
+		session.Device,
+		session.IpAddress,
+		session.UserAgent,
+		session.CreatedAt,
+	)
+}
+
+// GetSession retrieves a session by its ID.
+//
+// Parameters:
+//   - id: The session ID
+//
+// Returns:
+//   - Pointer to the Session if found, nil otherwise
+func GetSession(id string) *Session {
+	session, err := LookupSession(id)
+	if err != nil {
+		log.Println("Error fetching sessions:", err)
+	}
+	return session
+}
+
+// LookupSession retrieves a session by its ID, telling a session that does not exist apart
+// from a failed query.
+//
+// Parameters:
+//   - id: The session ID
+//
+// Returns:
+//   - Pointer to the Session if found, nil otherwise
+//   - Error if the query fails
+func LookupSession(id string) (*Session, error) {
+	sessions, err := fetchSessions(SELECT_SESSION_BY_ID, id)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return sessions[0], nil
+}
+
+// ListActiveSessions retrieves the sessions of a user that can still be refreshed, most recent first.
+// Sessions that were revoked, whose refresh tokens expired or were revoked after a reuse, or
+// whose tokens were all issued before the user's tokens were revoked are left out.
+//
+// Parameters:
+//   - userId: The UUID of the user
+//
+// Returns:
+//   - Slice of Session pointers, empty if the user has no active session
+func ListActiveSessions(userId uuid.UUID) []*Session {
+	cutoffs, err := user.GetTokenCutoffs(userId)
+	if err != nil {
+		return []*Session{}
+	}
+
+	sessions := []*Session{}
+	for _, session := range querySessions(SELECT_ACTIVE_SESSIONS_BY_USER, userId.String(), time.Now()) {
+		lastIssuedAt := session.CreatedAt
+		if session.LastRefreshedAt != nil {
+			lastIssuedAt = *session.LastRefreshedAt
+		}
+		if cutoffs != nil && cutoffs.IsRevoked(lastIssuedAt) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// TouchSession records that a session was refreshed.
+//
+// Parameters:
+//   - id: The session ID
+//
+// Returns:
+//   - Error if the update fails
+func TouchSession(id string) error {
+	return db.RunCommandWithArgs(UPDATE_LAST_REFRESHED_AT, time.Now(), id)
+}
+
+// RevokeSession revokes a session and every access and refresh token issued in it.
+// The tokens are added to the global blacklist until they expire. The session is only
+// marked revoked once its tokens are, so that a failed revocation can be retried.
+//
+// Parameters:
+//   - id: The session ID
+//   - revokedBy: Identifier of who revoked the session
+//
+// Returns:
+//   - ErrSessionNotFound or ErrSessionRevoked if the session cannot be revoked
+//   - Error if the tokens cannot be revoked or the update fails
+func RevokeSession(id string, revokedBy string) error {
+	session := GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+
+	if err := refresh.RevokeFamily(id, token.REASON_SESSION_REVOKED, revokedBy); err != nil {
+		return err
+	}
+	affected, err := db.RunCommandWithRowsAffected(REVOKE_SESSION, time.Now(), revokedBy, id)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionRevoked
+	}
+
+	log.Printf("Session %s revoked by %s", id, revokedBy)
+	return nil
+}
+
+// DeleteEndedSessions removes sessions none of whose refresh tokens are left, once the
+// refresh token cleanup has deleted their expired tokens.
+//
+// Returns:
+//   - Error if the deletion fails
+func DeleteEndedSessions() error {
+	return db.RunCommand(DELETE_ENDED_SESSIONS)
+}
+
+// querySessions runs a session query and scans the resulting rows.
+func querySessions(query string, args ...interface{}) []*Session {
+	sessions, err := fetchSessions(query, args...)
+	if err != nil {
+		log.Println("Error fetching sessions:", err)
+		return nil
+	}
+	return sessions
+}
+
+// fetchSessions runs a session query and scans the resulting rows, reporting a failed query.
+func fetchSessions(query string, args ...interface{}) ([]*Session, error) {
+	rows, err := db.RunQueryWithArgs(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var session Session
+		var userId string
+		var lastRefreshedAt, revokedAt sql.NullTime
+		err := rows.Scan(&session.Id, &userId, &session.ClientId, &session.Device, &session.IpAddress, &session.UserAgent,
+			&session.CreatedAt, &lastRefreshedAt, &revokedAt, &session.RevokedBy)
+		if err != nil {
+			log.Println("Error scanning session:", err)
+			continue
+		}
+		session.UserId, _ = uuid.Parse(userId)
+		if lastRefreshedAt.Valid {
+			session.LastRefreshedAt = &lastRefreshedAt.Time
+		}
+		if revokedAt.Valid {
+			session.RevokedAt = &revokedAt.Time
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
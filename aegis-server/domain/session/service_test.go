@@ -0,0 +1,198 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	"nfcunha/aegis/database"
+	"nfcunha/aegis/domain/refresh"
+	"nfcunha/aegis/domain/token"
+	"nfcunha/aegis/domain/user"
+	"nfcunha/aegis/util/jwt"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+	token.InitializeBlacklist(token.NewMemoryBlacklist())
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+// startSession persists a user and logs them in, returning the session and its tokens
+func startSession(t *testing.T, subject string) (*Session, *jwt.TokenPair) {
+	u := user.CreateUser(subject, "password123", "system")
+	user.PersistUser(u)
+	return startUserSession(t, u)
+}
+
+// startUserSession logs an existing user in, returning the session and its tokens
+func startUserSession(t *testing.T, u *user.User) (*Session, *jwt.TokenPair) {
+	session := CreateSession(u.Id, "", "Laptop", "10.0.0.1", "test-agent")
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(u.Id, u.Subject, []string{}, []string{}, jwt.TokenOptions{SessionId: session.Id})
+	if err != nil {
+		t.Fatalf("Failed to generate tokens: %v", err)
+	}
+	if _, err := refresh.StartFamily(session.Id, u.Id, "", tokenPair); err != nil {
+		t.Fatalf("StartFamily failed: %v", err)
+	}
+	if err := SaveSession(session); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	return session, tokenPair
+}
+
+// TestSaveSession tests that a session is stored with where it was started from
+func TestSaveSession(t *testing.T) {
+	session, tokenPair := startSession(t, "session-save@example.com")
+
+	stored := GetSession(session.Id)
+	if stored == nil {
+		t.Fatal("Expected session to be stored")
+	}
+	if stored.UserId != session.UserId || stored.Device != "Laptop" || stored.IpAddress != "10.0.0.1" || stored.UserAgent != "test-agent" {
+		t.Errorf("Unexpected stored session: %+v", stored)
+	}
+
+	claims, _ := jwt.ValidateToken(tokenPair.AccessToken)
+	if claims == nil || claims.SessionId != session.Id {
+		t.Error("Expected the access token to carry the session ID")
+	}
+}
+
+// TestListActiveSessions tests that only sessions that can still be refreshed are listed
+func TestListActiveSessions(t *testing.T) {
+	first, _ := startSession(t, "session-list@example.com")
+	u := user.GetUserById(first.UserId)
+	second, _ := startUserSession(t, u)
+
+	// A session whose tokens were never recorded has ended
+	SaveSession(CreateSession(u.Id, "", "", "10.0.0.2", "test-agent"))
+
+	sessions := ListActiveSessions(u.Id)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].Id != second.Id && sessions[1].Id != second.Id {
+		t.Errorf("Expected session %s to be listed", second.Id)
+	}
+}
+
+// TestListActiveSessions_TokensRevoked tests that sessions are ended by revoking all tokens of a user
+func TestListActiveSessions_TokensRevoked(t *testing.T) {
+	session, _ := startSession(t, "session-revoke-all@example.com")
+
+	user.RevokeAllTokens(session.UserId, "system")
+	if sessions := ListActiveSessions(session.UserId); len(sessions) != 0 {
+		t.Errorf("Expected no sessions, got %d", len(sessions))
+	}
+}
+
+// TestTouchSession tests that refreshes are recorded
+func TestTouchSession(t *testing.T) {
+	session, _ := startSession(t, "session-touch@example.com")
+
+	if err := TouchSession(session.Id); err != nil {
+		t.Fatalf("TouchSession failed: %v", err)
+	}
+	stored := GetSession(session.Id)
+	if stored.LastRefreshedAt == nil || stored.LastRefreshedAt.Before(session.CreatedAt) {
+		t.Errorf("Expected last refresh to be recorded, got %v", stored.LastRefreshedAt)
+	}
+}
+
+// TestRevokeSession tests that revoking a session revokes its tokens and only that session
+func TestRevokeSession(t *testing.T) {
+	session, tokenPair := startSession(t, "session-revoke@example.com")
+	other, otherPair := startUserSession(t, user.GetUserById(session.UserId))
+
+	if err := RevokeSession(session.Id, "session-revoke@example.com"); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+
+	if !token.GlobalBlacklist.IsBlacklisted(tokenPair.AccessTokenId) || !token.GlobalBlacklist.IsBlacklisted(tokenPair.RefreshTokenId) {
+		t.Error("Expected the session's tokens to be blacklisted")
+	}
+	if token.GlobalBlacklist.IsBlacklisted(otherPair.AccessTokenId) {
+		t.Error("Expected the tokens of other sessions to remain valid")
+	}
+	stored := GetSession(session.Id)
+	if stored.RevokedAt == nil || stored.RevokedBy != "session-revoke@example.com" {
+		t.Errorf("Expected revocation to be recorded, got %+v", stored)
+	}
+
+	sessions := ListActiveSessions(session.UserId)
+	if len(sessions) != 1 || sessions[0].Id != other.Id {
+		t.Errorf("Expected only session %s to remain, got %v", other.Id, sessions)
+	}
+}
+
+// TestRevokeSession_Errors tests revoking unknown and already revoked sessions
+func TestRevokeSession_Errors(t *testing.T) {
+	if err := RevokeSession(uuid.New().String(), "system"); err != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+
+	session, _ := startSession(t, "session-revoke-twice@example.com")
+	RevokeSession(session.Id, "system")
+	if err := RevokeSession(session.Id, "system"); err != ErrSessionRevoked {
+		t.Errorf("Expected ErrSessionRevoked, got %v", err)
+	}
+}
+
+// failingBlacklist rejects every revocation, like a blacklist whose store is unavailable
+type failingBlacklist struct {
+	token.Blacklist
+}
+
+func (b *failingBlacklist) Revoke(entry token.BlacklistEntry) error {
+	return errors.New("blacklist unavailable")
+}
+
+// TestRevokeSession_BlacklistFailure tests that a session stays revocable when its tokens cannot be blacklisted
+func TestRevokeSession_BlacklistFailure(t *testing.T) {
+	session, tokenPair := startSession(t, "session-revoke-failure@example.com")
+	original := token.GlobalBlacklist
+	token.GlobalBlacklist = &failingBlacklist{Blacklist: original}
+	defer func() { token.GlobalBlacklist = original }()
+
+	if err := RevokeSession(session.Id, "system"); err == nil {
+		t.Fatal("Expected RevokeSession to fail when the tokens cannot be blacklisted")
+	}
+	if stored := GetSession(session.Id); stored.RevokedAt != nil {
+		t.Error("Expected the session not to be marked revoked")
+	}
+
+	// Once the blacklist is back, the revocation can be retried
+	token.GlobalBlacklist = original
+	if err := RevokeSession(session.Id, "system"); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if !token.GlobalBlacklist.IsBlacklisted(tokenPair.AccessTokenId) {
+		t.Error("Expected the session's access token to be blacklisted")
+	}
+}
+
+// TestDeleteEndedSessions tests that sessions are removed once their refresh tokens are gone
+func TestDeleteEndedSessions(t *testing.T) {
+	active, _ := startSession(t, "session-cleanup@example.com")
+	ended := CreateSession(active.UserId, "", "", "10.0.0.3", "test-agent")
+	ended.CreatedAt = time.Now().Add(-time.Hour)
+	SaveSession(ended)
+
+	if err := DeleteEndedSessions(); err != nil {
+		t.Fatalf("DeleteEndedSessions failed: %v", err)
+	}
+	if GetSession(ended.Id) != nil {
+		t.Error("Expected ended session to be deleted")
+	}
+	if GetSession(active.Id) == nil {
+		t.Error("Expected active session to be kept")
+	}
+}
@@ -0,0 +1,48 @@
+// Package session provides domain models and business logic for login sessions.
+// A session starts when a user logs in and lasts as long as its refresh tokens: the tokens
+// issued at login and by every refresh carry its ID in a "sid" claim and form one refresh
+// token family. Revoking a session revokes every token of that family, and every other token
+// carrying its ID, such as tokens exchanged for them, is rejected once the session is revoked.
+package session
+
+import (
+	"time"
+	"github.com/google/uuid"
+)
+
+// Session represents a login of a user on a device, with where it was started from.
+type Session struct {
+	Id              string
+	UserId          uuid.UUID
+	ClientId        string
+	Device          string
+	IpAddress       string
+	UserAgent       string
+	CreatedAt       time.Time
+	LastRefreshedAt *time.Time
+	RevokedAt       *time.Time
+	RevokedBy       string
+}
+
+// CreateSession creates a new Session with a random ID for a user who just logged in.
+//
+// Parameters:
+//   - userId: The user who logged in
+//   - clientId: The client the user logged in to, empty for direct logins
+//   - device: Human-readable device name given by the client, may be empty
+//   - ipAddress: IP address the login came from
+//   - userAgent: User agent of the login request
+//
+// Returns:
+//   - Pointer to the newly created Session
+func CreateSession(userId uuid.UUID, clientId string, device string, ipAddress string, userAgent string) *Session {
+	return &Session{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		ClientId:  clientId,
+		Device:    device,
+		IpAddress: ipAddress,
+		UserAgent: userAgent,
+		CreatedAt: time.Now(),
+	}
+}
@@ -22,6 +22,57 @@ type Blacklist interface {
 	//   - Error if the operation fails
 	Add(jti string, expiresAt time.Time) error
 
+	// Revoke adds a token to the blacklist along with the details of the revocation.
+	// A zero RevokedAt is set to the current time.
+	//
+	// Parameters:
+	//   - entry: The revoked token's JTI, expiration, user, reason and who revoked it
+	//
+	// Returns:
+	//   - Error if the operation fails
+	Revoke(entry BlacklistEntry) error
+
+	// Get retrieves the blacklist entry of a revoked token.
+	//
+	// Parameters:
+	//   - jti: The unique JWT ID claim to look up
+	//
+	// Returns:
+	//   - The BlacklistEntry, or nil if the token is not blacklisted
+	Get(jti string) *BlacklistEntry
+
+	// List returns a page of the revoked tokens that have not expired yet, ordered by JTI.
+	//
+	// Parameters:
+	//   - after: JTI of the last entry of the previous page, empty for the first page
+	//   - limit: Maximum number of entries to return
+	//
+	// Returns:
+	//   - The entries with a JTI greater than after
+	//   - Error if the operation fails
+	List(after string, limit int) ([]BlacklistEntry, error)
+
+	// Changes returns the tokens revoked after a sequence number that have not expired yet,
+	// in the order they were revoked. Expired entries are dropped without notice, so
+	// consumers must forget entries past their ExpiresAt themselves.
+	//
+	// Parameters:
+	//   - since: Seq of the last entry already seen, 0 for all
+	//   - limit: Maximum number of entries to return
+	//
+	// Returns:
+	//   - The entries with a Seq greater than since
+	//   - Error if the operation fails
+	Changes(since int64, limit int) ([]BlacklistEntry, error)
+
+	// Epoch identifies the sequence the Seq values of Changes belong to. It differs whenever
+	// sequence numbers start over, such as after an in-memory blacklist is recreated, so that
+	// consumers of the change feed know their position is no longer valid.
+	//
+	// Returns:
+	//   - The epoch of the blacklist's sequence
+	Epoch() string
+
 	// IsBlacklisted checks if a token is currently on the blacklist.
 	//
 	// Parameters:
@@ -47,9 +98,21 @@ type Blacklist interface {
 	Size() int
 }
 
+// Reasons recorded with revoked tokens.
+const (
+	REASON_REVOKED             = "revoked"             // Revoked through the revocation endpoint
+	REASON_REFRESH_TOKEN_REUSE = "refresh_token_reuse" // Family revoked after a refresh token was replayed
+	REASON_IMPERSONATION_ENDED = "impersonation_ended" // Impersonation session ended before the token expired
+	REASON_SESSION_REVOKED     = "session_revoked"     // Login session revoked by the user or an administrator
+)
+
 // BlacklistEntry represents a single entry in the token blacklist.
 type BlacklistEntry struct {
+	Seq       int64     // Position in the blacklist's change feed, assigned on revocation
 	JTI       string    // JWT ID from the token's claims
 	ExpiresAt time.Time // When the token expires naturally
 	RevokedAt time.Time // When the token was revoked
+	UserId    string    // User the token was issued to, empty for client tokens
+	Reason    string    // Why the token was revoked
+	RevokedBy string    // Who revoked the token
 }
@@ -0,0 +1,188 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// CachedBlacklist is a read-through cache in front of another Blacklist, typically a
+// DatabaseBlacklist, so that IsBlacklisted does not hit the backend on every validation.
+//
+// Revoked tokens are cached until they expire, since a revocation is never undone.
+// Tokens found not to be revoked are cached for the configured TTL only, which bounds
+// how long a revocation made directly in the backend (e.g. by another instance sharing
+// the database) can go unnoticed. Revocations made through the cache are visible immediately.
+type CachedBlacklist struct {
+	backend Blacklist
+	revoked *MemoryBlacklist     // Confirmed revocations
+	checked map[string]time.Time // JTI -> when the backend last reported it as not revoked
+	ttl     time.Duration
+	mu      sync.Mutex // Protects checked
+}
+
+// NewCachedBlacklist wraps a blacklist with an in-memory read-through cache.
+//
+// Parameters:
+//   - backend: The blacklist holding the authoritative entries
+//   - ttl: How long a "not revoked" answer is cached
+//
+// Returns:
+//   - A new CachedBlacklist ready for use
+func NewCachedBlacklist(backend Blacklist, ttl time.Duration) *CachedBlacklist {
+	return &CachedBlacklist{
+		backend: backend,
+		revoked: NewMemoryBlacklist(),
+		checked: make(map[string]time.Time),
+		ttl:     ttl,
+	}
+}
+
+// Add adds a token to the backend and the cache by its JTI.
+//
+// Parameters:
+//   - jti: The unique JWT ID from the token's claims
+//   - expiresAt: When the token expires naturally
+//
+// Returns:
+//   - Error if the backend fails
+func (b *CachedBlacklist) Add(jti string, expiresAt time.Time) error {
+	return b.Revoke(BlacklistEntry{JTI: jti, ExpiresAt: expiresAt})
+}
+
+// Revoke writes a revocation through to the backend, then caches it.
+//
+// Parameters:
+//   - entry: The revoked token's details
+//
+// Returns:
+//   - Error if the backend fails, in which case nothing is cached
+func (b *CachedBlacklist) Revoke(entry BlacklistEntry) error {
+	if entry.RevokedAt.IsZero() {
+		entry.RevokedAt = time.Now()
+	}
+	if err := b.backend.Revoke(entry); err != nil {
+		return err
+	}
+	b.revoked.Revoke(entry)
+
+	b.mu.Lock()
+	delete(b.checked, entry.JTI)
+	b.mu.Unlock()
+	return nil
+}
+
+// Get retrieves the blacklist entry of a revoked token, from the cache if possible.
+//
+// Parameters:
+//   - jti: The JWT ID to look up
+//
+// Returns:
+//   - The BlacklistEntry, or nil if the token is not blacklisted
+func (b *CachedBlacklist) Get(jti string) *BlacklistEntry {
+	if entry := b.revoked.Get(jti); entry != nil {
+		return entry
+	}
+	entry := b.backend.Get(jti)
+	if entry != nil {
+		b.revoked.Revoke(*entry)
+	}
+	return entry
+}
+
+// List returns a page of the unexpired revoked tokens from the backend.
+//
+// Parameters:
+//   - after: JTI of the last entry of the previous page, empty for the first page
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - The entries with a JTI greater than after
+//   - Error if the backend fails
+func (b *CachedBlacklist) List(after string, limit int) ([]BlacklistEntry, error) {
+	return b.backend.List(after, limit)
+}
+
+// Changes returns the unexpired tokens revoked after a sequence number from the backend.
+//
+// Parameters:
+//   - since: Seq of the last entry already seen, 0 for all
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - The entries with a Seq greater than since
+//   - Error if the backend fails
+func (b *CachedBlacklist) Changes(since int64, limit int) ([]BlacklistEntry, error) {
+	return b.backend.Changes(since, limit)
+}
+
+// Epoch returns the epoch of the backend, whose sequence Changes reports.
+//
+// Returns:
+//   - The epoch of the backend's sequence
+func (b *CachedBlacklist) Epoch() string {
+	return b.backend.Epoch()
+}
+
+// IsBlacklisted checks the cache first and falls back to the backend on a miss.
+// The backend's answer decides, so a backend that fails closed keeps doing so; a "revoked"
+// answer is only cached once its entry could be read, and "not revoked" answers are only
+// cached when the backend gave them.
+//
+// Parameters:
+//   - jti: The JWT ID to check
+//
+// Returns:
+//   - true if the token is blacklisted, false otherwise
+func (b *CachedBlacklist) IsBlacklisted(jti string) bool {
+	if b.revoked.IsBlacklisted(jti) {
+		return true
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	checkedAt, cached := b.checked[jti]
+	b.mu.Unlock()
+	if cached && now.Sub(checkedAt) < b.ttl {
+		return false
+	}
+
+	if b.backend.IsBlacklisted(jti) {
+		if entry := b.backend.Get(jti); entry != nil {
+			b.revoked.Revoke(*entry)
+		}
+		return true
+	}
+
+	b.mu.Lock()
+	b.checked[jti] = now
+	b.mu.Unlock()
+	return false
+}
+
+// Cleanup removes expired entries from the backend and the cache,
+// and forgets "not revoked" answers older than the TTL.
+//
+// Returns:
+//   - Number of entries removed from the backend
+func (b *CachedBlacklist) Cleanup() int {
+	b.revoked.Cleanup()
+
+	now := time.Now()
+	b.mu.Lock()
+	for jti, checkedAt := range b.checked {
+		if now.Sub(checkedAt) >= b.ttl {
+			delete(b.checked, jti)
+		}
+	}
+	b.mu.Unlock()
+
+	return b.backend.Cleanup()
+}
+
+// Size returns the number of entries in the backend.
+//
+// Returns:
+//   - Number of blacklisted tokens
+func (b *CachedBlacklist) Size() int {
+	return b.backend.Size()
+}
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCachedBlacklist_WritesThrough(t *testing.T) {
+	backend := NewMemoryBlacklist()
+	bl := NewCachedBlacklist(backend, 1*time.Minute)
+	
+	bl.Revoke(BlacklistEntry{JTI: "cached-1", ExpiresAt: time.Now().Add(1 * time.Hour), Reason: REASON_REVOKED})
+	
+	if !backend.IsBlacklisted("cached-1") {
+		t.Error("Expected revocation to be written to the backend")
+	}
+	if !bl.IsBlacklisted("cached-1") {
+		t.Error("Expected token to be blacklisted")
+	}
+}
+
+func TestCachedBlacklist_ReadsThrough(t *testing.T) {
+	backend := NewMemoryBlacklist()
+	bl := NewCachedBlacklist(backend, 1*time.Minute)
+	
+	// Revoked directly in the backend, e.g. by another instance
+	backend.Add("cached-2", time.Now().Add(1*time.Hour))
+	
+	if !bl.IsBlacklisted("cached-2") {
+		t.Error("Expected cache miss to be read from the backend")
+	}
+	if entry := bl.Get("cached-2"); entry == nil {
+		t.Error("Expected entry to be cached")
+	}
+}
+
+func TestCachedBlacklist_NegativeTTL(t *testing.T) {
+	backend := NewMemoryBlacklist()
+	bl := NewCachedBlacklist(backend, 1*time.Minute)
+	
+	if bl.IsBlacklisted("cached-3") {
+		t.Fatal("Expected token not to be blacklisted")
+	}
+	
+	// The "not revoked" answer is cached for the TTL
+	backend.Add("cached-3", time.Now().Add(1*time.Hour))
+	if bl.IsBlacklisted("cached-3") {
+		t.Error("Expected cached answer within the TTL")
+	}
+	
+	// Revocations through the cache are visible immediately
+	bl.Add("cached-3", time.Now().Add(1*time.Hour))
+	if !bl.IsBlacklisted("cached-3") {
+		t.Error("Expected revocation through the cache to be visible")
+	}
+}
+
+func TestCachedBlacklist_NoTTL(t *testing.T) {
+	backend := NewMemoryBlacklist()
+	bl := NewCachedBlacklist(backend, 0)
+	
+	bl.IsBlacklisted("cached-4")
+	backend.Add("cached-4", time.Now().Add(1*time.Hour))
+	
+	if !bl.IsBlacklisted("cached-4") {
+		t.Error("Expected backend to be queried again without a TTL")
+	}
+}
+
+func TestCachedBlacklist_Cleanup(t *testing.T) {
+	backend := NewMemoryBlacklist()
+	bl := NewCachedBlacklist(backend, 1*time.Minute)
+	
+	bl.Add("cached-expired", time.Now().Add(-1*time.Minute))
+	bl.Add("cached-valid", time.Now().Add(1*time.Hour))
+	
+	if removed := bl.Cleanup(); removed != 1 {
+		t.Errorf("Expected 1 entry removed, got %d", removed)
+	}
+	if bl.Size() != 1 {
+		t.Errorf("Expected 1 entry left, got %d", bl.Size())
+	}
+}
@@ -0,0 +1,256 @@
+package token
+
+import (
+	"log"
+	"time"
+	db "nfcunha/aegis/database"
+)
+
+// DATABASE_EPOCH is the epoch of the database blacklist, whose sequence survives restarts.
+const DATABASE_EPOCH = "database"
+
+const (
+	INSERT_REVOKED_TOKEN = `
+		INSERT OR REPLACE INTO revoked_tokens (
+			jti,
+			user_id,
+			reason,
+			revoked_by,
+			revoked_at,
+			expires_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	SELECT_REVOKED_TOKEN_COLUMNS = `
+		SELECT
+			seq,
+			jti,
+			user_id,
+			reason,
+			revoked_by,
+			revoked_at,
+			expires_at
+		FROM
+			revoked_tokens
+	`
+
+	SELECT_REVOKED_TOKEN = SELECT_REVOKED_TOKEN_COLUMNS + `
+		WHERE
+			jti = ?
+	`
+
+	SELECT_REVOKED_TOKENS_PAGE = SELECT_REVOKED_TOKEN_COLUMNS + `
+		WHERE
+			jti > ? AND expires_at > ?
+		ORDER BY
+			jti
+		LIMIT ?
+	`
+
+	SELECT_REVOKED_TOKENS_SINCE = SELECT_REVOKED_TOKEN_COLUMNS + `
+		WHERE
+			seq > ? AND expires_at > ?
+		ORDER BY
+			seq
+		LIMIT ?
+	`
+
+	COUNT_REVOKED_TOKENS = `
+		SELECT
+			COUNT(*)
+		FROM
+			revoked_tokens
+	`
+
+	DELETE_EXPIRED_REVOKED_TOKENS = `
+		DELETE FROM revoked_tokens
+		WHERE expires_at < ?
+	`
+)
+
+// DatabaseBlacklist implements the Blacklist interface on the revoked_tokens table,
+// so revocations survive restarts and deployments.
+//
+// Every lookup queries the database; wrap it in a CachedBlacklist to keep
+// IsBlacklisted fast on the validation path.
+type DatabaseBlacklist struct{}
+
+// NewDatabaseBlacklist creates a blacklist backed by the revoked_tokens table.
+//
+// Returns:
+//   - A new DatabaseBlacklist ready for use
+func NewDatabaseBlacklist() *DatabaseBlacklist {
+	return &DatabaseBlacklist{}
+}
+
+// Add adds a token to the blacklist by its JTI, without revocation details.
+//
+// Parameters:
+//   - jti: The unique JWT ID from the token's claims
+//   - expiresAt: When the token expires naturally
+//
+// Returns:
+//   - Error if the insertion fails
+func (b *DatabaseBlacklist) Add(jti string, expiresAt time.Time) error {
+	return b.Revoke(BlacklistEntry{JTI: jti, ExpiresAt: expiresAt})
+}
+
+// Revoke stores a revoked token with the details of the revocation.
+// Revoking an already revoked token replaces its entry, which moves it to the end of the change feed.
+//
+// Parameters:
+//   - entry: The revoked token's details
+//
+// Returns:
+//   - Error if the insertion fails
+func (b *DatabaseBlacklist) Revoke(entry BlacklistEntry) error {
+	if entry.RevokedAt.IsZero() {
+		entry.RevokedAt = time.Now()
+	}
+	err := db.RunCommandWithArgs(INSERT_REVOKED_TOKEN,
+		entry.JTI,
+		entry.UserId,
+		entry.Reason,
+		entry.RevokedBy,
+		entry.RevokedAt,
+		entry.ExpiresAt,
+	)
+	if err != nil {
+		log.Printf("Error storing revoked token %s: %v", entry.JTI, err)
+	}
+	return err
+}
+
+// Get retrieves the blacklist entry of a revoked token.
+//
+// Parameters:
+//   - jti: The JWT ID to look up
+//
+// Returns:
+//   - The BlacklistEntry, or nil if the token is not blacklisted or the query fails
+func (b *DatabaseBlacklist) Get(jti string) *BlacklistEntry {
+	entry, err := b.lookup(jti)
+	if err != nil {
+		log.Println("Error fetching revoked token:", err)
+		return nil
+	}
+	return entry
+}
+
+// List returns a page of the unexpired revoked tokens ordered by JTI.
+//
+// Parameters:
+//   - after: JTI of the last entry of the previous page, empty for the first page
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - The entries with a JTI greater than after
+//   - Error if the query fails
+func (b *DatabaseBlacklist) List(after string, limit int) ([]BlacklistEntry, error) {
+	return queryEntries(SELECT_REVOKED_TOKENS_PAGE, after, time.Now(), limit)
+}
+
+// Changes returns the unexpired tokens revoked after a sequence number, oldest first.
+//
+// Parameters:
+//   - since: Seq of the last entry already seen, 0 for all
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - The entries with a Seq greater than since
+//   - Error if the query fails
+func (b *DatabaseBlacklist) Changes(since int64, limit int) ([]BlacklistEntry, error) {
+	return queryEntries(SELECT_REVOKED_TOKENS_SINCE, since, time.Now(), limit)
+}
+
+// Epoch returns DATABASE_EPOCH, as the sequence is stored with the tokens and shared by
+// every instance using the database.
+//
+// Returns:
+//   - The epoch of the blacklist's sequence
+func (b *DatabaseBlacklist) Epoch() string {
+	return DATABASE_EPOCH
+}
+
+// IsBlacklisted checks if a token is stored in the revoked_tokens table.
+// Fails closed: a token that cannot be looked up is reported as blacklisted, so that
+// revoked tokens are not accepted again while the database is unavailable.
+//
+// Parameters:
+//   - jti: The JWT ID to check
+//
+// Returns:
+//   - true if the token is blacklisted or the query fails, false otherwise
+func (b *DatabaseBlacklist) IsBlacklisted(jti string) bool {
+	entry, err := b.lookup(jti)
+	if err != nil {
+		log.Printf("Error checking revoked token %s, treating it as revoked: %v", jti, err)
+		return true
+	}
+	return entry != nil
+}
+
+// Cleanup removes revoked tokens that have expired naturally.
+//
+// Returns:
+//   - Number of entries removed
+func (b *DatabaseBlacklist) Cleanup() int {
+	removed, err := db.RunCommandWithRowsAffected(DELETE_EXPIRED_REVOKED_TOKENS, time.Now())
+	if err != nil {
+		log.Println("Error cleaning up revoked tokens:", err)
+		return 0
+	}
+	return int(removed)
+}
+
+// Size returns the number of revoked tokens stored in the database.
+//
+// Returns:
+//   - Number of entries in the blacklist, 0 if the query fails
+func (b *DatabaseBlacklist) Size() int {
+	rows, err := db.RunQuery(COUNT_REVOKED_TOKENS)
+	if err != nil {
+		log.Println("Error counting revoked tokens:", err)
+		return 0
+	}
+	defer rows.Close()
+
+	count := 0
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+	return count
+}
+
+// lookup retrieves the blacklist entry of a token, telling a token that is not blacklisted
+// (nil entry) apart from a failed query.
+func (b *DatabaseBlacklist) lookup(jti string) (*BlacklistEntry, error) {
+	entries, err := queryEntries(SELECT_REVOKED_TOKEN, jti)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// queryEntries runs a revoked token query and scans the resulting rows.
+func queryEntries(query string, args ...interface{}) ([]BlacklistEntry, error) {
+	rows, err := db.RunQueryWithArgs(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []BlacklistEntry
+	for rows.Next() {
+		var entry BlacklistEntry
+		err := rows.Scan(&entry.Seq, &entry.JTI, &entry.UserId, &entry.Reason, &entry.RevokedBy, &entry.RevokedAt, &entry.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,150 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"nfcunha/aegis/database"
+)
+
+func TestMain(m *testing.M) {
+	database.SetTestMode()
+	os.Remove("aegis-test.db")
+	database.Migrate()
+
+	code := m.Run()
+
+	os.Remove("aegis-test.db")
+	os.Exit(code)
+}
+
+func TestDatabaseBlacklist_Revoke(t *testing.T) {
+	bl := NewDatabaseBlacklist()
+	
+	expiresAt := time.Now().Add(1 * time.Hour).Truncate(time.Second)
+	err := bl.Revoke(BlacklistEntry{
+		JTI:       "db-jti-1",
+		ExpiresAt: expiresAt,
+		UserId:    "user-1",
+		Reason:    REASON_REVOKED,
+		RevokedBy: "admin@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	
+	if !bl.IsBlacklisted("db-jti-1") {
+		t.Error("Expected token to be blacklisted")
+	}
+	entry := bl.Get("db-jti-1")
+	if entry == nil {
+		t.Fatal("Expected entry to be stored")
+	}
+	if entry.UserId != "user-1" || entry.Reason != REASON_REVOKED || entry.RevokedBy != "admin@example.com" {
+		t.Errorf("Unexpected entry details: %+v", entry)
+	}
+	if !entry.ExpiresAt.Equal(expiresAt) || entry.RevokedAt.IsZero() {
+		t.Errorf("Unexpected entry times: %+v", entry)
+	}
+}
+
+func TestDatabaseBlacklist_SurvivesNewInstance(t *testing.T) {
+	NewDatabaseBlacklist().Add("db-jti-2", time.Now().Add(1*time.Hour))
+	
+	// A new instance (e.g. after a restart) sees the revocation
+	if !NewDatabaseBlacklist().IsBlacklisted("db-jti-2") {
+		t.Error("Expected revocation to be persisted")
+	}
+}
+
+func TestDatabaseBlacklist_IsBlacklisted_False(t *testing.T) {
+	if NewDatabaseBlacklist().IsBlacklisted("db-unknown") {
+		t.Error("Expected unknown token not to be blacklisted")
+	}
+}
+
+// simulateOutage points the database at a path that cannot be opened until the returned function is called
+func simulateOutage(t *testing.T) func() {
+	originalDBFile := database.DB_FILE
+	database.DB_FILE = filepath.Join(t.TempDir(), "missing", "aegis.db")
+	return func() { database.DB_FILE = originalDBFile }
+}
+
+func TestDatabaseBlacklist_IsBlacklisted_FailsClosed(t *testing.T) {
+	bl := NewDatabaseBlacklist()
+	restore := simulateOutage(t)
+	defer restore()
+
+	if !bl.IsBlacklisted("db-outage") {
+		t.Error("Expected a token that cannot be looked up to be treated as blacklisted")
+	}
+	if bl.Get("db-outage") != nil {
+		t.Error("Expected no entry when the query fails")
+	}
+}
+
+func TestCachedBlacklist_BackendFailure(t *testing.T) {
+	backend := NewDatabaseBlacklist()
+	backend.Add("cached-db-revoked", time.Now().Add(1*time.Hour))
+	bl := NewCachedBlacklist(backend, 1*time.Minute)
+
+	restore := simulateOutage(t)
+	if !bl.IsBlacklisted("cached-db-revoked") || !bl.IsBlacklisted("cached-db-unknown") {
+		t.Error("Expected tokens to be treated as blacklisted while the backend fails")
+	}
+	restore()
+
+	// Neither answer was cached during the outage
+	if !bl.IsBlacklisted("cached-db-revoked") {
+		t.Error("Expected revoked token to remain blacklisted")
+	}
+	if bl.IsBlacklisted("cached-db-unknown") {
+		t.Error("Expected unknown token not to be blacklisted once the backend recovers")
+	}
+}
+
+func TestDatabaseBlacklist_Cleanup(t *testing.T) {
+	database.RunCommand("DELETE FROM revoked_tokens")
+	bl := NewDatabaseBlacklist()
+	bl.Add("db-expired", time.Now().Add(-1*time.Minute))
+	bl.Add("db-valid", time.Now().Add(1*time.Hour))
+	
+	if removed := bl.Cleanup(); removed != 1 {
+		t.Errorf("Expected 1 entry removed, got %d", removed)
+	}
+	if bl.Size() != 1 || !bl.IsBlacklisted("db-valid") {
+		t.Error("Expected the unexpired entry to remain")
+	}
+}
+
+func TestDatabaseBlacklist_ListAndChanges(t *testing.T) {
+	database.RunCommand("DELETE FROM revoked_tokens")
+	bl := NewDatabaseBlacklist()
+	expiresAt := time.Now().Add(1 * time.Hour)
+	bl.Add("db-list-b", expiresAt)
+	bl.Add("db-list-a", expiresAt)
+	bl.Add("db-list-expired", time.Now().Add(-1*time.Minute))
+	bl.Add("db-list-c", expiresAt)
+	
+	page, err := bl.List("", 2)
+	if err != nil || len(page) != 2 || page[0].JTI != "db-list-a" || page[1].JTI != "db-list-b" {
+		t.Fatalf("Unexpected first page: %+v (err: %v)", page, err)
+	}
+	page, _ = bl.List(page[1].JTI, 2)
+	if len(page) != 1 || page[0].JTI != "db-list-c" {
+		t.Errorf("Unexpected second page: %+v", page)
+	}
+	
+	changes, err := bl.Changes(0, 10)
+	if err != nil || len(changes) != 3 || changes[0].JTI != "db-list-b" || changes[2].JTI != "db-list-c" {
+		t.Fatalf("Expected unexpired entries in revocation order, got %+v (err: %v)", changes, err)
+	}
+	
+	// Revoking again moves the entry to the end of the feed
+	bl.Add("db-list-a", expiresAt)
+	changes, _ = bl.Changes(changes[2].Seq, 10)
+	if len(changes) != 1 || changes[0].JTI != "db-list-a" {
+		t.Errorf("Expected the re-revoked entry only, got %+v", changes)
+	}
+}
@@ -1,17 +1,114 @@
 // Package token provides a global blacklist instance for token revocation.
 package token
 
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Blacklist storage backends selectable with AEGIS_BLACKLIST_STORE.
+const (
+	STORE_MEMORY   = "memory"
+	STORE_DATABASE = "database"
+)
+
+// Revocation transports selectable with AEGIS_BLACKLIST_REPLICATION.
+const (
+	REPLICATION_NONE     = "none"
+	REPLICATION_DATABASE = "database"
+)
+
 var (
 	// GlobalBlacklist is the application-wide token blacklist instance.
 	// It is initialized at application startup and used by all validation endpoints.
 	GlobalBlacklist Blacklist
+
+	BLACKLIST_STORE     = getBlacklistStore()
+	BLACKLIST_CACHE_TTL = getBlacklistCacheTTL()
+
+	BLACKLIST_REPLICATION   = getBlacklistReplication()
+	BLACKLIST_SYNC_INTERVAL = getBlacklistSyncInterval()
 )
 
 // InitializeBlacklist initializes the global blacklist with the specified implementation.
 // This should be called once during application startup, before any HTTP handlers are registered.
 //
 // Parameters:
-//   - blacklist: The blacklist implementation to use (e.g., MemoryBlacklist or Redis)
+//   - blacklist: The blacklist implementation to use (e.g., MemoryBlacklist or DatabaseBlacklist)
 func InitializeBlacklist(blacklist Blacklist) {
 	GlobalBlacklist = blacklist
 }
+
+// getBlacklistStore retrieves the blacklist backend from the AEGIS_BLACKLIST_STORE environment
+// variable: "memory" or "database". Defaults to "database" so revocations survive restarts.
+//
+// Returns:
+//   - The configured store name
+func getBlacklistStore() string {
+	const BLACKLIST_STORE_ENV = "AEGIS_BLACKLIST_STORE"
+	store := os.Getenv(BLACKLIST_STORE_ENV)
+	switch store {
+	case "":
+		return STORE_DATABASE
+	case STORE_MEMORY, STORE_DATABASE:
+		return store
+	}
+	log.Printf("Warning: invalid %s value '%s', using '%s'", BLACKLIST_STORE_ENV, store, STORE_DATABASE)
+	return STORE_DATABASE
+}
+
+// getBlacklistCacheTTL retrieves how long the database blacklist cache remembers that a token
+// is not revoked from the AEGIS_BLACKLIST_CACHE_TTL environment variable, in seconds.
+// Defaults to 5 seconds; 0 disables the cache.
+//
+// Returns:
+//   - Cache TTL duration, or 0 when disabled
+func getBlacklistCacheTTL() time.Duration {
+	const BLACKLIST_CACHE_TTL_ENV = "AEGIS_BLACKLIST_CACHE_TTL"
+	const DEFAULT_CACHE_TTL_SECONDS = 5
+	if ttlStr := os.Getenv(BLACKLIST_CACHE_TTL_ENV); ttlStr != "" {
+		if seconds, err := strconv.Atoi(ttlStr); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d seconds", BLACKLIST_CACHE_TTL_ENV, ttlStr, DEFAULT_CACHE_TTL_SECONDS)
+	}
+	return DEFAULT_CACHE_TTL_SECONDS * time.Second
+}
+
+// getBlacklistReplication retrieves how revocations are shared between instances from the
+// AEGIS_BLACKLIST_REPLICATION environment variable: "none" or "database".
+// Defaults to "none" for single-instance deployments.
+//
+// Returns:
+//   - The configured transport name
+func getBlacklistReplication() string {
+	const BLACKLIST_REPLICATION_ENV = "AEGIS_BLACKLIST_REPLICATION"
+	replication := os.Getenv(BLACKLIST_REPLICATION_ENV)
+	switch replication {
+	case "":
+		return REPLICATION_NONE
+	case REPLICATION_NONE, REPLICATION_DATABASE:
+		return replication
+	}
+	log.Printf("Warning: invalid %s value '%s', using '%s'", BLACKLIST_REPLICATION_ENV, replication, REPLICATION_NONE)
+	return REPLICATION_NONE
+}
+
+// getBlacklistSyncInterval retrieves how often revocations made by other instances are fetched
+// from the AEGIS_BLACKLIST_SYNC_INTERVAL environment variable, in seconds. Defaults to 2 seconds.
+//
+// Returns:
+//   - Sync interval duration
+func getBlacklistSyncInterval() time.Duration {
+	const BLACKLIST_SYNC_INTERVAL_ENV = "AEGIS_BLACKLIST_SYNC_INTERVAL"
+	const DEFAULT_SYNC_INTERVAL_SECONDS = 2
+	if intervalStr := os.Getenv(BLACKLIST_SYNC_INTERVAL_ENV); intervalStr != "" {
+		if seconds, err := strconv.Atoi(intervalStr); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d seconds", BLACKLIST_SYNC_INTERVAL_ENV, intervalStr, DEFAULT_SYNC_INTERVAL_SECONDS)
+	}
+	return DEFAULT_SYNC_INTERVAL_SECONDS * time.Second
+}
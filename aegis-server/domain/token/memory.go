@@ -1,18 +1,24 @@
 package token
 
 import (
+	"cmp"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+	"github.com/google/uuid"
 )
 
 // MemoryBlacklist implements the Blacklist interface using an in-memory map.
 // It provides thread-safe token revocation using sync.RWMutex for concurrent access.
 //
 // This implementation is suitable for development and single-instance deployments.
-// For production with multiple instances, consider using a Redis-backed implementation.
+// With multiple instances, wrap it in a ReplicatedBlacklist to share revocations.
 type MemoryBlacklist struct {
 	entries map[string]*BlacklistEntry // Map of JTI -> BlacklistEntry
-	mu      sync.RWMutex                // Protects concurrent access to entries
+	seq     int64                       // Seq of the latest revocation
+	epoch   string                      // Random ID of this blacklist's sequence
+	mu      sync.RWMutex                // Protects concurrent access to entries and seq
 }
 
 // NewMemoryBlacklist creates a new in-memory blacklist instance.
@@ -22,6 +28,7 @@ type MemoryBlacklist struct {
 func NewMemoryBlacklist() *MemoryBlacklist {
 	return &MemoryBlacklist{
 		entries: make(map[string]*BlacklistEntry),
+		epoch:   uuid.New().String(),
 	}
 }
 
@@ -35,18 +42,92 @@ func NewMemoryBlacklist() *MemoryBlacklist {
 // Returns:
 //   - Always returns nil (error interface for future implementations)
 func (b *MemoryBlacklist) Add(jti string, expiresAt time.Time) error {
+	return b.Revoke(BlacklistEntry{JTI: jti, ExpiresAt: expiresAt})
+}
+
+// Revoke adds a token to the blacklist with the details of the revocation,
+// assigning it the next sequence number. Thread-safe for concurrent writes.
+//
+// Parameters:
+//   - entry: The revoked token's details
+//
+// Returns:
+//   - Always returns nil (error interface for future implementations)
+func (b *MemoryBlacklist) Revoke(entry BlacklistEntry) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.entries[jti] = &BlacklistEntry{
-		JTI:       jti,
-		ExpiresAt: expiresAt,
-		RevokedAt: time.Now(),
+	if entry.RevokedAt.IsZero() {
+		entry.RevokedAt = time.Now()
 	}
+	b.seq++
+	entry.Seq = b.seq
+	b.entries[entry.JTI] = &entry
 
 	return nil
 }
 
+// Get retrieves the blacklist entry of a revoked token.
+// Thread-safe for concurrent reads.
+//
+// Parameters:
+//   - jti: The JWT ID to look up
+//
+// Returns:
+//   - A copy of the BlacklistEntry, or nil if the token is not blacklisted
+func (b *MemoryBlacklist) Get(jti string) *BlacklistEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	entry, exists := b.entries[jti]
+	if !exists {
+		return nil
+	}
+	copied := *entry
+	return &copied
+}
+
+// List returns a page of the unexpired entries ordered by JTI.
+// Thread-safe for concurrent reads.
+//
+// Parameters:
+//   - after: JTI of the last entry of the previous page, empty for the first page
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - Copies of the entries with a JTI greater than after
+//   - Always returns a nil error
+func (b *MemoryBlacklist) List(after string, limit int) ([]BlacklistEntry, error) {
+	entries := b.unexpired(func(entry *BlacklistEntry) bool { return entry.JTI > after })
+	slices.SortFunc(entries, func(x, y BlacklistEntry) int { return strings.Compare(x.JTI, y.JTI) })
+	return entries[:min(limit, len(entries))], nil
+}
+
+// Changes returns the unexpired entries revoked after a sequence number, oldest first.
+// Thread-safe for concurrent reads.
+//
+// Parameters:
+//   - since: Seq of the last entry already seen, 0 for all
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - Copies of the entries with a Seq greater than since
+//   - Always returns a nil error
+func (b *MemoryBlacklist) Changes(since int64, limit int) ([]BlacklistEntry, error) {
+	entries := b.unexpired(func(entry *BlacklistEntry) bool { return entry.Seq > since })
+	slices.SortFunc(entries, func(x, y BlacklistEntry) int { return cmp.Compare(x.Seq, y.Seq) })
+	return entries[:min(limit, len(entries))], nil
+}
+
+// Epoch returns the random ID of this blacklist's sequence. Sequence numbers start over
+// with every new MemoryBlacklist, such as after a restart, and so does the epoch.
+//
+// Returns:
+//   - The epoch of the blacklist's sequence
+func (b *MemoryBlacklist) Epoch() string {
+	return b.epoch
+}
+
 // IsBlacklisted checks if a token is currently on the blacklist.
 // Thread-safe for concurrent reads.
 //
@@ -98,3 +179,18 @@ func (b *MemoryBlacklist) Size() int {
 
 	return len(b.entries)
 }
+
+// unexpired returns copies of the unexpired entries accepted by a filter.
+func (b *MemoryBlacklist) unexpired(accept func(entry *BlacklistEntry) bool) []BlacklistEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	var entries []BlacklistEntry
+	for _, entry := range b.entries {
+		if entry.ExpiresAt.After(now) && accept(entry) {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
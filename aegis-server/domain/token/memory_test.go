@@ -43,6 +43,32 @@ func TestMemoryBlacklist_Add_UpdatesExpiration(t *testing.T) {
 	}
 }
 
+func TestMemoryBlacklist_Revoke(t *testing.T) {
+	bl := NewMemoryBlacklist()
+	
+	bl.Revoke(BlacklistEntry{
+		JTI:       "test-jti-revoke",
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+		UserId:    "user-1",
+		Reason:    REASON_REVOKED,
+		RevokedBy: "admin",
+	})
+	
+	entry := bl.Get("test-jti-revoke")
+	if entry == nil {
+		t.Fatal("Expected entry to be stored")
+	}
+	if entry.UserId != "user-1" || entry.Reason != REASON_REVOKED || entry.RevokedBy != "admin" {
+		t.Errorf("Unexpected entry details: %+v", entry)
+	}
+	if entry.RevokedAt.IsZero() {
+		t.Error("Expected RevokedAt to be set")
+	}
+	if bl.Get("unknown") != nil {
+		t.Error("Expected nil for unknown token")
+	}
+}
+
 func TestMemoryBlacklist_IsBlacklisted_False(t *testing.T) {
 	bl := NewMemoryBlacklist()
 	
@@ -274,3 +300,30 @@ func TestGlobalBlacklist_Initialization(t *testing.T) {
 		t.Errorf("Expected global blacklist to be same instance as initialized blacklist")
 	}
 }
+
+func TestMemoryBlacklist_ListAndChanges(t *testing.T) {
+	bl := NewMemoryBlacklist()
+	expiresAt := time.Now().Add(1 * time.Hour)
+	bl.Add("jti-b", expiresAt)
+	bl.Add("jti-a", expiresAt)
+	bl.Add("jti-expired", time.Now().Add(-1*time.Minute))
+	bl.Add("jti-c", expiresAt)
+
+	page, _ := bl.List("", 2)
+	if len(page) != 2 || page[0].JTI != "jti-a" || page[1].JTI != "jti-b" {
+		t.Fatalf("Unexpected first page: %+v", page)
+	}
+	page, _ = bl.List(page[1].JTI, 2)
+	if len(page) != 1 || page[0].JTI != "jti-c" {
+		t.Errorf("Unexpected second page: %+v", page)
+	}
+
+	changes, _ := bl.Changes(0, 10)
+	if len(changes) != 3 || changes[0].JTI != "jti-b" || changes[2].JTI != "jti-c" {
+		t.Fatalf("Expected unexpired entries in revocation order, got %+v", changes)
+	}
+	changes, _ = bl.Changes(changes[0].Seq, 1)
+	if len(changes) != 1 || changes[0].JTI != "jti-a" {
+		t.Errorf("Expected the entry after the cursor, got %+v", changes)
+	}
+}
@@ -0,0 +1,82 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// DPoPReplayCache is the application-wide cache of DPoP proof JTIs already used.
+// Proofs are short-lived, so it is kept in memory on every instance.
+var DPoPReplayCache = NewMemoryReplayCache()
+
+// MemoryReplayCache remembers the JTIs of single-use JWTs, such as DPoP proofs, until they expire.
+// It provides thread-safe replay detection using sync.RWMutex for concurrent access.
+//
+// Like MemoryBlacklist, it is suitable for single-instance deployments; with multiple
+// instances a proof replayed to another instance is not detected.
+type MemoryReplayCache struct {
+	entries map[string]time.Time // Map of JTI -> expiration time
+	mu      sync.RWMutex         // Protects concurrent access to entries
+}
+
+// NewMemoryReplayCache creates a new in-memory replay cache instance.
+//
+// Returns:
+//   - A new MemoryReplayCache ready for use
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Use records a JTI as used. Thread-safe; of concurrent uses of the same JTI, only one succeeds.
+//
+// Parameters:
+//   - jti: The unique identifier of the JWT
+//   - expiresAt: When the JWT is no longer accepted and the JTI can be forgotten
+//
+// Returns:
+//   - true if the JTI was not used before, false if this is a replay
+func (r *MemoryReplayCache) Use(jti string, expiresAt time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, exists := r.entries[jti]; exists && existing.After(time.Now()) {
+		return false
+	}
+	r.entries[jti] = expiresAt
+	return true
+}
+
+// Cleanup removes expired JTIs from the cache.
+// Thread-safe for concurrent cleanup operations.
+//
+// Returns:
+//   - Number of entries removed
+func (r *MemoryReplayCache) Cleanup() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for jti, expiresAt := range r.entries {
+		if expiresAt.Before(now) {
+			delete(r.entries, jti)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Size returns the current number of remembered JTIs.
+// Thread-safe for concurrent reads.
+//
+// Returns:
+//   - Number of entries in the cache
+func (r *MemoryReplayCache) Size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.entries)
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryReplayCache_Use(t *testing.T) {
+	cache := NewMemoryReplayCache()
+
+	expiresAt := time.Now().Add(1 * time.Minute)
+	if !cache.Use("proof-1", expiresAt) {
+		t.Errorf("Expected first use to succeed")
+	}
+	if cache.Use("proof-1", expiresAt) {
+		t.Errorf("Expected replayed JTI to be rejected")
+	}
+	if !cache.Use("proof-2", expiresAt) {
+		t.Errorf("Expected a different JTI to succeed")
+	}
+}
+
+func TestMemoryReplayCache_ExpiredEntryCanBeReused(t *testing.T) {
+	cache := NewMemoryReplayCache()
+
+	cache.Use("proof-1", time.Now().Add(-1*time.Second))
+	if !cache.Use("proof-1", time.Now().Add(1*time.Minute)) {
+		t.Errorf("Expected an expired JTI to be accepted again")
+	}
+}
+
+func TestMemoryReplayCache_Cleanup(t *testing.T) {
+	cache := NewMemoryReplayCache()
+
+	cache.Use("expired-1", time.Now().Add(-1*time.Minute))
+	cache.Use("expired-2", time.Now().Add(-1*time.Second))
+	cache.Use("valid", time.Now().Add(1*time.Minute))
+
+	if removed := cache.Cleanup(); removed != 2 {
+		t.Errorf("Expected 2 entries removed, got %d", removed)
+	}
+	if cache.Size() != 1 {
+		t.Errorf("Expected size 1 after cleanup, got %d", cache.Size())
+	}
+}
+
+func TestMemoryReplayCache_Concurrency(t *testing.T) {
+	cache := NewMemoryReplayCache()
+	expiresAt := time.Now().Add(1 * time.Minute)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cache.Use("same-proof", expiresAt) {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("Expected exactly one concurrent use to succeed, got %d", accepted)
+	}
+}
@@ -0,0 +1,222 @@
+package token
+
+import (
+	"log"
+	"sync"
+	"time"
+	"github.com/google/uuid"
+)
+
+// Transport carries revocations between Aegis instances.
+// Every instance publishes the revocations it makes and periodically fetches the ones
+// published since its cursor, so a token revoked on one replica is rejected by all of them.
+// Implementations must be thread-safe and deliver revocations in publication order.
+type Transport interface {
+	// Publish makes a revocation available to every instance.
+	//
+	// Parameters:
+	//   - origin: Identifier of the publishing instance
+	//   - entry: The revoked token's details
+	//
+	// Returns:
+	//   - Error if the revocation could not be published
+	Publish(origin string, entry BlacklistEntry) error
+
+	// Fetch retrieves revocations published after a cursor, oldest first.
+	// Implementations may cap the number of revocations returned per call.
+	//
+	// Parameters:
+	//   - cursor: Sequence number of the last revocation already seen, 0 for all
+	//
+	// Returns:
+	//   - The revocations published after the cursor
+	//   - Error if the revocations could not be fetched
+	Fetch(cursor int64) ([]Revocation, error)
+
+	// Cleanup removes published revocations of tokens that have expired naturally.
+	//
+	// Returns:
+	//   - Number of revocations removed
+	Cleanup() int
+}
+
+// Revocation is a revocation published through a Transport.
+type Revocation struct {
+	Seq    int64          // Position in the transport's feed, increasing in publication order
+	Origin string         // Instance that published the revocation
+	Entry  BlacklistEntry // The revoked token's details
+}
+
+// ReplicatedBlacklist keeps a local Blacklist in step with other Aegis instances.
+// Revocations are written to the local blacklist and published through the transport;
+// Sync applies the revocations published by other instances to the local blacklist.
+// Lookups only ever read the local blacklist.
+type ReplicatedBlacklist struct {
+	local     Blacklist
+	transport Transport
+	origin    string     // Identifier of this instance in the transport
+	cursor    int64      // Sequence number of the last revocation fetched
+	mu        sync.Mutex // Serializes Sync calls
+}
+
+// NewReplicatedBlacklist wraps a local blacklist so its revocations are shared through a transport.
+// The cursor starts at the beginning of the feed, so the first Sync catches up on every
+// revocation still held by the transport.
+//
+// Parameters:
+//   - local: The blacklist this instance checks tokens against
+//   - transport: The transport shared by all instances
+//
+// Returns:
+//   - A new ReplicatedBlacklist ready for use
+func NewReplicatedBlacklist(local Blacklist, transport Transport) *ReplicatedBlacklist {
+	return &ReplicatedBlacklist{
+		local:     local,
+		transport: transport,
+		origin:    uuid.New().String(),
+	}
+}
+
+// Add adds a token to the blacklist by its JTI and publishes the revocation.
+//
+// Parameters:
+//   - jti: The unique JWT ID from the token's claims
+//   - expiresAt: When the token expires naturally
+//
+// Returns:
+//   - Error if the local blacklist or the transport fails
+func (b *ReplicatedBlacklist) Add(jti string, expiresAt time.Time) error {
+	return b.Revoke(BlacklistEntry{JTI: jti, ExpiresAt: expiresAt})
+}
+
+// Revoke adds a token to the local blacklist, then publishes the revocation to the other instances.
+// If publishing fails the token is still revoked on this instance; the error is returned
+// so the caller can retry, which is safe since revoking a token twice has no further effect.
+//
+// Parameters:
+//   - entry: The revoked token's details
+//
+// Returns:
+//   - Error if the local blacklist or the transport fails
+func (b *ReplicatedBlacklist) Revoke(entry BlacklistEntry) error {
+	if entry.RevokedAt.IsZero() {
+		entry.RevokedAt = time.Now()
+	}
+	if err := b.local.Revoke(entry); err != nil {
+		return err
+	}
+	if err := b.transport.Publish(b.origin, entry); err != nil {
+		log.Printf("Failed to publish revocation of token %s: %v", entry.JTI, err)
+		return err
+	}
+	return nil
+}
+
+// Get retrieves the blacklist entry of a revoked token from the local blacklist.
+//
+// Parameters:
+//   - jti: The JWT ID to look up
+//
+// Returns:
+//   - The BlacklistEntry, or nil if the token is not blacklisted
+func (b *ReplicatedBlacklist) Get(jti string) *BlacklistEntry {
+	return b.local.Get(jti)
+}
+
+// List returns a page of the unexpired revoked tokens from the local blacklist.
+//
+// Parameters:
+//   - after: JTI of the last entry of the previous page, empty for the first page
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - The entries with a JTI greater than after
+//   - Error if the local blacklist fails
+func (b *ReplicatedBlacklist) List(after string, limit int) ([]BlacklistEntry, error) {
+	return b.local.List(after, limit)
+}
+
+// Changes returns the unexpired tokens revoked after a sequence number from the local blacklist.
+// Revocations made by other instances get a local sequence number when they are synced.
+//
+// Parameters:
+//   - since: Seq of the last entry already seen, 0 for all
+//   - limit: Maximum number of entries to return
+//
+// Returns:
+//   - The entries with a Seq greater than since
+//   - Error if the local blacklist fails
+func (b *ReplicatedBlacklist) Changes(since int64, limit int) ([]BlacklistEntry, error) {
+	return b.local.Changes(since, limit)
+}
+
+// Epoch returns the epoch of the local blacklist, whose sequence Changes reports.
+//
+// Returns:
+//   - The epoch of the local blacklist's sequence
+func (b *ReplicatedBlacklist) Epoch() string {
+	return b.local.Epoch()
+}
+
+// IsBlacklisted checks if a token is on the local blacklist.
+//
+// Parameters:
+//   - jti: The JWT ID to check
+//
+// Returns:
+//   - true if the token is blacklisted, false otherwise
+func (b *ReplicatedBlacklist) IsBlacklisted(jti string) bool {
+	return b.local.IsBlacklisted(jti)
+}
+
+// Sync applies the revocations published by other instances since the last call.
+// Revocations published by this instance and tokens that have already expired are skipped.
+// Should be called periodically; the interval bounds how long a token revoked on another
+// instance is still accepted by this one.
+//
+// Returns:
+//   - Number of revocations applied to the local blacklist
+//   - Error if fetching from the transport fails; revocations applied so far are kept
+func (b *ReplicatedBlacklist) Sync() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	applied := 0
+	now := time.Now()
+	for {
+		revocations, err := b.transport.Fetch(b.cursor)
+		if err != nil {
+			return applied, err
+		}
+		if len(revocations) == 0 {
+			return applied, nil
+		}
+
+		for _, revocation := range revocations {
+			if revocation.Origin != b.origin && revocation.Entry.ExpiresAt.After(now) {
+				if err := b.local.Revoke(revocation.Entry); err != nil {
+					return applied, err
+				}
+				applied++
+			}
+			b.cursor = revocation.Seq
+		}
+	}
+}
+
+// Cleanup removes expired entries from the local blacklist and the transport.
+//
+// Returns:
+//   - Number of entries removed from the local blacklist
+func (b *ReplicatedBlacklist) Cleanup() int {
+	b.transport.Cleanup()
+	return b.local.Cleanup()
+}
+
+// Size returns the number of entries in the local blacklist.
+//
+// Returns:
+//   - Number of blacklisted tokens
+func (b *ReplicatedBlacklist) Size() int {
+	return b.local.Size()
+}
@@ -0,0 +1,132 @@
+package token
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"nfcunha/aegis/database"
+)
+
+func TestReplicatedBlacklist_SharesRevocations(t *testing.T) {
+	transport := NewMemoryTransport()
+	first := NewReplicatedBlacklist(NewMemoryBlacklist(), transport)
+	second := NewReplicatedBlacklist(NewMemoryBlacklist(), transport)
+	
+	first.Revoke(BlacklistEntry{JTI: "replicated-1", ExpiresAt: time.Now().Add(1 * time.Hour), Reason: REASON_REVOKED})
+	
+	if !first.IsBlacklisted("replicated-1") {
+		t.Error("Expected token to be blacklisted on the revoking instance")
+	}
+	if second.IsBlacklisted("replicated-1") {
+		t.Error("Expected token not to be blacklisted before sync")
+	}
+	
+	applied, err := second.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if applied != 1 {
+		t.Errorf("Expected 1 revocation applied, got %d", applied)
+	}
+	if entry := second.Get("replicated-1"); entry == nil || entry.Reason != REASON_REVOKED {
+		t.Errorf("Expected replicated entry with its details, got %+v", entry)
+	}
+}
+
+func TestReplicatedBlacklist_SyncSkipsOwnAndExpired(t *testing.T) {
+	transport := NewMemoryTransport()
+	first := NewReplicatedBlacklist(NewMemoryBlacklist(), transport)
+	second := NewReplicatedBlacklist(NewMemoryBlacklist(), transport)
+	
+	first.Add("replicated-own", time.Now().Add(1*time.Hour))
+	second.Add("replicated-expired", time.Now().Add(-1*time.Minute))
+	
+	if applied, _ := first.Sync(); applied != 0 {
+		t.Errorf("Expected own and expired revocations to be skipped, got %d applied", applied)
+	}
+	
+	// The cursor has moved past both revocations
+	second.Add("replicated-new", time.Now().Add(1*time.Hour))
+	if applied, _ := first.Sync(); applied != 1 {
+		t.Errorf("Expected only the new revocation to be applied, got %d", applied)
+	}
+}
+
+func TestReplicatedBlacklist_SyncInBatches(t *testing.T) {
+	transport := NewMemoryTransport()
+	first := NewReplicatedBlacklist(NewMemoryBlacklist(), transport)
+	second := NewReplicatedBlacklist(NewMemoryBlacklist(), transport)
+	
+	expiresAt := time.Now().Add(1 * time.Hour)
+	for i := 0; i < FETCH_BATCH_SIZE+10; i++ {
+		first.Add(fmt.Sprintf("replicated-batch-%d", i), expiresAt)
+	}
+	
+	if applied, _ := second.Sync(); applied != FETCH_BATCH_SIZE+10 {
+		t.Errorf("Expected %d revocations applied, got %d", FETCH_BATCH_SIZE+10, applied)
+	}
+}
+
+func TestMemoryTransport_Cleanup(t *testing.T) {
+	transport := NewMemoryTransport()
+	transport.Publish("instance", BlacklistEntry{JTI: "expired", ExpiresAt: time.Now().Add(-1 * time.Minute)})
+	transport.Publish("instance", BlacklistEntry{JTI: "valid", ExpiresAt: time.Now().Add(1 * time.Hour)})
+	
+	if removed := transport.Cleanup(); removed != 1 {
+		t.Errorf("Expected 1 revocation removed, got %d", removed)
+	}
+	revocations, _ := transport.Fetch(0)
+	if len(revocations) != 1 || revocations[0].Entry.JTI != "valid" || revocations[0].Seq != 2 {
+		t.Errorf("Unexpected revocations after cleanup: %+v", revocations)
+	}
+}
+
+func TestDatabaseTransport(t *testing.T) {
+	database.RunCommand("DELETE FROM revocation_events")
+	
+	// Two instances with their own in-memory blacklists sharing the database
+	first := NewReplicatedBlacklist(NewMemoryBlacklist(), NewDatabaseTransport())
+	second := NewReplicatedBlacklist(NewMemoryBlacklist(), NewDatabaseTransport())
+	
+	expiresAt := time.Now().Add(1 * time.Hour).Truncate(time.Second)
+	err := first.Revoke(BlacklistEntry{
+		JTI:       "db-replicated-1",
+		ExpiresAt: expiresAt,
+		UserId:    "user-1",
+		Reason:    REASON_REVOKED,
+		RevokedBy: "admin@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	
+	if applied, err := second.Sync(); err != nil || applied != 1 {
+		t.Fatalf("Expected 1 revocation applied, got %d (err: %v)", applied, err)
+	}
+	entry := second.Get("db-replicated-1")
+	if entry == nil {
+		t.Fatal("Expected token to be blacklisted on the second instance")
+	}
+	if entry.UserId != "user-1" || entry.RevokedBy != "admin@example.com" || !entry.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Unexpected replicated entry: %+v", entry)
+	}
+	
+	if applied, _ := second.Sync(); applied != 0 {
+		t.Errorf("Expected nothing new on the second sync, got %d", applied)
+	}
+}
+
+func TestDatabaseTransport_Cleanup(t *testing.T) {
+	database.RunCommand("DELETE FROM revocation_events")
+	transport := NewDatabaseTransport()
+	transport.Publish("instance", BlacklistEntry{JTI: "db-event-expired", RevokedAt: time.Now(), ExpiresAt: time.Now().Add(-1 * time.Minute)})
+	transport.Publish("instance", BlacklistEntry{JTI: "db-event-valid", RevokedAt: time.Now(), ExpiresAt: time.Now().Add(1 * time.Hour)})
+	
+	if removed := transport.Cleanup(); removed != 1 {
+		t.Errorf("Expected 1 event removed, got %d", removed)
+	}
+	revocations, err := transport.Fetch(0)
+	if err != nil || len(revocations) != 1 || revocations[0].Entry.JTI != "db-event-valid" {
+		t.Errorf("Unexpected events after cleanup: %+v (err: %v)", revocations, err)
+	}
+}
@@ -0,0 +1,201 @@
+package token
+
+import (
+	"log"
+	"sync"
+	"time"
+	db "nfcunha/aegis/database"
+)
+
+const (
+	// FETCH_BATCH_SIZE caps the number of revocations returned by a single Fetch.
+	FETCH_BATCH_SIZE = 500
+
+	INSERT_REVOCATION_EVENT = `
+		INSERT INTO revocation_events (
+			origin,
+			jti,
+			user_id,
+			reason,
+			revoked_by,
+			revoked_at,
+			expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	SELECT_REVOCATION_EVENTS_AFTER = `
+		SELECT
+			seq,
+			origin,
+			jti,
+			user_id,
+			reason,
+			revoked_by,
+			revoked_at,
+			expires_at
+		FROM
+			revocation_events
+		WHERE
+			seq > ?
+		ORDER BY
+			seq
+		LIMIT ?
+	`
+
+	DELETE_EXPIRED_REVOCATION_EVENTS = `
+		DELETE FROM revocation_events
+		WHERE expires_at < ?
+	`
+)
+
+// DatabaseTransport shares revocations through the revocation_events table of the
+// database all instances are connected to. Every revocation is appended with an
+// increasing sequence number, which instances poll with a cursor.
+type DatabaseTransport struct{}
+
+// NewDatabaseTransport creates a transport backed by the revocation_events table.
+//
+// Returns:
+//   - A new DatabaseTransport ready for use
+func NewDatabaseTransport() *DatabaseTransport {
+	return &DatabaseTransport{}
+}
+
+// Publish appends a revocation to the revocation_events table.
+//
+// Parameters:
+//   - origin: Identifier of the publishing instance
+//   - entry: The revoked token's details
+//
+// Returns:
+//   - Error if the insertion fails
+func (t *DatabaseTransport) Publish(origin string, entry BlacklistEntry) error {
+	return db.RunCommandWithArgs(INSERT_REVOCATION_EVENT,
+		origin,
+		entry.JTI,
+		entry.UserId,
+		entry.Reason,
+		entry.RevokedBy,
+		entry.RevokedAt,
+		entry.ExpiresAt,
+	)
+}
+
+// Fetch retrieves up to FETCH_BATCH_SIZE revocations published after a cursor.
+//
+// Parameters:
+//   - cursor: Sequence number of the last revocation already seen, 0 for all
+//
+// Returns:
+//   - The revocations published after the cursor, oldest first
+//   - Error if the query fails
+func (t *DatabaseTransport) Fetch(cursor int64) ([]Revocation, error) {
+	rows, err := db.RunQueryWithArgs(SELECT_REVOCATION_EVENTS_AFTER, cursor, FETCH_BATCH_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revocations []Revocation
+	for rows.Next() {
+		var revocation Revocation
+		entry := &revocation.Entry
+		err := rows.Scan(&revocation.Seq, &revocation.Origin, &entry.JTI, &entry.UserId, &entry.Reason,
+			&entry.RevokedBy, &entry.RevokedAt, &entry.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+	return revocations, rows.Err()
+}
+
+// Cleanup removes revocation events of tokens that have expired naturally.
+//
+// Returns:
+//   - Number of events removed
+func (t *DatabaseTransport) Cleanup() int {
+	removed, err := db.RunCommandWithRowsAffected(DELETE_EXPIRED_REVOCATION_EVENTS, time.Now())
+	if err != nil {
+		log.Println("Error cleaning up revocation events:", err)
+		return 0
+	}
+	return int(removed)
+}
+
+// MemoryTransport is an in-process Transport, used to connect several
+// ReplicatedBlacklist instances in tests without a shared database.
+type MemoryTransport struct {
+	revocations []Revocation
+	seq         int64
+	mu          sync.Mutex // Protects revocations and seq
+}
+
+// NewMemoryTransport creates a new in-process transport.
+//
+// Returns:
+//   - A new MemoryTransport ready for use
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+// Publish appends a revocation to the in-memory feed.
+//
+// Parameters:
+//   - origin: Identifier of the publishing instance
+//   - entry: The revoked token's details
+//
+// Returns:
+//   - Always returns nil
+func (t *MemoryTransport) Publish(origin string, entry BlacklistEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seq++
+	t.revocations = append(t.revocations, Revocation{Seq: t.seq, Origin: origin, Entry: entry})
+	return nil
+}
+
+// Fetch retrieves up to FETCH_BATCH_SIZE revocations published after a cursor.
+//
+// Parameters:
+//   - cursor: Sequence number of the last revocation already seen, 0 for all
+//
+// Returns:
+//   - The revocations published after the cursor, oldest first
+//   - Always returns a nil error
+func (t *MemoryTransport) Fetch(cursor int64) ([]Revocation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var revocations []Revocation
+	for _, revocation := range t.revocations {
+		if revocation.Seq > cursor {
+			revocations = append(revocations, revocation)
+			if len(revocations) == FETCH_BATCH_SIZE {
+				break
+			}
+		}
+	}
+	return revocations, nil
+}
+
+// Cleanup removes revocations of tokens that have expired naturally.
+//
+// Returns:
+//   - Number of revocations removed
+func (t *MemoryTransport) Cleanup() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	kept := t.revocations[:0]
+	for _, revocation := range t.revocations {
+		if revocation.Entry.ExpiresAt.After(now) {
+			kept = append(kept, revocation)
+		}
+	}
+	removed := len(t.revocations) - len(kept)
+	t.revocations = kept
+	return removed
+}
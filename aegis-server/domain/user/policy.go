@@ -0,0 +1,108 @@
+package user
+
+import (
+	"log"
+	"os"
+	"github.com/google/uuid"
+)
+
+// TokenPolicy defines what happens to a user's outstanding tokens when their account changes.
+type TokenPolicy string
+
+const (
+	TOKEN_POLICY_REVOKE TokenPolicy = "revoke" // All tokens are rejected, the user must log in again
+	TOKEN_POLICY_STALE  TokenPolicy = "stale"  // Access tokens are rejected, refresh tokens still work to pick up the new claims
+	TOKEN_POLICY_NONE   TokenPolicy = "none"   // Tokens keep working until they expire
+)
+
+// ChangeEvent identifies an account change that may invalidate issued tokens.
+type ChangeEvent string
+
+const (
+	EVENT_PASSWORD_CHANGED   ChangeEvent = "password_changed"
+	EVENT_ROLE_REMOVED       ChangeEvent = "role_removed"
+	EVENT_PERMISSION_REMOVED ChangeEvent = "permission_removed"
+	EVENT_USER_DELETED       ChangeEvent = "user_deleted"
+)
+
+var TOKEN_POLICIES = getTokenPolicies()
+
+// TokenPolicyFor returns the configured token policy for an account change.
+//
+// Parameters:
+//   - event: The account change
+//
+// Returns:
+//   - The configured TokenPolicy, TOKEN_POLICY_NONE for unknown events
+func TokenPolicyFor(event ChangeEvent) TokenPolicy {
+	if policy, exists := TOKEN_POLICIES[event]; exists {
+		return policy
+	}
+	return TOKEN_POLICY_NONE
+}
+
+// InvalidateTokens applies the configured token policy after an account change.
+// Deleted users need no update: tokens of users that no longer exist are rejected
+// at verification time unless the deletion policy is "none".
+//
+// Parameters:
+//   - userId: The UUID of the changed user
+//   - event: The account change
+//   - changedBy: Identifier of who made the change
+//
+// Returns:
+//   - Error if the update fails
+func InvalidateTokens(userId uuid.UUID, event ChangeEvent, changedBy string) error {
+	if event == EVENT_USER_DELETED {
+		return nil
+	}
+
+	policy := TokenPolicyFor(event)
+	var err error
+	switch policy {
+	case TOKEN_POLICY_REVOKE:
+		_, err = RevokeAllTokens(userId, changedBy)
+	case TOKEN_POLICY_STALE:
+		_, err = MarkTokensStale(userId, changedBy)
+	default:
+		return nil
+	}
+
+	if err == nil {
+		log.Printf("Applied token policy '%s' to user %s after %s", policy, userId.String(), event)
+	}
+	return err
+}
+
+// getTokenPolicies reads the token policy of each account change from the environment:
+//   - AEGIS_TOKEN_POLICY_PASSWORD_CHANGE (default "revoke")
+//   - AEGIS_TOKEN_POLICY_ROLE_CHANGE (default "stale")
+//   - AEGIS_TOKEN_POLICY_PERMISSION_CHANGE (default "stale")
+//   - AEGIS_TOKEN_POLICY_USER_DELETE (default "revoke"; "stale" behaves as "revoke")
+//
+// Returns:
+//   - Map of account change to token policy
+func getTokenPolicies() map[ChangeEvent]TokenPolicy {
+	return map[ChangeEvent]TokenPolicy{
+		EVENT_PASSWORD_CHANGED:   getTokenPolicy("AEGIS_TOKEN_POLICY_PASSWORD_CHANGE", TOKEN_POLICY_REVOKE),
+		EVENT_ROLE_REMOVED:       getTokenPolicy("AEGIS_TOKEN_POLICY_ROLE_CHANGE", TOKEN_POLICY_STALE),
+		EVENT_PERMISSION_REMOVED: getTokenPolicy("AEGIS_TOKEN_POLICY_PERMISSION_CHANGE", TOKEN_POLICY_STALE),
+		EVENT_USER_DELETED:       getTokenPolicy("AEGIS_TOKEN_POLICY_USER_DELETE", TOKEN_POLICY_REVOKE),
+	}
+}
+
+// getTokenPolicy reads a single token policy from an environment variable,
+// falling back to the default when unset or invalid.
+func getTokenPolicy(env string, defaultPolicy TokenPolicy) TokenPolicy {
+	value := os.Getenv(env)
+	if value == "" {
+		return defaultPolicy
+	}
+	switch policy := TokenPolicy(value); policy {
+	case TOKEN_POLICY_REVOKE, TOKEN_POLICY_STALE, TOKEN_POLICY_NONE:
+		log.Printf("Using token policy '%s' for %s", policy, env)
+		return policy
+	}
+	log.Printf("Warning: invalid %s value '%s', using '%s'", env, value, defaultPolicy)
+	return defaultPolicy
+}
@@ -0,0 +1,38 @@
+package user
+
+import (
+	"testing"
+)
+
+// TestTokenPolicyFor_Defaults tests the default token policy of each account change
+func TestTokenPolicyFor_Defaults(t *testing.T) {
+	expected := map[ChangeEvent]TokenPolicy{
+		EVENT_PASSWORD_CHANGED:   TOKEN_POLICY_REVOKE,
+		EVENT_ROLE_REMOVED:       TOKEN_POLICY_STALE,
+		EVENT_PERMISSION_REMOVED: TOKEN_POLICY_STALE,
+		EVENT_USER_DELETED:       TOKEN_POLICY_REVOKE,
+	}
+	for event, policy := range expected {
+		if TokenPolicyFor(event) != policy {
+			t.Errorf("Expected policy %s for %s, got %s", policy, event, TokenPolicyFor(event))
+		}
+	}
+	if TokenPolicyFor(ChangeEvent("unknown")) != TOKEN_POLICY_NONE {
+		t.Error("Expected no policy for unknown events")
+	}
+}
+
+// TestGetTokenPolicy tests reading a token policy from the environment
+func TestGetTokenPolicy(t *testing.T) {
+	const env = "AEGIS_TOKEN_POLICY_TEST"
+	
+	t.Setenv(env, "none")
+	if policy := getTokenPolicy(env, TOKEN_POLICY_REVOKE); policy != TOKEN_POLICY_NONE {
+		t.Errorf("Expected configured policy, got %s", policy)
+	}
+	
+	t.Setenv(env, "invalid")
+	if policy := getTokenPolicy(env, TOKEN_POLICY_REVOKE); policy != TOKEN_POLICY_REVOKE {
+		t.Errorf("Expected default policy for invalid value, got %s", policy)
+	}
+}
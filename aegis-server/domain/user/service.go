@@ -1,6 +1,8 @@
 package user
 
 import (
+	"database/sql"
+	"encoding/json"
 	"log"
 	"time"
 	"github.com/google/uuid"
@@ -19,7 +21,9 @@ const (
 			created_at, 
 			created_by, 
 			updated_at, 
-			updated_by 
+			updated_by, 
+			authz_version, 
+			additional_info 
 		FROM 
 			users
 	`
@@ -34,7 +38,9 @@ const (
 			created_at, 
 			created_by, 
 			updated_at, 
-			updated_by 
+			updated_by, 
+			authz_version, 
+			additional_info 
 		FROM 
 			users 
 		WHERE 
@@ -51,7 +57,9 @@ const (
 			created_at, 
 			created_by, 
 			updated_at, 
-			updated_by 
+			updated_by, 
+			authz_version, 
+			additional_info 
 		FROM 
 			users 
 		WHERE 
@@ -86,8 +94,9 @@ const (
 			created_at, 
 			created_by, 
 			updated_at, 
-			updated_by
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			updated_by, 
+			additional_info
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	DELETE_USER = `
@@ -104,7 +113,8 @@ const (
 			salt = ?, 
 			pepper = ?, 
 			updated_at = ?, 
-			updated_by = ? 
+			updated_by = ?, 
+			additional_info = ? 
 		WHERE id = ?
 	`
 
@@ -127,6 +137,45 @@ const (
 		DELETE FROM user_permissions 
 		WHERE user_id = ? AND permission = ?
 	`
+
+	SELECT_TOKEN_CUTOFFS = `
+		SELECT 
+			tokens_valid_after, 
+			tokens_stale_before, 
+			authz_version 
+		FROM 
+			users 
+		WHERE 
+			id = ?
+	`
+
+	UPDATE_TOKENS_VALID_AFTER = `
+		UPDATE 
+			users 
+		SET 
+			tokens_valid_after = ?, 
+			updated_at = ?, 
+			updated_by = ? 
+		WHERE id = ?
+	`
+
+	BUMP_AUTHZ_VERSION = `
+		UPDATE 
+			users 
+		SET 
+			authz_version = authz_version + 1 
+		WHERE id = ?
+	`
+
+	UPDATE_TOKENS_STALE_BEFORE = `
+		UPDATE 
+			users 
+		SET 
+			tokens_stale_before = ?, 
+			updated_at = ?, 
+			updated_by = ? 
+		WHERE id = ?
+	`
 )
 
 // ListUsers retrieves all users from the database including their roles and permissions.
@@ -146,8 +195,10 @@ func ListUsers() []*User {
 	for queryResult.Next() {
 		var idStr, subject, passwordHash, salt, pepper, createdBy, updatedBy string
 		var createdAt, updatedAt time.Time
+		var authzVersion int
+		var additionalInfo string
 
-		err := queryResult.Scan(&idStr, &subject, &passwordHash, &salt, &pepper, &createdAt, &createdBy, &updatedAt, &updatedBy)
+		err := queryResult.Scan(&idStr, &subject, &passwordHash, &salt, &pepper, &createdAt, &createdBy, &updatedAt, &updatedBy, &authzVersion, &additionalInfo)
 		if err != nil {
 			log.Println("Error scanning user:", err)
 			continue
@@ -169,7 +220,9 @@ func ListUsers() []*User {
 			CreatedBy:    createdBy,
 			UpdatedAt:    updatedAt,
 			UpdatedBy:    updatedBy,
+			AuthzVersion: authzVersion,
 		}
+		user.AdditionalInfo = decodeAdditionalInfo(additionalInfo)
 		LoadUserPermissions(user)
 		LoadUserRoles(user)
 		users = append(users, user)
@@ -203,8 +256,10 @@ func GetUserById(userId uuid.UUID) *User {
 
 	var idStr, subject, passwordHash, salt, pepper, createdBy, updatedBy string
 	var createdAt, updatedAt time.Time
+	var authzVersion int
+	var additionalInfo string
 
-	err = queryResult.Scan(&idStr, &subject, &passwordHash, &salt, &pepper, &createdAt, &createdBy, &updatedAt, &updatedBy)
+	err = queryResult.Scan(&idStr, &subject, &passwordHash, &salt, &pepper, &createdAt, &createdBy, &updatedAt, &updatedBy, &authzVersion, &additionalInfo)
 	if err != nil {
 		return nil
 	}
@@ -224,7 +279,9 @@ func GetUserById(userId uuid.UUID) *User {
 		CreatedBy:    createdBy,
 		UpdatedAt:    updatedAt,
 		UpdatedBy:    updatedBy,
+		AuthzVersion: authzVersion,
 	}
+	user.AdditionalInfo = decodeAdditionalInfo(additionalInfo)
 
 	LoadUserPermissions(&user)
 	LoadUserRoles(&user)
@@ -257,8 +314,10 @@ func GetUserBySubject(subject string) *User {
 
 	var idStr, passwordHash, salt, pepper, createdBy, updatedBy string
 	var createdAt, updatedAt time.Time
+	var authzVersion int
+	var additionalInfo string
 
-	err = queryResult.Scan(&idStr, &subject, &passwordHash, &salt, &pepper, &createdAt, &createdBy, &updatedAt, &updatedBy)
+	err = queryResult.Scan(&idStr, &subject, &passwordHash, &salt, &pepper, &createdAt, &createdBy, &updatedAt, &updatedBy, &authzVersion, &additionalInfo)
 	if err != nil {
 		return nil
 	}
@@ -278,7 +337,9 @@ func GetUserBySubject(subject string) *User {
 		CreatedBy:	createdBy,
 		UpdatedAt:    updatedAt,
 		UpdatedBy:    updatedBy,
+		AuthzVersion: authzVersion,
 	}
+	user.AdditionalInfo = decodeAdditionalInfo(additionalInfo)
 
 	LoadUserPermissions(&user)
 	LoadUserRoles(&user)
@@ -394,7 +455,12 @@ func syncPermissions(user, existingUser *User) {
 //   - If the database insertion fails
 func SaveUser(user *User) {
 	log.Printf("Saving user: %s", user.Subject)
-	err := db.RunCommandWithArgs(INSERT_USER,
+	additionalInfo, err := encodeAdditionalInfo(user.AdditionalInfo)
+	if err != nil {
+		log.Printf("Error encoding additional info of user %s: %v", user.Subject, err)
+		panic(err)
+	}
+	err = db.RunCommandWithArgs(INSERT_USER,
 		user.Id.String(),
 		user.Subject,
 		user.PasswordHash,
@@ -404,6 +470,7 @@ func SaveUser(user *User) {
 		user.CreatedBy,
 		user.UpdatedAt,
 		user.UpdatedBy,
+		additionalInfo,
 	)
 
 	if err != nil {
@@ -422,13 +489,19 @@ func SaveUser(user *User) {
 //   - If the database update fails
 func UpdateUser(user *User) {
 	log.Printf("Updating user: %s", user.Subject)
-	err := db.RunCommandWithArgs(UPDATE_USER,
+	additionalInfo, err := encodeAdditionalInfo(user.AdditionalInfo)
+	if err != nil {
+		log.Printf("Error encoding additional info of user %s: %v", user.Subject, err)
+		panic(err)
+	}
+	err = db.RunCommandWithArgs(UPDATE_USER,
 		user.Subject,
 		user.PasswordHash,
 		user.Salt,
 		user.Pepper,
 		user.UpdatedAt,
 		user.UpdatedBy,
+		additionalInfo,
 		user.Id.String(),
 	)
 
@@ -457,6 +530,84 @@ func DeleteUser(userId uuid.UUID) {
 	log.Printf("User deleted successfully: %s", userId.String())
 }
 
+// GetTokenCutoffs retrieves the times before which tokens issued to a user are rejected.
+//
+// Parameters:
+//   - userId: The UUID of the user
+//
+// Returns:
+//   - The user's TokenCutoffs, or nil if the user does not exist
+//   - Error if the query fails
+func GetTokenCutoffs(userId uuid.UUID) (*TokenCutoffs, error) {
+	rows, err := db.RunQueryWithArgs(SELECT_TOKEN_CUTOFFS, userId.String())
+	if err != nil {
+		log.Println("Error fetching token cutoffs:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	var validAfter, staleBefore sql.NullTime
+	var cutoffs TokenCutoffs
+	if err := rows.Scan(&validAfter, &staleBefore, &cutoffs.AuthzVersion); err != nil {
+		log.Println("Error scanning token cutoffs:", err)
+		return nil, err
+	}
+
+	if validAfter.Valid {
+		cutoffs.ValidAfter = &validAfter.Time
+	}
+	if staleBefore.Valid {
+		cutoffs.StaleBefore = &staleBefore.Time
+	}
+	return &cutoffs, nil
+}
+
+// RevokeAllTokens invalidates every token issued to a user so far ("log out everywhere").
+// Tokens issued before the returned cutoff are rejected from then on; tokens issued
+// afterwards, e.g. by logging in again right away, are not affected.
+//
+// Parameters:
+//   - userId: The UUID of the user
+//   - revokedBy: Identifier of who revoked the tokens
+//
+// Returns:
+//   - The new cutoff time
+//   - Error if the update fails
+func RevokeAllTokens(userId uuid.UUID, revokedBy string) (time.Time, error) {
+	validAfter := time.Now()
+	if err := db.RunCommandWithArgs(UPDATE_TOKENS_VALID_AFTER, validAfter, validAfter, revokedBy, userId.String()); err != nil {
+		log.Printf("Error revoking tokens of user %s: %v", userId.String(), err)
+		return time.Time{}, err
+	}
+	log.Printf("All tokens revoked for user %s by %s", userId.String(), revokedBy)
+	return validAfter, nil
+}
+
+// MarkTokensStale marks the access tokens issued to a user so far as stale, because the
+// claims they carry no longer match the user's account. Stale access tokens are rejected,
+// while refresh tokens keep working so clients can obtain tokens with the current claims.
+//
+// Parameters:
+//   - userId: The UUID of the user
+//   - changedBy: Identifier of who changed the account
+//
+// Returns:
+//   - The new cutoff time
+//   - Error if the update fails
+func MarkTokensStale(userId uuid.UUID, changedBy string) (time.Time, error) {
+	staleBefore := time.Now()
+	if err := db.RunCommandWithArgs(UPDATE_TOKENS_STALE_BEFORE, staleBefore, staleBefore, changedBy, userId.String()); err != nil {
+		log.Printf("Error marking tokens of user %s as stale: %v", userId.String(), err)
+		return time.Time{}, err
+	}
+	log.Printf("Tokens of user %s marked as stale by %s", userId.String(), changedBy)
+	return staleBefore, nil
+}
+
 // LoadUserRoles loads all roles assigned to a user from the database.
 //
 // Parameters:
@@ -494,6 +645,7 @@ func AddUserRole(user *User, role UserRole) {
 	if err != nil {
 		panic(err)
 	}
+	bumpAuthzVersion(user)
 }
 
 // RemoveUserRole removes a role association from a user in the database.
@@ -509,6 +661,7 @@ func RemoveUserRole(user *User, role UserRole) {
 	if err != nil {
 		panic(err)
 	}
+	bumpAuthzVersion(user)
 }
 
 // LoadUserPermissions loads all permissions assigned to a user from the database.
@@ -548,6 +701,7 @@ func AddUserPermission(user *User, permission Permission) {
 	if err != nil {
 		panic(err)
 	}
+	bumpAuthzVersion(user)
 }
 
 // RemoveUserPermission removes a permission association from a user in the database.
@@ -563,4 +717,41 @@ func RemoveUserPermission(user *User, permission Permission) {
 	if err != nil {
 		panic(err)
 	}
-}
\ No newline at end of file
+	bumpAuthzVersion(user)
+}
+
+// bumpAuthzVersion increments the authorization version of a user after a change to their
+// roles or permissions, so tokens carrying the previous grants can be detected as stale.
+//
+// Parameters:
+//   - user: The user whose grants changed
+//
+// Panics:
+//   - If the database update fails
+func bumpAuthzVersion(user *User) {
+	err := db.RunCommandWithArgs(BUMP_AUTHZ_VERSION, user.Id.String())
+	if err != nil {
+		panic(err)
+	}
+	user.AuthzVersion++
+}
+
+// encodeAdditionalInfo serializes a user's additional info as a JSON object for storage.
+func encodeAdditionalInfo(additionalInfo map[string]interface{}) (string, error) {
+	if additionalInfo == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(additionalInfo)
+	return string(encoded), err
+}
+
+// decodeAdditionalInfo reads a user's additional info stored as a JSON object.
+// Malformed values are logged and read as empty, so the user can still log in.
+func decodeAdditionalInfo(value string) map[string]interface{} {
+	additionalInfo := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(value), &additionalInfo); err != nil {
+		log.Printf("Error decoding additional info: %v", err)
+		return map[string]interface{}{}
+	}
+	return additionalInfo
+}
@@ -3,6 +3,7 @@
 package user
 
 import (
+	"slices"
 	"time"
 	"github.com/google/uuid"
 	"nfcunha/aegis/util/hash"
@@ -14,6 +15,9 @@ type UserRole string
 // Permission represents a specific permission that can be granted to a user.
 type Permission string
 
+// ROLE_SCOPE_PREFIX marks the scope values that request a role rather than a permission (e.g. "role:admin").
+const ROLE_SCOPE_PREFIX = "role:"
+
 // User represents a user entity in the system with authentication credentials,
 // audit information, roles, and permissions.
 type User struct {
@@ -29,6 +33,26 @@ type User struct {
 	AdditionalInfo  map[string]interface{}
 	Roles			[]UserRole
 	Permissions		[]Permission
+	AuthzVersion	int // Incremented on every role or permission change
+}
+
+// TokenCutoffs holds the per-user state issued tokens are checked against.
+// Tokens issued before ValidAfter are revoked; access tokens issued before StaleBefore,
+// or stamped with an authorization version other than AuthzVersion, carry outdated claims.
+type TokenCutoffs struct {
+	ValidAfter   *time.Time
+	StaleBefore  *time.Time
+	AuthzVersion int
+}
+
+// IsRevoked reports whether a token issued at the given time has been revoked.
+func (c *TokenCutoffs) IsRevoked(issuedAt time.Time) bool {
+	return c.ValidAfter != nil && issuedAt.Before(*c.ValidAfter)
+}
+
+// IsStale reports whether an access token issued at the given time carries outdated claims.
+func (c *TokenCutoffs) IsStale(issuedAt time.Time) bool {
+	return c.StaleBefore != nil && issuedAt.Before(*c.StaleBefore)
 }
 
 // CreateUser creates a new User instance with a hashed password.
@@ -200,3 +224,29 @@ func (u *User) HasPermission(permission Permission) bool {
 	return false
 }
 
+// Grants returns the user's roles and permissions as token claims, narrowed to a requested scope.
+// Scope values prefixed with "role:" select roles and all other values select permissions, the
+// same format introspection reports scopes in. Values the user does not hold are ignored.
+//
+// Parameters:
+//   - scope: The requested scope values, or empty for all of the user's grants
+//
+// Returns:
+//   - The granted role names
+//   - The granted permissions
+func (u *User) Grants(scope []string) ([]string, []string) {
+	roles := []string{}
+	for _, role := range u.Roles {
+		if len(scope) == 0 || slices.Contains(scope, ROLE_SCOPE_PREFIX+string(role)) {
+			roles = append(roles, string(role))
+		}
+	}
+
+	permissions := []string{}
+	for _, permission := range u.Permissions {
+		if len(scope) == 0 || slices.Contains(scope, string(permission)) {
+			permissions = append(permissions, string(permission))
+		}
+	}
+	return roles, permissions
+}
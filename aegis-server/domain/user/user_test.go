@@ -1,6 +1,7 @@
 package user
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -450,3 +451,58 @@ func TestRemovePermission_FromMultiple(t *testing.T) {
 		t.Error("Other permissions should remain")
 	}
 }
+
+// TestTokenCutoffs tests that tokens issued before a cutoff are revoked or stale
+func TestTokenCutoffs(t *testing.T) {
+	now := time.Now()
+	cutoffs := TokenCutoffs{ValidAfter: &now}
+	
+	if !cutoffs.IsRevoked(now.Add(-time.Second)) {
+		t.Error("Token issued before the cutoff should be revoked")
+	}
+	if cutoffs.IsRevoked(now) {
+		t.Error("Token issued at the cutoff should not be revoked")
+	}
+	if cutoffs.IsStale(now.Add(-time.Second)) {
+		t.Error("Token should not be stale without a stale cutoff")
+	}
+	
+	cutoffs.StaleBefore = &now
+	if !cutoffs.IsStale(now.Add(-time.Second)) {
+		t.Error("Token issued before the stale cutoff should be stale")
+	}
+}
+
+// TestGrants tests that grants are narrowed to the requested roles and permissions the user holds
+func TestGrants(t *testing.T) {
+	user := CreateUser("test@example.com", "password", "admin")
+	user.AddRole(UserRole("admin"), "system")
+	user.AddRole(UserRole("user"), "system")
+	user.AddPermission(Permission("read:invoices"), "system")
+	user.AddPermission(Permission("write:invoices"), "system")
+
+	tests := []struct {
+		name                string
+		scope               []string
+		expectedRoles       []string
+		expectedPermissions []string
+	}{
+		{"no scope", nil, []string{"admin", "user"}, []string{"read:invoices", "write:invoices"}},
+		{"role and permission", []string{"role:user", "read:invoices"}, []string{"user"}, []string{"read:invoices"}},
+		{"permission only", []string{"write:invoices"}, []string{}, []string{"write:invoices"}},
+		{"not held", []string{"role:auditor", "delete:invoices"}, []string{}, []string{}},
+		{"role name without prefix", []string{"admin"}, []string{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, permissions := user.Grants(tt.scope)
+			if !reflect.DeepEqual(roles, tt.expectedRoles) {
+				t.Errorf("Expected roles %v, got %v", tt.expectedRoles, roles)
+			}
+			if !reflect.DeepEqual(permissions, tt.expectedPermissions) {
+				t.Errorf("Expected permissions %v, got %v", tt.expectedPermissions, permissions)
+			}
+		})
+	}
+}
@@ -5,6 +5,13 @@ import (
 	"time"
 	migrations "nfcunha/aegis/database"
 	api "nfcunha/aegis/api"
+	"nfcunha/aegis/domain/authcode"
+	"nfcunha/aegis/domain/devicecode"
+	"nfcunha/aegis/domain/impersonation"
+	"nfcunha/aegis/domain/keyring"
+	"nfcunha/aegis/domain/reference"
+	"nfcunha/aegis/domain/refresh"
+	"nfcunha/aegis/domain/session"
 	"nfcunha/aegis/domain/token"
 )
 
@@ -12,10 +19,62 @@ func main() {
 	// Initialize database and run migrations
 	migrations.Migrate()
 	
+	// Load the persisted signing keyring, storing the configured key on first start
+	if err := keyring.Initialize(); err != nil {
+		log.Fatal("Failed to initialize signing keyring:", err)
+	}
+	
+	// Start background job for signing key maintenance
+	// Runs every hour to retire keys past their overlap window and rotate the active key when due
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			log.Println("Running signing key maintenance job")
+			keyring.RunScheduledMaintenance()
+		}
+	}()
+	
 	// Initialize the token blacklist system
-	blacklist := token.NewMemoryBlacklist()
+	// Revocations are persisted in the database unless the in-memory store is selected
+	var blacklist token.Blacklist
+	switch token.BLACKLIST_STORE {
+	case token.STORE_MEMORY:
+		blacklist = token.NewMemoryBlacklist()
+	default:
+		blacklist = token.NewDatabaseBlacklist()
+		if token.BLACKLIST_CACHE_TTL > 0 {
+			blacklist = token.NewCachedBlacklist(blacklist, token.BLACKLIST_CACHE_TTL)
+			log.Printf("Token blacklist cache enabled (TTL: %v)", token.BLACKLIST_CACHE_TTL)
+		}
+	}
+	
+	// Share revocations with other instances, so a token revoked on one replica is rejected by all
+	if token.BLACKLIST_REPLICATION == token.REPLICATION_DATABASE {
+		replicated := token.NewReplicatedBlacklist(blacklist, token.NewDatabaseTransport())
+		if _, err := replicated.Sync(); err != nil {
+			log.Println("Initial blacklist sync failed:", err)
+		}
+		blacklist = replicated
+		
+		// Start background job fetching revocations made by other instances
+		go func() {
+			ticker := time.NewTicker(token.BLACKLIST_SYNC_INTERVAL)
+			defer ticker.Stop()
+			
+			for range ticker.C {
+				if applied, err := replicated.Sync(); err != nil {
+					log.Println("Blacklist sync failed:", err)
+				} else if applied > 0 {
+					log.Printf("Blacklist sync applied %d revocations from other instances", applied)
+				}
+			}
+		}()
+		log.Printf("Token blacklist replication enabled (transport: %s, interval: %v)", token.BLACKLIST_REPLICATION, token.BLACKLIST_SYNC_INTERVAL)
+	}
 	token.InitializeBlacklist(blacklist)
-	log.Println("Token blacklist system initialized")
+	log.Printf("Token blacklist system initialized (store: %s)", token.BLACKLIST_STORE)
 	
 	// Start background cleanup job for expired blacklist entries
 	// Runs every hour to remove tokens that have naturally expired
@@ -30,6 +89,91 @@ func main() {
 		}
 	}()
 	
+	// Start background cleanup job for used DPoP proofs
+	// Runs every minute; proofs are only accepted for a short time after they are created
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			if removed := token.DPoPReplayCache.Cleanup(); removed > 0 {
+				log.Printf("DPoP replay cache cleanup removed %d proofs. Current size: %d entries", removed, token.DPoPReplayCache.Size())
+			}
+		}
+	}()
+	
+	// Start background cleanup job for expired authorization codes
+	// Runs every hour; codes are single-use and only valid for a minute
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			log.Println("Running authorization code cleanup job")
+			if err := authcode.DeleteExpiredAuthorizationCodes(); err != nil {
+				log.Println("Authorization code cleanup failed:", err)
+			}
+		}
+	}()
+	
+	// Start background cleanup job for expired device authorization requests
+	// Runs every hour; requests expire after 10 minutes
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			log.Println("Running device authorization cleanup job")
+			if err := devicecode.DeleteExpiredDeviceAuthorizations(); err != nil {
+				log.Println("Device authorization cleanup failed:", err)
+			}
+		}
+	}()
+	
+	// Start background cleanup job for expired refresh tokens and the sessions they ended
+	// Runs every hour; rotated tokens are kept until they expire to detect reuse
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			log.Println("Running refresh token cleanup job")
+			if err := refresh.DeleteExpiredRefreshTokens(); err != nil {
+				log.Println("Refresh token cleanup failed:", err)
+			}
+			if err := session.DeleteEndedSessions(); err != nil {
+				log.Println("Session cleanup failed:", err)
+			}
+		}
+	}()
+	
+	// Start background cleanup job for expired reference tokens
+	// Runs every hour; expired handles no longer resolve and are only kept until then
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			log.Println("Running reference token cleanup job")
+			if err := reference.DeleteExpiredReferenceTokens(); err != nil {
+				log.Println("Reference token cleanup failed:", err)
+			}
+		}
+	}()
+	
+	// Start background job recording the end of expired impersonation sessions
+	// Runs every minute; impersonation tokens are short-lived
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		
+		for range ticker.C {
+			if err := impersonation.EndExpiredSessions(); err != nil {
+				log.Println("Impersonation session expiry failed:", err)
+			}
+		}
+	}()
+	
 	// Start the API server
 	api.RegisterApis()
 }
\ No newline at end of file
@@ -0,0 +1,262 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var CLAIM_MAPPINGS = getClaimMappings()
+var CLAIM_MAX_SIZE = getClaimMaxSize()
+
+// ClaimMapping copies a user attribute (a key of the user's additional info) into tokens
+// under the given claim name.
+type ClaimMapping struct {
+	Attribute string `json:"attribute"`
+	Claim     string `json:"claim"`
+}
+
+// reservedClaims holds the names of the claims Aegis sets itself, which custom claims may not replace.
+var reservedClaims = claimNames(TokenClaims{}, IdTokenClaims{})
+
+// IsReservedClaim reports whether a claim name is used by Aegis itself and cannot be mapped.
+//
+// Parameters:
+//   - name: The claim name
+//
+// Returns:
+//   - true if the claim is reserved, false otherwise
+func IsReservedClaim(name string) bool {
+	return reservedClaims[name]
+}
+
+// ParseClaimMappings parses a comma-separated list of claim mappings. Each entry is either an
+// attribute name, copied under the same claim name, or "attribute:claim" to rename it,
+// e.g. "department,tenant_id:tenant".
+//
+// Parameters:
+//   - value: The list of mappings
+//
+// Returns:
+//   - The parsed mappings
+//   - Error if an entry is malformed or maps to a reserved claim
+func ParseClaimMappings(value string) ([]ClaimMapping, error) {
+	mappings := []ClaimMapping{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		attribute, claim, renamed := strings.Cut(entry, ":")
+		if !renamed {
+			claim = attribute
+		}
+		mapping := ClaimMapping{Attribute: strings.TrimSpace(attribute), Claim: strings.TrimSpace(claim)}
+		if err := mapping.Validate(); err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// Validate checks that a mapping names an attribute and a claim Aegis does not set itself.
+//
+// Returns:
+//   - Error describing the problem, nil if the mapping is valid
+func (m ClaimMapping) Validate() error {
+	if m.Attribute == "" || m.Claim == "" {
+		return fmt.Errorf("invalid claim mapping '%s:%s': attribute and claim are required", m.Attribute, m.Claim)
+	}
+	if IsReservedClaim(m.Claim) {
+		return fmt.Errorf("invalid claim mapping for %s: claim '%s' is reserved", m.Attribute, m.Claim)
+	}
+	return nil
+}
+
+// MapClaims builds the custom claims of a user's tokens from their attributes.
+// Attributes the user does not have are left out. Claims are added in mapping order while
+// their encoded size stays within CLAIM_MAX_SIZE bytes; claims that do not fit are dropped
+// with a warning, so a large attribute never makes a token unusable.
+//
+// Parameters:
+//   - attributes: The user's additional info
+//   - mappings: The claim mappings to apply
+//
+// Returns:
+//   - The custom claims, or nil if none apply
+func MapClaims(attributes map[string]interface{}, mappings []ClaimMapping) map[string]interface{} {
+	var claims map[string]interface{}
+	size := 0
+	for _, mapping := range mappings {
+		value, exists := attributes[mapping.Attribute]
+		if !exists || value == nil || IsReservedClaim(mapping.Claim) {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			log.Printf("Warning: attribute %s cannot be encoded as a claim: %v", mapping.Attribute, err)
+			continue
+		}
+		// Each claim adds its quoted name, a colon and a separating comma
+		claimSize := len(encoded) + len(mapping.Claim) + 4
+		if size+claimSize > CLAIM_MAX_SIZE {
+			log.Printf("Warning: claim %s dropped, custom claims would exceed %d bytes", mapping.Claim, CLAIM_MAX_SIZE)
+			continue
+		}
+		if claims == nil {
+			claims = make(map[string]interface{})
+		}
+		claims[mapping.Claim] = value
+		size += claimSize
+	}
+	return claims
+}
+
+// MarshalWithClaims encodes a value as a JSON object with custom claims added as top-level
+// members. Members of the value take precedence over custom claims with the same name.
+//
+// Parameters:
+//   - value: The value to encode, which must encode as a JSON object
+//   - custom: The custom claims to add, may be nil
+//
+// Returns:
+//   - The encoded JSON object
+//   - Error if encoding fails
+func MarshalWithClaims(value interface{}, custom map[string]interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil || len(custom) == 0 {
+		return encoded, err
+	}
+	members := map[string]interface{}{}
+	for name, claim := range custom {
+		members[name] = claim
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for name, field := range fields {
+		members[name] = field
+	}
+	return json.Marshal(members)
+}
+
+// MarshalJSON encodes the claims with the custom claims as top-level claims.
+func (c TokenClaims) MarshalJSON() ([]byte, error) {
+	type tokenClaims TokenClaims
+	return MarshalWithClaims(tokenClaims(c), c.Custom)
+}
+
+// UnmarshalJSON decodes the claims, collecting claims Aegis does not set itself into Custom.
+func (c *TokenClaims) UnmarshalJSON(data []byte) error {
+	type tokenClaims TokenClaims
+	if err := json.Unmarshal(data, (*tokenClaims)(c)); err != nil {
+		return err
+	}
+	custom, err := unknownClaims(data)
+	c.Custom = custom
+	return err
+}
+
+// MarshalJSON encodes the claims with the custom claims as top-level claims.
+func (c IdTokenClaims) MarshalJSON() ([]byte, error) {
+	type idTokenClaims IdTokenClaims
+	return MarshalWithClaims(idTokenClaims(c), c.Custom)
+}
+
+// UnmarshalJSON decodes the claims, collecting claims Aegis does not set itself into Custom.
+func (c *IdTokenClaims) UnmarshalJSON(data []byte) error {
+	type idTokenClaims IdTokenClaims
+	if err := json.Unmarshal(data, (*idTokenClaims)(c)); err != nil {
+		return err
+	}
+	custom, err := unknownClaims(data)
+	c.Custom = custom
+	return err
+}
+
+// unknownClaims returns the members of an encoded claims object that are not reserved claims.
+func unknownClaims(data []byte) (map[string]interface{}, error) {
+	var members map[string]interface{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	var custom map[string]interface{}
+	for name, value := range members {
+		if reservedClaims[name] {
+			continue
+		}
+		if custom == nil {
+			custom = make(map[string]interface{})
+		}
+		custom[name] = value
+	}
+	return custom, nil
+}
+
+// claimNames collects the JSON member names of the fields of claim structs, including
+// those of embedded structs such as jwt.RegisteredClaims.
+func claimNames(values ...interface{}) map[string]bool {
+	names := map[string]bool{}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if field.Anonymous && tag == "" {
+				collect(field.Type)
+				continue
+			}
+			if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+				names[name] = true
+			}
+		}
+	}
+	for _, value := range values {
+		collect(reflect.TypeOf(value))
+	}
+	return names
+}
+
+// getClaimMappings retrieves the claim mappings applied to user tokens from the
+// AEGIS_CLAIM_MAPPINGS environment variable, e.g. "department,tenant_id:tenant,employee_id:emp_id".
+// Clients can override them with their own mappings. Defaults to no custom claims.
+//
+// Returns:
+//   - The claim mappings
+func getClaimMappings() []ClaimMapping {
+	const CLAIM_MAPPINGS_ENV = "AEGIS_CLAIM_MAPPINGS"
+	value := os.Getenv(CLAIM_MAPPINGS_ENV)
+	if value == "" {
+		return []ClaimMapping{}
+	}
+	mappings, err := ParseClaimMappings(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s value '%s', using no claim mappings: %v", CLAIM_MAPPINGS_ENV, value, err)
+		return []ClaimMapping{}
+	}
+	log.Printf("Mapping user attributes to claims: %s", value)
+	return mappings
+}
+
+// getClaimMaxSize retrieves the maximum encoded size of the custom claims of a token from the
+// AEGIS_CLAIM_MAX_SIZE environment variable, in bytes. Defaults to 1024 bytes.
+//
+// Returns:
+//   - Maximum size in bytes
+func getClaimMaxSize() int {
+	const CLAIM_MAX_SIZE_ENV = "AEGIS_CLAIM_MAX_SIZE"
+	const DEFAULT_CLAIM_MAX_SIZE = 1024
+	if sizeStr := os.Getenv(CLAIM_MAX_SIZE_ENV); sizeStr != "" {
+		if size, err := strconv.Atoi(sizeStr); err == nil && size >= 0 {
+			return size
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d bytes", CLAIM_MAX_SIZE_ENV, sizeStr, DEFAULT_CLAIM_MAX_SIZE)
+	}
+	return DEFAULT_CLAIM_MAX_SIZE
+}
@@ -0,0 +1,111 @@
+package jwt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"github.com/google/uuid"
+)
+
+// TestParseClaimMappings tests parsing of plain and renamed mappings
+func TestParseClaimMappings(t *testing.T) {
+	mappings, err := ParseClaimMappings("department, tenant_id:tenant,,employee_id:emp_id")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []ClaimMapping{
+		{Attribute: "department", Claim: "department"},
+		{Attribute: "tenant_id", Claim: "tenant"},
+		{Attribute: "employee_id", Claim: "emp_id"},
+	}
+	if len(mappings) != len(expected) {
+		t.Fatalf("Expected %d mappings, got %v", len(expected), mappings)
+	}
+	for i := range expected {
+		if mappings[i] != expected[i] {
+			t.Errorf("Expected mapping %v, got %v", expected[i], mappings[i])
+		}
+	}
+}
+
+// TestParseClaimMappings_Reserved tests that attributes cannot replace claims Aegis sets itself
+func TestParseClaimMappings_Reserved(t *testing.T) {
+	for _, value := range []string{"sub", "tenant:roles", "level:exp", "nonce", "tenant:"} {
+		if _, err := ParseClaimMappings(value); err == nil {
+			t.Errorf("Expected mapping %q to be rejected", value)
+		}
+	}
+}
+
+// TestMapClaims tests copying and renaming of attributes, skipping missing ones
+func TestMapClaims(t *testing.T) {
+	attributes := map[string]interface{}{"department": "sales", "tenant_id": "acme", "internal": "secret"}
+	mappings := []ClaimMapping{
+		{Attribute: "department", Claim: "department"},
+		{Attribute: "tenant_id", Claim: "tenant"},
+		{Attribute: "employee_id", Claim: "emp_id"},
+	}
+
+	claims := MapClaims(attributes, mappings)
+	if len(claims) != 2 || claims["department"] != "sales" || claims["tenant"] != "acme" {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+	if MapClaims(attributes, nil) != nil {
+		t.Error("Expected no claims without mappings")
+	}
+}
+
+// TestMapClaims_SizeLimit tests that claims exceeding the size limit are dropped
+func TestMapClaims_SizeLimit(t *testing.T) {
+	original := CLAIM_MAX_SIZE
+	CLAIM_MAX_SIZE = 64
+	defer func() { CLAIM_MAX_SIZE = original }()
+
+	attributes := map[string]interface{}{"tenant": "acme", "bio": strings.Repeat("x", 100), "team": "core"}
+	mappings := []ClaimMapping{{"tenant", "tenant"}, {"bio", "bio"}, {"team", "team"}}
+
+	claims := MapClaims(attributes, mappings)
+	if _, exists := claims["bio"]; exists {
+		t.Error("Expected oversized claim to be dropped")
+	}
+	if claims["tenant"] != "acme" || claims["team"] != "core" {
+		t.Errorf("Expected claims within the limit to be kept, got %v", claims)
+	}
+}
+
+// TestCustomClaims tests that custom claims are top-level claims of access tokens only
+func TestCustomClaims(t *testing.T) {
+	custom := map[string]interface{}{"tenant": "acme", "emp_id": float64(42)}
+	tokenPair, err := GenerateTokenPairWithOptions(uuid.New(), "custom@example.com", []string{}, []string{}, TokenOptions{Claims: custom})
+	if err != nil {
+		t.Fatalf("Failed to generate tokens: %v", err)
+	}
+
+	claims, err := ValidateToken(tokenPair.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.Custom["tenant"] != "acme" || claims.Custom["emp_id"] != float64(42) || len(claims.Custom) != 2 {
+		t.Errorf("Unexpected custom claims %v", claims.Custom)
+	}
+
+	refreshClaims, _ := ValidateToken(tokenPair.RefreshToken)
+	if refreshClaims == nil || refreshClaims.Custom != nil {
+		t.Error("Expected refresh token without custom claims")
+	}
+}
+
+// TestCustomClaims_Encoding tests that reserved claims win over custom claims with the same name
+func TestCustomClaims_Encoding(t *testing.T) {
+	claims := TokenClaims{Subject: "user@example.com", Custom: map[string]interface{}{"subject": "spoofed", "tenant": "acme"}}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to encode claims: %v", err)
+	}
+
+	var members map[string]interface{}
+	json.Unmarshal(encoded, &members)
+	if members["subject"] != "user@example.com" || members["tenant"] != "acme" {
+		t.Errorf("Unexpected encoding %s", encoded)
+	}
+}
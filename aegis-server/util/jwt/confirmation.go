@@ -0,0 +1,35 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+)
+
+// Confirmation holds the key a token is bound to (RFC 7800 "cnf" claim).
+// JKT is the JWK thumbprint of the client's DPoP key (RFC 9449 section 6) and
+// X5tS256 the thumbprint of its TLS client certificate (RFC 8705 section 3.1).
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
+
+// IsEmpty reports whether the confirmation binds the token to nothing.
+//
+// Returns:
+//   - true if neither a DPoP key nor a certificate is set
+func (c *Confirmation) IsEmpty() bool {
+	return c == nil || (c.JKT == "" && c.X5tS256 == "")
+}
+
+// CertificateThumbprint computes the "x5t#S256" thumbprint of a certificate: the
+// base64url-encoded SHA-256 hash of its DER encoding.
+//
+// Parameters:
+//   - cert: The client certificate
+//
+// Returns:
+//   - The base64url-encoded thumbprint
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return encodeSegment(sum[:])
+}
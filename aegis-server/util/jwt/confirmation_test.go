@@ -0,0 +1,29 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+)
+
+// TestCertificateThumbprint tests the RFC 8705 "x5t#S256" thumbprint of a certificate
+func TestCertificateThumbprint(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("certificate DER bytes")}
+	sum := sha256.Sum256(cert.Raw)
+
+	if thumbprint := CertificateThumbprint(cert); thumbprint != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected thumbprint %s", thumbprint)
+	}
+}
+
+// TestConfirmationIsEmpty tests detection of tokens bound to nothing
+func TestConfirmationIsEmpty(t *testing.T) {
+	var missing *Confirmation
+	if !missing.IsEmpty() || !(&Confirmation{}).IsEmpty() {
+		t.Error("Expected nil and zero confirmations to be empty")
+	}
+	if (&Confirmation{JKT: "key"}).IsEmpty() || (&Confirmation{X5tS256: "cert"}).IsEmpty() {
+		t.Error("Expected confirmations with a key or certificate not to be empty")
+	}
+}
@@ -0,0 +1,146 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPOP_PROOF_TYPE is the "typ" header every DPoP proof must carry (RFC 9449 section 4.2).
+const DPOP_PROOF_TYPE = "dpop+jwt"
+
+var DPOP_PROOF_LIFETIME = getDPoPProofLifetime()
+
+// ErrInvalidDPoPProof is returned by ParseDPoPProof for proofs that are malformed, badly signed,
+// outdated or not made for the request they were sent with.
+var ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+// DPOP_SIGNING_ALGORITHMS lists the asymmetric algorithms accepted for DPoP proofs.
+var DPOP_SIGNING_ALGORITHMS = []string{"RS256", "PS256", "ES256", "EdDSA"}
+
+// DPoPClaims represents the claims of a DPoP proof JWT (RFC 9449 section 4.2).
+type DPoPClaims struct {
+	Htm string `json:"htm"`
+	Htu string `json:"htu"`
+	Ath string `json:"ath,omitempty"` // Hash of the access token the proof is sent with
+	jwt.RegisteredClaims
+}
+
+// DPoPProof is a verified DPoP proof.
+type DPoPProof struct {
+	JKT       string    // Thumbprint of the key that signed the proof
+	JTI       string    // Unique identifier of the proof, for replay detection
+	ExpiresAt time.Time // When the proof is no longer accepted and can be forgotten
+}
+
+// ParseDPoPProof verifies a DPoP proof: its type, its signature with the public key of its "jwk"
+// header, its age, and that it was made for the HTTP method and URL of the request. When the
+// proof is sent with an access token, its "ath" claim must hash that token. Replay detection is
+// left to the caller, using the returned JTI.
+//
+// Parameters:
+//   - proof: The DPoP header value
+//   - method: The HTTP method of the request
+//   - requestUrl: The URL of the request; the query and fragment are ignored
+//   - accessToken: The access token sent with the proof, or empty at the token endpoints
+//
+// Returns:
+//   - The verified proof, with the thumbprint of its key
+//   - Error wrapping ErrInvalidDPoPProof if the proof is not acceptable
+func ParseDPoPProof(proof string, method string, requestUrl string, accessToken string) (*DPoPProof, error) {
+	var key *JWK
+	claims := &DPoPClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, DPOP_PROOF_TYPE) {
+			return nil, errors.New("unexpected proof type")
+		}
+		raw, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		if _, private := raw["d"]; private {
+			return nil, errors.New("jwk header contains a private key")
+		}
+		encoded, _ := json.Marshal(raw)
+		key = &JWK{}
+		if err := json.Unmarshal(encoded, key); err != nil {
+			return nil, errors.New("malformed jwk header")
+		}
+		return key.PublicKey()
+	}, jwt.WithValidMethods(DPOP_SIGNING_ALGORITHMS))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing jti or iat", ErrInvalidDPoPProof)
+	}
+	issuedAt := claims.IssuedAt.Time
+	if age := time.Since(issuedAt); age > DPOP_PROOF_LIFETIME || age < -DPOP_PROOF_LIFETIME {
+		return nil, fmt.Errorf("%w: proof issued at %v is outside the accepted window", ErrInvalidDPoPProof, issuedAt)
+	}
+	if claims.Htm != method {
+		return nil, fmt.Errorf("%w: htm %q does not match %s", ErrInvalidDPoPProof, claims.Htm, method)
+	}
+	if normalizeHtu(claims.Htu) == "" || normalizeHtu(claims.Htu) != normalizeHtu(requestUrl) {
+		return nil, fmt.Errorf("%w: htu %q does not match %s", ErrInvalidDPoPProof, claims.Htu, requestUrl)
+	}
+	if accessToken != "" && claims.Ath != AccessTokenHash(accessToken) {
+		return nil, fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+	}
+
+	return &DPoPProof{
+		JKT:       key.Thumbprint(),
+		JTI:       claims.ID,
+		ExpiresAt: issuedAt.Add(DPOP_PROOF_LIFETIME),
+	}, nil
+}
+
+// AccessTokenHash computes the "ath" claim of a DPoP proof: the base64url-encoded
+// SHA-256 hash of the access token.
+//
+// Parameters:
+//   - accessToken: The access token, as sent in the Authorization header
+//
+// Returns:
+//   - The base64url-encoded hash
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return encodeSegment(sum[:])
+}
+
+// normalizeHtu reduces a URL to the parts compared for the "htu" claim: the scheme and host
+// in lower case, and the path. Returns an empty string for URLs that are not absolute.
+func normalizeHtu(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme) + "://" + strings.ToLower(parsed.Host) + parsed.EscapedPath()
+}
+
+// getDPoPProofLifetime retrieves how far the "iat" claim of a DPoP proof may be from the
+// current time from the AEGIS_DPOP_PROOF_LIFETIME environment variable, in seconds.
+// Defaults to 60 seconds.
+//
+// Returns:
+//   - Proof lifetime duration
+func getDPoPProofLifetime() time.Duration {
+	const DPOP_PROOF_LIFETIME_ENV = "AEGIS_DPOP_PROOF_LIFETIME"
+	const DEFAULT_PROOF_LIFETIME_SECONDS = 60
+	if lifetimeStr := os.Getenv(DPOP_PROOF_LIFETIME_ENV); lifetimeStr != "" {
+		if seconds, err := strconv.Atoi(lifetimeStr); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("Warning: invalid %s value '%s', using default %d seconds", DPOP_PROOF_LIFETIME_ENV, lifetimeStr, DEFAULT_PROOF_LIFETIME_SECONDS)
+	}
+	return DEFAULT_PROOF_LIFETIME_SECONDS * time.Second
+}
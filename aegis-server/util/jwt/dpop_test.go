@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const testHtu = "https://auth.example.com/aegis/api/auth/validate"
+
+// signTestProof signs DPoP proof claims with an ES256 key, embedding its public JWK
+func signTestProof(t *testing.T, key *ecdsa.PrivateKey, claims DPoPClaims, header map[string]interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	jwk, _ := PublicJWK(&key.PublicKey)
+	token.Header["typ"] = DPOP_PROOF_TYPE
+	token.Header["jwk"] = jwk
+	for name, value := range header {
+		token.Header[name] = value
+	}
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign proof: %v", err)
+	}
+	return proof
+}
+
+// testProofClaims returns the claims of a fresh proof for a POST to testHtu
+func testProofClaims(accessToken string) DPoPClaims {
+	claims := DPoPClaims{
+		Htm: "POST",
+		Htu: testHtu,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.New().String(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if accessToken != "" {
+		claims.Ath = AccessTokenHash(accessToken)
+	}
+	return claims
+}
+
+// TestParseDPoPProof tests that a valid proof yields the thumbprint of its key
+func TestParseDPoPProof(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := PublicJWK(&key.PublicKey)
+	claims := testProofClaims("access-token")
+
+	proof, err := ParseDPoPProof(signTestProof(t, key, claims, nil), "POST", testHtu+"?debug=true", "access-token")
+	if err != nil {
+		t.Fatalf("ParseDPoPProof failed: %v", err)
+	}
+	if proof.JKT != jwk.Thumbprint() {
+		t.Errorf("Expected jkt %s, got %s", jwk.Thumbprint(), proof.JKT)
+	}
+	if proof.JTI != claims.ID {
+		t.Errorf("Expected jti %s, got %s", claims.ID, proof.JTI)
+	}
+}
+
+// TestParseDPoPProof_Invalid tests that proofs not made for the request are rejected
+func TestParseDPoPProof_Invalid(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	old := testProofClaims("")
+	old.IssuedAt = jwt.NewNumericDate(time.Now().Add(-DPOP_PROOF_LIFETIME - time.Minute))
+	noJti := testProofClaims("")
+	noJti.ID = ""
+	otherMethod := testProofClaims("")
+	otherMethod.Htm = "GET"
+	otherUrl := testProofClaims("")
+	otherUrl.Htu = "https://evil.example.com/aegis/api/auth/validate"
+
+	cases := []struct {
+		name        string
+		proof       string
+		accessToken string
+	}{
+		{"not a JWT", "not-a-proof", ""},
+		{"wrong type", signTestProof(t, key, testProofClaims(""), map[string]interface{}{"typ": "JWT"}), ""},
+		{"missing jwk", signTestProof(t, key, testProofClaims(""), map[string]interface{}{"jwk": nil}), ""},
+		{"private key in jwk", signTestProof(t, key, testProofClaims(""), map[string]interface{}{"jwk": map[string]interface{}{"kty": "EC", "d": "secret"}}), ""},
+		{"outdated", signTestProof(t, key, old, nil), ""},
+		{"missing jti", signTestProof(t, key, noJti, nil), ""},
+		{"other method", signTestProof(t, key, otherMethod, nil), ""},
+		{"other URL", signTestProof(t, key, otherUrl, nil), ""},
+		{"missing ath", signTestProof(t, key, testProofClaims(""), nil), "access-token"},
+		{"other access token", signTestProof(t, key, testProofClaims("other-token"), nil), "access-token"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseDPoPProof(tc.proof, "POST", testHtu, tc.accessToken)
+			if !errors.Is(err, ErrInvalidDPoPProof) {
+				t.Errorf("Expected ErrInvalidDPoPProof, got %v", err)
+			}
+		})
+	}
+}
+
+// TestParseDPoPProof_SymmetricAlgorithm tests that proofs signed with HMAC are rejected
+func TestParseDPoPProof_SymmetricAlgorithm(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testProofClaims(""))
+	token.Header["typ"] = DPOP_PROOF_TYPE
+	token.Header["jwk"] = map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"}
+	proof, _ := token.SignedString([]byte("secret"))
+
+	if _, err := ParseDPoPProof(proof, "POST", testHtu, ""); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Errorf("Expected ErrInvalidDPoPProof, got %v", err)
+	}
+}
+
+// TestJWKPublicKey tests that JWKs convert back into the keys they were built from
+func TestJWKPublicKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, publicKey := range []crypto.PublicKey{&rsaKey.PublicKey, &ecKey.PublicKey, edKey} {
+		jwk, _ := PublicJWK(publicKey)
+		converted, err := jwk.PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey failed for %s: %v", jwk.Kty, err)
+		}
+		if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(converted) {
+			t.Errorf("Expected %s key to round-trip", jwk.Kty)
+		}
+	}
+
+	if _, err := (&JWK{Kty: "oct"}).PublicKey(); err == nil {
+		t.Error("Expected error for symmetric key")
+	}
+}
@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ErrIdTokensUnsupported is returned by GenerateIdToken when the active signing key is an HMAC
+// secret. Relying parties cannot verify ID tokens signed with a secret only Aegis knows.
+var ErrIdTokensUnsupported = errors.New("ID tokens require an asymmetric signing key")
+
+// IdTokenClaims represents the claims of an OpenID Connect ID token (OpenID Connect Core section 2).
+// ID tokens tell the client who logged in; they are not accepted as access tokens.
+type IdTokenClaims struct {
+	PreferredUsername string                 `json:"preferred_username"`
+	Nonce             string                 `json:"nonce,omitempty"`
+	TokenType         string                 `json:"token_type"` // Always "id"
+	Custom            map[string]interface{} `json:"-"`          // Claims mapped from user attributes, encoded as top-level claims
+	jwt.RegisteredClaims
+}
+
+// GenerateIdToken creates an ID token for a user who authenticated through the authorization endpoint.
+// The token is signed with the active key and expires together with the access token.
+// The active key must be asymmetric, see IdTokensSupported.
+//
+// Parameters:
+//   - userId: Unique identifier for the user, used as the "sub" claim
+//   - subject: User's subject, used as the "preferred_username" claim
+//   - clientId: The client the token is issued to, used as the "aud" claim
+//   - nonce: The nonce sent in the authorization request, may be empty
+//   - custom: Claims mapped from the user's attributes, may be nil
+//
+// Returns:
+//   - TokenOutput containing the signed ID token and its expiration time
+//   - ErrIdTokensUnsupported if the active key is not asymmetric, or error if token signing fails
+func GenerateIdToken(userId uuid.UUID, subject string, clientId string, nonce string, custom map[string]interface{}) (*TokenOutput, error) {
+	if !IdTokensSupported() {
+		return nil, ErrIdTokensUnsupported
+	}
+
+	now := time.Now()
+	expirationTime := now.Add(TOKEN_EXPIRATION)
+
+	jti := uuid.New().String()
+	claims := &IdTokenClaims{
+		PreferredUsername: subject,
+		Nonce:             nonce,
+		TokenType:         "id",
+		Custom:            custom,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   userId.String(),
+			Audience:  jwt.ClaimStrings{clientId},
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    ISSUER,
+		},
+	}
+
+	tokenString, err := signClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenOutput{
+		Token:     tokenString,
+		ExpiresAt: expirationTime,
+		Id:        jti,
+	}, nil
+}
+
+// IdTokensSupported reports whether ID tokens can be issued, i.e. whether the active signing key
+// is asymmetric so that relying parties can verify them with the published public key.
+//
+// Returns:
+//   - true if the active key is RS256, ES256 or EdDSA, false for HS256
+func IdTokensSupported() bool {
+	return IsAsymmetric(KEYRING.ActiveKey().Algorithm)
+}
@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// JWK represents a public key in JSON Web Key format (RFC 7517).
+// Only the members needed for RSA, EC P-256 and Ed25519 public keys are included.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS represents a JSON Web Key Set as served by the jwks.json endpoint.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK converts a public key into its JWK representation.
+//
+// Parameters:
+//   - publicKey: *rsa.PublicKey, *ecdsa.PublicKey (P-256) or ed25519.PublicKey
+//
+// Returns:
+//   - The JWK with key type specific members populated
+//   - Error if the key type is not supported
+func PublicJWK(publicKey crypto.PublicKey) (*JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   encodeSegment(key.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 EC keys are supported")
+		}
+		return &JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   encodeSegment(key.X.FillBytes(make([]byte, 32))),
+			Y:   encodeSegment(key.Y.FillBytes(make([]byte, 32))),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encodeSegment(key),
+		}, nil
+	}
+	return nil, errors.New("unsupported public key type")
+}
+
+// PublicKey converts the JWK back into a public key, the inverse of PublicJWK.
+//
+// Returns:
+//   - *rsa.PublicKey, *ecdsa.PublicKey (P-256) or ed25519.PublicKey
+//   - Error if the key type is not supported or a member is malformed
+func (j *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case j.Kty == "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("malformed RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("malformed EC key")
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, errors.New("malformed EC key")
+		}
+		return key, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("malformed Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// Thumbprint computes the RFC 7638 JWK thumbprint (base64url-encoded SHA-256)
+// over the required members of the key, in lexicographic order.
+//
+// Returns:
+//   - The base64url-encoded thumbprint
+func (j *JWK) Thumbprint() string {
+	var canonical string
+	switch j.Kty {
+	case "RSA":
+		canonical = `{"e":"` + j.E + `","kty":"RSA","n":"` + j.N + `"}`
+	case "EC":
+		canonical = `{"crv":"` + j.Crv + `","kty":"EC","x":"` + j.X + `","y":"` + j.Y + `"}`
+	case "OKP":
+		canonical = `{"crv":"` + j.Crv + `","kty":"OKP","x":"` + j.X + `"}`
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return encodeSegment(sum[:])
+}
+
+// PublicJWKS returns the key set that verifiers need to check Aegis tokens offline.
+// Includes the active key and every key still accepted for verification, so verifiers
+// keep accepting tokens across a rotation. HMAC keys are never published.
+//
+// Returns:
+//   - JWKS containing the public signing keys, if any
+func PublicJWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range KEYRING.Keys() {
+		if jwk := signingKeyJWK(key); jwk != nil {
+			jwks.Keys = append(jwks.Keys, *jwk)
+		}
+	}
+	return jwks
+}
+
+// signingKeyJWK builds the published JWK for a signing key, or nil for HMAC keys.
+func signingKeyJWK(key *SigningKey) *JWK {
+	if key == nil || !IsAsymmetric(key.Algorithm) {
+		return nil
+	}
+	jwk, err := PublicJWK(key.PublicKey)
+	if err != nil {
+		return nil
+	}
+	jwk.Use = "sig"
+	jwk.Alg = key.Algorithm
+	jwk.Kid = key.Kid
+	return jwk
+}
+
+// encodeSegment encodes bytes as unpadded base64url, as required by JOSE.
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
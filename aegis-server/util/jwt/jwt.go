@@ -1,5 +1,6 @@
-// Package jwt provides utilities for generating and validating JSON Web Tokens (JWT)
-// with HMAC-SHA256 signing. Tokens include user identity, roles, and permissions.
+// Package jwt provides utilities for generating and validating JSON Web Tokens (JWT).
+// Tokens are signed with HMAC-SHA256 by default, or with RS256, ES256 or EdDSA when an
+// asymmetric algorithm is configured. Tokens include user identity, roles, and permissions.
 package jwt
 
 import (
@@ -9,6 +10,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -16,33 +18,85 @@ import (
 
 var JWT_SECRET = getJwtSecret()
 var TOKEN_EXPIRATION = getTokenExpiration()
+var ISSUER = getIssuer()
 const REFRESH_TOKEN_EXTRA_TIME = 1 * time.Minute
 
 // TokenClaims represents the JWT claims structure containing user identity and authorization data.
 // It embeds jwt.RegisteredClaims for standard JWT fields like expiration and issuer.
 // The JTI (JWT ID) field provides a unique identifier for each token, enabling token revocation.
 type TokenClaims struct {
-	UserId      string   `json:"user_id"`
-	Subject     string   `json:"subject"`
-	Roles       []string `json:"roles"`
-	Permissions []string `json:"permissions"`
-	TokenType   string   `json:"token_type"` // "access" or "refresh"
+	UserId       string                 `json:"user_id"`
+	Subject      string                 `json:"subject"`
+	Roles        []string               `json:"roles"`
+	Permissions  []string               `json:"permissions"`
+	TokenType    string                 `json:"token_type"`             // "access" or "refresh"
+	ClientId     string                 `json:"client_id,omitempty"`    // OAuth client the token was issued to, if any
+	AuthzVersion int                    `json:"authz_ver,omitempty"`    // User's authorization version when the roles and permissions were captured
+	Actor        *Actor                 `json:"act,omitempty"`          // Party acting on behalf of the subject, for exchanged and impersonation tokens
+	Impersonated bool                   `json:"impersonated,omitempty"` // Issued to an administrator impersonating the subject
+	Scope        string                 `json:"scope,omitempty"`        // Space-delimited scope the grants were narrowed to, if any
+	Confirmation *Confirmation          `json:"cnf,omitempty"`          // Key the token is bound to, for DPoP-bound tokens
+	SessionId    string                 `json:"sid,omitempty"`          // Login session the token was issued in, if any
+	IssuedAtUs   int64                  `json:"iat_us,omitempty"`       // Issue time in Unix microseconds, compared against the user's token cutoffs
+	Custom       map[string]interface{} `json:"-"`                      // Claims mapped from user attributes, encoded as top-level claims
 	jwt.RegisteredClaims
 }
 
+// IssuedAtTime returns when the token was issued, with microsecond precision when the token
+// carries an "iat_us" claim and otherwise at the start of the second of its "iat" claim.
+//
+// Returns:
+//   - The issue time, or the zero time if the token has no issue time
+func (c *TokenClaims) IssuedAtTime() time.Time {
+	if c.IssuedAtUs != 0 {
+		return time.UnixMicro(c.IssuedAtUs)
+	}
+	if c.IssuedAt != nil {
+		return c.IssuedAt.Time
+	}
+	return time.Time{}
+}
+
+// Actor identifies the party a token was delegated to (RFC 8693 section 4.1).
+// A nested actor records an earlier delegation in the chain.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// TokenOptions customizes tokens issued to a registered OAuth client.
+// Zero values leave the corresponding claims out and let the server defaults apply.
+type TokenOptions struct {
+	ClientId             string
+	AccessTokenLifetime  time.Duration
+	RefreshTokenLifetime time.Duration
+	AuthzVersion         int                    // User's authorization version, stamped into the "authz_ver" claim
+	Audience             []string               // Services the token is meant for ("aud" claim)
+	Actor                *Actor                 // Party the token is delegated to ("act" claim)
+	Impersonated         bool                   // Issued to an administrator acting as the user
+	Scope                []string               // Scope the grants were narrowed to, so refreshed tokens can never be wider
+	Confirmation         *Confirmation          // Key the tokens are bound to, for DPoP and mTLS
+	Claims               map[string]interface{} // Custom claims mapped from user attributes; only access tokens carry them
+	SessionId            string                 // Login session the tokens were issued in ("sid" claim)
+}
+
 // TokenOutput represents the result of token generation, containing the signed token
 // string and its expiration timestamp.
 type TokenOutput struct {
 	Token     string    `json:"token"`
 	ExpiresAt time.Time `json:"expires_at"`
+	Id        string    `json:"-"` // JTI of the token
 }
 
 // TokenPair represents both access and refresh tokens returned during authentication.
+// The token IDs are kept server-side to track refresh token rotation and are never serialized.
 type TokenPair struct {
 	AccessToken  string    `json:"access_token"`
 	RefreshToken string    `json:"refresh_token"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	AccessTokenId    string    `json:"-"`
+	RefreshTokenId   string    `json:"-"`
 }
 
 // GenerateTokenPair creates both an access token and a refresh token.
@@ -58,17 +112,56 @@ type TokenPair struct {
 //   - TokenPair containing both access and refresh tokens with their expiration times
 //   - Error if token signing fails
 func GenerateTokenPair(userId uuid.UUID, subject string, roles []string, permissions []string) (*TokenPair, error) {
-	accessExpiration := time.Now().Add(TOKEN_EXPIRATION)
-	refreshExpiration := time.Now().Add(TOKEN_EXPIRATION + REFRESH_TOKEN_EXTRA_TIME)
+	return GenerateTokenPairWithOptions(userId, subject, roles, permissions, TokenOptions{})
+}
+
+// TokenLifetimes returns the lifetimes of the access and refresh tokens issued with the given
+// options. Without a refresh lifetime override, the refresh token outlives the access token by
+// REFRESH_TOKEN_EXTRA_TIME.
+//
+// Parameters:
+//   - options: The lifetime overrides of the requesting client
+//
+// Returns:
+//   - The access token lifetime
+//   - The refresh token lifetime
+func TokenLifetimes(options TokenOptions) (time.Duration, time.Duration) {
+	accessLifetime := TOKEN_EXPIRATION
+	if options.AccessTokenLifetime > 0 {
+		accessLifetime = options.AccessTokenLifetime
+	}
+	refreshLifetime := accessLifetime + REFRESH_TOKEN_EXTRA_TIME
+	if options.RefreshTokenLifetime > 0 {
+		refreshLifetime = options.RefreshTokenLifetime
+	}
+	return accessLifetime, refreshLifetime
+}
+
+// GenerateTokenPairWithOptions creates an access token and a refresh token for a user,
+// applying the client ID and lifetime overrides of the requesting client.
+// Without a refresh lifetime override, the refresh token expires 1 minute after the access token.
+//
+// Parameters:
+//   - userId: Unique identifier for the user
+//   - subject: User's subject (typically email or username)
+//   - roles: List of roles assigned to the user
+//   - permissions: List of permissions granted to the user
+//   - options: Client ID and lifetime overrides
+//
+// Returns:
+//   - TokenPair containing both access and refresh tokens with their expiration times
+//   - Error if token signing fails
+func GenerateTokenPairWithOptions(userId uuid.UUID, subject string, roles []string, permissions []string, options TokenOptions) (*TokenPair, error) {
+	accessLifetime, refreshLifetime := TokenLifetimes(options)
 
 	// Generate access token
-	accessToken, err := generateTokenWithType(userId, subject, roles, permissions, "access", TOKEN_EXPIRATION)
+	accessToken, err := generateTokenWithType(userId.String(), subject, roles, permissions, "access", accessLifetime, options)
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate refresh token
-	refreshToken, err := generateTokenWithType(userId, subject, roles, permissions, "refresh", TOKEN_EXPIRATION + REFRESH_TOKEN_EXTRA_TIME)
+	refreshToken, err := generateTokenWithType(userId.String(), subject, roles, permissions, "refresh", refreshLifetime, options)
 	if err != nil {
 		return nil, err
 	}
@@ -76,32 +169,97 @@ func GenerateTokenPair(userId uuid.UUID, subject string, roles []string, permiss
 	return &TokenPair{
 		AccessToken:      accessToken.Token,
 		RefreshToken:     refreshToken.Token,
-		ExpiresAt:        accessExpiration,
-		RefreshExpiresAt: refreshExpiration,
+		ExpiresAt:        accessToken.ExpiresAt,
+		RefreshExpiresAt: refreshToken.ExpiresAt,
+		AccessTokenId:    accessToken.Id,
+		RefreshTokenId:   refreshToken.Id,
 	}, nil
 }
 
+// GenerateAccessToken creates a single access token for a user, without refresh token.
+// Used for tokens that must not be renewed, such as impersonation tokens.
+//
+// Parameters:
+//   - userId: Unique identifier for the user
+//   - subject: User's subject (typically email or username)
+//   - roles: List of roles assigned to the user
+//   - permissions: List of permissions granted to the user
+//   - options: Lifetime override and extra claims
+//
+// Returns:
+//   - TokenOutput containing the signed access token and its expiration time
+//   - Error if token signing fails
+func GenerateAccessToken(userId uuid.UUID, subject string, roles []string, permissions []string, options TokenOptions) (*TokenOutput, error) {
+	lifetime := TOKEN_EXPIRATION
+	if options.AccessTokenLifetime > 0 {
+		lifetime = options.AccessTokenLifetime
+	}
+	return generateTokenWithType(userId.String(), subject, roles, permissions, "access", lifetime, options)
+}
+
+// GenerateClientToken creates an access token for a client acting on its own behalf
+// (client credentials grant). The token has no user: its subject is the client ID and
+// the granted scopes are carried as permissions. No refresh token is issued.
+//
+// Parameters:
+//   - clientId: The authenticated client
+//   - scopes: Scopes granted to the client
+//   - lifetime: Token lifetime, or 0 for the server default
+//   - audience: Services the token is meant for, or nil for an unrestricted token
+//   - confirmation: Key the token is bound to, or nil for a bearer token
+//
+// Returns:
+//   - TokenOutput containing the signed access token and its expiration time
+//   - Error if token signing fails
+func GenerateClientToken(clientId string, scopes []string, lifetime time.Duration, audience []string, confirmation *Confirmation) (*TokenOutput, error) {
+	if lifetime <= 0 {
+		lifetime = TOKEN_EXPIRATION
+	}
+	return generateTokenWithType("", clientId, []string{}, scopes, "access", lifetime, TokenOptions{ClientId: clientId, Audience: audience, Confirmation: confirmation})
+}
+
 // generateTokenWithType creates a JWT token with a specific type (access or refresh).
 // Each token includes a unique JTI (JWT ID) claim for revocation support.
-func generateTokenWithType(userId uuid.UUID, subject string, roles []string, permissions []string, tokenType string, expiration time.Duration) (*TokenOutput, error) {
-	expirationTime := time.Now().Add(expiration)
+// Machine tokens have no user ID; their "sub" is the client ID.
+func generateTokenWithType(userId string, subject string, roles []string, permissions []string, tokenType string, expiration time.Duration, options TokenOptions) (*TokenOutput, error) {
+	now := time.Now()
+	expirationTime := now.Add(expiration)
+
+	sub := userId
+	if sub == "" {
+		sub = options.ClientId
+	}
 
+	jti := uuid.New().String()
 	claims := &TokenClaims{
-		UserId:      userId.String(),
-		Subject:     subject,
-		Roles:       roles,
-		Permissions: permissions,
-		TokenType:   tokenType,
+		UserId:       userId,
+		Subject:      subject,
+		Roles:        roles,
+		Permissions:  permissions,
+		TokenType:    tokenType,
+		ClientId:     options.ClientId,
+		AuthzVersion: options.AuthzVersion,
+		Actor:        options.Actor,
+		Impersonated: options.Impersonated,
+		Scope:        strings.Join(options.Scope, " "),
+		Confirmation: options.Confirmation,
+		SessionId:    options.SessionId,
+		IssuedAtUs:   now.UnixMicro(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        uuid.New().String(), // JTI: Unique identifier for token revocation
+			ID:        jti, // JTI: Unique identifier for token revocation
+			Subject:   sub, // OIDC "sub": stable user (or client) identifier
+			Audience:  options.Audience,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "aegis",
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    ISSUER,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(JWT_SECRET))
+	if tokenType == "access" {
+		claims.Custom = options.Claims
+	}
+
+	tokenString, err := signClaims(claims)
 	if err != nil {
 		return nil, err
 	}
@@ -109,11 +267,23 @@ func generateTokenWithType(userId uuid.UUID, subject string, roles []string, per
 	return &TokenOutput{
 		Token:     tokenString,
 		ExpiresAt: expirationTime,
+		Id:        jti,
 	}, nil
 }
 
+// signClaims signs the claims with the active key of the keyring and sets the kid header.
+func signClaims(claims jwt.Claims) (string, error) {
+	key := KEYRING.ActiveKey()
+	token := jwt.NewWithClaims(key.Method(), claims)
+	if key.Kid != "" {
+		token.Header["kid"] = key.Kid
+	}
+	return token.SignedString(key.signingMaterial())
+}
+
 // ValidateToken parses and validates a JWT token string, verifying its signature and expiration.
-// The token must be signed with HMAC-SHA256 using the configured secret.
+// The verification key is selected from the keyring by the token's kid header; tokens signed
+// by an unknown or retired key are rejected.
 //
 // Parameters:
 //   - tokenString: The JWT token string to validate
@@ -125,10 +295,15 @@ func ValidateToken(tokenString string) (*TokenClaims, error) {
 	claims := &TokenClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key := KEYRING.Lookup(kid)
+		if key == nil {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(JWT_SECRET), nil
+		return key.verificationMaterial(), nil
 	})
 
 	if err != nil {
@@ -171,7 +346,7 @@ func ValidateRefreshToken(tokenString string) (*TokenClaims, error) {
 func getTokenExpiration() time.Duration {
 	const JWT_EXP_TIME_ENV = "AEGIS_JWT_EXP_TIME"
 	const DEFAULT_EXPIRATION_MINUTES = 1440 // 24 hours
-	
+
 	if expStr := os.Getenv(JWT_EXP_TIME_ENV); expStr != "" {
 		if minutes, err := strconv.Atoi(expStr); err == nil && minutes > 0 {
 			log.Printf("Using token expiration: %d minutes", minutes)
@@ -179,11 +354,26 @@ func getTokenExpiration() time.Duration {
 		}
 		log.Printf("Warning: invalid %s value '%s', using default %d minutes", JWT_EXP_TIME_ENV, expStr, DEFAULT_EXPIRATION_MINUTES)
 	}
-	
+
 	log.Printf("Using default token expiration: %d minutes (24 hours)", DEFAULT_EXPIRATION_MINUTES)
 	return time.Duration(DEFAULT_EXPIRATION_MINUTES) * time.Minute
 }
 
+// getIssuer retrieves the token issuer from the AEGIS_ISSUER environment variable.
+// OpenID Connect clients require the issuer to be the public base URL of Aegis
+// (e.g., "https://auth.example.com/api/aegis"). Defaults to "aegis".
+//
+// Returns:
+//   - The issuer identifier placed in the "iss" claim
+func getIssuer() string {
+	const ISSUER_ENV = "AEGIS_ISSUER"
+	if issuer := os.Getenv(ISSUER_ENV); issuer != "" {
+		log.Printf("Using token issuer: %s", issuer)
+		return issuer
+	}
+	return "aegis"
+}
+
 // getJwtSecret retrieves the JWT signing secret from the AEGIS_JWT_SECRET environment variable.
 // If not set, it generates a cryptographically secure 256-bit random secret suitable for HMAC-SHA256.
 // A warning is logged when using a randomly generated secret.
@@ -483,3 +483,77 @@ func TestGenerateTokenWithType_InvalidSigningMethod(t *testing.T) {
 		t.Error("ValidateToken should return error for wrong signing method")
 	}
 }
+
+// TestGenerateTokenPairWithOptions tests client ID and lifetime overrides
+func TestGenerateTokenPairWithOptions(t *testing.T) {
+	options := TokenOptions{
+		ClientId:             "client-1",
+		AccessTokenLifetime:  5 * time.Minute,
+		RefreshTokenLifetime: 2 * time.Hour,
+	}
+
+	tokenPair, err := GenerateTokenPairWithOptions(uuid.New(), "test@example.com", []string{}, []string{}, options)
+	if err != nil {
+		t.Fatalf("GenerateTokenPairWithOptions failed: %v", err)
+	}
+
+	accessClaims, _ := ValidateToken(tokenPair.AccessToken)
+	if accessClaims.ClientId != "client-1" {
+		t.Errorf("Expected client_id client-1, got %s", accessClaims.ClientId)
+	}
+	if lifetime := accessClaims.ExpiresAt.Sub(accessClaims.IssuedAt.Time); lifetime < 4*time.Minute || lifetime > 6*time.Minute {
+		t.Errorf("Expected access lifetime of 5 minutes, got %v", lifetime)
+	}
+
+	refreshClaims, _ := ValidateToken(tokenPair.RefreshToken)
+	if lifetime := refreshClaims.ExpiresAt.Sub(refreshClaims.IssuedAt.Time); lifetime < 119*time.Minute || lifetime > 121*time.Minute {
+		t.Errorf("Expected refresh lifetime of 2 hours, got %v", lifetime)
+	}
+}
+
+// TestGenerateTokenPairWithOptions_AuthzVersion tests that the authorization version is stamped in both tokens
+func TestGenerateTokenPairWithOptions_AuthzVersion(t *testing.T) {
+	tokenPair, _ := GenerateTokenPairWithOptions(uuid.New(), "test@example.com", []string{}, []string{}, TokenOptions{AuthzVersion: 7})
+
+	for _, tokenString := range []string{tokenPair.AccessToken, tokenPair.RefreshToken} {
+		claims, _ := ValidateToken(tokenString)
+		if claims.AuthzVersion != 7 {
+			t.Errorf("Expected authz_ver 7, got %d", claims.AuthzVersion)
+		}
+	}
+}
+
+// TestGenerateTokenPair_NoClientId tests that tokens without a client omit the claim
+func TestGenerateTokenPair_NoClientId(t *testing.T) {
+	tokenPair, _ := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+
+	claims, _ := ValidateToken(tokenPair.AccessToken)
+	if claims.ClientId != "" {
+		t.Errorf("Expected no client_id, got %s", claims.ClientId)
+	}
+}
+
+// TestGenerateClientToken tests machine tokens issued with the client credentials grant
+func TestGenerateClientToken(t *testing.T) {
+	token, err := GenerateClientToken("service-a", []string{"read:users"}, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateClientToken failed: %v", err)
+	}
+
+	claims, err := ValidateToken(token.Token)
+	if err != nil {
+		t.Fatalf("Client token should be valid: %v", err)
+	}
+	if claims.UserId != "" {
+		t.Errorf("Expected no user ID, got %s", claims.UserId)
+	}
+	if claims.RegisteredClaims.Subject != "service-a" || claims.ClientId != "service-a" {
+		t.Errorf("Expected sub and client_id service-a, got %s and %s", claims.RegisteredClaims.Subject, claims.ClientId)
+	}
+	if claims.TokenType != "access" {
+		t.Errorf("Expected access token, got %s", claims.TokenType)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "read:users" {
+		t.Errorf("Expected scopes as permissions, got %v", claims.Permissions)
+	}
+}
@@ -0,0 +1,143 @@
+package jwt
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// KEYRING holds every key currently usable for signing or verifying tokens.
+// It starts with the key configured at startup and is replaced by the persisted
+// keyring once the database is available.
+var KEYRING = NewKeyring(getSigningKey())
+
+// Keyring holds the active signing key and any keys that are still accepted for
+// verification, indexed by key ID (kid). Thread-safe for concurrent access.
+//
+// New tokens are always signed with the active key. Keys kept for verification
+// only allow tokens signed before a rotation to stay valid until they expire.
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey // Map of kid -> SigningKey (active and verifying)
+	mu     sync.RWMutex           // Protects concurrent access to active and keys
+
+	reload         func() error  // Reloads the keyring when a token names an unknown key, if set
+	reloadInterval time.Duration // Minimum time between reloads triggered by unknown keys
+	lastReload     time.Time     // When an unknown key last triggered a reload
+	reloadMu       sync.Mutex    // Protects concurrent access to the reload fields
+}
+
+// NewKeyring creates a keyring with the given active key and verification-only keys.
+//
+// Parameters:
+//   - active: The key used to sign new tokens
+//   - verifying: Keys that are only used to verify existing tokens
+//
+// Returns:
+//   - A new Keyring ready for use
+func NewKeyring(active *SigningKey, verifying ...*SigningKey) *Keyring {
+	keyring := &Keyring{}
+	keyring.Replace(active, verifying...)
+	return keyring
+}
+
+// Replace atomically swaps the contents of the keyring.
+//
+// Parameters:
+//   - active: The key used to sign new tokens
+//   - verifying: Keys that are only used to verify existing tokens
+func (k *Keyring) Replace(active *SigningKey, verifying ...*SigningKey) {
+	keys := make(map[string]*SigningKey)
+	for _, key := range verifying {
+		keys[key.Kid] = key
+	}
+	keys[active.Kid] = active
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = active
+	k.keys = keys
+}
+
+// ActiveKey returns the key used to sign new tokens.
+func (k *Keyring) ActiveKey() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// ReloadOnUnknownKey makes Lookup reload the keyring when a token names a key it does not
+// hold, so that a key rotated in by another instance sharing the database verifies tokens
+// before the next scheduled reload. Reloads are attempted at most once per interval, so that
+// tokens with made-up key IDs cannot flood the database.
+//
+// Parameters:
+//   - reload: Function that reloads the keyring
+//   - interval: Minimum time between reloads
+func (k *Keyring) ReloadOnUnknownKey(reload func() error, interval time.Duration) {
+	k.reloadMu.Lock()
+	defer k.reloadMu.Unlock()
+	k.reload = reload
+	k.reloadInterval = interval
+}
+
+// Lookup finds the key matching a token's kid header.
+// Tokens without a kid (issued before key IDs were introduced) resolve to the active key.
+// An unknown kid triggers a reload of the keyring if one is configured and due.
+//
+// Parameters:
+//   - kid: The key ID from the token header, or empty
+//
+// Returns:
+//   - The matching SigningKey, or nil if the key is unknown or retired
+func (k *Keyring) Lookup(kid string) *SigningKey {
+	if key := k.find(kid); key != nil || kid == "" {
+		return key
+	}
+
+	reload := k.dueReload()
+	if reload == nil {
+		return nil
+	}
+	log.Printf("Unknown signing key %s, reloading the keyring", kid)
+	if err := reload(); err != nil {
+		log.Println("Failed to reload keyring:", err)
+		return nil
+	}
+	return k.find(kid)
+}
+
+// find returns the key with the given kid, or the active key for an empty kid.
+func (k *Keyring) find(kid string) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if kid == "" {
+		return k.active
+	}
+	return k.keys[kid]
+}
+
+// dueReload returns the reload function if a reload is configured and the interval since the
+// last one has passed, recording the attempt. Returns nil otherwise.
+func (k *Keyring) dueReload() func() error {
+	k.reloadMu.Lock()
+	defer k.reloadMu.Unlock()
+	if k.reload == nil || time.Since(k.lastReload) < k.reloadInterval {
+		return nil
+	}
+	k.lastReload = time.Now()
+	return k.reload
+}
+
+// Keys returns all keys in the keyring, with the active key first.
+func (k *Keyring) Keys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := []*SigningKey{k.active}
+	for kid, key := range k.keys {
+		if kid != k.active.Kid {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,137 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// parseHeader decodes a token without verifying it, to inspect the header
+func parseHeader(t *testing.T, tokenString string) map[string]interface{} {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &TokenClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	return token.Header
+}
+
+// TestGenerateTokenPair_KidHeader tests that tokens carry the active key's kid
+func TestGenerateTokenPair_KidHeader(t *testing.T) {
+	key, _ := GenerateSigningKey(ALGORITHM_ES256)
+	useSigningKey(t, key)
+
+	tokenPair, err := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	header := parseHeader(t, tokenPair.AccessToken)
+	if header["kid"] != key.Kid {
+		t.Errorf("Expected kid %s, got %v", key.Kid, header["kid"])
+	}
+}
+
+// TestKeyring_VerifyingKeyStillAccepted tests that tokens survive a rotation while the old key is kept
+func TestKeyring_VerifyingKeyStillAccepted(t *testing.T) {
+	oldKey, _ := GenerateSigningKey(ALGORITHM_HS256)
+	newKey, _ := GenerateSigningKey(ALGORITHM_RS256)
+	useSigningKey(t, oldKey)
+
+	tokenPair, err := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// Rotate: new key becomes active, old key is kept for verification
+	KEYRING.Replace(newKey, oldKey)
+
+	if _, err := ValidateToken(tokenPair.AccessToken); err != nil {
+		t.Errorf("Token signed by verifying key should remain valid: %v", err)
+	}
+
+	newPair, _ := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	if parseHeader(t, newPair.AccessToken)["kid"] != newKey.Kid {
+		t.Error("New tokens should be signed with the new active key")
+	}
+}
+
+// TestKeyring_RetiredKeyRejected tests that tokens are rejected once their key leaves the keyring
+func TestKeyring_RetiredKeyRejected(t *testing.T) {
+	oldKey, _ := GenerateSigningKey(ALGORITHM_HS256)
+	newKey, _ := GenerateSigningKey(ALGORITHM_HS256)
+	useSigningKey(t, oldKey)
+
+	tokenPair, _ := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+
+	// Retire the old key entirely
+	KEYRING.Replace(newKey)
+
+	_, err := ValidateToken(tokenPair.AccessToken)
+	if err == nil {
+		t.Fatal("Token signed by a retired key should be rejected")
+	}
+}
+
+// TestKeyring_Keys tests that the active key is listed first
+func TestKeyring_Keys(t *testing.T) {
+	active, _ := GenerateSigningKey(ALGORITHM_EDDSA)
+	verifying, _ := GenerateSigningKey(ALGORITHM_ES256)
+	keyring := NewKeyring(active, verifying)
+
+	keys := keyring.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys))
+	}
+	if keys[0] != active {
+		t.Error("Expected active key to be listed first")
+	}
+	if keyring.Lookup("") != active {
+		t.Error("Expected empty kid to resolve to the active key")
+	}
+	if keyring.Lookup("unknown") != nil {
+		t.Error("Expected unknown kid to resolve to nil")
+	}
+}
+
+// TestKeyring_ReloadOnUnknownKey tests that an unknown kid reloads the keyring at most once per interval
+func TestKeyring_ReloadOnUnknownKey(t *testing.T) {
+	active, _ := GenerateSigningKey(ALGORITHM_ES256)
+	rotated, _ := GenerateSigningKey(ALGORITHM_ES256)
+	keyring := NewKeyring(active)
+
+	reloads := 0
+	keyring.ReloadOnUnknownKey(func() error {
+		reloads++
+		keyring.Replace(rotated, active)
+		return nil
+	}, time.Hour)
+
+	if keyring.Lookup(rotated.Kid) != rotated {
+		t.Error("Expected the reload to pick up the rotated key")
+	}
+	if keyring.Lookup(rotated.Kid) != rotated || keyring.Lookup("") != rotated {
+		t.Error("Expected known keys to resolve without a reload")
+	}
+	if keyring.Lookup("unknown") != nil || keyring.Lookup("other") != nil {
+		t.Error("Expected unknown kids to resolve to nil")
+	}
+	if reloads != 1 {
+		t.Errorf("Expected 1 reload within the interval, got %d", reloads)
+	}
+}
+
+// TestPublicJWKS_IncludesVerifyingKeys tests that verification-only keys are still published
+func TestPublicJWKS_IncludesVerifyingKeys(t *testing.T) {
+	active, _ := GenerateSigningKey(ALGORITHM_ES256)
+	verifying, _ := GenerateSigningKey(ALGORITHM_RS256)
+	hmac, _ := GenerateSigningKey(ALGORITHM_HS256)
+	original := KEYRING
+	KEYRING = NewKeyring(active, verifying, hmac)
+	defer func() { KEYRING = original }()
+
+	jwks := PublicJWKS()
+	if len(jwks.Keys) != 2 {
+		t.Errorf("Expected 2 published keys, got %d", len(jwks.Keys))
+	}
+}
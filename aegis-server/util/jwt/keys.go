@@ -0,0 +1,286 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Supported token signing algorithms.
+// HS256 uses a shared secret; the others sign with a private key and
+// verify with a public key that can be published through the JWKS endpoint.
+const (
+	ALGORITHM_HS256 = "HS256"
+	ALGORITHM_RS256 = "RS256"
+	ALGORITHM_ES256 = "ES256"
+	ALGORITHM_EDDSA = "EdDSA"
+)
+
+const RSA_KEY_BITS = 2048
+
+var SIGNING_ALGORITHM = getSigningAlgorithm()
+
+// SigningKey holds the key material used to sign and verify tokens.
+//
+// For HMAC keys, Secret contains the shared secret. A nil Secret means the key
+// is backed by JWT_SECRET. For asymmetric keys, PrivateKey signs tokens and
+// PublicKey verifies them.
+type SigningKey struct {
+	Kid        string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// IsAsymmetric reports whether the algorithm signs with a private/public key pair.
+//
+// Parameters:
+//   - algorithm: The JWS algorithm name (e.g., "RS256")
+//
+// Returns:
+//   - true for RS256, ES256 and EdDSA, false otherwise
+func IsAsymmetric(algorithm string) bool {
+	return algorithm == ALGORITHM_RS256 || algorithm == ALGORITHM_ES256 || algorithm == ALGORITHM_EDDSA
+}
+
+// IsSupportedAlgorithm reports whether Aegis can sign tokens with the given algorithm.
+//
+// Parameters:
+//   - algorithm: The JWS algorithm name
+//
+// Returns:
+//   - true if the algorithm is supported, false otherwise
+func IsSupportedAlgorithm(algorithm string) bool {
+	return algorithm == ALGORITHM_HS256 || IsAsymmetric(algorithm)
+}
+
+// GenerateSigningKey creates a new random key for the given algorithm.
+// RSA keys are 2048 bits, ECDSA keys use the P-256 curve and HMAC secrets are 256 bits.
+// HMAC keys get a random key ID since they have no public key to derive one from.
+//
+// Parameters:
+//   - algorithm: One of the supported algorithm constants
+//
+// Returns:
+//   - The generated SigningKey
+//   - Error if the algorithm is unsupported or key generation fails
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	switch algorithm {
+	case ALGORITHM_HS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return &SigningKey{Kid: uuid.New().String(), Algorithm: algorithm, Secret: secret}, nil
+	case ALGORITHM_RS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, RSA_KEY_BITS)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigningKey(algorithm, privateKey)
+	case ALGORITHM_ES256:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigningKey(algorithm, privateKey)
+	case ALGORITHM_EDDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigningKey(algorithm, privateKey)
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+}
+
+// NewSigningKey wraps an asymmetric private key into a SigningKey.
+// The key type must match the algorithm, and the key ID is derived from
+// the RFC 7638 thumbprint of the public key.
+//
+// Parameters:
+//   - algorithm: RS256, ES256 or EdDSA
+//   - privateKey: The private key (*rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey)
+//
+// Returns:
+//   - The SigningKey ready for use
+//   - Error if the key type does not match the algorithm
+func NewSigningKey(algorithm string, privateKey crypto.Signer) (*SigningKey, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != ALGORITHM_RS256 {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", algorithm)
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm != ALGORITHM_ES256 || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ECDSA P-256 key required for %s", algorithm)
+		}
+	case ed25519.PrivateKey:
+		if algorithm != ALGORITHM_EDDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", algorithm)
+		}
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+
+	publicKey := privateKey.Public()
+	jwk, err := PublicJWK(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		Kid:        jwk.Thumbprint(),
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}, nil
+}
+
+// ParsePrivateKeyPEM parses a PEM-encoded private key for the given algorithm.
+// Accepts PKCS#8, PKCS#1 (RSA) and SEC 1 (EC) encodings.
+//
+// Parameters:
+//   - algorithm: RS256, ES256 or EdDSA
+//   - pemBytes: The PEM-encoded private key
+//
+// Returns:
+//   - The SigningKey built from the parsed key
+//   - Error if the PEM cannot be decoded or does not match the algorithm
+func ParsePrivateKeyPEM(algorithm string, pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return NewSigningKey(algorithm, signer)
+}
+
+// EncodePrivateKeyPEM encodes the key's private material as PKCS#8 PEM.
+// Only valid for asymmetric keys.
+//
+// Returns:
+//   - The PEM-encoded private key
+//   - Error if the key is not asymmetric or encoding fails
+func (k *SigningKey) EncodePrivateKeyPEM() ([]byte, error) {
+	if k.PrivateKey == nil {
+		return nil, errors.New("signing key has no private key")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Method returns the golang-jwt signing method matching the key's algorithm.
+func (k *SigningKey) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// signingMaterial returns the value passed to SignedString for this key.
+func (k *SigningKey) signingMaterial() interface{} {
+	if k.Algorithm == ALGORITHM_HS256 {
+		return k.hmacSecret()
+	}
+	return k.PrivateKey
+}
+
+// verificationMaterial returns the value used to verify signatures made by this key.
+func (k *SigningKey) verificationMaterial() interface{} {
+	if k.Algorithm == ALGORITHM_HS256 {
+		return k.hmacSecret()
+	}
+	return k.PublicKey
+}
+
+// hmacSecret returns the key's shared secret, falling back to JWT_SECRET.
+func (k *SigningKey) hmacSecret() []byte {
+	if k.Secret != nil {
+		return k.Secret
+	}
+	return []byte(JWT_SECRET)
+}
+
+// getSigningAlgorithm retrieves the signing algorithm from the AEGIS_JWT_ALGORITHM environment variable.
+// Defaults to HS256 if not set or if the value is not a supported algorithm.
+//
+// Returns:
+//   - The configured algorithm name
+func getSigningAlgorithm() string {
+	const JWT_ALGORITHM_ENV = "AEGIS_JWT_ALGORITHM"
+	algorithm := os.Getenv(JWT_ALGORITHM_ENV)
+	if algorithm == "" {
+		return ALGORITHM_HS256
+	}
+	if !IsSupportedAlgorithm(algorithm) {
+		log.Printf("Warning: unsupported %s value '%s', using %s", JWT_ALGORITHM_ENV, algorithm, ALGORITHM_HS256)
+		return ALGORITHM_HS256
+	}
+	return algorithm
+}
+
+// getSigningKey builds the signing key configured at startup.
+// HS256 keys are backed by JWT_SECRET. Asymmetric keys are loaded from the PEM file
+// referenced by AEGIS_JWT_PRIVATE_KEY_FILE; if not set, a key pair is generated
+// and a warning is logged because tokens will not survive a restart.
+//
+// Returns:
+//   - The SigningKey used to sign new tokens
+func getSigningKey() *SigningKey {
+	const JWT_PRIVATE_KEY_FILE_ENV = "AEGIS_JWT_PRIVATE_KEY_FILE"
+	algorithm := SIGNING_ALGORITHM
+	if algorithm == ALGORITHM_HS256 {
+		return &SigningKey{Algorithm: algorithm}
+	}
+
+	if keyFile := os.Getenv(JWT_PRIVATE_KEY_FILE_ENV); keyFile != "" {
+		pemBytes, err := os.ReadFile(keyFile)
+		if err != nil {
+			log.Fatalf("Failed to read JWT private key file '%s': %v", keyFile, err)
+		}
+		key, err := ParsePrivateKeyPEM(algorithm, pemBytes)
+		if err != nil {
+			log.Fatalf("Failed to parse JWT private key file '%s': %v", keyFile, err)
+		}
+		log.Printf("Using %s signing key from %s (kid: %s)", algorithm, keyFile, key.Kid)
+		return key
+	}
+
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		log.Fatal("Failed to generate JWT signing key:", err)
+	}
+	log.Printf("Warning: using randomly generated %s signing key, consider setting the environment variable '%s'\n", algorithm, JWT_PRIVATE_KEY_FILE_ENV)
+	return key
+}
@@ -0,0 +1,155 @@
+package jwt
+
+import (
+	"encoding/pem"
+	"testing"
+	"github.com/google/uuid"
+)
+
+// useSigningKey swaps the package keyring for one holding only the given key for the duration of a test
+func useSigningKey(t *testing.T, key *SigningKey) {
+	original := KEYRING
+	KEYRING = NewKeyring(key)
+	t.Cleanup(func() { KEYRING = original })
+}
+
+// TestAsymmetricAlgorithms_RoundTrip tests signing and validating with each asymmetric algorithm
+func TestAsymmetricAlgorithms_RoundTrip(t *testing.T) {
+	for _, algorithm := range []string{ALGORITHM_RS256, ALGORITHM_ES256, ALGORITHM_EDDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateSigningKey(algorithm)
+			if err != nil {
+				t.Fatalf("GenerateSigningKey should not return error: %v", err)
+			}
+			useSigningKey(t, key)
+
+			tokenPair, err := GenerateTokenPair(uuid.New(), "test@example.com", []string{"admin"}, []string{"read"})
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			claims, err := ValidateToken(tokenPair.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken should not return error: %v", err)
+			}
+			if claims.Subject != "test@example.com" {
+				t.Errorf("Expected Subject 'test@example.com', got '%s'", claims.Subject)
+			}
+		})
+	}
+}
+
+// TestValidateToken_AlgorithmMismatch tests that tokens signed with another algorithm are rejected
+func TestValidateToken_AlgorithmMismatch(t *testing.T) {
+	// Sign with the default HS256 key
+	tokenPair, err := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// Switch to an RS256 key and try to validate
+	key, _ := GenerateSigningKey(ALGORITHM_RS256)
+	useSigningKey(t, key)
+
+	_, err = ValidateToken(tokenPair.AccessToken)
+	if err == nil {
+		t.Error("ValidateToken should reject a token signed with a different algorithm")
+	}
+}
+
+// TestValidateToken_DifferentKeyPair tests that tokens signed by another key pair are rejected
+func TestValidateToken_DifferentKeyPair(t *testing.T) {
+	first, _ := GenerateSigningKey(ALGORITHM_ES256)
+	second, _ := GenerateSigningKey(ALGORITHM_ES256)
+	useSigningKey(t, first)
+
+	tokenPair, err := GenerateTokenPair(uuid.New(), "test@example.com", []string{}, []string{})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	KEYRING = NewKeyring(second)
+	_, err = ValidateToken(tokenPair.AccessToken)
+	if err == nil {
+		t.Error("ValidateToken should reject a token signed by another key pair")
+	}
+}
+
+// TestParsePrivateKeyPEM_RoundTrip tests that encoded keys parse back to the same key ID
+func TestParsePrivateKeyPEM_RoundTrip(t *testing.T) {
+	for _, algorithm := range []string{ALGORITHM_RS256, ALGORITHM_ES256, ALGORITHM_EDDSA} {
+		key, _ := GenerateSigningKey(algorithm)
+		pemBytes, err := key.EncodePrivateKeyPEM()
+		if err != nil {
+			t.Fatalf("EncodePrivateKeyPEM should not return error: %v", err)
+		}
+
+		parsed, err := ParsePrivateKeyPEM(algorithm, pemBytes)
+		if err != nil {
+			t.Fatalf("ParsePrivateKeyPEM should not return error: %v", err)
+		}
+		if parsed.Kid != key.Kid {
+			t.Errorf("Expected kid %s, got %s", key.Kid, parsed.Kid)
+		}
+	}
+}
+
+// TestParsePrivateKeyPEM_WrongAlgorithm tests that a key is rejected for a mismatched algorithm
+func TestParsePrivateKeyPEM_WrongAlgorithm(t *testing.T) {
+	key, _ := GenerateSigningKey(ALGORITHM_RS256)
+	pemBytes, _ := key.EncodePrivateKeyPEM()
+
+	_, err := ParsePrivateKeyPEM(ALGORITHM_ES256, pemBytes)
+	if err == nil {
+		t.Error("ParsePrivateKeyPEM should reject an RSA key for ES256")
+	}
+
+	_, err = ParsePrivateKeyPEM(ALGORITHM_RS256, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}))
+	if err == nil {
+		t.Error("ParsePrivateKeyPEM should reject invalid key data")
+	}
+}
+
+// TestPublicJWKS_HMAC tests that shared secrets are never published
+func TestPublicJWKS_HMAC(t *testing.T) {
+	useSigningKey(t, &SigningKey{Algorithm: ALGORITHM_HS256})
+
+	jwks := PublicJWKS()
+	if len(jwks.Keys) != 0 {
+		t.Errorf("Expected empty key set for HS256, got %d keys", len(jwks.Keys))
+	}
+}
+
+// TestPublicJWKS_Asymmetric tests the published key members for each key type
+func TestPublicJWKS_Asymmetric(t *testing.T) {
+	expectedKty := map[string]string{
+		ALGORITHM_RS256: "RSA",
+		ALGORITHM_ES256: "EC",
+		ALGORITHM_EDDSA: "OKP",
+	}
+	for algorithm, kty := range expectedKty {
+		key, _ := GenerateSigningKey(algorithm)
+		useSigningKey(t, key)
+
+		jwks := PublicJWKS()
+		if len(jwks.Keys) != 1 {
+			t.Fatalf("Expected 1 key for %s, got %d", algorithm, len(jwks.Keys))
+		}
+		jwk := jwks.Keys[0]
+		if jwk.Kty != kty || jwk.Alg != algorithm || jwk.Use != "sig" {
+			t.Errorf("Unexpected JWK for %s: %+v", algorithm, jwk)
+		}
+		if jwk.Kid != key.Kid || jwk.Thumbprint() != key.Kid {
+			t.Errorf("Expected kid to be the key thumbprint for %s", algorithm)
+		}
+	}
+}
+
+// TestGetSigningAlgorithm_InvalidValue tests invalid env var falls back to HS256
+func TestGetSigningAlgorithm_InvalidValue(t *testing.T) {
+	t.Setenv("AEGIS_JWT_ALGORITHM", "none")
+
+	if algorithm := getSigningAlgorithm(); algorithm != ALGORITHM_HS256 {
+		t.Errorf("Expected fallback to HS256, got %s", algorithm)
+	}
+}